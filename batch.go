@@ -0,0 +1,300 @@
+package redimo
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// maxBatchWriteRequests is the maximum number of put and delete requests in a BatchWriteItem call.
+const maxBatchWriteRequests = 25
+
+// maxBatchGetKeys is the maximum number of keys in a BatchGetItem call.
+const maxBatchGetKeys = 100
+
+// BatchWrites returns a copy of the client that writes the members of SADD, ZADD (without flags),
+// GEOADD, SREM, ZREM, HDEL, DEL, LPUSH and RPUSH with BatchWriteItem, 25 members per request, sending up
+// to concurrency requests at a time. Items DynamoDB leaves unprocessed are retried according to the
+// client's RetryPolicy.
+//
+// This is much faster for large numbers of members, but a batched write cannot tell whether a member
+// already existed: SADD, ZADD, SREM, ZREM and HDEL return no members and GEOADD returns no locations.
+// DEL returns the fields it found, even if they are concurrently deleted, and LPUSH and RPUSH are not
+// affected. Each batch is applied on its own, so a failed command may have written some members.
+//
+// HDEL reads the fields it deletes first, 1 RCU each, and deletes those holding values offloaded to a
+// blob store or split into chunks one by one, so that they are released.
+func (c Client) BatchWrites(concurrency int) Client {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	c.batchConcurrency = concurrency
+	return c
+}
+
+// ExactResults returns a copy of the client that writes every member of a command with its own
+// request, so that commands return exactly which members were added or removed. This is the default.
+func (c Client) ExactResults() Client {
+	c.batchConcurrency = 0
+	return c
+}
+
+func (c Client) batchWrites() bool {
+	return c.batchConcurrency > 0
+}
+
+func putRequest(item map[string]types.AttributeValue) types.WriteRequest {
+	return types.WriteRequest{PutRequest: &types.PutRequest{Item: item}}
+}
+
+func deleteRequest(key map[string]types.AttributeValue) types.WriteRequest {
+	return types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: key}}
+}
+
+// batchWrite sends the requests in batches of 25, up to batchConcurrency batches at a time, and
+// returns the first error.
+func (c Client) batchWrite(requests []types.WriteRequest) error {
+	var batches [][]types.WriteRequest
+
+	for len(requests) > maxBatchWriteRequests {
+		batches = append(batches, requests[:maxBatchWriteRequests])
+		requests = requests[maxBatchWriteRequests:]
+	}
+
+	if len(requests) > 0 {
+		batches = append(batches, requests)
+	}
+
+	return fanOut(len(batches), c.batchConcurrency, func(i int) error {
+		return c.writeBatch(batches[i])
+	})
+}
+
+// writeBatch sends a single batch, retrying the unprocessed items according to the client's retry policy.
+func (c Client) writeBatch(requests []types.WriteRequest) error {
+	once := c.WithRetryPolicy(NoRetries)
+
+	return c.retryPolicy.do(c.ctx, func() error {
+		resp, err := once.ddb().BatchWriteItem(c.ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{c.tableName: requests},
+		})
+		if err != nil {
+			return err
+		}
+
+		requests = resp.UnprocessedItems[c.tableName]
+		if len(requests) == 0 {
+			return nil
+		}
+
+		return &Error{Kind: ErrThrottled, Err: fmt.Errorf("%v items of the batch were not processed", len(requests))}
+	})
+}
+
+// batchGet reads the given sort keys of the key with getItems, and returns the given attributes of
+// those that exist by sort key.
+func (c Client) batchGet(key string, sortKeys []string, attributes ...string) (items map[string]map[string]types.AttributeValue, err error) {
+	keys := make([]keyDef, len(sortKeys))
+	for i, sk := range sortKeys {
+		keys[i] = keyDef{pk: key, sk: sk}
+	}
+
+	found, err := c.getItems(keys, attributes...)
+	if err != nil {
+		return nil, err
+	}
+
+	items = make(map[string]map[string]types.AttributeValue)
+
+	for i, item := range found {
+		if len(item) > 0 {
+			items[sortKeys[i]] = item
+		}
+	}
+
+	return items, nil
+}
+
+// getItems reads the given items with BatchGetItem, 100 keys per request and up to batchConcurrency
+// requests at a time, and returns their given attributes in the same order, with no attributes for
+// those that don't exist. The reads are strongly consistent, 1 RCU per 4 KB item, but unlike a
+// transaction they are not a snapshot: each item is read at its own time.
+func (c Client) getItems(keys []keyDef, attributes ...string) (items []map[string]types.AttributeValue, err error) {
+	// The keys of the items are read too, to tell which item is which.
+	names := map[string]string{"#pk": c.partitionKey, "#sk": c.sortKey}
+	projection := []string{"#pk", "#sk"}
+
+	for i, attribute := range attributes {
+		names[fmt.Sprintf("#a%v", i)] = attribute
+		projection = append(projection, fmt.Sprintf("#a%v", i))
+	}
+
+	// A batch may not name the same item twice.
+	var unique []keyDef
+
+	seen := make(map[keyDef]struct{})
+
+	for _, key := range keys {
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			unique = append(unique, key)
+		}
+	}
+
+	var mu sync.Mutex
+
+	found := make(map[keyDef]map[string]types.AttributeValue)
+	batches := (len(unique) + maxBatchGetKeys - 1) / maxBatchGetKeys
+
+	err = fanOut(batches, c.batchConcurrency, func(i int) error {
+		batch := unique[i*maxBatchGetKeys:]
+		if len(batch) > maxBatchGetKeys {
+			batch = batch[:maxBatchGetKeys]
+		}
+
+		read, err := c.getBatch(batch, names, strings.Join(projection, ", "))
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, item := range read {
+			found[parseKey(item, c)] = item
+		}
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	items = make([]map[string]types.AttributeValue, len(keys))
+
+	for i, key := range keys {
+		if item, ok := found[key]; ok {
+			items[i] = make(map[string]types.AttributeValue, len(attributes))
+
+			for _, attribute := range attributes {
+				if av, ok := item[attribute]; ok {
+					items[i][attribute] = av
+				}
+			}
+		}
+	}
+
+	return items, nil
+}
+
+// getBatch reads a single batch of items, retrying the unprocessed keys according to the client's retry
+// policy, and returns those that exist.
+func (c Client) getBatch(keys []keyDef, names map[string]string, projection string) (items []map[string]types.AttributeValue, err error) {
+	once := c.WithRetryPolicy(NoRetries)
+	request := types.KeysAndAttributes{
+		ConsistentRead:           aws.Bool(true),
+		ExpressionAttributeNames: names,
+		ProjectionExpression:     aws.String(projection),
+	}
+
+	for _, key := range keys {
+		request.Keys = append(request.Keys, key.toAV(c))
+	}
+
+	err = c.retryPolicy.do(c.ctx, func() error {
+		resp, err := once.ddb().BatchGetItem(c.ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]types.KeysAndAttributes{c.tableName: request},
+		})
+		if err != nil {
+			return err
+		}
+
+		items = append(items, resp.Responses[c.tableName]...)
+
+		request.Keys = resp.UnprocessedKeys[c.tableName].Keys
+		if len(request.Keys) == 0 {
+			return nil
+		}
+
+		return &Error{Kind: ErrThrottled, Err: fmt.Errorf("%v keys of the batch were not processed", len(request.Keys))}
+	})
+
+	return items, err
+}
+
+// batchDelete deletes the given sort keys of the key with BatchWriteItem. It is meant for members, or
+// for items known not to hold values that must be released; see batchDeleteValues.
+func (c Client) batchDelete(key string, sortKeys []string) error {
+	requests := make([]types.WriteRequest, 0, len(sortKeys))
+	seen := make(map[string]struct{})
+
+	for _, sk := range sortKeys {
+		// A batch may not name the same item twice.
+		if _, ok := seen[sk]; ok {
+			continue
+		}
+
+		seen[sk] = struct{}{}
+		requests = append(requests, deleteRequest(keyDef{pk: key, sk: sk}.toAV(c)))
+	}
+
+	return c.batchWrite(requests)
+}
+
+// batchDeleteValues deletes the given sort keys of the key, which may hold values, with BatchWriteItem.
+// A batched delete cannot return what it deleted, so the values are read first, and the items that
+// hold values to release are deleted one by one instead, and their values released. An item that is
+// overwritten with such a value between the read and the batch leaks it rather than release it twice.
+func (c Client) batchDeleteValues(key string, sortKeys []string) error {
+	sortKeys = uniqueKeys(sortKeys)
+
+	items, err := c.batchGet(key, sortKeys, vk)
+	if err != nil {
+		return err
+	}
+
+	var batched, released []string
+
+	for _, sk := range sortKeys {
+		if releasable(items[sk][vk]) {
+			released = append(released, sk)
+		} else {
+			batched = append(batched, sk)
+		}
+	}
+
+	if err = c.batchDelete(key, batched); err != nil {
+		return err
+	}
+
+	return c.fanOut(len(released), func(i int) error {
+		resp, err := c.ddb().DeleteItem(c.ctx, &dynamodb.DeleteItemInput{
+			Key:          keyDef{pk: key, sk: released[i]}.toAV(c),
+			ReturnValues: types.ReturnValueAllOld,
+			TableName:    aws.String(c.tableName),
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.releaseAV(key, resp.Attributes[vk])
+	})
+}
+
+// batchPutScores puts the given sort keys of the key with BatchWriteItem, each with the numeric sort key
+// attribute set to the given value. Members take the expiry of the key, which commands inherit before
+// they write; their version is replaced by a new one, as with any write.
+func (c Client) batchPutScores(key string, scores map[string]types.AttributeValue) error {
+	requests := make([]types.WriteRequest, 0, len(scores))
+
+	for sk, score := range scores {
+		item := keyDef{pk: key, sk: sk}.toAV(c)
+		item[c.sortKeyNum] = score
+
+		requests = append(requests, putRequest(item))
+	}
+
+	return c.batchWrite(requests)
+}
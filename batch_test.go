@@ -0,0 +1,303 @@
+package redimo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchWrites(t *testing.T) {
+	c := newClient(t).BatchWrites(4)
+
+	var members []string
+	for i := 0; i < 60; i++ {
+		members = append(members, fmt.Sprintf("m%v", i))
+	}
+
+	addedMembers, err := c.SADD("s1", append(members, "m0")...)
+	assert.NoError(t, err)
+	assert.Nil(t, addedMembers)
+
+	count, err := c.SCARD("s1")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(60), count)
+
+	removedMembers, err := c.SREM("s1", members[10:]...)
+	assert.NoError(t, err)
+	assert.Nil(t, removedMembers)
+
+	found, err := c.SMEMBERS("s1")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, members[:10], found)
+
+	scores := make(map[string]float64)
+	for i, member := range members {
+		scores[member] = float64(i)
+	}
+
+	_, err = c.ZADD("z1", scores, Flags{})
+	assert.NoError(t, err)
+
+	score, ok, err := c.ZSCORE("z1", "m42")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 42.0, score)
+
+	addedMembers, err = c.ZADD("z1", map[string]float64{"m1": 100, "new": 1}, Flags{IfNotExists})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"new"}, addedMembers)
+
+	_, err = c.ZREM("z1", members...)
+	assert.NoError(t, err)
+
+	count, err = c.ZCARD("z1")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), count)
+
+	_, err = c.GEOADD("g1", map[string]GLocation{"Palermo": {38.115556, 13.361389}})
+	assert.NoError(t, err)
+
+	locations, err := c.GEOPOS("g1", "Palermo")
+	assert.NoError(t, err)
+	assert.InDelta(t, 13.361389, locations["Palermo"].Lon, 0.001)
+
+	fields := make(map[string]Value)
+	for _, member := range members {
+		fields[member] = StringValue{member}
+	}
+
+	assert.NoError(t, c.HMSET("h1", fields))
+
+	deletedFields, err := c.HDEL("h1", members[:30]...)
+	assert.NoError(t, err)
+	assert.Nil(t, deletedFields)
+
+	hlen, err := c.HLEN("h1")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(30), hlen)
+
+	deletedKeys, err := c.DEL("h1", "s1", "nosuchkey")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, deletedKeys)
+
+	exists, err := c.EXISTS("h1", "s1")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, exists)
+}
+
+func TestBatchPush(t *testing.T) {
+	c := newClient(t)
+	batched := c.BatchWrites(2)
+
+	var elements []interface{}
+	for i := 0; i < 30; i++ {
+		elements = append(elements, StringValue{fmt.Sprintf("e%v", i)})
+	}
+
+	for _, client := range []Client{c, batched} {
+		key := fmt.Sprintf("l%v", client.batchConcurrency)
+
+		length, err := client.RPUSH(key, StringValue{"middle"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), length)
+
+		length, err = client.LPUSH(key, elements...)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(31), length)
+
+		length, err = client.RPUSH(key, elements...)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(61), length)
+	}
+
+	exact, err := c.LRANGE("l0", 0, -1)
+	assert.NoError(t, err)
+
+	fromBatches, err := c.LRANGE("l2", 0, -1)
+	assert.NoError(t, err)
+
+	assert.Equal(t, readStrings(exact), readStrings(fromBatches))
+	assert.Equal(t, "e29", fromBatches[0].String())
+}
+
+// unprocessingService leaves the last item of the next failures batches unprocessed, and the last key of
+// the next getFailures batches of reads.
+type unprocessingService struct {
+	DynamoDBAPI
+	failures    int
+	calls       int
+	getFailures int
+	getCalls    int
+}
+
+func (s *unprocessingService) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	s.getCalls++
+
+	if s.getFailures == 0 {
+		return s.DynamoDBAPI.BatchGetItem(ctx, params, optFns...)
+	}
+
+	s.getFailures--
+
+	processed := make(map[string]types.KeysAndAttributes)
+	unprocessed := make(map[string]types.KeysAndAttributes)
+
+	for table, request := range params.RequestItems {
+		keys := request.Keys
+
+		if len(keys) > 1 {
+			request.Keys = keys[:len(keys)-1]
+			processed[table] = request
+		}
+
+		request.Keys = keys[len(keys)-1:]
+		unprocessed[table] = request
+	}
+
+	out := &dynamodb.BatchGetItemOutput{UnprocessedKeys: unprocessed}
+
+	if len(processed) > 0 {
+		resp, err := s.DynamoDBAPI.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: processed}, optFns...)
+		if err != nil {
+			return nil, err
+		}
+
+		out.Responses = resp.Responses
+	}
+
+	return out, nil
+}
+
+func (s *unprocessingService) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	s.calls++
+
+	if s.failures == 0 {
+		return s.DynamoDBAPI.BatchWriteItem(ctx, params, optFns...)
+	}
+
+	s.failures--
+
+	processed := make(map[string][]types.WriteRequest)
+	unprocessed := make(map[string][]types.WriteRequest)
+
+	for table, requests := range params.RequestItems {
+		if len(requests) > 1 {
+			processed[table] = requests[:len(requests)-1]
+		}
+
+		unprocessed[table] = requests[len(requests)-1:]
+	}
+
+	if len(processed) > 0 {
+		if _, err := s.DynamoDBAPI.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: processed}, optFns...); err != nil {
+			return nil, err
+		}
+	}
+
+	return &dynamodb.BatchWriteItemOutput{UnprocessedItems: unprocessed}, nil
+}
+
+func TestBatchUnprocessedItems(t *testing.T) {
+	c := newClient(t)
+	service := &unprocessingService{DynamoDBAPI: c.ddbClient}
+	c.ddbClient = service
+	c = c.BatchWrites(1).WithRetryPolicy(RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    time.Millisecond,
+		Retryable:   []error{ErrThrottled},
+	})
+
+	service.failures = 2
+	_, err := c.SADD("s1", "m1", "m2", "m3")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, service.calls)
+
+	members, err := c.SMEMBERS("s1")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"m1", "m2", "m3"}, members)
+
+	service.failures, service.calls = 3, 0
+	_, err = c.SADD("s1", "m4", "m5")
+	assert.True(t, errors.Is(err, ErrThrottled))
+
+	var e *Error
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, 3, e.Attempts)
+	assert.Equal(t, 3, service.calls)
+}
+
+func TestBatchUnprocessedKeys(t *testing.T) {
+	c := newClient(t)
+	service := &unprocessingService{DynamoDBAPI: c.ddbClient}
+	c.ddbClient = service
+	c = c.WithRetryPolicy(RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    time.Millisecond,
+		Retryable:   []error{ErrThrottled},
+	})
+
+	_, err := c.HSET("h", map[string]Value{"f1": StringValue{"a"}, "f2": StringValue{"b"}})
+	assert.NoError(t, err)
+
+	service.getFailures = 2
+	items, err := c.batchGet("h", []string{"f1", "f2", "f3", "f1"}, vk)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, service.getCalls)
+	assert.Len(t, items, 2)
+	assert.Equal(t, "a", ReturnValue{items["f1"][vk]}.String())
+	assert.Equal(t, "b", ReturnValue{items["f2"][vk]}.String())
+
+	service.getFailures, service.getCalls = 3, 0
+	_, err = c.batchGet("h", []string{"f1", "f2"}, vk)
+	assert.True(t, errors.Is(err, ErrThrottled))
+	assert.Equal(t, 3, service.getCalls)
+}
+
+func TestBatchWritesKeepValuesConsistent(t *testing.T) {
+	store := FileBlobStore{Dir: t.TempDir()}
+	c := newClient(t).OffloadValues(store, 8).ChunkValues(2)
+	batched := c.BatchWrites(2)
+
+	_, err := c.HSET("hash", map[string]Value{
+		"offloaded": StringValue{"offloaded value"},
+		"chunked":   StringValue{"abcd"},
+		"plain":     StringValue{"a"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, blobCount(t, store))
+	assert.Equal(t, 2, chunkCount(t, c, "hash"))
+
+	_, err = batched.HDEL("hash", "offloaded", "chunked", "plain", "missing")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, blobCount(t, store))
+	assert.Equal(t, 0, chunkCount(t, c, "hash"))
+
+	exists, err := c.EXISTS("hash")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, exists)
+
+	_, err = c.SADD("set", "m1")
+	assert.NoError(t, err)
+
+	_, err = c.EXPIRE("set", 3600)
+	assert.NoError(t, err)
+
+	_, err = batched.SADD("set", "m1", "m2")
+	assert.NoError(t, err)
+
+	items, err := c.partitionItems("set")
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+
+	for _, item := range items {
+		assert.WithinDuration(t, time.Now().Add(time.Hour), c.itemExpiry(item), time.Minute)
+	}
+}
@@ -0,0 +1,425 @@
+package redimo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// BlobStore stores values outside DynamoDB, such as in S3, under the hex encoded SHA-256 hash of their
+// content. Implementations must be safe for concurrent use.
+type BlobStore interface {
+	// Put stores the data under the hash. Putting data that is already stored must succeed.
+	Put(ctx context.Context, hash string, data []byte) error
+
+	// Get returns the data stored under the hash, or an error matching os.ErrNotExist if there is none.
+	Get(ctx context.Context, hash string) ([]byte, error)
+
+	// Delete deletes the data stored under the hash. Deleting data that is not stored must succeed.
+	Delete(ctx context.Context, hash string) error
+}
+
+// blobPointerKey is the only key of the map stored in place of an offloaded value.
+const blobPointerKey = "_redimo/blob"
+
+// OffloadValues returns a copy of the client that stores string and bytes values larger than threshold
+// bytes in the blob store, and only a pointer to them in DynamoDB. Values are stored by content, so
+// identical values share a blob; the pointers to each blob are counted in an internal item, shared
+// by all namespaces, and the blob is deleted once nothing points to it. Offloading takes precedence
+// over ChunkValues, which still applies to values between the chunk size and the threshold.
+//
+// SET, GETSET, MSET, HSET, HMSET, HSETNX and XADD offload values, as do SET, HSET and XADD in
+// transactions. GET, HGET, HMGET, HGETALL, XRANGE and the other commands that read values resolve
+// pointers, which needs a client with the blob store, but not with a threshold: a threshold of zero
+// only resolves pointers. The blobs of values that are overwritten by the commands above, or deleted
+// by DEL, HDEL, XDEL, XTRIM or FLUSHDB, are released with them, and so are those of keys replaced by
+// COPY or RENAME. Other commands, and deleting with a client without the blob store, leave blobs
+// behind.
+//
+// Expired values are released when a command overwrites them, or DEL or FLUSHDB deletes their key,
+// before DynamoDB does. DynamoDB deleting expired items leaves their blobs behind, until FLUSHDB on a
+// client without a namespace deletes every blob still counted.
+//
+// While the last pointer to a blob is released, the blob is deleted and commands storing the same
+// content wait for it, up to a minute, before putting it again.
+func (c Client) OffloadValues(store BlobStore, threshold int) Client {
+	if threshold < 0 {
+		threshold = 0
+	}
+
+	c.blobs = store
+	c.blobThreshold = threshold
+
+	return c
+}
+
+type blobPointer struct {
+	hash string
+	size int
+	valueEncoding
+}
+
+func (p blobPointer) toAV() types.AttributeValue {
+	inner := map[string]types.AttributeValue{
+		"hash": &types.AttributeValueMemberS{Value: p.hash},
+		"size": &types.AttributeValueMemberN{Value: strconv.Itoa(p.size)},
+	}
+
+	p.valueEncoding.put(inner)
+
+	return &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+		blobPointerKey: &types.AttributeValueMemberM{Value: inner},
+	}}
+}
+
+func parseBlobPointer(av types.AttributeValue) (p blobPointer, ok bool) {
+	outer, ok := av.(*types.AttributeValueMemberM)
+	if !ok || len(outer.Value) != 1 {
+		return p, false
+	}
+
+	inner, ok := outer.Value[blobPointerKey].(*types.AttributeValueMemberM)
+	if !ok {
+		return p, false
+	}
+
+	p.hash = ReturnValue{inner.Value["hash"]}.String()
+	p.size = int(ReturnValue{inner.Value["size"]}.Int())
+	p.valueEncoding = parseValueEncoding(inner.Value)
+
+	return p, p.hash != ""
+}
+
+// blobRefPartition begins the partition of the internal item that counts the pointers to a blob. It
+// is stored outside any namespace, since blobs are shared by content. The internal partitions of keys
+// are "_redimo/" followed by the key, and keys that begin with "_redimo/" are redimo's own, so no key
+// has its bookkeeping under this partition.
+const blobRefPartition = "_redimo/_redimo/blob/"
+
+// blobDeletingAttribute marks the count of a blob that is being deleted with the time the deletion
+// started.
+const blobDeletingAttribute = "deleting"
+
+// blobDeleteTimeout is how long pointers to a blob are held off while it is deleted. A deletion that
+// has not finished by then is taken to have been abandoned.
+const blobDeleteTimeout = time.Minute
+
+// blobDeleteWait is how long to wait before counting a pointer to a blob that is being deleted again.
+const blobDeleteWait = 10 * time.Millisecond
+
+func blobRefKey(hash string) keyDef {
+	return keyDef{pk: blobRefPartition + hash, sk: "refs"}
+}
+
+// offload puts the data of a value in the blob store, and returns the pointer to store in its place.
+// The blob is put and referenced before the pointer is written, so a pointer that is not written in
+// the end must be released with abandonAV.
+func (c Client) offload(data []byte, enc valueEncoding) (types.AttributeValue, error) {
+	sum := sha256.Sum256(data)
+	p := blobPointer{hash: hex.EncodeToString(sum[:]), size: len(data), valueEncoding: enc}
+
+	if err := c.acquireBlob(p.hash); err != nil {
+		return nil, err
+	}
+
+	if err := c.blobs.Put(c.ctx, p.hash, data); err != nil {
+		return nil, fmt.Errorf("couldn't put blob %v: %w", p.hash, err)
+	}
+
+	return p.toAV(), nil
+}
+
+// acquireBlob adds a pointer to the count of the blob. While the blob is being deleted, the pointer is
+// only counted once the deletion is done, so that the blob is not deleted after it is put again.
+func (c Client) acquireBlob(hash string) error {
+	key := blobRefKey(hash).toAV(c.withoutNamespace())
+
+	for {
+		_, err := c.ddb().UpdateItem(c.ctx, &dynamodb.UpdateItemInput{
+			ConditionExpression:       aws.String(fmt.Sprintf("attribute_not_exists(#%v)", blobDeletingAttribute)),
+			ExpressionAttributeNames:  map[string]string{"#" + vk: vk, "#" + blobDeletingAttribute: blobDeletingAttribute},
+			ExpressionAttributeValues: map[string]types.AttributeValue{":delta": IntValue{1}.ToAV()},
+			Key:                       key,
+			TableName:                 aws.String(c.tableName),
+			UpdateExpression:          aws.String("ADD #val :delta"),
+		})
+		if !errors.Is(err, ErrConditionFailed) {
+			return err
+		}
+
+		resp, err := c.ddb().GetItem(c.ctx, &dynamodb.GetItemInput{
+			ConsistentRead: aws.Bool(true),
+			Key:            key,
+			TableName:      aws.String(c.tableName),
+		})
+		if err != nil {
+			return err
+		}
+
+		started, ok := parseExpiry(resp.Item[blobDeletingAttribute])
+		if ok && time.Since(started) > blobDeleteTimeout {
+			if err = c.abandonBlobDeletion(key, resp.Item[blobDeletingAttribute]); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if ok {
+			select {
+			case <-c.ctx.Done():
+				return c.ctx.Err()
+			case <-time.After(blobDeleteWait):
+			}
+		}
+	}
+}
+
+// abandonBlobDeletion removes the mark of the deletion started at the given time from the count of a
+// blob, unless another deletion has marked it since.
+func (c Client) abandonBlobDeletion(key map[string]types.AttributeValue, started types.AttributeValue) error {
+	builder := newExpresionBuilder()
+	builder.condition(fmt.Sprintf("#%[1]v = :%[1]v", blobDeletingAttribute), blobDeletingAttribute)
+	builder.values[blobDeletingAttribute] = started
+	builder.updateREMOVE(blobDeletingAttribute)
+
+	_, err := c.ddb().UpdateItem(c.ctx, &dynamodb.UpdateItemInput{
+		ConditionExpression:       builder.conditionExpression(),
+		ExpressionAttributeNames:  builder.expressionAttributeNames(),
+		ExpressionAttributeValues: builder.expressionAttributeValues(),
+		Key:                       key,
+		TableName:                 aws.String(c.tableName),
+		UpdateExpression:          builder.updateExpression(),
+	})
+	if errors.Is(err, ErrConditionFailed) {
+		return nil
+	}
+
+	return err
+}
+
+// offloaded reports whether the client offloads data of the size to its blob store.
+func (c Client) offloaded(data []byte) bool {
+	return c.blobs != nil && c.blobThreshold > 0 && len(data) > c.blobThreshold
+}
+
+// unoffload reads the data of a value from the blob store.
+func (c Client) unoffload(p blobPointer) ([]byte, error) {
+	if c.blobs == nil {
+		return nil, ErrNoBlobStore
+	}
+
+	data, err := c.blobs.Get(c.ctx, p.hash)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get blob %v: %w", p.hash, err)
+	}
+
+	if len(data) != p.size {
+		return nil, fmt.Errorf("couldn't get blob %v: got %v bytes instead of %v", p.hash, len(data), p.size)
+	}
+
+	return data, nil
+}
+
+// releaseBlob removes a pointer from the count of the blob, and deletes the blob if it was the last.
+func (c Client) releaseBlob(p blobPointer) error {
+	if c.blobs == nil {
+		return ErrNoBlobStore
+	}
+
+	resp, err := c.ddb().UpdateItem(c.ctx, &dynamodb.UpdateItemInput{
+		ExpressionAttributeNames:  map[string]string{"#" + vk: vk},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":delta": IntValue{-1}.ToAV()},
+		Key:                       blobRefKey(p.hash).toAV(c.withoutNamespace()),
+		ReturnValues:              types.ReturnValueUpdatedNew,
+		TableName:                 aws.String(c.tableName),
+		UpdateExpression:          aws.String("ADD #val :delta"),
+	})
+	if err != nil || (ReturnValue{resp.Attributes[vk]}).Int() > 0 {
+		return err
+	}
+
+	return c.deleteBlob(p.hash, true)
+}
+
+// deleteBlob deletes the blob along with its count, if the count exists and, when unreferenced is set,
+// no pointer was added to it since it reached zero. The count is marked as being deleted first, which
+// holds off new pointers until both are deleted, and the mark is removed again if the blob can't be.
+func (c Client) deleteBlob(hash string, unreferenced bool) error {
+	key := blobRefKey(hash).toAV(c.withoutNamespace())
+	started := expiryAV(time.Now())
+
+	builder := newExpresionBuilder()
+	builder.addConditionExists(vk)
+	builder.addConditionNotExists(blobDeletingAttribute)
+
+	if unreferenced {
+		builder.condition(fmt.Sprintf("#%v <= :zero", vk), vk)
+		builder.values["zero"] = IntValue{0}.ToAV()
+	}
+
+	builder.updateSetAV(blobDeletingAttribute, started)
+
+	_, err := c.ddb().UpdateItem(c.ctx, &dynamodb.UpdateItemInput{
+		ConditionExpression:       builder.conditionExpression(),
+		ExpressionAttributeNames:  builder.expressionAttributeNames(),
+		ExpressionAttributeValues: builder.expressionAttributeValues(),
+		Key:                       key,
+		TableName:                 aws.String(c.tableName),
+		UpdateExpression:          builder.updateExpression(),
+	})
+	if errors.Is(err, ErrConditionFailed) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err = c.blobs.Delete(c.ctx, hash); err != nil {
+		if abandonErr := c.abandonBlobDeletion(key, started); abandonErr != nil {
+			return abandonErr
+		}
+
+		return fmt.Errorf("couldn't delete blob %v: %w", hash, err)
+	}
+
+	builder = newExpresionBuilder()
+	builder.condition(fmt.Sprintf("#%[1]v = :%[1]v", blobDeletingAttribute), blobDeletingAttribute)
+	builder.values[blobDeletingAttribute] = started
+
+	_, err = c.ddb().DeleteItem(c.ctx, &dynamodb.DeleteItemInput{
+		ConditionExpression:       builder.conditionExpression(),
+		ExpressionAttributeNames:  builder.expressionAttributeNames(),
+		ExpressionAttributeValues: builder.expressionAttributeValues(),
+		Key:                       key,
+		TableName:                 aws.String(c.tableName),
+	})
+	if errors.Is(err, ErrConditionFailed) {
+		return nil
+	}
+
+	return err
+}
+
+// acquireBlobs adds the pointers in the item, which is being copied, to the counts of their blobs.
+func (c Client) acquireBlobs(item map[string]types.AttributeValue) error {
+	for _, p := range itemBlobPointers(item) {
+		if err := c.acquireBlob(p.hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// itemBlobPointers returns the pointers held by an item: its value, or the fields of a stream item.
+func itemBlobPointers(item map[string]types.AttributeValue) (pointers []blobPointer) {
+	for name, av := range item {
+		if name != vk && !strings.HasPrefix(name, "_") {
+			continue
+		}
+
+		if p, ok := parseBlobPointer(av); ok {
+			pointers = append(pointers, p)
+		}
+	}
+
+	return pointers
+}
+
+// FileBlobStore is a BlobStore that keeps blobs as files in a directory, for tests and development.
+type FileBlobStore struct {
+	// Dir is the directory the blobs are kept in. It is created when the first blob is put.
+	Dir string
+}
+
+var _ BlobStore = FileBlobStore{}
+
+func (s FileBlobStore) path(hash string) (string, error) {
+	if len(hash) < 2 || filepath.Base(hash) != hash {
+		return "", fmt.Errorf("invalid blob hash %q", hash)
+	}
+
+	return filepath.Join(s.Dir, hash[:2], hash), nil
+}
+
+// Put writes the data to a file named after the hash, in a subdirectory named after its first two
+// characters. The file is written under a temporary name and renamed, so that readers never see a
+// partial blob.
+func (s FileBlobStore) Put(ctx context.Context, hash string, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	path, err := s.path(hash)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), hash+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get reads the file of the hash.
+func (s FileBlobStore) Get(ctx context.Context, hash string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	path, err := s.path(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(path)
+}
+
+// Delete removes the file of the hash, if there is one.
+func (s FileBlobStore) Delete(ctx context.Context, hash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	path, err := s.path(hash)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
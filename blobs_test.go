@@ -0,0 +1,315 @@
+package redimo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func blobCount(t *testing.T, store FileBlobStore) int {
+	files, err := filepath.Glob(filepath.Join(store.Dir, "*", "*"))
+	assert.NoError(t, err)
+
+	return len(files)
+}
+
+func TestFileBlobStore(t *testing.T) {
+	store := FileBlobStore{Dir: t.TempDir()}
+	ctx := context.Background()
+	hash := strings.Repeat("ab", 32)
+
+	_, err := store.Get(ctx, hash)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	assert.NoError(t, store.Put(ctx, hash, []byte("data")))
+	assert.NoError(t, store.Put(ctx, hash, []byte("data")))
+
+	data, err := store.Get(ctx, hash)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("data"), data)
+	assert.Equal(t, 1, blobCount(t, store))
+
+	assert.NoError(t, store.Delete(ctx, hash))
+	assert.NoError(t, store.Delete(ctx, hash))
+	assert.Equal(t, 0, blobCount(t, store))
+
+	assert.Error(t, store.Put(ctx, "../escape", []byte("data")))
+}
+
+func TestOffloadedStrings(t *testing.T) {
+	store := FileBlobStore{Dir: t.TempDir()}
+	plain := newClient(t)
+	c := plain.OffloadValues(store, 10)
+
+	large := strings.Repeat("offloaded", 3)
+
+	_, err := c.SET("a", large)
+	assert.NoError(t, err)
+	_, err = c.Namespace("tenant").SET("b", large)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, blobCount(t, store))
+
+	val, err := c.GET("a")
+	assert.NoError(t, err)
+	assert.Equal(t, large, val.String())
+
+	_, err = plain.GET("a")
+	assert.Equal(t, ErrNoBlobStore, err)
+
+	ok, err := c.SET("a", large+"!", IfNotExists)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 1, blobCount(t, store))
+
+	_, err = c.COPY("a", "copy", Flags{})
+	assert.NoError(t, err)
+
+	_, err = c.DEL("a")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, blobCount(t, store))
+
+	_, err = c.Namespace("tenant").SET("b", "small")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, blobCount(t, store))
+
+	val, err = c.GET("copy")
+	assert.NoError(t, err)
+	assert.Equal(t, large, val.String())
+
+	old, err := c.GETSET("copy", StringValue{"small"})
+	assert.NoError(t, err)
+	assert.Equal(t, large, old.String())
+	assert.Equal(t, 0, blobCount(t, store))
+}
+
+func TestOffloadedHashesAndStreams(t *testing.T) {
+	store := FileBlobStore{Dir: t.TempDir()}
+	c := newClient(t).OffloadValues(store, 4).ChunkValues(2)
+
+	large := []byte("offloaded bytes")
+
+	_, err := c.HSET("hash", map[string]Value{"large": BytesValue{large}, "chunked": StringValue{"abcd"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, blobCount(t, store))
+	assert.Equal(t, 2, chunkCount(t, c, "hash"))
+
+	all, err := c.HGETALL("hash")
+	assert.NoError(t, err)
+	assert.Equal(t, large, all["large"].Bytes())
+	assert.Equal(t, "abcd", all["chunked"].String())
+
+	_, err = c.HDEL("hash", "large")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, blobCount(t, store))
+
+	id, err := c.XADD("stream", XAutoID, map[string]Value{"body": BytesValue{large}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, blobCount(t, store))
+
+	items, err := c.XRANGE("stream", XStart, XEnd, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, large, items[0].Fields["body"].Bytes())
+
+	_, err = c.XDEL("stream", id)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, blobCount(t, store))
+
+	_, err = c.HSET("hash", map[string]Value{"large": BytesValue{large}})
+	assert.NoError(t, err)
+
+	_, err = c.DEL("hash")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, blobCount(t, store))
+}
+
+func TestBlobCounts(t *testing.T) {
+	store := FileBlobStore{Dir: t.TempDir()}
+	c := newClient(t).OffloadValues(store, 4)
+
+	large := "offloaded value"
+	sum := sha256.Sum256([]byte(large))
+	hash := hex.EncodeToString(sum[:])
+
+	_, err := c.SET("a", large)
+	assert.NoError(t, err)
+
+	// The key named after the blob's count has bookkeeping of its own, which doesn't include the count.
+	_, err = c.RPUSH("blob/"+hash, StringValue{"element"})
+	assert.NoError(t, err)
+	_, err = c.DEL("blob/" + hash)
+	assert.NoError(t, err)
+
+	val, err := c.GET("a")
+	assert.NoError(t, err)
+	assert.Equal(t, large, val.String())
+
+	refs, err := c.partitionItems(blobRefKey(hash).pk)
+	assert.NoError(t, err)
+	assert.Len(t, refs, 1)
+
+	// Expired values are released when their key is deleted.
+	_, err = c.SET("expiring", large, PX(10))
+	assert.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+
+	_, err = c.DEL("a", "expiring")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, blobCount(t, store))
+
+	refs, err = c.partitionItems(blobRefKey(hash).pk)
+	assert.NoError(t, err)
+	assert.Empty(t, refs)
+
+	// Storing the content of a blob that is being deleted waits for the deletion to finish.
+	_, err = c.SET("a", large)
+	assert.NoError(t, err)
+
+	hooked := &deleteHookStore{BlobStore: store}
+	stored := make(chan error, 1)
+	hooked.beforeDelete = func() {
+		hooked.beforeDelete = nil
+
+		go func() {
+			_, err := c.SET("b", large)
+			stored <- err
+		}()
+
+		select {
+		case <-stored:
+			t.Error("stored a blob while it was being deleted")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	_, err = c.OffloadValues(hooked, 4).DEL("a")
+	assert.NoError(t, err)
+	assert.NoError(t, <-stored)
+	assert.Equal(t, 1, blobCount(t, store))
+
+	val, err = c.GET("b")
+	assert.NoError(t, err)
+	assert.Equal(t, large, val.String())
+
+	// Blobs left behind are deleted by FLUSHDB on a client without a namespace.
+	_, err = c.SET("a", large+"!")
+	assert.NoError(t, err)
+	_, err = c.OffloadValues(nil, 0).DEL("a")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, blobCount(t, store))
+
+	_, err = c.FLUSHDB()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, blobCount(t, store))
+}
+
+// deleteHookStore calls beforeDelete, if set, before deleting a blob.
+type deleteHookStore struct {
+	BlobStore
+	beforeDelete func()
+}
+
+func (s *deleteHookStore) Delete(ctx context.Context, hash string) error {
+	if s.beforeDelete != nil {
+		s.beforeDelete()
+	}
+
+	return s.BlobStore.Delete(ctx, hash)
+}
+
+func TestOffloadedMultiCommands(t *testing.T) {
+	store := FileBlobStore{Dir: t.TempDir()}
+	c := newClient(t).CheckTypes().OffloadValues(store, 8).ChunkValues(2)
+
+	large := "offloaded value"
+	chunked := "chunked"
+
+	assert.NoError(t, c.HMSET("hash", map[string]Value{"large": StringValue{large}, "chunked": StringValue{chunked}}))
+	assert.Equal(t, 1, blobCount(t, store))
+	assert.Equal(t, 4, chunkCount(t, c, "hash"))
+
+	all, err := c.HGETALL("hash")
+	assert.NoError(t, err)
+	assert.Equal(t, large, all["large"].String())
+	assert.Equal(t, chunked, all["chunked"].String())
+
+	// Values replaced by HMSET are released, and those HSETNX doesn't write are abandoned.
+	assert.NoError(t, c.HMSET("hash", map[string]Value{"large": StringValue{"s"}, "chunked": StringValue{"s"}}))
+	assert.Equal(t, 0, blobCount(t, store))
+	assert.Equal(t, 0, chunkCount(t, c, "hash"))
+
+	ok, err := c.HSETNX("hash", "large", StringValue{large})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 0, blobCount(t, store))
+
+	ok, err = c.HSETNX("hash", "new", StringValue{large})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 1, blobCount(t, store))
+
+	assert.NoError(t, c.MSET(map[string]Value{"s1": StringValue{large + "!"}, "s2": StringValue{chunked}}))
+	assert.Equal(t, 2, blobCount(t, store))
+	assert.Equal(t, 4, chunkCount(t, c, "s2"))
+
+	ok, err = c.MSETNX(map[string]Value{"s1": StringValue{large + "?"}, "s3": StringValue{"v"}})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 2, blobCount(t, store))
+
+	assert.NoError(t, c.MSET(map[string]Value{"s1": StringValue{"s"}, "s2": StringValue{"s"}}))
+	assert.Equal(t, 1, blobCount(t, store))
+	assert.Equal(t, 0, chunkCount(t, c, "s2"))
+
+	// Transactions release the values they replace or delete, and abandon those they don't write.
+	_, err = c.MULTI().
+		SET("s1", StringValue{large + "!"}).
+		HSET("hash", map[string]Value{"chunked": StringValue{chunked}}).
+		HDEL("hash", "new").
+		EXEC()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, blobCount(t, store))
+	assert.Equal(t, 4, chunkCount(t, c, "hash"))
+
+	val, err := c.GET("s1")
+	assert.NoError(t, err)
+	assert.Equal(t, large+"!", val.String())
+
+	_, err = c.MULTI().SET("s1", StringValue{"s"}).XADD("stream", XAutoID, map[string]Value{"body": StringValue{large}}).EXEC()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, blobCount(t, store))
+
+	_, err = c.MULTI().SET("s2", StringValue{large + "?"}).SADD("hash", "member").EXEC()
+	assert.Equal(t, ErrWrongType, err)
+
+	_, err = c.MULTI().SET("s2", StringValue{large + "?"}).HSET("s2", map[string]Value{"f": StringValue{"v"}}).EXEC()
+	assert.Equal(t, ErrWrongType, err)
+	assert.Equal(t, 1, blobCount(t, store))
+
+	// A value that changes between EXEC reading and writing it aborts the transaction.
+	service := &transactHookService{DynamoDBAPI: c.ddbClient}
+	hooked := c
+	hooked.ddbClient = service
+	service.beforeTransact = func() {
+		service.beforeTransact = nil
+
+		_, err := c.SET("s1", large+"#")
+		assert.NoError(t, err)
+	}
+
+	_, err = hooked.MULTI().SET("s1", StringValue{chunked}).EXEC()
+	assert.True(t, errors.Is(err, ErrConditionFailed))
+	assert.Equal(t, 2, blobCount(t, store))
+	assert.Equal(t, 0, chunkCount(t, c, "s1"))
+
+	_, err = c.DEL("hash", "s1", "s2", "stream")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, blobCount(t, store))
+}
@@ -0,0 +1,443 @@
+package redimo
+
+import (
+	"container/list"
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Cache is an in-process read-through cache of the results of GET, HGET, HGETALL, SMEMBERS and ZSCORE,
+// for clients returned by CacheReads. Results are evicted least recently used first once the cache
+// holds more than MaxEntries results or MaxBytes of values, and expire after their TTL, or when the key
+// expires if that is sooner.
+//
+// Every item a cached client writes, by any command, invalidates the cached results of its key, so the
+// client reads its own writes. Writes made by other clients, or by other processes, are only seen once
+// the results expire, unless the keys they write are passed to Invalidate, or to Listen through an
+// InvalidationSource.
+//
+// A Cache is safe for concurrent use, so a single Cache can be shared by many clients. Clients of
+// different tables and namespaces don't share results.
+type Cache struct {
+	options CacheOptions
+
+	mu          sync.Mutex
+	lru         *list.List
+	entries     map[cacheID]*list.Element
+	keys        map[cacheKey]map[cacheID]*list.Element
+	bytes       int
+	generations [cacheStripes]uint64
+	stats       CacheStats
+}
+
+// cacheStripes is the number of generations invalidations are counted in. Keys are spread over them by
+// hash, so that a write only holds off caching the results being read of keys in its stripe, without
+// the cache keeping a generation for every key ever written.
+const cacheStripes = 256
+
+// CacheOptions are the bounds of a Cache.
+type CacheOptions struct {
+	// MaxEntries is the number of results the cache holds at most, or 0 for no limit.
+	MaxEntries int
+
+	// MaxBytes is the approximate size of the values the cache holds at most, or 0 for no limit.
+	MaxBytes int
+
+	// TTL is how long results are cached for. Without a TTL, results are cached until they are evicted
+	// or invalidated, or the key expires.
+	TTL time.Duration
+
+	// KeyTTL, if set, returns how long the results of the key are cached for, instead of TTL. Results of
+	// keys it returns a negative duration for are not cached.
+	KeyTTL func(key string) time.Duration
+}
+
+// CacheStats are the counts of lookups and evictions of a Cache.
+type CacheStats struct {
+	Hits          int64
+	Misses        int64
+	Evictions     int64
+	Invalidations int64
+}
+
+// cacheKey is the partition a result was read from, as stored in the table.
+type cacheKey struct {
+	table string
+	pk    string
+}
+
+// stripe returns the index of the generation that counts the invalidations of the key.
+func (k cacheKey) stripe() int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(k.table))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(k.pk))
+
+	return int(h.Sum32() % cacheStripes)
+}
+
+// cacheID identifies a result: the command, and the field or member it read, if any.
+type cacheID struct {
+	cacheKey
+	command string
+	field   string
+}
+
+type cacheEntry struct {
+	id      cacheID
+	result  interface{}
+	size    int
+	expires time.Time
+}
+
+// NewCache returns an empty cache with the given bounds.
+func NewCache(options CacheOptions) *Cache {
+	return &Cache{
+		options: options,
+		lru:     list.New(),
+		entries: make(map[cacheID]*list.Element),
+		keys:    make(map[cacheKey]map[cacheID]*list.Element),
+	}
+}
+
+// CacheReads returns a copy of the client that serves GET, HGET, HGETALL, SMEMBERS and ZSCORE from the
+// cache when it can, and invalidates the cache's results of every key it writes. Results served from
+// the cache consume no capacity, but skip the type check of the key, so a command against a key that
+// has since been replaced by another client with a value of another type may return a stale result
+// instead of ErrWrongType. Pass nil to stop caching.
+func (c Client) CacheReads(cache *Cache) Client {
+	c.cache = cache
+	return c
+}
+
+// Stats returns the counts of lookups and evictions since the cache was created.
+func (cache *Cache) Stats() CacheStats {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return cache.stats
+}
+
+// Len returns the number of results the cache holds.
+func (cache *Cache) Len() int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return cache.lru.Len()
+}
+
+// Invalidate drops the cached results of the partition keys of the table. Partition keys are keys as
+// stored in the table, prefixed with their namespace, if any.
+func (cache *Cache) Invalidate(table string, pks ...string) {
+	if cache == nil {
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	for _, pk := range pks {
+		key := cacheKey{table: table, pk: pk}
+		cache.generations[key.stripe()]++
+
+		for _, elem := range cache.keys[key] {
+			cache.remove(elem)
+			cache.stats.Invalidations++
+		}
+	}
+}
+
+// Purge drops every result the cache holds.
+func (cache *Cache) Purge() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	for i := range cache.generations {
+		cache.generations[i]++
+	}
+
+	cache.lru.Init()
+	cache.entries = make(map[cacheID]*list.Element)
+	cache.keys = make(map[cacheKey]map[cacheID]*list.Element)
+	cache.bytes = 0
+}
+
+// InvalidationSource reports the keys written by other processes, such as from DynamoDB Streams or
+// a pub/sub channel the writers publish to.
+type InvalidationSource interface {
+	// Invalidations calls invalidate with the table and the partition keys of the items written to it,
+	// until the context is done or the source fails. Partition keys are keys as stored in the table,
+	// prefixed with their namespace, if any.
+	Invalidations(ctx context.Context, invalidate func(table string, pks ...string)) error
+}
+
+// Listen invalidates the keys reported by the source until the context is done or the source fails,
+// and returns the source's error. As invalidations may be missed from then on, Listen purges the
+// cache when it returns.
+func (cache *Cache) Listen(ctx context.Context, source InvalidationSource) error {
+	defer cache.Purge()
+
+	return source.Invalidations(ctx, cache.Invalidate)
+}
+
+// cacheFill stores a copy of the result of a read, unless the key was invalidated while it was being
+// read. The result expires at expires, if that is sooner than the cache's TTL.
+type cacheFill func(result interface{}, size int, expires time.Time)
+
+// cached returns a copy of the cached result of the command for the key and field, or a cacheFill to
+// store the result once the command has read it. Results are copied in and out of the cache, so that
+// callers can't change the values it holds.
+func (c Client) cached(command string, key string, field string) (result interface{}, ok bool, fill cacheFill) {
+	cache := c.cache
+	if cache == nil {
+		return nil, false, func(interface{}, int, time.Time) {}
+	}
+
+	id := cacheID{cacheKey: cacheKey{table: c.tableName, pk: c.namespaced(key)}, command: command, field: field}
+	now := time.Now()
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if elem, found := cache.entries[id]; found {
+		entry := elem.Value.(*cacheEntry)
+		if entry.expires.IsZero() || now.Before(entry.expires) {
+			cache.lru.MoveToFront(elem)
+			cache.stats.Hits++
+
+			return cloneResult(entry.result), true, nil
+		}
+
+		cache.remove(elem)
+	}
+
+	cache.stats.Misses++
+	generation := cache.generations[id.stripe()]
+
+	ttl := cache.options.TTL
+	if cache.options.KeyTTL != nil {
+		ttl = cache.options.KeyTTL(key)
+	}
+
+	return nil, false, func(result interface{}, size int, expires time.Time) {
+		if ttl < 0 {
+			return
+		}
+
+		if ttl > 0 && (expires.IsZero() || now.Add(ttl).Before(expires)) {
+			expires = now.Add(ttl)
+		}
+
+		cache.add(generation, &cacheEntry{id: id, result: cloneResult(result), size: size, expires: expires})
+	}
+}
+
+func (cache *Cache) add(generation uint64, entry *cacheEntry) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if generation != cache.generations[entry.id.stripe()] {
+		// The result may predate a write made while it was being read.
+		return
+	}
+
+	if cache.options.MaxBytes > 0 && entry.size > cache.options.MaxBytes {
+		return
+	}
+
+	if elem, found := cache.entries[entry.id]; found {
+		cache.remove(elem)
+	}
+
+	elem := cache.lru.PushFront(entry)
+	cache.entries[entry.id] = elem
+	cache.bytes += entry.size
+
+	if cache.keys[entry.id.cacheKey] == nil {
+		cache.keys[entry.id.cacheKey] = make(map[cacheID]*list.Element)
+	}
+
+	cache.keys[entry.id.cacheKey][entry.id] = elem
+
+	for (cache.options.MaxEntries > 0 && cache.lru.Len() > cache.options.MaxEntries) ||
+		(cache.options.MaxBytes > 0 && cache.bytes > cache.options.MaxBytes) {
+		cache.remove(cache.lru.Back())
+		cache.stats.Evictions++
+	}
+}
+
+func (cache *Cache) remove(elem *list.Element) {
+	entry := cache.lru.Remove(elem).(*cacheEntry)
+	cache.bytes -= entry.size
+
+	delete(cache.entries, entry.id)
+
+	if ids := cache.keys[entry.id.cacheKey]; ids != nil {
+		delete(ids, entry.id)
+
+		if len(ids) == 0 {
+			delete(cache.keys, entry.id.cacheKey)
+		}
+	}
+}
+
+// invalidateItems invalidates the partition keys of the written items of the table.
+func (cache *Cache) invalidateItems(table *string, partitionKey string, keys ...map[string]types.AttributeValue) {
+	if cache == nil {
+		return
+	}
+
+	pks := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		if pk, ok := key[partitionKey].(*types.AttributeValueMemberS); ok {
+			pks = append(pks, pk.Value)
+		}
+	}
+
+	cache.Invalidate(aws.ToString(table), pks...)
+}
+
+func (cache *Cache) invalidateTransaction(partitionKey string, params *dynamodb.TransactWriteItemsInput) {
+	if cache == nil {
+		return
+	}
+
+	for _, action := range params.TransactItems {
+		switch {
+		case action.Put != nil:
+			cache.invalidateItems(action.Put.TableName, partitionKey, action.Put.Item)
+		case action.Update != nil:
+			cache.invalidateItems(action.Update.TableName, partitionKey, action.Update.Key)
+		case action.Delete != nil:
+			cache.invalidateItems(action.Delete.TableName, partitionKey, action.Delete.Key)
+		}
+	}
+}
+
+func (cache *Cache) invalidateBatch(partitionKey string, params *dynamodb.BatchWriteItemInput) {
+	if cache == nil {
+		return
+	}
+
+	for table, requests := range params.RequestItems {
+		for _, request := range requests {
+			switch {
+			case request.PutRequest != nil:
+				cache.invalidateItems(&table, partitionKey, request.PutRequest.Item)
+			case request.DeleteRequest != nil:
+				cache.invalidateItems(&table, partitionKey, request.DeleteRequest.Key)
+			}
+		}
+	}
+}
+
+// cloneResult returns a deep copy of a cached result.
+func cloneResult(result interface{}) interface{} {
+	switch result := result.(type) {
+	case ReturnValue:
+		return ReturnValue{cloneAV(result.av)}
+	case map[string]ReturnValue:
+		cloned := make(map[string]ReturnValue, len(result))
+		for field, value := range result {
+			cloned[field] = ReturnValue{cloneAV(value.av)}
+		}
+
+		return cloned
+	case []string:
+		return append([]string(nil), result...)
+	}
+
+	return result
+}
+
+// cloneAV returns a deep copy of the attribute value.
+func cloneAV(av types.AttributeValue) types.AttributeValue {
+	switch av := av.(type) {
+	case *types.AttributeValueMemberB:
+		return &types.AttributeValueMemberB{Value: append([]byte(nil), av.Value...)}
+	case *types.AttributeValueMemberSS:
+		return &types.AttributeValueMemberSS{Value: append([]string(nil), av.Value...)}
+	case *types.AttributeValueMemberNS:
+		return &types.AttributeValueMemberNS{Value: append([]string(nil), av.Value...)}
+	case *types.AttributeValueMemberBS:
+		bs := make([][]byte, len(av.Value))
+		for i, b := range av.Value {
+			bs[i] = append([]byte(nil), b...)
+		}
+
+		return &types.AttributeValueMemberBS{Value: bs}
+	case *types.AttributeValueMemberL:
+		l := make([]types.AttributeValue, len(av.Value))
+		for i, elem := range av.Value {
+			l[i] = cloneAV(elem)
+		}
+
+		return &types.AttributeValueMemberL{Value: l}
+	case *types.AttributeValueMemberM:
+		m := make(map[string]types.AttributeValue, len(av.Value))
+		for k, elem := range av.Value {
+			m[k] = cloneAV(elem)
+		}
+
+		return &types.AttributeValueMemberM{Value: m}
+	}
+
+	// Strings, numbers, booleans and nulls can't be changed through the value.
+	return av
+}
+
+// avSize returns the approximate size of the attribute value, in bytes.
+func avSize(av types.AttributeValue) (size int) {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return len(v.Value)
+	case *types.AttributeValueMemberN:
+		return len(v.Value)
+	case *types.AttributeValueMemberB:
+		return len(v.Value)
+	case *types.AttributeValueMemberSS:
+		for _, s := range v.Value {
+			size += len(s)
+		}
+	case *types.AttributeValueMemberNS:
+		for _, n := range v.Value {
+			size += len(n)
+		}
+	case *types.AttributeValueMemberBS:
+		for _, b := range v.Value {
+			size += len(b)
+		}
+	case *types.AttributeValueMemberM:
+		for k, elem := range v.Value {
+			size += len(k) + avSize(elem)
+		}
+	case *types.AttributeValueMemberL:
+		for _, elem := range v.Value {
+			size += avSize(elem)
+		}
+	}
+
+	return size + 1
+}
+
+// itemExpiry returns the expiry of the item, or the zero time if it has none.
+func (c Client) itemExpiry(item map[string]types.AttributeValue) time.Time {
+	at, _ := parseExpiry(item[expiryAttribute])
+	return at
+}
+
+// earliest returns the earlier of two expiries, where the zero time is no expiry.
+func earliest(a time.Time, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+
+	return a
+}
@@ -0,0 +1,277 @@
+package redimo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachedReads(t *testing.T) {
+	plain := newClient(t)
+	cache := NewCache(CacheOptions{})
+	c := plain.CacheReads(cache)
+
+	_, err := c.SET("config", "v1")
+	assert.NoError(t, err)
+	_, err = c.HSET("hash", map[string]interface{}{"a": "1", "b": 2})
+	assert.NoError(t, err)
+	_, err = c.SADD("set", "x", "y")
+	assert.NoError(t, err)
+	_, err = c.ZADD("zset", map[string]float64{"m": 1.5}, Flags{})
+	assert.NoError(t, err)
+
+	read := func() {
+		val, err := c.GET("config")
+		assert.NoError(t, err)
+		assert.Equal(t, "v1", val.String())
+
+		val, err = c.HGET("hash", "b")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), val.Int())
+
+		all, err := c.HGETALL("hash")
+		assert.NoError(t, err)
+		assert.Equal(t, "1", all["a"].String())
+
+		// Results are copies, so changing them doesn't change the cache.
+		delete(all, "a")
+
+		members, err := c.SMEMBERS("set")
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"x", "y"}, members)
+
+		score, found, err := c.ZSCORE("zset", "m")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, 1.5, score)
+
+		_, found, err = c.ZSCORE("zset", "missing")
+		assert.NoError(t, err)
+		assert.False(t, found)
+
+		val, err = c.GET("missing")
+		assert.NoError(t, err)
+		assert.True(t, val.Empty())
+	}
+
+	read()
+	assert.Equal(t, CacheStats{Misses: 7}, cache.Stats())
+	assert.Equal(t, 7, cache.Len())
+
+	var cc ConsumedCapacity
+
+	c = c.TrackCapacity(&cc)
+	read()
+	assert.Equal(t, CacheStats{Hits: 7, Misses: 7}, cache.Stats())
+	assert.Equal(t, 0.0, cc.Total().Read)
+
+	// Writes through a cached client invalidate the key.
+	_, err = c.SET("config", "v2")
+	assert.NoError(t, err)
+
+	val, err := c.GET("config")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", val.String())
+
+	_, err = c.HSET("hash", map[string]interface{}{"c": "3"})
+	assert.NoError(t, err)
+
+	all, err := c.HGETALL("hash")
+	assert.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	val, err = c.HGET("hash", "b")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), val.Int())
+
+	_, err = c.DEL("set")
+	assert.NoError(t, err)
+
+	members, err := c.SMEMBERS("set")
+	assert.NoError(t, err)
+	assert.Empty(t, members)
+
+	// Writes by other clients are only seen once the key is invalidated.
+	_, err = plain.SET("config", "v3")
+	assert.NoError(t, err)
+
+	val, err = c.GET("config")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", val.String())
+
+	cache.Invalidate(c.tableName, "config")
+
+	val, err = c.GET("config")
+	assert.NoError(t, err)
+	assert.Equal(t, "v3", val.String())
+
+	// Clients of other namespaces don't share results.
+	_, err = plain.Namespace("ns").SET("config", "ns")
+	assert.NoError(t, err)
+
+	val, err = c.Namespace("ns").GET("config")
+	assert.NoError(t, err)
+	assert.Equal(t, "ns", val.String())
+
+	_, err = c.Namespace("ns").SET("config", "ns2")
+	assert.NoError(t, err)
+
+	val, err = c.GET("config")
+	assert.NoError(t, err)
+	assert.Equal(t, "v3", val.String())
+
+	// Values are copied in and out of the cache, so changing the bytes of a result doesn't change it.
+	_, err = c.SET("blob", BytesValue{[]byte("abc")})
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		val, err = c.GET("blob")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("abc"), val.Bytes())
+
+		val.Bytes()[0] = 'x'
+	}
+
+	cache.Purge()
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestCacheFillInvalidation(t *testing.T) {
+	c := newClient(t).CacheReads(NewCache(CacheOptions{}))
+
+	other := "b"
+	for i := 0; (cacheKey{c.tableName, other}).stripe() == (cacheKey{c.tableName, "a"}).stripe(); i++ {
+		other = fmt.Sprintf("b%v", i)
+	}
+
+	// A write to another key while a result is read doesn't keep it out of the cache.
+	_, _, fill := c.cached("GET", "a", "")
+	c.cache.Invalidate(c.tableName, other)
+	fill(ReturnValue{StringValue{"v1"}.ToAV()}, 2, time.Time{})
+	assert.Equal(t, 1, c.cache.Len())
+
+	// A write to the key itself does, as the result may predate it.
+	_, _, fill = c.cached("GET", "c", "")
+	c.cache.Invalidate(c.tableName, "c")
+	fill(ReturnValue{StringValue{"v1"}.ToAV()}, 2, time.Time{})
+	assert.Equal(t, 1, c.cache.Len())
+}
+
+func TestCacheBounds(t *testing.T) {
+	plain := newClient(t)
+
+	for _, key := range []string{"a", "b", "c"} {
+		_, err := plain.SET(key, "0123456789")
+		assert.NoError(t, err)
+	}
+
+	read := func(c Client, keys ...string) {
+		for _, key := range keys {
+			_, err := c.GET(key)
+			assert.NoError(t, err)
+		}
+	}
+
+	cache := NewCache(CacheOptions{MaxEntries: 2})
+	read(plain.CacheReads(cache), "a", "b", "a", "c")
+	assert.Equal(t, 2, cache.Len())
+	assert.Equal(t, int64(1), cache.Stats().Evictions)
+
+	read(plain.CacheReads(cache), "a")
+	assert.Equal(t, int64(2), cache.Stats().Hits)
+
+	cache = NewCache(CacheOptions{MaxBytes: 25})
+	read(plain.CacheReads(cache), "a", "b", "c")
+	assert.Equal(t, 2, cache.Len())
+
+	cache = NewCache(CacheOptions{MaxBytes: 5})
+	read(plain.CacheReads(cache), "a")
+	assert.Equal(t, 0, cache.Len())
+
+	cache = NewCache(CacheOptions{TTL: time.Millisecond})
+	read(plain.CacheReads(cache), "a")
+	time.Sleep(5 * time.Millisecond)
+	read(plain.CacheReads(cache), "a")
+	assert.Equal(t, CacheStats{Misses: 2}, cache.Stats())
+
+	cache = NewCache(CacheOptions{TTL: time.Hour, KeyTTL: func(key string) time.Duration {
+		if key == "b" {
+			return -1
+		}
+
+		return time.Hour
+	}})
+	read(plain.CacheReads(cache), "a", "b")
+	assert.Equal(t, 1, cache.Len())
+
+	// Results don't outlive the key's own expiry.
+	_, err := plain.SET("expiring", "value", PX(100))
+	assert.NoError(t, err)
+
+	cache = NewCache(CacheOptions{TTL: time.Hour})
+	c := plain.CacheReads(cache)
+	val, err := c.GET("expiring")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", val.String())
+
+	time.Sleep(150 * time.Millisecond)
+
+	val, err = c.GET("expiring")
+	assert.NoError(t, err)
+	assert.True(t, val.Empty())
+}
+
+type chanInvalidations chan []string
+
+func (ch chanInvalidations) Invalidations(ctx context.Context, invalidate func(table string, pks ...string)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case keys, ok := <-ch:
+			if !ok {
+				return errors.New("closed")
+			}
+
+			invalidate(keys[0], keys[1:]...)
+		}
+	}
+}
+
+func TestCacheListen(t *testing.T) {
+	plain := newClient(t)
+	cache := NewCache(CacheOptions{})
+	c := plain.CacheReads(cache)
+
+	_, err := plain.SET("config", "v1")
+	assert.NoError(t, err)
+
+	_, err = c.GET("config")
+	assert.NoError(t, err)
+
+	source := make(chanInvalidations)
+	done := make(chan error)
+
+	go func() {
+		done <- cache.Listen(context.Background(), source)
+	}()
+
+	_, err = plain.SET("config", "v2")
+	assert.NoError(t, err)
+
+	source <- []string{c.tableName, "config"}
+
+	assert.Eventually(t, func() bool {
+		val, err := c.GET("config")
+		return err == nil && val.String() == "v2"
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 1, cache.Len())
+
+	close(source)
+	assert.EqualError(t, <-done, "closed")
+	assert.Equal(t, 0, cache.Len())
+}
@@ -0,0 +1,146 @@
+package redimo
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// CapacityUnits are the read and write capacity units consumed by DynamoDB requests.
+type CapacityUnits struct {
+	Read  float64
+	Write float64
+}
+
+func (u CapacityUnits) add(other CapacityUnits) CapacityUnits {
+	return CapacityUnits{Read: u.Read + other.Read, Write: u.Write + other.Write}
+}
+
+// ConsumedCapacity adds up the capacity consumed by the commands of a client returned by
+// TrackCapacity, over every page, batch and transaction they make, split by table and by index.
+// Capacity consumed by requests that fail is not reported by DynamoDB, and so is not included.
+// It is safe for concurrent use, so a single ConsumedCapacity can be shared by many clients.
+type ConsumedCapacity struct {
+	mu       sync.Mutex
+	requests int
+	tables   map[string]CapacityUnits
+	indexes  map[capacityIndex]CapacityUnits
+}
+
+type capacityIndex struct {
+	table string
+	index string
+}
+
+// TrackCapacity returns a copy of the client that has every DynamoDB request report the capacity it
+// consumes, and adds it to cc. To get the capacity of a single command, track it on its own:
+//
+//	var cc redimo.ConsumedCapacity
+//	members, err := c.TrackCapacity(&cc).SMEMBERS("key")
+//	fmt.Println(cc.Total().Read)
+func (c Client) TrackCapacity(cc *ConsumedCapacity) Client {
+	c.capacity = cc
+	return c
+}
+
+// Total returns the capacity consumed on all tables and their indexes.
+func (cc *ConsumedCapacity) Total() (total CapacityUnits) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	for _, units := range cc.tables {
+		total = total.add(units)
+	}
+
+	for _, units := range cc.indexes {
+		total = total.add(units)
+	}
+
+	return
+}
+
+// Table returns the capacity consumed on the table itself, not counting its indexes.
+func (cc *ConsumedCapacity) Table(name string) CapacityUnits {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	return cc.tables[name]
+}
+
+// Index returns the capacity consumed on an index of the table, such as the local secondary index
+// that sorted sets use.
+func (cc *ConsumedCapacity) Index(table, index string) CapacityUnits {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	return cc.indexes[capacityIndex{table: table, index: index}]
+}
+
+// Requests returns the number of DynamoDB requests that reported capacity.
+func (cc *ConsumedCapacity) Requests() int {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	return cc.requests
+}
+
+// Reset sets all the consumed capacity back to zero.
+func (cc *ConsumedCapacity) Reset() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.requests = 0
+	cc.tables = nil
+	cc.indexes = nil
+}
+
+// record adds the capacity reported by a request. Units that DynamoDB does not split into reads and
+// writes are counted as reads for read requests, and as writes otherwise.
+func (cc *ConsumedCapacity) record(read bool, consumed ...types.ConsumedCapacity) {
+	if cc == nil || len(consumed) == 0 {
+		return
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if cc.tables == nil {
+		cc.tables = make(map[string]CapacityUnits)
+		cc.indexes = make(map[capacityIndex]CapacityUnits)
+	}
+
+	cc.requests++
+
+	for _, c := range consumed {
+		table := aws.ToString(c.TableName)
+
+		if c.Table == nil && c.LocalSecondaryIndexes == nil && c.GlobalSecondaryIndexes == nil {
+			cc.tables[table] = cc.tables[table].add(capacityUnits(read, c.CapacityUnits, c.ReadCapacityUnits, c.WriteCapacityUnits))
+			continue
+		}
+
+		if c.Table != nil {
+			cc.tables[table] = cc.tables[table].add(capacityUnits(read, c.Table.CapacityUnits, c.Table.ReadCapacityUnits, c.Table.WriteCapacityUnits))
+		}
+
+		for _, indexes := range []map[string]types.Capacity{c.LocalSecondaryIndexes, c.GlobalSecondaryIndexes} {
+			for name, capacity := range indexes {
+				key := capacityIndex{table: table, index: name}
+				cc.indexes[key] = cc.indexes[key].add(capacityUnits(read, capacity.CapacityUnits, capacity.ReadCapacityUnits, capacity.WriteCapacityUnits))
+			}
+		}
+	}
+}
+
+func capacityUnits(read bool, total, readUnits, writeUnits *float64) CapacityUnits {
+	if readUnits != nil || writeUnits != nil {
+		return CapacityUnits{Read: aws.ToFloat64(readUnits), Write: aws.ToFloat64(writeUnits)}
+	}
+
+	if read {
+		return CapacityUnits{Read: aws.ToFloat64(total)}
+	}
+
+	return CapacityUnits{Write: aws.ToFloat64(total)}
+}
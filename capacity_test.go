@@ -0,0 +1,88 @@
+package redimo
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsumedCapacity(t *testing.T) {
+	c := newClient(t).CheckTypes()
+
+	var cc ConsumedCapacity
+
+	tracked := c.TrackCapacity(&cc)
+
+	_, err := tracked.SET("k1", "v1")
+	assert.NoError(t, err)
+	assert.True(t, cc.Requests() > 0)
+	assert.True(t, cc.Table(c.tableName).Write > 0)
+	assert.Equal(t, cc.Table(c.tableName), cc.Total())
+
+	cc.Reset()
+	assert.Equal(t, 0, cc.Requests())
+	assert.Equal(t, CapacityUnits{}, cc.Total())
+
+	// GET reads the type of the key and its value, each a small item.
+	_, err = tracked.GET("k1")
+	assert.NoError(t, err)
+	assert.Equal(t, CapacityUnits{Read: 2}, cc.Table(c.tableName))
+	assert.Equal(t, 2, cc.Requests())
+
+	cc.Reset()
+
+	_, err = tracked.SkipTypeChecks().GET("k1")
+	assert.NoError(t, err)
+	assert.Equal(t, CapacityUnits{Read: 1}, cc.Table(c.tableName))
+	assert.Equal(t, 1, cc.Requests())
+
+	cc.Reset()
+
+	_, err = tracked.EventuallyConsistent().GET("k1")
+	assert.NoError(t, err)
+	assert.Equal(t, CapacityUnits{Read: 1}, cc.Table(c.tableName))
+
+	cc.Reset()
+
+	_, err = tracked.ZADD("z1", map[string]float64{"m1": 1, "m2": 2}, Flags{})
+	assert.NoError(t, err)
+	assert.True(t, cc.Index(c.tableName, c.indexName).Write >= 2)
+
+	cc.Reset()
+
+	members, err := tracked.ZRANGEBYSCORE("z1", 0, 10, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(members))
+	assert.True(t, cc.Index(c.tableName, c.indexName).Read > 0)
+	assert.Equal(t, cc.Total().Read, cc.Table(c.tableName).Read+cc.Index(c.tableName, c.indexName).Read)
+
+	before := cc.Total()
+	_, err = c.GET("k1")
+	assert.NoError(t, err)
+	assert.Equal(t, before, cc.Total())
+}
+
+func TestConsumedCapacityConcurrent(t *testing.T) {
+	c := newClient(t)
+
+	var cc ConsumedCapacity
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := c.TrackCapacity(&cc).INCR("counter")
+			assert.NoError(t, err)
+		}()
+	}
+
+	wg.Wait()
+
+	assert.True(t, cc.Requests() >= 10)
+	assert.True(t, cc.Total().Write >= 10)
+}
@@ -0,0 +1,306 @@
+package redimo
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// DefaultChunkSize is a chunk size for ChunkValues that leaves room in each item for its keys and
+// other attributes.
+const DefaultChunkSize = 350 * 1024
+
+// chunkPrefix begins the sort keys of chunks, which are stored in the partition of the key they belong
+// to, so that deleting the key deletes them too.
+const chunkPrefix = "_redimo/chunk/"
+
+// chunkManifestKey is the only key of the map stored in place of a chunked value.
+const chunkManifestKey = "_redimo/chunks"
+
+// ChunkValues returns a copy of the client that stores string and bytes values larger than size bytes
+// in chunks of at most size bytes, so that they are not limited by DynamoDB's 400 KB item size. SET,
+// GETSET, MSET, HSET, HMSET, HSETNX and XADD split values, as do SET, HSET and XADD in transactions,
+// but every client reassembles them on read, so clients with and without chunking can share a table.
+// A size of zero, the default, turns chunking off.
+//
+// A chunked value is written in a single transaction with a manifest that takes its place, so it is
+// limited to the client's TransactionActions chunks, or ErrTooManyActions is returned, and to
+// DynamoDB's 4 MB transaction size, or ErrItemTooLarge is returned. MSET, HMSET and transactions write
+// the chunks in their own transactions, which count them towards the same limit. Reading a chunked value takes a query for its chunks on top of the usual read. The
+// chunks of a value that is overwritten by the commands above, or deleted by DEL, HDEL, XDEL or XTRIM,
+// are deleted with it; other commands leave them behind until the key is deleted.
+func (c Client) ChunkValues(size int) Client {
+	if size < 0 {
+		size = 0
+	}
+
+	c.chunkSize = size
+	return c
+}
+
+type chunkManifest struct {
+	id    string
+	count int
+	valueEncoding
+}
+
+func (m chunkManifest) toAV() types.AttributeValue {
+	inner := map[string]types.AttributeValue{
+		"id":    &types.AttributeValueMemberS{Value: m.id},
+		"count": &types.AttributeValueMemberN{Value: strconv.Itoa(m.count)},
+	}
+
+	m.valueEncoding.put(inner)
+
+	return &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+		chunkManifestKey: &types.AttributeValueMemberM{Value: inner},
+	}}
+}
+
+func parseChunkManifest(av types.AttributeValue) (m chunkManifest, ok bool) {
+	outer, ok := av.(*types.AttributeValueMemberM)
+	if !ok || len(outer.Value) != 1 {
+		return m, false
+	}
+
+	inner, ok := outer.Value[chunkManifestKey].(*types.AttributeValueMemberM)
+	if !ok {
+		return m, false
+	}
+
+	m.id = ReturnValue{inner.Value["id"]}.String()
+	m.count = int(ReturnValue{inner.Value["count"]}.Int())
+	m.valueEncoding = parseValueEncoding(inner.Value)
+
+	return m, m.id != ""
+}
+
+func (m chunkManifest) prefix() string {
+	return chunkPrefix + m.id + "/"
+}
+
+func (m chunkManifest) sortKey(i int) string {
+	return fmt.Sprintf("%v%06d", m.prefix(), i)
+}
+
+// chunked reports whether the client splits data of the size into chunks.
+func (c Client) chunked(data []byte) bool {
+	return c.chunkSize > 0 && len(data) > c.chunkSize
+}
+
+// chunk splits the data of a value into chunks. It returns the manifest to store in place of the value,
+// and the actions that put the chunks in the key's partition, with the given expiry if it is not nil.
+func (c Client) chunk(key string, data []byte, enc valueEncoding, expiry types.AttributeValue) (manifest types.AttributeValue, puts []types.TransactWriteItem) {
+	m := chunkManifest{id: uuid.New().String(), count: (len(data) + c.chunkSize - 1) / c.chunkSize, valueEncoding: enc}
+
+	for i := 0; i < m.count; i++ {
+		end := (i + 1) * c.chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		item := keyDef{pk: key, sk: m.sortKey(i)}.toAV(c)
+		item[vk] = &types.AttributeValueMemberB{Value: data[i*c.chunkSize : end]}
+
+		if expiry != nil {
+			c.stampExpiry(item, expiry)
+		}
+
+		puts = append(puts, types.TransactWriteItem{Put: &types.Put{Item: item, TableName: aws.String(c.tableName)}})
+	}
+
+	return m.toAV(), puts
+}
+
+// unchunk reads the chunks of a value from the key's partition and returns their data.
+func (c Client) unchunk(key string, m chunkManifest) ([]byte, error) {
+	var (
+		data             []byte
+		count            int
+		lastEvaluatedKey map[string]types.AttributeValue
+	)
+
+	for {
+		builder := newExpresionBuilder()
+		builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(key)})
+		builder.addConditionBeginWith(c.sortKey, StringValue{m.prefix()})
+
+		resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
+			ConsistentRead:            aws.Bool(c.consistentReads),
+			ExclusiveStartKey:         lastEvaluatedKey,
+			ExpressionAttributeNames:  builder.expressionAttributeNames(),
+			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			KeyConditionExpression:    builder.conditionExpression(),
+			TableName:                 aws.String(c.tableName),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range resp.Items {
+			data = append(data, ReturnValue{item[vk]}.Bytes()...)
+			count++
+		}
+
+		if len(resp.LastEvaluatedKey) == 0 {
+			break
+		}
+
+		lastEvaluatedKey = resp.LastEvaluatedKey
+	}
+
+	if count != m.count {
+		// The value was overwritten since its manifest was read, and its chunks are being deleted.
+		return nil, &Error{Kind: ErrTransactionConflict, Err: errors.New("chunks of the value were deleted by a concurrent write")}
+	}
+
+	return data, nil
+}
+
+// deleteChunks deletes the chunks of the value, if the attribute value is the manifest of one.
+func (c Client) deleteChunks(key string, av types.AttributeValue) error {
+	m, ok := parseChunkManifest(av)
+	if !ok {
+		return nil
+	}
+
+	sortKeys := make([]string, m.count)
+	for i := range sortKeys {
+		sortKeys[i] = m.sortKey(i)
+	}
+
+	return c.fanOut(len(sortKeys), func(i int) error {
+		_, err := c.ddb().DeleteItem(c.ctx, &dynamodb.DeleteItemInput{
+			Key:       keyDef{pk: key, sk: sortKeys[i]}.toAV(c),
+			TableName: aws.String(c.tableName),
+		})
+
+		return err
+	})
+}
+
+// updateValue runs the update of an item's value and returns the item as it was before. If the value
+// is chunked, the update runs in a transaction with the puts of the chunks, on condition that the value
+// is still the one read before it, and is retried if another write changed it in between. The chunks of
+// the old value, if any, are left for the caller to delete once it is done with them.
+func (c Client) updateValue(input *dynamodb.UpdateItemInput, chunks []types.TransactWriteItem) (old map[string]types.AttributeValue, err error) {
+	if len(chunks) == 0 {
+		input.ReturnValues = types.ReturnValueAllOld
+
+		resp, err := c.updateItem(input)
+		if err != nil {
+			return nil, err
+		}
+
+		return resp.Attributes, nil
+	}
+
+	if len(chunks)+1 > c.transactionActions {
+		return nil, ErrTooManyActions
+	}
+
+	update := types.TransactWriteItem{Update: &types.Update{
+		ExpressionAttributeValues: input.ExpressionAttributeValues,
+		Key:                       input.Key,
+	}}
+	if transactionSize(append([]types.TransactWriteItem{update}, chunks...)) > maxTransactionSize {
+		return nil, ErrItemTooLarge
+	}
+
+	var (
+		failed error
+		read   types.AttributeValue
+	)
+
+	for {
+		resp, err := c.ddb().GetItem(c.ctx, &dynamodb.GetItemInput{
+			ConsistentRead: aws.Bool(true),
+			Key:            input.Key,
+			TableName:      input.TableName,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		old = resp.Item
+
+		// A transaction can't delete the expired item first the way updateItem does, so it is done here.
+		if c.expired(old, now) {
+			if _, err = c.deleteExpired(input.Key, now); err != nil {
+				return nil, err
+			}
+
+			old = nil
+		}
+
+		// If the value is the one the failed attempt expected, it was the update's own condition that failed.
+		if failed != nil && (ReturnValue{old[vk]}).Equals(ReturnValue{read}) {
+			return nil, failed
+		}
+
+		read = old[vk]
+
+		_, err = c.ddb().TransactWriteItems(c.ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: append([]types.TransactWriteItem{valueUpdate(input, read)}, chunks...),
+		})
+		if !errors.Is(err, ErrConditionFailed) {
+			if err != nil {
+				return nil, err
+			}
+
+			return old, nil
+		}
+
+		failed = err
+	}
+}
+
+// valueUpdate returns the update of the input as a transaction action, on condition that the value of the
+// item is still old, or that the item still has no value if old is nil.
+func valueUpdate(input *dynamodb.UpdateItemInput, old types.AttributeValue) types.TransactWriteItem {
+	names := map[string]string{"#redimoValue": vk}
+	for k, v := range input.ExpressionAttributeNames {
+		names[k] = v
+	}
+
+	values := make(map[string]types.AttributeValue, len(input.ExpressionAttributeValues)+1)
+	for k, v := range input.ExpressionAttributeValues {
+		values[k] = v
+	}
+
+	condition := "attribute_not_exists(#redimoValue)"
+	if old != nil {
+		condition = "#redimoValue = :redimoOld"
+		values[":redimoOld"] = old
+	}
+
+	if input.ConditionExpression != nil {
+		condition = fmt.Sprintf("(%v) AND %v", *input.ConditionExpression, condition)
+	}
+
+	if len(values) == 0 {
+		values = nil
+	}
+
+	return types.TransactWriteItem{Update: &types.Update{
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		Key:                       input.Key,
+		TableName:                 input.TableName,
+		UpdateExpression:          input.UpdateExpression,
+	}}
+}
+
+// addFilterNotChunk filters the chunks of values out of a query on a key's partition.
+func (b *expressionBuilder) addFilterNotChunk(sortKey string) {
+	b.filter(fmt.Sprintf("NOT begins_with(#%v, :chunk)", sortKey), sortKey)
+	b.values["chunk"] = StringValue{chunkPrefix}.ToAV()
+}
@@ -0,0 +1,188 @@
+package redimo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func chunkCount(t *testing.T, c Client, key string) (count int) {
+	items, err := c.partitionItems(key)
+	assert.NoError(t, err)
+
+	for _, item := range items {
+		if strings.HasPrefix(parseKey(item, c).sk, chunkPrefix) {
+			count++
+		}
+	}
+
+	return
+}
+
+func TestChunkedStrings(t *testing.T) {
+	plain := newClient(t)
+	c := plain.ChunkValues(10)
+
+	large := strings.Repeat("0123456789", 4) + "é"
+
+	ok, err := c.SET("page", large)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 5, chunkCount(t, c, "page"))
+
+	val, err := c.GET("page")
+	assert.NoError(t, err)
+	assert.Equal(t, large, val.String())
+
+	val, err = plain.GET("page")
+	assert.NoError(t, err)
+	assert.Equal(t, large, val.String())
+
+	values, err := c.MGET("page")
+	assert.NoError(t, err)
+	assert.Equal(t, large, values["page"].String())
+
+	ok, err = c.SET("page", "other", IfNotExists)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 5, chunkCount(t, c, "page"))
+
+	_, err = c.SET("page", large+large)
+	assert.NoError(t, err)
+	assert.Equal(t, 9, chunkCount(t, c, "page"))
+
+	old, err := c.GETSET("page", StringValue{"small"})
+	assert.NoError(t, err)
+	assert.Equal(t, large+large, old.String())
+	assert.Equal(t, 0, chunkCount(t, c, "page"))
+
+	val, err = c.GET("page")
+	assert.NoError(t, err)
+	assert.Equal(t, "small", val.String())
+
+	_, err = c.SET("page", large, EX(60))
+	assert.NoError(t, err)
+
+	ttl, err := c.TTL("page")
+	assert.NoError(t, err)
+	assert.True(t, ttl > 0)
+
+	items, err := c.partitionItems("page")
+	assert.NoError(t, err)
+
+	for _, item := range items {
+		_, hasTTL := item[c.ttlAttribute]
+		assert.True(t, hasTTL)
+	}
+
+	deleted, err := c.DEL("page")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	assert.Equal(t, 0, chunkCount(t, c, "page"))
+
+	_, err = c.TransactionActions(3).SET("page", large)
+	assert.Equal(t, ErrTooManyActions, err)
+
+	_, err = plain.ChunkValues(256*1024).SET("page", strings.Repeat("x", 5*1024*1024))
+	assert.Equal(t, ErrItemTooLarge, err)
+}
+
+func TestChunkedWriteRace(t *testing.T) {
+	c := newClient(t).ChunkValues(10)
+
+	_, err := c.SET("page", strings.Repeat("a", 30))
+	assert.NoError(t, err)
+
+	service := &transactHookService{DynamoDBAPI: c.ddbClient}
+	hooked := c
+	hooked.ddbClient = service
+	service.beforeTransact = func() {
+		service.beforeTransact = nil
+
+		_, err := c.SET("page", strings.Repeat("b", 40))
+		assert.NoError(t, err)
+	}
+
+	old, err := hooked.GETSET("page", StringValue{strings.Repeat("c", 30)})
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("b", 40), old.String())
+	assert.Equal(t, 3, chunkCount(t, c, "page"))
+
+	val, err := c.GET("page")
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("c", 30), val.String())
+}
+
+func TestChunkedHashes(t *testing.T) {
+	c := newClient(t).ChunkValues(4)
+
+	large := []byte("a larger value")
+
+	saved, err := c.HSET("hash", map[string]Value{"large": BytesValue{large}, "small": StringValue{"s"}})
+	assert.NoError(t, err)
+	assert.Len(t, saved, 2)
+	assert.Equal(t, 4, chunkCount(t, c, "hash"))
+
+	val, err := c.HGET("hash", "large")
+	assert.NoError(t, err)
+	assert.Equal(t, large, val.Bytes())
+
+	all, err := c.HGETALL("hash")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]ReturnValue{"large": {BytesValue{large}.ToAV()}, "small": {StringValue{"s"}.ToAV()}}, all)
+
+	values, err := c.HMGET("hash", "large")
+	assert.NoError(t, err)
+	assert.Equal(t, large, values["large"].Bytes())
+
+	keys, err := c.HKEYS("hash")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"large", "small"}, keys)
+
+	count, err := c.HLEN("hash")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), count)
+
+	keyType, err := c.TYPE("hash")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeHash, keyType)
+
+	saved, err = c.HSET("hash", map[string]Value{"large": StringValue{"tiny"}})
+	assert.NoError(t, err)
+	assert.Empty(t, saved)
+	assert.Equal(t, 0, chunkCount(t, c, "hash"))
+
+	_, err = c.HSET("hash", map[string]Value{"large": BytesValue{large}})
+	assert.NoError(t, err)
+
+	deleted, err := c.HDEL("hash", "large")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"large"}, deleted)
+	assert.Equal(t, 0, chunkCount(t, c, "hash"))
+}
+
+func TestChunkedStreams(t *testing.T) {
+	c := newClient(t).ChunkValues(8)
+
+	large := strings.Repeat("stream", 5)
+
+	id, err := c.XADD("stream", XAutoID, map[string]Value{"body": StringValue{large}, "kind": StringValue{"page"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, chunkCount(t, c, "stream"))
+
+	items, err := c.XRANGE("stream", XStart, XEnd, 10)
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, large, items[0].Fields["body"].String())
+	assert.Equal(t, "page", items[0].Fields["kind"].String())
+
+	count, err := c.XLEN("stream", XStart, XEnd)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), count)
+
+	deleted, err := c.XDEL("stream", id)
+	assert.NoError(t, err)
+	assert.Equal(t, []XID{id}, deleted)
+	assert.Equal(t, 0, chunkCount(t, c, "stream"))
+}
@@ -0,0 +1,167 @@
+package redimo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec compresses values for CompressValues. Implementations must be safe for concurrent use.
+type Codec interface {
+	// Name identifies the codec in the values it compressed, so it must not change once data is written.
+	Name() string
+
+	// Compress returns the compressed form of the data.
+	Compress(data []byte) ([]byte, error)
+
+	// Decompress returns the data that was compressed.
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	// Gzip compresses values with gzip at the default level.
+	Gzip Codec = gzipCodec{}
+
+	// Zstd compresses values with Zstandard at the default level, which is both faster and smaller than
+	// Gzip for most data.
+	Zstd Codec = zstdCodec{}
+)
+
+// codecs are the codecs every client can decompress values with.
+var codecs = map[string]Codec{Gzip.Name(): Gzip, Zstd.Name(): Zstd}
+
+// CompressValues returns a copy of the client that compresses string and bytes values larger than
+// threshold bytes with the codec, unless that fails to make them smaller. A nil codec turns compression
+// off, the default. SET, GETSET, MSET, HSET, HMSET, HSETNX and XADD compress values, as do SET, HSET
+// and XADD in transactions, but every client decompresses values compressed with Gzip or Zstd on read,
+// and those written without compression stay readable as they are, so compression can be turned on
+// for an existing table. Values compressed with another codec can only be read by clients with that
+// codec.
+//
+// Compression runs before ChunkValues and OffloadValues, whose sizes then apply to the compressed
+// value. Compressed values are stored as binary, so commands that work on the stored value, such as
+// APPEND, INCR, GETRANGE and STRLEN, and the other commands that don't compress, see them as they are
+// stored rather than as the original value.
+func (c Client) CompressValues(codec Codec, threshold int) Client {
+	if threshold < 0 {
+		threshold = 0
+	}
+
+	c.codec = codec
+	c.codecThreshold = threshold
+
+	return c
+}
+
+// compress returns the compressed data and the name of the codec, if the client compresses values of
+// its size and compression makes it smaller. Otherwise it returns the data as it is.
+func (c Client) compress(data []byte) (compressed []byte, codec string, err error) {
+	if c.codec == nil || len(data) <= c.codecThreshold {
+		return data, "", nil
+	}
+
+	compressed, err = c.codec.Compress(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("couldn't compress value with %v: %w", c.codec.Name(), err)
+	}
+
+	if len(compressed) >= len(data) {
+		return data, "", nil
+	}
+
+	return compressed, c.codec.Name(), nil
+}
+
+// decompress returns the data that was compressed with the codec.
+func (c Client) decompress(data []byte, codec string) ([]byte, error) {
+	decompressor, ok := codecs[codec]
+	if c.codec != nil && c.codec.Name() == codec {
+		decompressor, ok = c.codec, true
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("couldn't decompress value: unknown codec %q", codec)
+	}
+
+	data, err := decompressor.Decompress(data)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decompress value with %v: %w", codec, err)
+	}
+
+	return data, nil
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return "gzip" }
+
+func (gzipCodec) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// The zstd encoder and decoder are safe for concurrent use of EncodeAll and DecodeAll, so they are
+// shared, and created on first use.
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+type zstdCodec struct{}
+
+func (zstdCodec) init() error {
+	zstdOnce.Do(func() {
+		if zstdEncoder, zstdErr = zstd.NewWriter(nil); zstdErr != nil {
+			return
+		}
+
+		zstdDecoder, zstdErr = zstd.NewReader(nil)
+	})
+
+	return zstdErr
+}
+
+func (zstdCodec) Name() string { return "zstd" }
+
+func (z zstdCodec) Compress(data []byte) ([]byte, error) {
+	if err := z.init(); err != nil {
+		return nil, err
+	}
+
+	return zstdEncoder.EncodeAll(data, nil), nil
+}
+
+func (z zstdCodec) Decompress(data []byte) ([]byte, error) {
+	if err := z.init(); err != nil {
+		return nil, err
+	}
+
+	return zstdDecoder.DecodeAll(data, nil)
+}
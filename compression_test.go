@@ -0,0 +1,152 @@
+package redimo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// doubleCodec compresses values that are a string repeated twice.
+type doubleCodec struct{}
+
+func (doubleCodec) Name() string { return "double" }
+
+func (doubleCodec) Compress(data []byte) ([]byte, error) {
+	return data[:len(data)/2], nil
+}
+
+func (doubleCodec) Decompress(data []byte) ([]byte, error) {
+	return append(data, data...), nil
+}
+
+func storedValue(t *testing.T, c Client, key string) types.AttributeValue {
+	items, err := c.partitionItems(key)
+	assert.NoError(t, err)
+
+	for _, item := range items {
+		if !strings.HasPrefix(parseKey(item, c).sk, chunkPrefix) {
+			return item[vk]
+		}
+	}
+
+	return nil
+}
+
+func TestCodecs(t *testing.T) {
+	data := []byte(strings.Repeat(`{"name":"redimo"},`, 100))
+
+	for _, codec := range []Codec{Gzip, Zstd} {
+		compressed, err := codec.Compress(data)
+		assert.NoError(t, err)
+		assert.True(t, len(compressed) < len(data), codec.Name())
+
+		decompressed, err := codec.Decompress(compressed)
+		assert.NoError(t, err)
+		assert.Equal(t, data, decompressed)
+
+		_, err = codec.Decompress([]byte("not compressed"))
+		assert.Error(t, err)
+	}
+}
+
+func TestCompressedStrings(t *testing.T) {
+	plain := newClient(t)
+	c := plain.CompressValues(Zstd, 64)
+
+	large := strings.Repeat(`{"field":"value"}`, 20)
+
+	_, err := plain.SET("old", large)
+	assert.NoError(t, err)
+	_, err = c.SET("large", large)
+	assert.NoError(t, err)
+	_, err = c.SET("small", "small")
+	assert.NoError(t, err)
+
+	_, compressed := parseEncodedValue(storedValue(t, c, "large"))
+	assert.True(t, compressed)
+	_, compressed = parseEncodedValue(storedValue(t, c, "small"))
+	assert.False(t, compressed)
+
+	for _, client := range []Client{c, plain, plain.CompressValues(Gzip, 0)} {
+		values, err := client.MGET("old", "large", "small")
+		assert.NoError(t, err)
+		assert.Equal(t, large, values["old"].String())
+		assert.Equal(t, large, values["large"].String())
+		assert.Equal(t, "small", values["small"].String())
+	}
+
+	old, err := c.GETSET("large", StringValue{"replaced"})
+	assert.NoError(t, err)
+	assert.Equal(t, large, old.String())
+
+	incompressible := []byte("0123456789")
+	_, err = c.CompressValues(Gzip, 0).SET("bytes", incompressible)
+	assert.NoError(t, err)
+	assert.Equal(t, BytesValue{incompressible}.ToAV(), storedValue(t, c, "bytes"))
+
+	_, err = c.CompressValues(doubleCodec{}, 0).SET("custom", "abcabc")
+	assert.NoError(t, err)
+
+	_, err = c.GET("custom")
+	assert.Error(t, err)
+
+	val, err := c.CompressValues(doubleCodec{}, 0).GET("custom")
+	assert.NoError(t, err)
+	assert.Equal(t, "abcabc", val.String())
+}
+
+func TestCompressedHashesAndStreams(t *testing.T) {
+	c := newClient(t).CompressValues(Gzip, 16)
+
+	large := []byte(strings.Repeat("compressible ", 10))
+
+	_, err := c.HSET("hash", map[string]Value{"large": BytesValue{large}, "small": StringValue{"s"}})
+	assert.NoError(t, err)
+
+	val, err := c.HGET("hash", "large")
+	assert.NoError(t, err)
+	assert.Equal(t, large, val.Bytes())
+
+	all, err := c.HGETALL("hash")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]ReturnValue{"large": {BytesValue{large}.ToAV()}, "small": {StringValue{"s"}.ToAV()}}, all)
+
+	_, err = c.XADD("stream", XAutoID, map[string]Value{"body": StringValue{string(large)}})
+	assert.NoError(t, err)
+
+	items, err := c.XRANGE("stream", XStart, XEnd, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, string(large), items[0].Fields["body"].String())
+}
+
+func TestCompressedChunksAndBlobs(t *testing.T) {
+	store := FileBlobStore{Dir: t.TempDir()}
+	c := newClient(t).CompressValues(Zstd, 0).ChunkValues(8)
+
+	large := strings.Repeat("chunked and compressed ", 20)
+
+	_, err := c.SET("chunked", large)
+	assert.NoError(t, err)
+	assert.True(t, chunkCount(t, c, "chunked") < (len(large)+7)/8)
+
+	val, err := c.GET("chunked")
+	assert.NoError(t, err)
+	assert.Equal(t, large, val.String())
+
+	c = c.OffloadValues(store, 8)
+
+	_, err = c.SET("offloaded", large)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, blobCount(t, store))
+
+	val, err = c.GET("offloaded")
+	assert.NoError(t, err)
+	assert.Equal(t, large, val.String())
+
+	_, err = c.DEL("chunked", "offloaded")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, blobCount(t, store))
+	assert.Equal(t, 0, chunkCount(t, c, "chunked"))
+}
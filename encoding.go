@@ -0,0 +1,287 @@
+package redimo
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Values written by SET, HSET and XADD may be compressed, encrypted, and chunked or offloaded, in that
+// order. What takes the place of the value in its item describes how to get it back: a chunk manifest,
+// a blob pointer, or, for values that are only compressed or encrypted, an encoded value that holds
+// the data itself. Values that need none of this are stored as they are.
+
+const (
+	// compressedValueKey is the only key of the map stored in place of a compressed value.
+	compressedValueKey = "_redimo/compressed"
+
+	// encryptedValueKey is the only key of the map stored in place of an encrypted value.
+	encryptedValueKey = "_redimo/encrypted"
+)
+
+// valueSlot is where a value is stored: the key and sort key of its item, and the attribute that holds
+// it. Encrypted values are bound to their slot. The fields of a stream item are stored before its ID
+// is known, so their slots have no sort key.
+type valueSlot struct {
+	key       string
+	sk        string
+	attribute string
+}
+
+func itemSlot(key string, sk string) valueSlot {
+	return valueSlot{key: key, sk: sk, attribute: vk}
+}
+
+func streamFieldSlot(key string, field string) valueSlot {
+	return valueSlot{key: key, attribute: "_" + field}
+}
+
+// valueEncoding records how the stored data of a value was derived from the original value.
+type valueEncoding struct {
+	binary  bool
+	codec   string
+	keyID   string
+	dataKey []byte
+	nonce   []byte
+}
+
+func (e valueEncoding) put(inner map[string]types.AttributeValue) {
+	inner["type"] = &types.AttributeValueMemberS{Value: "S"}
+	if e.binary {
+		inner["type"] = &types.AttributeValueMemberS{Value: "B"}
+	}
+
+	if e.codec != "" {
+		inner["codec"] = &types.AttributeValueMemberS{Value: e.codec}
+	}
+
+	if e.keyID != "" {
+		inner["kid"] = &types.AttributeValueMemberS{Value: e.keyID}
+		inner["dek"] = &types.AttributeValueMemberB{Value: e.dataKey}
+		inner["nonce"] = &types.AttributeValueMemberB{Value: e.nonce}
+	}
+}
+
+func parseValueEncoding(inner map[string]types.AttributeValue) (e valueEncoding) {
+	e.binary = ReturnValue{inner["type"]}.String() == "B"
+	e.codec = ReturnValue{inner["codec"]}.String()
+	e.keyID = ReturnValue{inner["kid"]}.String()
+	e.dataKey = ReturnValue{inner["dek"]}.Bytes()
+	e.nonce = ReturnValue{inner["nonce"]}.Bytes()
+
+	return e
+}
+
+func (e valueEncoding) encrypted() bool {
+	return e.keyID != ""
+}
+
+// encodedValue is a compressed or encrypted value that is neither chunked nor offloaded.
+type encodedValue struct {
+	data []byte
+	valueEncoding
+}
+
+func (v encodedValue) toAV() types.AttributeValue {
+	inner := map[string]types.AttributeValue{
+		"data": &types.AttributeValueMemberB{Value: v.data},
+	}
+
+	v.valueEncoding.put(inner)
+
+	name := compressedValueKey
+	if v.encrypted() {
+		name = encryptedValueKey
+	}
+
+	return &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+		name: &types.AttributeValueMemberM{Value: inner},
+	}}
+}
+
+func parseEncodedValue(av types.AttributeValue) (v encodedValue, ok bool) {
+	outer, ok := av.(*types.AttributeValueMemberM)
+	if !ok || len(outer.Value) != 1 {
+		return v, false
+	}
+
+	inner, ok := outer.Value[compressedValueKey].(*types.AttributeValueMemberM)
+	if !ok {
+		if inner, ok = outer.Value[encryptedValueKey].(*types.AttributeValueMemberM); !ok {
+			return v, false
+		}
+	}
+
+	v.data = ReturnValue{inner.Value["data"]}.Bytes()
+	v.valueEncoding = parseValueEncoding(inner.Value)
+
+	return v, v.codec != "" || v.encrypted()
+}
+
+// valueBytes returns the content of string and bytes attribute values.
+func valueBytes(av types.AttributeValue) (data []byte, binary bool, ok bool) {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return []byte(v.Value), false, true
+	case *types.AttributeValueMemberB:
+		return v.Value, true, true
+	}
+
+	return nil, false, false
+}
+
+// storeAV returns the attribute value to store in the slot in place of av: a pointer to a blob, if the
+// value is offloaded, the manifest of its chunks, along with the actions that put the chunks, or the
+// encoded value. The blob is put and referenced before the pointer is written, so a pointer that is
+// not written in the end must be released with abandonAV. Maps with reserved keys are rejected, since
+// they would be taken for what storeAV returns.
+func (c Client) storeAV(slot valueSlot, av types.AttributeValue, expiry types.AttributeValue) (stored types.AttributeValue, puts []types.TransactWriteItem, err error) {
+	if err = checkReservedKeys(av); err != nil {
+		return nil, nil, err
+	}
+
+	data, binary, ok := valueBytes(av)
+	if !ok {
+		return av, nil, nil
+	}
+
+	enc := valueEncoding{binary: binary}
+
+	if data, enc.codec, err = c.compress(data); err != nil {
+		return nil, nil, err
+	}
+
+	if data, err = c.encrypt(slot, data, &enc); err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case c.offloaded(data):
+		stored, err = c.offload(data, enc)
+		return stored, nil, err
+	case c.chunked(data):
+		stored, puts = c.chunk(slot.key, data, enc, expiry)
+		return stored, puts, nil
+	case enc.codec != "" || enc.encrypted():
+		return encodedValue{data: data, valueEncoding: enc}.toAV(), nil, nil
+	}
+
+	return av, nil, nil
+}
+
+// abandonAV releases the blob referenced by a pointer that storeAV returned but was never written.
+// Chunks are written along with their manifest, so there is nothing to do for them.
+func (c Client) abandonAV(stored types.AttributeValue) error {
+	if p, ok := parseBlobPointer(stored); ok {
+		return c.releaseBlob(p)
+	}
+
+	return nil
+}
+
+// loadAV returns the value the attribute value in the slot stands for, reading it from the blob store
+// if it is a pointer, or reassembling its chunks if it is a manifest, and decoding it.
+func (c Client) loadAV(slot valueSlot, av types.AttributeValue) (types.AttributeValue, error) {
+	var (
+		data []byte
+		enc  valueEncoding
+		err  error
+	)
+
+	if m, ok := parseChunkManifest(av); ok {
+		data, err = c.unchunk(slot.key, m)
+		enc = m.valueEncoding
+	} else if p, ok := parseBlobPointer(av); ok {
+		data, err = c.unoffload(p)
+		enc = p.valueEncoding
+	} else if v, ok := parseEncodedValue(av); ok {
+		data, enc = v.data, v.valueEncoding
+	} else {
+		return av, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c.decode(slot, data, enc)
+}
+
+func (c Client) loadValue(slot valueSlot, val ReturnValue) (ReturnValue, error) {
+	av, err := c.loadAV(slot, val.av)
+	return ReturnValue{av}, err
+}
+
+// decode returns the string or bytes attribute value of the stored data, decrypting and decompressing
+// it first if it was encrypted or compressed.
+func (c Client) decode(slot valueSlot, data []byte, enc valueEncoding) (types.AttributeValue, error) {
+	var err error
+
+	if enc.encrypted() {
+		if data, err = c.decrypt(slot, data, enc); err != nil {
+			return nil, err
+		}
+	}
+
+	if enc.codec != "" {
+		if data, err = c.decompress(data, enc.codec); err != nil {
+			return nil, err
+		}
+	}
+
+	if enc.binary {
+		return &types.AttributeValueMemberB{Value: data}, nil
+	}
+
+	return &types.AttributeValueMemberS{Value: string(data)}, nil
+}
+
+// releasable reports whether the stored value is a pointer to a blob or the manifest of chunks, which
+// must be released with releaseAV once the value is overwritten or deleted.
+func releasable(av types.AttributeValue) bool {
+	if _, ok := parseBlobPointer(av); ok {
+		return true
+	}
+
+	_, ok := parseChunkManifest(av)
+
+	return ok
+}
+
+// addConditionValueUnchanged requires that the value of the item is still the one read as old, for
+// writes that overwrite it in a transaction, which can't return the value it replaced: the same pointer
+// or manifest if old was releasable, and otherwise a value that isn't. The value released once the
+// write is done is then the one it replaced.
+func (b *expressionBuilder) addConditionValueUnchanged(old types.AttributeValue) {
+	if releasable(old) {
+		b.condition(fmt.Sprintf("#%v = :old", vk), vk)
+		b.values["old"] = old
+
+		return
+	}
+
+	b.alias("blobPointer", blobPointerKey)
+	b.alias("chunkManifest", chunkManifestKey)
+	b.condition(fmt.Sprintf("NOT (attribute_exists(#%[1]v.#blobPointer) OR attribute_exists(#%[1]v.#chunkManifest))", vk), vk)
+}
+
+// abandonAVs abandons the stored values that were not written, by key, stopping at the first error.
+func (c Client) abandonAVs(stored map[string]types.AttributeValue) error {
+	for _, av := range stored {
+		if err := c.abandonAV(av); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// releaseAV releases what a value that is being overwritten or deleted stands for: the blob it points
+// to, or its chunks.
+func (c Client) releaseAV(key string, av types.AttributeValue) error {
+	if p, ok := parseBlobPointer(av); ok {
+		return c.releaseBlob(p)
+	}
+
+	return c.deleteChunks(key, av)
+}
@@ -0,0 +1,246 @@
+package redimo
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// KeyProvider creates and unwraps the data keys that EncryptValues encrypts values with. It is backed
+// by master keys that never leave it, such as those of AWS KMS, each with an ID, so that keys can be
+// rotated while values encrypted with older keys stay readable. Implementations must be safe for
+// concurrent use.
+type KeyProvider interface {
+	// GenerateDataKey returns a new random 32 byte data key, the data key wrapped with the current
+	// master key, and the ID of that master key.
+	GenerateDataKey(ctx context.Context) (keyID string, dataKey []byte, wrapped []byte, err error)
+
+	// DecryptDataKey returns the data key that was wrapped with the master key of the ID.
+	DecryptDataKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// EncryptValues returns a copy of the client that encrypts string and bytes values with AES-GCM before
+// storing them, independently of the table's encryption at rest. Each value gets its own data key from
+// the provider, which is stored wrapped along with the ID of its master key, and its ciphertext is
+// bound to its key, sort key and attribute, so that it can't be read in place of another value. A nil
+// provider turns encryption off, the default.
+//
+// SET, GETSET, MSET, HSET, HMSET, HSETNX and XADD encrypt values, as do SET, HSET and XADD in
+// transactions, and reading them back needs a client with a provider that knows their master keys.
+// Values written without encryption stay readable as they are. COPY and RENAME re-encrypt the values
+// they move for their new key. Encryption runs after CompressValues and before ChunkValues and
+// OffloadValues. Encrypted values are stored as binary, so commands that work on the stored value,
+// such as APPEND, INCR, GETRANGE and STRLEN, and the other commands that don't encrypt, store or see
+// them in plaintext or as they are stored.
+func (c Client) EncryptValues(keys KeyProvider) Client {
+	c.keys = keys
+	return c
+}
+
+// associatedData is what an encrypted value is bound to: the slot it is stored in, namespace included.
+func (c Client) associatedData(slot valueSlot) []byte {
+	var ad []byte
+
+	for _, part := range []string{c.namespaced(slot.key), slot.sk, slot.attribute} {
+		size := make([]byte, binary.MaxVarintLen64)
+		ad = append(ad, size[:binary.PutUvarint(size, uint64(len(part)))]...)
+		ad = append(ad, part...)
+	}
+
+	return ad
+}
+
+// encrypt encrypts the data for the slot with a new data key, and records the key in the encoding, if
+// the client encrypts values. Otherwise it returns the data as it is.
+func (c Client) encrypt(slot valueSlot, data []byte, enc *valueEncoding) ([]byte, error) {
+	if c.keys == nil {
+		return data, nil
+	}
+
+	keyID, dataKey, wrapped, err := c.keys.GenerateDataKey(c.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't generate data key: %w", err)
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := randomBytes(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+
+	enc.keyID, enc.dataKey, enc.nonce = keyID, wrapped, nonce
+
+	return aead.Seal(nil, nonce, data, c.associatedData(slot)), nil
+}
+
+// decrypt returns the data that was encrypted for the slot.
+func (c Client) decrypt(slot valueSlot, data []byte, enc valueEncoding) ([]byte, error) {
+	if c.keys == nil {
+		return nil, ErrNoKeyProvider
+	}
+
+	dataKey, err := c.keys.DecryptDataKey(c.ctx, enc.keyID, enc.dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decrypt data key of %v: %w", enc.keyID, err)
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = aead.Open(nil, enc.nonce, data, c.associatedData(slot))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decrypt value: %w", err)
+	}
+
+	return data, nil
+}
+
+// storedEncoding returns the encoding of a stored value, if it has one.
+func storedEncoding(av types.AttributeValue) (enc valueEncoding, ok bool) {
+	if m, ok := parseChunkManifest(av); ok {
+		return m.valueEncoding, true
+	}
+
+	if p, ok := parseBlobPointer(av); ok {
+		return p.valueEncoding, true
+	}
+
+	if v, ok := parseEncodedValue(av); ok {
+		return v.valueEncoding, true
+	}
+
+	return enc, false
+}
+
+// rebindItem re-encrypts the encrypted values of an item that is being moved from the partition pk to
+// newPK, since they are bound to where they are stored. It returns the actions that put the chunks of
+// the re-encrypted values, and the chunks and blobs of the values they replace, which the move must
+// not copy and must release.
+func (c Client) rebindItem(item map[string]types.AttributeValue, pk string, newPK string) (puts []types.TransactWriteItem, chunkPrefixes []string, pointers []blobPointer, err error) {
+	for name, av := range item {
+		if name != vk && !strings.HasPrefix(name, "_") {
+			continue
+		}
+
+		if enc, ok := storedEncoding(av); !ok || !enc.encrypted() {
+			continue
+		}
+
+		slot := valueSlot{key: pk, attribute: name}
+		if name == vk {
+			slot.sk = parseKey(item, c).sk
+		}
+
+		plain, err := c.loadAV(slot, av)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		slot.key = newPK
+
+		stored, valuePuts, err := c.storeAV(slot, plain, item[expiryAttribute])
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if m, ok := parseChunkManifest(av); ok {
+			chunkPrefixes = append(chunkPrefixes, m.prefix())
+		}
+
+		if p, ok := parseBlobPointer(av); ok {
+			pointers = append(pointers, p)
+		}
+
+		item[name] = stored
+		puts = append(puts, valuePuts...)
+	}
+
+	return puts, chunkPrefixes, pointers, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// StaticKeyProvider is a KeyProvider with master keys held in memory, such as keys loaded from a
+// secrets manager at startup. Data keys are wrapped with AES-GCM, bound to the ID of their master key.
+//
+// To rotate keys, add a new key to Keys and make it the KeyID. Values encrypted with the old key stay
+// readable as long as it is in Keys, and are encrypted with the new key when they are next written.
+type StaticKeyProvider struct {
+	// Keys maps key IDs to AES master keys of 16, 24 or 32 bytes.
+	Keys map[string][]byte
+
+	// KeyID is the ID of the key that new data keys are wrapped with.
+	KeyID string
+}
+
+var _ KeyProvider = StaticKeyProvider{}
+
+func (p StaticKeyProvider) gcm(keyID string) (cipher.AEAD, error) {
+	key, ok := p.Keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", keyID)
+	}
+
+	return newGCM(key)
+}
+
+// GenerateDataKey creates a data key and wraps it with the key of KeyID.
+func (p StaticKeyProvider) GenerateDataKey(ctx context.Context) (keyID string, dataKey []byte, wrapped []byte, err error) {
+	aead, err := p.gcm(p.KeyID)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	if dataKey, err = randomBytes(32); err != nil {
+		return "", nil, nil, err
+	}
+
+	nonce, err := randomBytes(aead.NonceSize())
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	return p.KeyID, dataKey, aead.Seal(nonce, nonce, dataKey, []byte(p.KeyID)), nil
+}
+
+// DecryptDataKey unwraps a data key with the key of the ID.
+func (p StaticKeyProvider) DecryptDataKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, err := p.gcm(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wrapped) < aead.NonceSize() {
+		return nil, fmt.Errorf("wrapped data key is too short")
+	}
+
+	return aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(keyID))
+}
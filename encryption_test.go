@@ -0,0 +1,251 @@
+package redimo
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+)
+
+func testKeys() StaticKeyProvider {
+	return StaticKeyProvider{
+		Keys:  map[string][]byte{"2020": bytes.Repeat([]byte{1}, 32)},
+		KeyID: "2020",
+	}
+}
+
+func TestStaticKeyProvider(t *testing.T) {
+	ctx := context.Background()
+	keys := testKeys()
+
+	keyID, dataKey, wrapped, err := keys.GenerateDataKey(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "2020", keyID)
+	assert.Len(t, dataKey, 32)
+	assert.NotContains(t, string(wrapped), string(dataKey))
+
+	unwrapped, err := keys.DecryptDataKey(ctx, keyID, wrapped)
+	assert.NoError(t, err)
+	assert.Equal(t, dataKey, unwrapped)
+
+	keys.Keys["2021"] = bytes.Repeat([]byte{2}, 16)
+
+	_, err = keys.DecryptDataKey(ctx, "2021", wrapped)
+	assert.Error(t, err)
+
+	_, err = keys.DecryptDataKey(ctx, "2019", wrapped)
+	assert.Error(t, err)
+
+	_, _, _, err = StaticKeyProvider{KeyID: "missing"}.GenerateDataKey(ctx)
+	assert.Error(t, err)
+}
+
+func TestEncryptedValues(t *testing.T) {
+	plain := newClient(t)
+	c := plain.EncryptValues(testKeys())
+
+	_, err := plain.SET("old", "plaintext")
+	assert.NoError(t, err)
+	_, err = c.SET("secret", "123-45-6789")
+	assert.NoError(t, err)
+	_, err = c.HSET("person", map[string]Value{"ssn": StringValue{"123-45-6789"}, "photo": BytesValue{[]byte{1, 2, 3}}})
+	assert.NoError(t, err)
+
+	stored := storedValue(t, c, "secret")
+	assert.NotContains(t, ReturnValue{stored}.String(), "6789")
+
+	v, ok := parseEncodedValue(stored)
+	assert.True(t, ok)
+	assert.Equal(t, "2020", v.keyID)
+
+	values, err := c.MGET("old", "secret")
+	assert.NoError(t, err)
+	assert.Equal(t, "plaintext", values["old"].String())
+	assert.Equal(t, "123-45-6789", values["secret"].String())
+
+	_, err = plain.GET("secret")
+	assert.Equal(t, ErrNoKeyProvider, err)
+
+	all, err := c.HGETALL("person")
+	assert.NoError(t, err)
+	assert.Equal(t, "123-45-6789", all["ssn"].String())
+	assert.Equal(t, []byte{1, 2, 3}, all["photo"].Bytes())
+
+	// Ciphertext copied to another field doesn't decrypt there.
+	item, err := c.partitionItems("person")
+	assert.NoError(t, err)
+
+	for _, i := range item {
+		if parseKey(i, c).sk == "ssn" {
+			i[c.sortKey] = StringValue{"photo"}.ToAV()
+			_, err = c.ddbClient.PutItem(context.Background(), &dynamodb.PutItemInput{Item: i, TableName: aws.String(c.tableName)})
+			assert.NoError(t, err)
+		}
+	}
+
+	_, err = c.HGET("person", "photo")
+	assert.Error(t, err)
+
+	id, err := c.XADD("stream", XAutoID, map[string]Value{"body": StringValue{"secret body"}})
+	assert.NoError(t, err)
+
+	items, err := c.XRANGE("stream", id, id, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret body", items[0].Fields["body"].String())
+
+	compressible := strings.Repeat(`{"ssn":"123-45-6789"}`, 10)
+	_, err = c.CompressValues(Zstd, 0).SET("compressed", compressible)
+	assert.NoError(t, err)
+
+	v, _ = parseEncodedValue(storedValue(t, c, "compressed"))
+	assert.Equal(t, "zstd", v.codec)
+	assert.True(t, v.encrypted())
+
+	val, err := c.GET("compressed")
+	assert.NoError(t, err)
+	assert.Equal(t, compressible, val.String())
+
+	// Rotating keys keeps older values readable, and new values use the new key.
+	rotated := testKeys()
+	rotated.Keys["2021"] = bytes.Repeat([]byte{2}, 16)
+	rotated.KeyID = "2021"
+	c = plain.EncryptValues(rotated)
+
+	val, err = c.GET("secret")
+	assert.NoError(t, err)
+	assert.Equal(t, "123-45-6789", val.String())
+
+	_, err = c.SET("secret", "987-65-4321")
+	assert.NoError(t, err)
+
+	v, _ = parseEncodedValue(storedValue(t, c, "secret"))
+	assert.Equal(t, "2021", v.keyID)
+
+	_, err = plain.EncryptValues(testKeys()).GET("secret")
+	assert.Error(t, err)
+}
+
+func TestEncryptedMoves(t *testing.T) {
+	store := FileBlobStore{Dir: t.TempDir()}
+	c := newClient(t).EncryptValues(testKeys()).ChunkValues(16).OffloadValues(store, 64)
+
+	chunked := strings.Repeat("chunked ", 4)
+	offloaded := strings.Repeat("offloaded ", 10)
+
+	_, err := c.HSET("hash", map[string]Value{"chunked": StringValue{chunked}, "offloaded": StringValue{offloaded}, "small": StringValue{"small"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, blobCount(t, store))
+
+	chunks := chunkCount(t, c, "hash")
+	assert.True(t, chunks > 0)
+
+	assertHash := func(key string) {
+		all, err := c.HGETALL(key)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"chunked": chunked, "offloaded": offloaded, "small": "small"}, map[string]string{
+			"chunked":   all["chunked"].String(),
+			"offloaded": all["offloaded"].String(),
+			"small":     all["small"].String(),
+		})
+	}
+
+	ok, err := c.COPY("hash", "copy", Flags{})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 2, blobCount(t, store))
+	assert.Equal(t, chunks, chunkCount(t, c, "copy"))
+	assertHash("hash")
+	assertHash("copy")
+
+	err = c.RENAME("copy", "renamed")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, blobCount(t, store))
+	assert.Equal(t, 0, chunkCount(t, c, "copy"))
+	assert.Equal(t, chunks, chunkCount(t, c, "renamed"))
+	assertHash("renamed")
+
+	_, err = c.DEL("hash", "renamed")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, blobCount(t, store))
+}
+
+func TestEncryptedCommands(t *testing.T) {
+	c := newClient(t).EncryptValues(testKeys())
+	secret := "123-45-6789"
+
+	assertEncrypted := func(key string, attribute string) {
+		items, err := c.partitionItems(key)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, items, key)
+
+		for _, item := range items {
+			v, ok := parseEncodedValue(item[attribute])
+			assert.True(t, ok && v.encrypted(), key)
+		}
+	}
+
+	_, err := c.GETSET("getset", StringValue{secret})
+	assert.NoError(t, err)
+	assertEncrypted("getset", vk)
+
+	old, err := c.GETSET("getset", StringValue{"other"})
+	assert.NoError(t, err)
+	assert.Equal(t, secret, old.String())
+
+	assert.NoError(t, c.MSET(map[string]Value{"mset1": StringValue{secret}, "mset2": StringValue{secret}}))
+	assertEncrypted("mset1", vk)
+	assertEncrypted("mset2", vk)
+
+	ok, err := c.MSETNX(map[string]Value{"msetnx": StringValue{secret}})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assertEncrypted("msetnx", vk)
+
+	values, err := c.MGET("mset1", "mset2", "msetnx")
+	assert.NoError(t, err)
+	assert.Equal(t, secret, values["mset1"].String())
+	assert.Equal(t, secret, values["msetnx"].String())
+
+	assert.NoError(t, c.HMSET("hmset", map[string]Value{"ssn": StringValue{secret}, "photo": BytesValue{[]byte{1, 2, 3}}}))
+	assertEncrypted("hmset", vk)
+
+	ok, err = c.HSETNX("hsetnx", "ssn", StringValue{secret})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assertEncrypted("hsetnx", vk)
+
+	all, err := c.HGETALL("hmset")
+	assert.NoError(t, err)
+	assert.Equal(t, secret, all["ssn"].String())
+	assert.Equal(t, []byte{1, 2, 3}, all["photo"].Bytes())
+
+	val, err := c.HGET("hsetnx", "ssn")
+	assert.NoError(t, err)
+	assert.Equal(t, secret, val.String())
+
+	results, err := c.MULTI().
+		SET("txset", StringValue{secret}).
+		HSET("txhset", map[string]Value{"ssn": StringValue{secret}}).
+		XADD("txxadd", XAutoID, map[string]Value{"ssn": StringValue{secret}}).
+		EXEC()
+	assert.NoError(t, err)
+	assertEncrypted("txset", vk)
+	assertEncrypted("txhset", vk)
+	assertEncrypted("txxadd", "_ssn")
+
+	val, err = c.GET("txset")
+	assert.NoError(t, err)
+	assert.Equal(t, secret, val.String())
+
+	val, err = c.HGET("txhset", "ssn")
+	assert.NoError(t, err)
+	assert.Equal(t, secret, val.String())
+
+	items, err := c.XRANGE("txxadd", results[2].ID, results[2].ID, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, secret, items[0].Fields["ssn"].String())
+}
@@ -0,0 +1,245 @@
+package redimo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+var (
+	// ErrConditionFailed is returned when a write is rejected because its condition does not hold. Most
+	// commands handle this themselves and report it as a false result instead.
+	ErrConditionFailed = errors.New("redimo: condition failed")
+
+	// ErrTransactionConflict is returned when an item is being written by a concurrent transaction, or
+	// when a transaction is cancelled because of a conflicting request. It is safe to retry.
+	ErrTransactionConflict = errors.New("redimo: transaction conflict")
+
+	// ErrThrottled is returned when DynamoDB rejects a request because the table's capacity, or the
+	// account's request limit, has been exceeded. It is safe to retry after backing off.
+	ErrThrottled = errors.New("redimo: request throttled")
+
+	// ErrItemTooLarge is returned when an item exceeds DynamoDB's 400 KB item size limit, or a partition
+	// with a local secondary index exceeds its 10 GB limit.
+	ErrItemTooLarge = errors.New("redimo: item too large")
+
+	// ErrTooManyActions is returned when a transaction has more actions than DynamoDB allows, such as
+	// MGET or MSET with too many keys.
+	ErrTooManyActions = errors.New("redimo: too many actions in transaction")
+
+	// ErrWrongType is returned when a command is run against a key that holds a different type of value,
+	// by clients returned by CheckTypes.
+	ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+	// ErrNoSuchKey is returned by RENAME and RENAMENX when the key to be renamed does not exist.
+	ErrNoSuchKey = errors.New("ERR no such key")
+
+	// ErrSameKey is returned by COPY when the source and destination keys are the same.
+	ErrSameKey = errors.New("ERR source and destination objects are the same")
+
+	// ErrTxAborted is matched by the TxAbortError EXEC returns when a transaction fails.
+	ErrTxAborted = errors.New("EXECABORT Transaction discarded")
+
+	// ErrWatchConflict is matched by the TxAbortError EXEC returns when an item the transaction
+	// watched has been written since.
+	ErrWatchConflict = errors.New("redimo: watched item changed")
+
+	// ErrNoVersions is returned by WATCH when the client has no VersionAttribute.
+	ErrNoVersions = errors.New("redimo: WATCH needs a version attribute")
+
+	// ErrWatchFields is returned by WATCH when it is given no fields for a key that holds a type other
+	// than a string, as only strings are held by a single item that can be watched.
+	ErrWatchFields = errors.New("redimo: WATCH needs the fields of a key that isn't a string")
+
+	// ErrTxSameItem is returned by EXEC when more than one queued command writes the same item.
+	ErrTxSameItem = errors.New("redimo: transaction writes the same item more than once")
+
+	// ErrNoBlobStore is returned when a value offloaded to a BlobStore is read or released by a client
+	// without one. See OffloadValues.
+	ErrNoBlobStore = errors.New("redimo: value is offloaded, but the client has no blob store")
+
+	// ErrNoKeyProvider is returned when an encrypted value is read by a client without a KeyProvider.
+	// See EncryptValues.
+	ErrNoKeyProvider = errors.New("redimo: value is encrypted, but the client has no key provider")
+
+	// ErrReservedKey is returned when a value to store is a map with a key that begins with "_redimo/",
+	// at any depth. Such keys are reserved for the maps redimo stores in place of values, such as
+	// pointers to offloaded blobs and the manifests of chunked values.
+	ErrReservedKey = errors.New("redimo: map keys beginning with _redimo/ are reserved")
+
+	// ErrNoSuchPath is returned by the JSON commands when a path doesn't exist in the document.
+	ErrNoSuchPath = errors.New("ERR path does not exist")
+
+	// ErrWrongJSONType is matched by the errors the JSON commands return when the value at a path has
+	// the wrong type, such as JSONARRAPPEND on an object.
+	ErrWrongJSONType = errors.New("ERR wrong type of path value")
+)
+
+// Error is returned for DynamoDB errors that redimo recognizes. Use errors.Is with the sentinel errors
+// above to react to them, and errors.As to get at the DynamoDB error itself.
+type Error struct {
+	// Kind is the sentinel error, such as ErrConditionFailed, that describes the failure.
+	Kind error
+
+	// Err is the error returned by DynamoDB.
+	Err error
+
+	// Reasons holds the outcome of every action of a cancelled transaction, in the order of the actions.
+	Reasons []CancellationReason
+
+	// Attempts is the number of attempts made according to the client's RetryPolicy, if more than one.
+	Attempts int
+}
+
+func (e *Error) Error() string {
+	if e.Attempts > 1 {
+		return fmt.Sprintf("%v after %v attempts: %v", e.Kind, e.Attempts, e.Err)
+	}
+
+	return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error's Kind is the target sentinel error. For a cancelled transaction, that is
+// the kind of the first action that failed with a recognized reason; the reasons of the other actions
+// are in Reasons.
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// CancellationReason is the outcome of one action of a cancelled transaction.
+type CancellationReason struct {
+	// Code is DynamoDB's cancellation code, such as "ConditionalCheckFailed". It is "None" for actions
+	// that did not cause the cancellation.
+	Code string
+
+	// Message is DynamoDB's description of the failure, if any.
+	Message string
+
+	// Kind is the sentinel error matching the code, or nil if the action did not fail or redimo does
+	// not recognize the code.
+	Kind error
+}
+
+// translateError wraps the errors returned by DynamoDB that match a sentinel error in an Error, and
+// returns any other error unchanged.
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		return canceledError(err, canceled)
+	}
+
+	if kind := errorKind(err); kind != nil {
+		return &Error{Kind: kind, Err: err}
+	}
+
+	return err
+}
+
+func errorKind(err error) error {
+	var (
+		conditionFailed    *types.ConditionalCheckFailedException
+		conflict           *types.TransactionConflictException
+		inProgress         *types.TransactionInProgressException
+		throughput         *types.ProvisionedThroughputExceededException
+		requestLimit       *types.RequestLimitExceeded
+		itemCollectionSize *types.ItemCollectionSizeLimitExceededException
+		apiErr             smithy.APIError
+	)
+
+	switch {
+	case errors.As(err, &conditionFailed):
+		return ErrConditionFailed
+	case errors.As(err, &conflict), errors.As(err, &inProgress):
+		return ErrTransactionConflict
+	case errors.As(err, &throughput), errors.As(err, &requestLimit):
+		return ErrThrottled
+	case errors.As(err, &itemCollectionSize):
+		return ErrItemTooLarge
+	case errors.As(err, &apiErr):
+		switch {
+		case apiErr.ErrorCode() == "ThrottlingException":
+			return ErrThrottled
+		case apiErr.ErrorCode() != "ValidationException":
+			return nil
+		case itemTooLargeMessage(apiErr.ErrorMessage()):
+			return ErrItemTooLarge
+		case tooManyActionsMessage(apiErr.ErrorMessage()):
+			return ErrTooManyActions
+		}
+	}
+
+	return nil
+}
+
+// DynamoDB reports items over 400 KB and transactions with too many actions as a ValidationException,
+// or a ValidationError cancellation reason, with no more specific code, so they are told apart by their
+// messages, which TestTranslateError pins:
+//
+//   - "Item size has exceeded the maximum allowed size", for a PutItem, or a Put in a transaction.
+//   - "Item size to update has exceeded the maximum allowed size", for an UpdateItem, or an Update in a
+//     transaction.
+//   - "1 validation error detected: Value '[...]' at 'transactItems' failed to satisfy constraint:
+//     Member must have length less than or equal to 100", for TransactWriteItems and TransactGetItems,
+//     where the value is left out by some versions of DynamoDB Local.
+const (
+	itemTooLargePut          = "Item size has exceeded the maximum allowed size"
+	itemTooLargeUpdate       = "Item size to update has exceeded the maximum allowed size"
+	tooManyActionsMember     = "at 'transactItems' failed to satisfy constraint"
+	tooManyActionsConstraint = "Member must have length less than or equal to"
+)
+
+func itemTooLargeMessage(message string) bool {
+	return strings.Contains(message, itemTooLargePut) || strings.Contains(message, itemTooLargeUpdate)
+}
+
+func tooManyActionsMessage(message string) bool {
+	return strings.Contains(message, tooManyActionsMember) && strings.Contains(message, tooManyActionsConstraint)
+}
+
+// cancellationKinds maps the codes of transaction cancellation reasons to sentinel errors.
+var cancellationKinds = map[string]error{
+	"ConditionalCheckFailed":          ErrConditionFailed,
+	"TransactionConflict":             ErrTransactionConflict,
+	"ProvisionedThroughputExceeded":   ErrThrottled,
+	"ThrottlingError":                 ErrThrottled,
+	"ItemCollectionSizeLimitExceeded": ErrItemTooLarge,
+}
+
+// canceledError converts a TransactionCanceledException into an Error whose Kind is that of the first
+// action that failed with a recognized reason. Without one, the error is returned unchanged.
+func canceledError(err error, canceled *types.TransactionCanceledException) error {
+	e := &Error{Err: err}
+
+	for _, r := range canceled.CancellationReasons {
+		reason := CancellationReason{Code: aws.ToString(r.Code), Message: aws.ToString(r.Message)}
+
+		reason.Kind = cancellationKinds[reason.Code]
+		if reason.Code == "ValidationError" && itemTooLargeMessage(reason.Message) {
+			reason.Kind = ErrItemTooLarge
+		}
+
+		if e.Kind == nil {
+			e.Kind = reason.Kind
+		}
+
+		e.Reasons = append(e.Reasons, reason)
+	}
+
+	if e.Kind == nil {
+		return err
+	}
+
+	return e
+}
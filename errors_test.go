@@ -0,0 +1,121 @@
+package redimo
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslateError(t *testing.T) {
+	assert.Nil(t, translateError(nil))
+
+	other := errors.New("something else")
+	assert.Equal(t, other, translateError(other))
+
+	tests := []struct {
+		err  error
+		kind error
+	}{
+		{&types.ConditionalCheckFailedException{}, ErrConditionFailed},
+		{&types.TransactionConflictException{}, ErrTransactionConflict},
+		{&types.TransactionInProgressException{}, ErrTransactionConflict},
+		{&types.ProvisionedThroughputExceededException{}, ErrThrottled},
+		{&types.RequestLimitExceeded{}, ErrThrottled},
+		{&smithy.GenericAPIError{Code: "ThrottlingException"}, ErrThrottled},
+		{&types.ItemCollectionSizeLimitExceededException{}, ErrItemTooLarge},
+		// The messages DynamoDB returns, which are matched as text.
+		{&smithy.GenericAPIError{Code: "ValidationException", Message: "Item size has exceeded the maximum allowed size"}, ErrItemTooLarge},
+		{&smithy.GenericAPIError{Code: "ValidationException", Message: "Item size to update has exceeded the maximum allowed size"}, ErrItemTooLarge},
+		{&smithy.GenericAPIError{Code: "ValidationException", Message: "1 validation error detected: Value '[com.amazonaws.dynamodb.v20120810.TransactWriteItem@1]' at 'transactItems' failed to satisfy constraint: Member must have length less than or equal to 100"}, ErrTooManyActions},
+		{&smithy.GenericAPIError{Code: "ValidationException", Message: "1 validation error detected: Value at 'transactItems' failed to satisfy constraint: Member must have length less than or equal to 100"}, ErrTooManyActions},
+	}
+
+	for _, tt := range tests {
+		wrapped := &smithy.OperationError{ServiceID: "DynamoDB", OperationName: "UpdateItem", Err: tt.err}
+		err := translateError(wrapped)
+		assert.True(t, errors.Is(err, tt.kind), "%T", tt.err)
+		assert.True(t, errors.Is(err, wrapped))
+	}
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	assert.True(t, errors.As(translateError(&types.ConditionalCheckFailedException{}), &conditionFailed))
+
+	err := translateError(&types.TransactionCanceledException{CancellationReasons: []types.CancellationReason{
+		{Code: aws.String("None")},
+		{Code: aws.String("TransactionConflict")},
+		{Code: aws.String("ConditionalCheckFailed")},
+	}})
+	// Only the first failing action's reason is matched; the others are in Reasons.
+	assert.True(t, errors.Is(err, ErrTransactionConflict))
+	assert.False(t, errors.Is(err, ErrConditionFailed))
+	assert.False(t, errors.Is(err, ErrThrottled))
+
+	var e *Error
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, ErrTransactionConflict, e.Kind)
+	assert.Len(t, e.Reasons, 3)
+	assert.Nil(t, e.Reasons[0].Kind)
+
+	assert.Equal(t, ErrConditionFailed, e.Reasons[2].Kind)
+
+	err = translateError(&types.TransactionCanceledException{CancellationReasons: []types.CancellationReason{
+		{Code: aws.String("None")},
+		{Code: aws.String("ValidationError"), Message: aws.String("Item size to update has exceeded the maximum allowed size")},
+	}})
+	assert.True(t, errors.Is(err, ErrItemTooLarge))
+
+	other = translateError(&smithy.GenericAPIError{Code: "ValidationException", Message: "Item size is fine"})
+	assert.False(t, errors.Is(other, ErrItemTooLarge))
+
+	unknown := &types.TransactionCanceledException{CancellationReasons: []types.CancellationReason{{Code: aws.String("ValidationError")}}}
+	assert.Equal(t, unknown, translateError(unknown))
+}
+
+func TestTypedErrors(t *testing.T) {
+	c := newClient(t)
+
+	tooLarge := strings.Repeat("x", 500*1024)
+
+	_, err := c.HSET("h1", map[string]Value{"f1": StringValue{tooLarge}})
+	assert.True(t, errors.Is(err, ErrItemTooLarge))
+
+	err = c.MSET(map[string]Value{"k1": StringValue{"v1"}, "k2": StringValue{tooLarge}})
+	assert.True(t, errors.Is(err, ErrItemTooLarge))
+
+	keys := make([]string, maxTransactionActions+1)
+	for i := range keys {
+		keys[i] = "k"
+	}
+
+	_, err = c.MGET(keys...)
+	assert.Equal(t, ErrTooManyActions, err)
+
+	_, err = c.SET("k1", StringValue{"v1"})
+	assert.NoError(t, err)
+
+	builder := newExpresionBuilder()
+	builder.addConditionNotExists(c.partitionKey)
+
+	_, err = c.ddb().TransactWriteItems(c.ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{Item: keyDef{pk: "k2", sk: ""}.toAV(c), TableName: aws.String(c.tableName)}},
+			{Put: &types.Put{
+				ConditionExpression:      builder.conditionExpression(),
+				ExpressionAttributeNames: builder.expressionAttributeNames(),
+				Item:                     keyDef{pk: "k1", sk: ""}.toAV(c),
+				TableName:                aws.String(c.tableName),
+			}},
+		},
+	})
+
+	var e *Error
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, ErrConditionFailed, e.Kind)
+	assert.Equal(t, []string{"None", "ConditionalCheckFailed"}, []string{e.Reasons[0].Code, e.Reasons[1].Code})
+}
@@ -0,0 +1,247 @@
+package redimo
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// The placeholders of the expiry and TTL attributes, and of their values, in the update expressions
+// that stamp a key's expiry. They are distinct from the "#name" and ":name" placeholders of the
+// expression builder.
+const (
+	expiryName  = "#redimoExpiry"
+	expiryValue = ":redimoExpiry"
+	ttlName     = "#redimoTTL"
+	ttlValue    = ":redimoTTL"
+)
+
+// keyExpiry is the expiry of a key, stamped on the items written to the key's partitions. The partitions
+// are namespaced, as the service sees them.
+type keyExpiry struct {
+	partitions []keyPartition
+	expiry     types.AttributeValue
+}
+
+// covers reports whether the item at the given namespaced key belongs to the key.
+func (e keyExpiry) covers(pk string, sk string) bool {
+	for _, p := range e.partitions {
+		if p.pk == pk && (p.owns == nil || p.owns(sk)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// inheritExpiry returns a copy of the client that stamps the expiry of the key on the items it writes to
+// the key and its bookkeeping, those of the given consumer groups included, unless the write sets an
+// expiry of its own. Items added to a key after EXPIRE thereby expire with the rest of it, as they do in
+// Redis. A key without an expiry has it removed from the items updated, so that an expired item that
+// DynamoDB has not deleted yet does not take its stale expiry along. Looking up the expiry reads the
+// key's first live item, 1 RCU.
+func (c Client) inheritExpiry(key string, groups ...string) (Client, error) {
+	if internalKey(key) {
+		return c, nil
+	}
+
+	expiry, _, err := c.currentExpiry(key)
+	if err != nil {
+		return c, err
+	}
+
+	partitions := c.keyPartitions(key, groups)
+	for i := range partitions {
+		partitions[i].pk = c.namespaced(partitions[i].pk)
+	}
+
+	c.expiries = append(c.expiries[:len(c.expiries):len(c.expiries)], keyExpiry{partitions: partitions, expiry: expiry})
+
+	return c, nil
+}
+
+// currentExpiry returns the expiry of the key, or nil if it has none, and whether the key exists. The
+// items of a key share its expiry, so it is read from the first live item, one item at a time so that
+// large keys cost no more than small ones.
+func (c Client) currentExpiry(key string) (expiry types.AttributeValue, exists bool, err error) {
+	var lastEvaluatedKey map[string]types.AttributeValue
+
+	for {
+		builder := newExpresionBuilder()
+		builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(key)})
+		builder.addFilterNotExpired(expiryAttribute, time.Now())
+
+		resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
+			ConsistentRead:            aws.Bool(c.consistentReads),
+			ExclusiveStartKey:         lastEvaluatedKey,
+			ExpressionAttributeNames:  builder.expressionAttributeNames(),
+			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			FilterExpression:          builder.filterExpression(),
+			KeyConditionExpression:    builder.conditionExpression(),
+			Limit:                     aws.Int32(1),
+			ProjectionExpression:      aws.String(fmt.Sprintf("#%v", expiryAttribute)),
+			Select:                    types.SelectSpecificAttributes,
+			TableName:                 aws.String(c.tableName),
+		})
+		if err != nil {
+			return nil, false, err
+		}
+
+		if len(resp.Items) > 0 {
+			return resp.Items[0][expiryAttribute], true, nil
+		}
+
+		if len(resp.LastEvaluatedKey) == 0 {
+			return nil, false, nil
+		}
+
+		lastEvaluatedKey = resp.LastEvaluatedKey
+	}
+}
+
+// expiryOf returns the expiry to stamp on the item at the given key, nil if its key has no expiry, and
+// whether the item belongs to a key whose expiry is inherited at all.
+func (s dynamoService) expiryOf(key map[string]types.AttributeValue) (expiry types.AttributeValue, covered bool) {
+	pk := ReturnValue{key[s.partitionKey]}.String()
+	sk := recoverFromEmptySK(ReturnValue{key[s.sortKey]}.String())
+
+	for _, e := range s.expiries {
+		if e.covers(pk, sk) {
+			return e.expiry, true
+		}
+	}
+
+	return nil, false
+}
+
+// expireItem returns a copy of the item with the expiry of its key, unless it has an expiry of its own.
+func (s dynamoService) expireItem(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	expiry, _ := s.expiryOf(item)
+	if expiry == nil || item[expiryAttribute] != nil {
+		return item
+	}
+
+	expired := make(map[string]types.AttributeValue, len(item)+2)
+	for k, v := range item {
+		expired[k] = v
+	}
+
+	expired[expiryAttribute] = expiry
+	expired[s.ttlAttribute] = ttlAV(expiry)
+
+	return expired
+}
+
+// expireUpdate adds setting the expiry of the item's key, or removing it if the key has none, to the
+// update expression, unless the update sets or removes the expiry itself, and returns it with copies of
+// the attribute names and values that include the expiry's placeholders.
+func (s dynamoService) expireUpdate(key map[string]types.AttributeValue, update *string, names map[string]string,
+	values map[string]types.AttributeValue) (*string, map[string]string, map[string]types.AttributeValue) {
+	expiry, covered := s.expiryOf(key)
+	if !covered {
+		return update, names, values
+	}
+
+	for name, attribute := range names {
+		if attribute == expiryAttribute && strings.Contains(aws.ToString(update), name) {
+			return update, names, values
+		}
+	}
+
+	expiredNames := map[string]string{expiryName: expiryAttribute, ttlName: s.ttlAttribute}
+	for k, v := range names {
+		expiredNames[k] = v
+	}
+
+	if expiry == nil {
+		return addRemoveClause(update, expiryName+", "+ttlName), expiredNames, values
+	}
+
+	expiredValues := map[string]types.AttributeValue{expiryValue: expiry, ttlValue: ttlAV(expiry)}
+	for k, v := range values {
+		expiredValues[k] = v
+	}
+
+	clause := expiryName + " = " + expiryValue + ", " + ttlName + " = " + ttlValue
+
+	return addSetClause(update, clause), expiredNames, expiredValues
+}
+
+func (s dynamoService) expirePutItem(params *dynamodb.PutItemInput) *dynamodb.PutItemInput {
+	if len(s.expiries) == 0 {
+		return params
+	}
+
+	expired := *params
+	expired.Item = s.expireItem(params.Item)
+
+	return &expired
+}
+
+func (s dynamoService) expireUpdateItem(params *dynamodb.UpdateItemInput) *dynamodb.UpdateItemInput {
+	if len(s.expiries) == 0 {
+		return params
+	}
+
+	expired := *params
+	expired.UpdateExpression, expired.ExpressionAttributeNames, expired.ExpressionAttributeValues =
+		s.expireUpdate(params.Key, params.UpdateExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+
+	return &expired
+}
+
+func (s dynamoService) expireTransactWriteItems(params *dynamodb.TransactWriteItemsInput) *dynamodb.TransactWriteItemsInput {
+	if len(s.expiries) == 0 {
+		return params
+	}
+
+	expired := *params
+	expired.TransactItems = make([]types.TransactWriteItem, len(params.TransactItems))
+
+	for i, action := range params.TransactItems {
+		switch {
+		case action.Put != nil:
+			put := *action.Put
+			put.Item = s.expireItem(put.Item)
+			action.Put = &put
+		case action.Update != nil:
+			update := *action.Update
+			update.UpdateExpression, update.ExpressionAttributeNames, update.ExpressionAttributeValues =
+				s.expireUpdate(update.Key, update.UpdateExpression, update.ExpressionAttributeNames, update.ExpressionAttributeValues)
+			action.Update = &update
+		}
+
+		expired.TransactItems[i] = action
+	}
+
+	return &expired
+}
+
+func (s dynamoService) expireBatchWriteItem(params *dynamodb.BatchWriteItemInput) *dynamodb.BatchWriteItemInput {
+	if len(s.expiries) == 0 {
+		return params
+	}
+
+	expired := *params
+	expired.RequestItems = make(map[string][]types.WriteRequest, len(params.RequestItems))
+
+	for table, requests := range params.RequestItems {
+		expiredRequests := make([]types.WriteRequest, len(requests))
+
+		for i, request := range requests {
+			if request.PutRequest != nil {
+				request.PutRequest = &types.PutRequest{Item: s.expireItem(request.PutRequest.Item)}
+			}
+
+			expiredRequests[i] = request
+		}
+
+		expired.RequestItems[table] = expiredRequests
+	}
+
+	return &expired
+}
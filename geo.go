@@ -1,9 +1,9 @@
 package redimo
 
 import (
-	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
@@ -68,19 +68,39 @@ const (
 
 // GEOADD adds the given members into the key. Members are represented by a map of name to GLocation, which is just a wrapper
 // for latitude and longitude. If a member already exists, its location will be updated. The method only returns the members
-// that were added as part of the operation and did not already exist.
+// that were added as part of the operation and did not already exist, or none with BatchWrites.
 //
-// Cost is O(1) / 1 WCU for each member being added or updated.
+// Cost is O(1) / 1 WCU for each member being added or updated, plus the type check of the key.
 //
 // Works similar to https://redis.io/commands/geoadd
 func (c Client) GEOADD(key string, members map[string]GLocation) (newlyAddedMembers map[string]GLocation, err error) {
+	c, finish := c.command("GEOADD", []string{key}, members)
+	defer finish(&err)
+
+	if c, err = c.inheritExpiry(key); err != nil {
+		return
+	}
+
+	if err = c.claimType(key, TypeGeo); err != nil {
+		return
+	}
+
 	newlyAddedMembers = make(map[string]GLocation)
 
+	if c.batchWrites() {
+		scores := make(map[string]types.AttributeValue)
+		for member, location := range members {
+			scores[member] = location.toAV()
+		}
+
+		return newlyAddedMembers, c.batchPutScores(key, scores)
+	}
+
 	for member, location := range members {
 		builder := newExpresionBuilder()
 		builder.updateSetAV(c.sortKeyNum, location.toAV())
 
-		resp, err := c.ddbClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		resp, err := c.updateItem(&dynamodb.UpdateItemInput{
 			ConditionExpression:       builder.conditionExpression(),
 			ExpressionAttributeNames:  builder.expressionAttributeNames(),
 			ExpressionAttributeValues: builder.expressionAttributeValues(),
@@ -106,10 +126,13 @@ func (c Client) GEOADD(key string, members map[string]GLocation) (newlyAddedMemb
 // the members or the key is missing, ok will be false. Each GUnit also has convenience methods to convert
 // distances into other units.
 //
-// Cost is O(1) / 1 RCU for each of the two members.
+// Cost is O(1) / 1 RCU for each of the two members, plus the type check of the key.
 //
 // Works similar to https://redis.io/commands/geodist
 func (c Client) GEODIST(key string, member1, member2 string, unit GUnit) (distance float64, ok bool, err error) {
+	c, finish := c.command("GEODIST", []string{key}, member1, member2, unit)
+	defer finish(&err)
+
 	locations, err := c.GEOPOS(key, member1, member2)
 	if err != nil || len(locations) < 2 {
 		return
@@ -121,10 +144,13 @@ func (c Client) GEODIST(key string, member1, member2 string, unit GUnit) (distan
 // GEOHASH returns the Geohash strings (see https://en.wikipedia.org/wiki/Geohash) of the given members. If any members
 // were not found, they will not be present in the returned map.
 //
-// Cost is O(1) / 1 RCU for each member.
+// Cost is O(1) / 1 RCU for each member, plus the type check of the key.
 //
 // Works similar to https://redis.io/commands/geohash
 func (c Client) GEOHASH(key string, members ...string) (geohashes map[string]string, err error) {
+	c, finish := c.command("GEOHASH", []string{key}, members)
+	defer finish(&err)
+
 	geohashes = make(map[string]string)
 	locations, err := c.GEOPOS(key, members...)
 
@@ -140,14 +166,21 @@ func (c Client) GEOHASH(key string, members ...string) (geohashes map[string]str
 // GEOPOS returns the stored locations for each of the given members, as a map of member to location.
 // If a member cannot be found, it will not be present in the returned map.
 //
-// Cost is O(1) / 1 RCU for each member.
+// Cost is O(1) / 1 RCU for each member, plus the type check of the key.
 //
 // Works similar to https://redis.io/commands/geopos
 func (c Client) GEOPOS(key string, members ...string) (locations map[string]GLocation, err error) {
+	c, finish := c.command("GEOPOS", []string{key}, members)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeGeo); err != nil {
+		return
+	}
+
 	locations = make(map[string]GLocation)
 
 	for _, member := range members {
-		resp, err := c.ddbClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		resp, err := c.ddb().GetItem(c.ctx, &dynamodb.GetItemInput{
 			ConsistentRead: aws.Bool(c.consistentReads),
 			Key:            keyDef{pk: key, sk: member}.toAV(c),
 			TableName:      aws.String(c.tableName),
@@ -157,7 +190,7 @@ func (c Client) GEOPOS(key string, members ...string) (locations map[string]GLoc
 			return locations, err
 		}
 
-		if len(resp.Item) > 0 {
+		if len(resp.Item) > 0 && !c.expired(resp.Item, time.Now()) {
 			locations[member] = fromCellIDString(resp.Item[c.sortKeyNum].(*types.AttributeValueMemberN).Value)
 		}
 	}
@@ -174,16 +207,24 @@ func (c Client) GEOPOS(key string, members ...string) (locations map[string]GLoc
 // to sort the locations as required.
 //
 // Cost is O(N) where N is the number of locations inside the square / bounding box that contains the circle
-// we're searching inside.
+// we're searching inside, plus the type check of the key.
 //
 // Works similar to https://redis.io/commands/georadius
 func (c Client) GEORADIUS(key string, center GLocation, radius float64, radiusUnit GUnit, count int32) (positions map[string]GLocation, err error) {
+	c, finish := c.command("GEORADIUS", []string{key}, center, radius, radiusUnit, count)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeGeo); err != nil {
+		return
+	}
+
 	positions = make(map[string]GLocation)
 	radiusCap := s2.CapFromCenterAngle(s2.PointFromLatLng(center.s2LatLng()), s1.Angle(radiusUnit.To(Meters, radius)/earthRadiusMeters))
 
 	for _, cellID := range radiusCap.CellUnionBound() {
 		builder := newExpresionBuilder()
-		builder.addConditionEquality(c.partitionKey, StringValue{key})
+		builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(key)})
+		builder.addFilterNotExpired(expiryAttribute, time.Now())
 		builder.condition(fmt.Sprintf("#%v BETWEEN :start AND :stop", c.sortKeyNum), c.sortKeyNum)
 		builder.values["start"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", cellID.RangeMin())}
 		builder.values["stop"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", cellID.RangeMax())}
@@ -193,12 +234,13 @@ func (c Client) GEORADIUS(key string, center GLocation, radius float64, radiusUn
 		hasMoreResults := true
 
 		for hasMoreResults && count > 0 {
-			resp, err := c.ddbClient.Query(context.TODO(), &dynamodb.QueryInput{
+			resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
 				ConsistentRead:            aws.Bool(c.consistentReads),
 				ExclusiveStartKey:         cursor,
 				ExpressionAttributeNames:  builder.expressionAttributeNames(),
 				ExpressionAttributeValues: builder.expressionAttributeValues(),
 				IndexName:                 aws.String(c.indexName),
+				FilterExpression:          builder.filterExpression(),
 				KeyConditionExpression:    builder.conditionExpression(),
 				Limit:                     aws.Int32(count),
 				TableName:                 aws.String(c.tableName),
@@ -237,10 +279,13 @@ func (c Client) GEORADIUS(key string, center GLocation, radius float64, radiusUn
 // to sort the locations as required.
 //
 // Cost is O(N) where N is the number of locations inside the square / bounding box that contains the circle
-// we're searching inside.
+// we're searching inside, plus the type check of the key.
 //
 // Works similar to https://redis.io/commands/georadiusbymember
 func (c Client) GEORADIUSBYMEMBER(key string, member string, radius float64, radiusUnit GUnit, count int32) (positions map[string]GLocation, err error) {
+	c, finish := c.command("GEORADIUSBYMEMBER", []string{key}, member, radius, radiusUnit, count)
+	defer finish(&err)
+
 	locations, err := c.GEOPOS(key, member)
 	if err == nil {
 		positions, err = c.GEORADIUS(key, locations[member], radius, radiusUnit, count)
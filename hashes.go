@@ -1,8 +1,9 @@
 package redimo
 
 import (
-	"context"
+	"errors"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
@@ -10,86 +11,183 @@ import (
 )
 
 func (c Client) HGET(key string, field string) (val ReturnValue, err error) {
-	resp, err := c.ddbClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+	c, finish := c.command("HGET", []string{key}, field)
+	defer finish(&err)
+
+	cached, ok, fill := c.cached("HGET", key, field)
+	if ok {
+		return cached.(ReturnValue), nil
+	}
+
+	if err = c.checkType(key, TypeHash); err != nil {
+		return
+	}
+
+	resp, err := c.ddb().GetItem(c.ctx, &dynamodb.GetItemInput{
 		ConsistentRead: aws.Bool(c.consistentReads),
 		Key: keyDef{
 			pk: key,
 			sk: field,
 		}.toAV(c),
-		ProjectionExpression: aws.String(strings.Join([]string{vk}, ", ")),
-		TableName:            aws.String(c.tableName),
+		ExpressionAttributeNames: map[string]string{"#" + expiryAttribute: expiryAttribute},
+		ProjectionExpression:     aws.String(strings.Join([]string{vk, "#" + expiryAttribute}, ", ")),
+		TableName:                aws.String(c.tableName),
 	})
+	if err == nil && !c.expired(resp.Item, time.Now()) {
+		val, err = c.loadValue(itemSlot(key, field), parseItem(resp.Item, c).val)
+	}
+
 	if err == nil {
-		val = parseItem(resp.Item, c).val
+		fill(val, avSize(val.av), c.itemExpiry(resp.Item))
 	}
 
 	return
 }
 
 func (c Client) HSET(key string, vFieldMap interface{}) (newlySavedFields map[string]Value, err error) {
+	c, finish := c.command("HSET", []string{key}, vFieldMap)
+	defer finish(&err)
+
 	fieldMap, err := ToValueMapE(vFieldMap)
 	if err != nil {
 		return newlySavedFields, err
 	}
 
+	if c, err = c.inheritExpiry(key); err != nil {
+		return
+	}
+
+	if err = c.claimType(key, TypeHash); err != nil {
+		return
+	}
+
 	newlySavedFields = make(map[string]Value)
 
 	for field, value := range fieldMap {
+		stored, chunks, err := c.storeAV(itemSlot(key, field), value.ToAV(), nil)
+		if err != nil {
+			return newlySavedFields, err
+		}
+
 		builder := newExpresionBuilder()
-		builder.updateSetAV(vk, value.ToAV())
+		builder.updateSetAV(vk, stored)
 
-		resp, err := c.ddbClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		old, err := c.updateValue(&dynamodb.UpdateItemInput{
 			ConditionExpression:       builder.conditionExpression(),
 			ExpressionAttributeNames:  builder.expressionAttributeNames(),
 			ExpressionAttributeValues: builder.expressionAttributeValues(),
 			Key:                       keyDef{pk: key, sk: field}.toAV(c),
-			ReturnValues:              types.ReturnValueAllOld,
 			TableName:                 aws.String(c.tableName),
 			UpdateExpression:          builder.updateExpression(),
-		})
+		}, chunks)
 
 		if err != nil {
 			return newlySavedFields, err
 		}
 
-		if len(resp.Attributes) < 1 {
+		if len(old) < 1 {
 			newlySavedFields[field] = value
 		}
+
+		if err = c.releaseAV(key, old[vk]); err != nil {
+			return newlySavedFields, err
+		}
 	}
 
 	return
 }
 
+// HMSET sets the given fields of the hash at the key in transactions of up to TransactionActions
+// items, the chunks of chunked values included. The fields are read first, 1 RCU each, so that the
+// values they replace are released once they are overwritten.
+//
+// Works similar to https://redis.io/commands/hmset
 func (c Client) HMSET(key string, vFieldMap interface{}) (err error) {
+	c, finish := c.command("HMSET", []string{key}, vFieldMap)
+	defer finish(&err)
+
 	fieldMap, err := ToValueMapE(vFieldMap)
 	if err != nil {
 		return err
 	}
 
+	if c, err = c.inheritExpiry(key); err != nil {
+		return
+	}
+
+	if err = c.claimType(key, TypeHash); err != nil {
+		return
+	}
+
+	stored := make(map[string]types.AttributeValue, len(fieldMap))
+	chunks := make(map[string][]types.TransactWriteItem, len(fieldMap))
+
+	// Values that are stored but not written in the end are abandoned.
+	defer func() {
+		if err != nil {
+			if abandonErr := c.abandonAVs(stored); abandonErr != nil {
+				err = abandonErr
+			}
+		}
+	}()
+
 	var fields []string
-	for field := range fieldMap {
+
+	for field, value := range fieldMap {
+		av, puts, err := c.storeAV(itemSlot(key, field), value.ToAV(), nil)
+		if err != nil {
+			return err
+		}
+
+		if len(puts)+1 > c.transactionActions {
+			return ErrTooManyActions
+		}
+
+		stored[field], chunks[field] = av, puts
 		fields = append(fields, field)
 	}
 
-	var (
-		hasMoreFields = true
-		leftFields    = fields
-	)
-	for hasMoreFields {
-		if len(leftFields) > c.transactionActions {
-			fields, hasMoreFields = leftFields[:c.transactionActions], true
-			leftFields = leftFields[c.transactionActions:]
-		} else {
-			fields, hasMoreFields = leftFields, false
+	for len(fields) > 0 {
+		actions, n := 0, 0
+		for n < len(fields) && actions+len(chunks[fields[n]])+1 <= c.transactionActions {
+			actions += len(chunks[fields[n]]) + 1
+			n++
 		}
 
-		items := make([]types.TransactWriteItem, len(fields))
-		for i, field := range fields {
-			v := fieldMap[field]
+		written, err := c.hmset(key, fields[:n], stored, chunks)
+		if written {
+			for _, field := range fields[:n] {
+				delete(stored, field)
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+
+		fields = fields[n:]
+	}
+
+	return
+}
+
+// hmset writes the stored values of the fields in a transaction, along with their chunks, and releases
+// the values they replace. The fields are read first, and read again if they change before the write.
+func (c Client) hmset(key string, fields []string, stored map[string]types.AttributeValue, chunks map[string][]types.TransactWriteItem) (written bool, err error) {
+	for {
+		old, err := c.batchGet(key, fields, vk)
+		if err != nil {
+			return false, err
+		}
+
+		var items []types.TransactWriteItem
+
+		for _, field := range fields {
 			builder := newExpresionBuilder()
-			builder.updateSET(vk, v)
+			builder.updateSetAV(vk, stored[field])
+			builder.addConditionValueUnchanged(old[field][vk])
 
-			items[i] = types.TransactWriteItem{
+			items = append(items, types.TransactWriteItem{
 				Update: &types.Update{
 					ConditionExpression:       builder.conditionExpression(),
 					ExpressionAttributeNames:  builder.expressionAttributeNames(),
@@ -101,20 +199,39 @@ func (c Client) HMSET(key string, vFieldMap interface{}) (err error) {
 					TableName:        aws.String(c.tableName),
 					UpdateExpression: builder.updateExpression(),
 				},
-			}
+			})
+			items = append(items, chunks[field]...)
 		}
 
-		_, err = c.ddbClient.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{
+		_, err = c.ddb().TransactWriteItems(c.ctx, &dynamodb.TransactWriteItemsInput{
 			TransactItems: items,
 		})
+		if errors.Is(err, ErrConditionFailed) {
+			continue
+		}
+
 		if err != nil {
-			return err
+			return false, err
+		}
+
+		for _, item := range old {
+			if err = c.releaseAV(key, item[vk]); err != nil {
+				return true, err
+			}
 		}
+
+		return true, nil
 	}
-	return
 }
 
 func (c Client) HMGET(key string, fields ...string) (values map[string]ReturnValue, err error) {
+	c, finish := c.command("HMGET", []string{key}, fields)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeHash); err != nil {
+		return
+	}
+
 	values = make(map[string]ReturnValue)
 
 	var (
@@ -137,21 +254,31 @@ func (c Client) HMGET(key string, fields ...string) (values map[string]ReturnVal
 					pk: key,
 					sk: field,
 				}.toAV(c),
-				ProjectionExpression: aws.String(strings.Join([]string{c.sortKey, vk}, ", ")),
-				TableName:            aws.String(c.tableName),
+				ExpressionAttributeNames: map[string]string{"#" + expiryAttribute: expiryAttribute},
+				ProjectionExpression:     aws.String(strings.Join([]string{c.sortKey, vk, "#" + expiryAttribute}, ", ")),
+				TableName:                aws.String(c.tableName),
 			}}
 		}
 
-		resp, err := c.ddbClient.TransactGetItems(context.TODO(), &dynamodb.TransactGetItemsInput{
+		resp, err := c.ddb().TransactGetItems(c.ctx, &dynamodb.TransactGetItemsInput{
 			TransactItems: items,
 		})
 		if err != nil {
 			return values, err
 		}
 
+		now := time.Now()
+
 		for i, field := range fields {
+			if c.expired(resp.Responses[i].Item, now) {
+				values[field] = ReturnValue{}
+				continue
+			}
+
 			pi := parseItem(resp.Responses[i].Item, c)
-			values[field] = pi.val
+			if values[field], err = c.loadValue(itemSlot(key, field), pi.val); err != nil {
+				return values, err
+			}
 		}
 	}
 
@@ -159,8 +286,19 @@ func (c Client) HMGET(key string, fields ...string) (values map[string]ReturnVal
 }
 
 func (c Client) HDEL(key string, fields ...string) (deletedFields []string, err error) {
+	c, finish := c.command("HDEL", []string{key}, fields)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeHash); err != nil {
+		return
+	}
+
+	if c.batchWrites() {
+		return nil, c.batchDeleteValues(key, fields)
+	}
+
 	for _, field := range fields {
-		resp, err := c.ddbClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		resp, err := c.ddb().DeleteItem(c.ctx, &dynamodb.DeleteItemInput{
 			Key: keyDef{
 				pk: key,
 				sk: field,
@@ -175,22 +313,34 @@ func (c Client) HDEL(key string, fields ...string) (deletedFields []string, err
 		if len(resp.Attributes) > 0 {
 			deletedFields = append(deletedFields, field)
 		}
+
+		if err = c.releaseAV(key, resp.Attributes[vk]); err != nil {
+			return deletedFields, err
+		}
 	}
 
 	return
 }
 
 func (c Client) HEXISTS(key string, field string) (exists bool, err error) {
-	resp, err := c.ddbClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+	c, finish := c.command("HEXISTS", []string{key}, field)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeHash); err != nil {
+		return
+	}
+
+	resp, err := c.ddb().GetItem(c.ctx, &dynamodb.GetItemInput{
 		ConsistentRead: aws.Bool(c.consistentReads),
 		Key: keyDef{
 			pk: key,
 			sk: field,
 		}.toAV(c),
-		ProjectionExpression: aws.String(strings.Join([]string{c.partitionKey}, ", ")),
-		TableName:            aws.String(c.tableName),
+		ExpressionAttributeNames: map[string]string{"#" + expiryAttribute: expiryAttribute},
+		ProjectionExpression:     aws.String(strings.Join([]string{c.partitionKey, "#" + expiryAttribute}, ", ")),
+		TableName:                aws.String(c.tableName),
 	})
-	if err == nil && len(resp.Item) > 0 {
+	if err == nil && len(resp.Item) > 0 && !c.expired(resp.Item, time.Now()) {
 		exists = true
 	}
 
@@ -198,20 +348,38 @@ func (c Client) HEXISTS(key string, field string) (exists bool, err error) {
 }
 
 func (c Client) HGETALL(key string) (fieldValues map[string]ReturnValue, err error) {
+	c, finish := c.command("HGETALL", []string{key})
+	defer finish(&err)
+
+	cached, ok, fill := c.cached("HGETALL", key, "")
+	if ok {
+		return cached.(map[string]ReturnValue), nil
+	}
+
+	if err = c.checkType(key, TypeHash); err != nil {
+		return
+	}
+
 	fieldValues = make(map[string]ReturnValue)
 	hasMoreResults := true
+	size := 0
+
+	var expires time.Time
 
 	var lastEvaluatedKey map[string]types.AttributeValue
 
 	for hasMoreResults {
 		builder := newExpresionBuilder()
-		builder.addConditionEquality(c.partitionKey, StringValue{key})
+		builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(key)})
+		builder.addFilterNotExpired(expiryAttribute, time.Now())
+		builder.addFilterNotChunk(c.sortKey)
 
-		resp, err := c.ddbClient.Query(context.TODO(), &dynamodb.QueryInput{
+		resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
 			ConsistentRead:            aws.Bool(c.consistentReads),
 			ExclusiveStartKey:         lastEvaluatedKey,
 			ExpressionAttributeNames:  builder.expressionAttributeNames(),
 			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			FilterExpression:          builder.filterExpression(),
 			KeyConditionExpression:    builder.conditionExpression(),
 			TableName:                 aws.String(c.tableName),
 		})
@@ -222,7 +390,12 @@ func (c Client) HGETALL(key string) (fieldValues map[string]ReturnValue, err err
 
 		for _, item := range resp.Items {
 			parsedItem := parseItem(item, c)
-			fieldValues[parsedItem.sk] = parsedItem.val
+			if fieldValues[parsedItem.sk], err = c.loadValue(itemSlot(key, parsedItem.sk), parsedItem.val); err != nil {
+				return fieldValues, err
+			}
+
+			size += len(parsedItem.sk) + avSize(fieldValues[parsedItem.sk].av)
+			expires = earliest(expires, c.itemExpiry(item))
 		}
 
 		if len(resp.LastEvaluatedKey) > 0 {
@@ -232,10 +405,15 @@ func (c Client) HGETALL(key string) (fieldValues map[string]ReturnValue, err err
 		}
 	}
 
+	fill(fieldValues, size, expires)
+
 	return
 }
 
 func (c Client) HINCRBYFLOAT(key string, field string, delta float64) (after float64, err error) {
+	c, finish := c.command("HINCRBYFLOAT", []string{key}, field, delta)
+	defer finish(&err)
+
 	rv, err := c.hIncr(key, field, FloatValue{delta})
 	if err == nil {
 		after = rv.Float()
@@ -245,9 +423,17 @@ func (c Client) HINCRBYFLOAT(key string, field string, delta float64) (after flo
 }
 
 func (c Client) hIncr(key string, field string, delta Value) (after ReturnValue, err error) {
+	if c, err = c.inheritExpiry(key); err != nil {
+		return
+	}
+
+	if err = c.claimType(key, TypeHash); err != nil {
+		return
+	}
+
 	builder := newExpresionBuilder()
 	builder.keys[vk] = struct{}{}
-	resp, err := c.ddbClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+	resp, err := c.updateItem(&dynamodb.UpdateItemInput{
 		ExpressionAttributeNames: builder.expressionAttributeNames(),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":delta": delta.ToAV(),
@@ -266,6 +452,9 @@ func (c Client) hIncr(key string, field string, delta Value) (after ReturnValue,
 }
 
 func (c Client) HINCRBY(key string, field string, delta int64) (after int64, err error) {
+	c, finish := c.command("HINCRBY", []string{key}, field, delta)
+	defer finish(&err)
+
 	rv, err := c.hIncr(key, field, IntValue{delta})
 
 	if err == nil {
@@ -276,19 +465,29 @@ func (c Client) HINCRBY(key string, field string, delta int64) (after int64, err
 }
 
 func (c Client) HKEYS(key string) (keys []string, err error) {
+	c, finish := c.command("HKEYS", []string{key})
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeHash); err != nil {
+		return
+	}
+
 	hasMoreResults := true
 
 	var lastEvaluatedKey map[string]types.AttributeValue
 
 	for hasMoreResults {
 		builder := newExpresionBuilder()
-		builder.addConditionEquality(c.partitionKey, StringValue{key})
+		builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(key)})
+		builder.addFilterNotExpired(expiryAttribute, time.Now())
+		builder.addFilterNotChunk(c.sortKey)
 
-		resp, err := c.ddbClient.Query(context.TODO(), &dynamodb.QueryInput{
+		resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
 			ConsistentRead:            aws.Bool(c.consistentReads),
 			ExclusiveStartKey:         lastEvaluatedKey,
 			ExpressionAttributeNames:  builder.expressionAttributeNames(),
 			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			FilterExpression:          builder.filterExpression(),
 			KeyConditionExpression:    builder.conditionExpression(),
 			TableName:                 aws.String(c.tableName),
 			ProjectionExpression:      aws.String(c.sortKey),
@@ -315,6 +514,9 @@ func (c Client) HKEYS(key string) (keys []string, err error) {
 }
 
 func (c Client) HVALS(key string) (values []ReturnValue, err error) {
+	c, finish := c.command("HVALS", []string{key})
+	defer finish(&err)
+
 	all, err := c.HGETALL(key)
 	if err == nil {
 		for _, v := range all {
@@ -326,19 +528,33 @@ func (c Client) HVALS(key string) (values []ReturnValue, err error) {
 }
 
 func (c Client) HLEN(key string) (count int32, err error) {
+	c, finish := c.command("HLEN", []string{key})
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeHash); err != nil {
+		return
+	}
+
+	return c.hLen(key)
+}
+
+func (c Client) hLen(key string) (count int32, err error) {
 	hasMoreResults := true
 
 	var lastEvaluatedKey map[string]types.AttributeValue
 
 	for hasMoreResults {
 		builder := newExpresionBuilder()
-		builder.addConditionEquality(c.partitionKey, StringValue{key})
+		builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(key)})
+		builder.addFilterNotExpired(expiryAttribute, time.Now())
+		builder.addFilterNotChunk(c.sortKey)
 
-		resp, err := c.ddbClient.Query(context.TODO(), &dynamodb.QueryInput{
+		resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
 			ConsistentRead:            aws.Bool(c.consistentReads),
 			ExclusiveStartKey:         lastEvaluatedKey,
 			ExpressionAttributeNames:  builder.expressionAttributeNames(),
 			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			FilterExpression:          builder.filterExpression(),
 			KeyConditionExpression:    builder.conditionExpression(),
 			TableName:                 aws.String(c.tableName),
 			Select:                    types.SelectCount,
@@ -348,7 +564,7 @@ func (c Client) HLEN(key string) (count int32, err error) {
 			return count, err
 		}
 
-		count += resp.ScannedCount
+		count += resp.Count
 
 		if len(resp.LastEvaluatedKey) > 0 {
 			lastEvaluatedKey = resp.LastEvaluatedKey
@@ -361,11 +577,27 @@ func (c Client) HLEN(key string) (count int32, err error) {
 }
 
 func (c Client) HSETNX(key string, field string, value Value) (ok bool, err error) {
+	c, finish := c.command("HSETNX", []string{key}, field, value)
+	defer finish(&err)
+
+	if c, err = c.inheritExpiry(key); err != nil {
+		return
+	}
+
+	if err = c.claimType(key, TypeHash); err != nil {
+		return
+	}
+
+	stored, chunks, err := c.storeAV(itemSlot(key, field), value.ToAV(), nil)
+	if err != nil {
+		return false, err
+	}
+
 	builder := newExpresionBuilder()
-	builder.updateSET(vk, value)
+	builder.updateSetAV(vk, stored)
 	builder.addConditionNotExists(c.partitionKey)
 
-	_, err = c.ddbClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+	_, err = c.updateValue(&dynamodb.UpdateItemInput{
 		ConditionExpression:       builder.conditionExpression(),
 		ExpressionAttributeNames:  builder.expressionAttributeNames(),
 		ExpressionAttributeValues: builder.expressionAttributeValues(),
@@ -375,10 +607,10 @@ func (c Client) HSETNX(key string, field string, value Value) (ok bool, err erro
 		}.toAV(c),
 		TableName:        aws.String(c.tableName),
 		UpdateExpression: builder.updateExpression(),
-	})
+	}, chunks)
 
-	if conditionFailureError(err) {
-		return false, nil
+	if errors.Is(err, ErrConditionFailed) {
+		return false, c.abandonAV(stored)
 	}
 
 	if err != nil {
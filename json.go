@@ -0,0 +1,661 @@
+package redimo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// JSON documents are stored as DynamoDB documents in the value attribute of the key's item, so that
+// each command translates its path into a document path, and runs as a single update or projection
+// of that item instead of reading and rewriting the whole document.
+//
+// Paths are the definite subset of JSONPath that maps onto DynamoDB document paths: $ (or . or an
+// empty path) is the root, followed by .name or ['name'] for object members and [n] for array
+// elements, with n not negative. The legacy RedisJSON syntax without the leading $, such as
+// .a.b[0] or a.b[0], is accepted too. Wildcards, filters, slices and recursive descent are not
+// supported, so a path selects at most one value, and commands return that value rather than an array
+// of matches.
+
+type jsonPathElem struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+type jsonPath []jsonPathElem
+
+// parseJSONPath parses a path into its members and elements.
+func parseJSONPath(path string) (jsonPath, error) {
+	invalid := func(reason string) error {
+		return fmt.Errorf("redimo: unsupported JSON path %q: %v", path, reason)
+	}
+
+	s := strings.TrimPrefix(path, "$")
+	if s == "." {
+		return nil, nil
+	}
+
+	if s != "" && s[0] != '.' && s[0] != '[' {
+		if s != path {
+			return nil, invalid("expected . or [ after $")
+		}
+
+		s = "." + s
+	}
+
+	var elems jsonPath
+
+	for s != "" {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+
+			name := s[:end]
+			if name == "" || name == "*" {
+				return nil, invalid("expected a member name")
+			}
+
+			elems = append(elems, jsonPathElem{name: name})
+			s = s[end:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, invalid("unclosed [")
+			}
+
+			inner := s[1:end]
+			s = s[end+1:]
+
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				elems = append(elems, jsonPathElem{name: inner[1 : len(inner)-1]})
+				continue
+			}
+
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return nil, invalid("expected a quoted member name or an array index that is not negative")
+			}
+
+			elems = append(elems, jsonPathElem{index: index, isIndex: true})
+		default:
+			return nil, invalid("expected . or [")
+		}
+	}
+
+	return elems, nil
+}
+
+// expression returns the document path expression of the path within the value attribute, adding the
+// names it uses to names.
+func (p jsonPath) expression(names map[string]string) string {
+	names["#"+vk] = vk
+
+	var b strings.Builder
+	b.WriteString("#" + vk)
+
+	for _, e := range p {
+		if e.isIndex {
+			fmt.Fprintf(&b, "[%d]", e.index)
+			continue
+		}
+
+		placeholder := fmt.Sprintf("#json%d", len(names))
+		for ph, name := range names {
+			if name == e.name && ph != "#"+vk {
+				placeholder = ph
+			}
+		}
+
+		names[placeholder] = e.name
+		b.WriteString("." + placeholder)
+	}
+
+	return b.String()
+}
+
+// resolve returns the value at the path within the document.
+func (p jsonPath) resolve(doc types.AttributeValue) (types.AttributeValue, bool) {
+	av := doc
+
+	for _, e := range p {
+		switch v := av.(type) {
+		case *types.AttributeValueMemberM:
+			if e.isIndex {
+				return nil, false
+			}
+
+			var ok bool
+			if av, ok = v.Value[e.name]; !ok {
+				return nil, false
+			}
+		case *types.AttributeValueMemberL:
+			if !e.isIndex || e.index >= len(v.Value) {
+				return nil, false
+			}
+
+			av = v.Value[e.index]
+		default:
+			return nil, false
+		}
+	}
+
+	return av, av != nil
+}
+
+// parseJSON returns the attribute value of a JSON text: a map for an object, a list for an array, and
+// a string, number, bool or null for the others.
+func parseJSON(text string) (types.AttributeValue, error) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, fmt.Errorf("redimo: invalid JSON: %w", err)
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("redimo: invalid JSON: unexpected data after the value")
+	}
+
+	av := jsonToAV(v)
+
+	return av, checkReservedKeys(av)
+}
+
+func jsonToAV(v interface{}) types.AttributeValue {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]types.AttributeValue, len(v))
+		for k, elem := range v {
+			m[k] = jsonToAV(elem)
+		}
+
+		return &types.AttributeValueMemberM{Value: m}
+	case []interface{}:
+		l := make([]types.AttributeValue, len(v))
+		for i, elem := range v {
+			l[i] = jsonToAV(elem)
+		}
+
+		return &types.AttributeValueMemberL{Value: l}
+	case json.Number:
+		return &types.AttributeValueMemberN{Value: v.String()}
+	case string:
+		return &types.AttributeValueMemberS{Value: v}
+	case bool:
+		return &types.AttributeValueMemberBOOL{Value: v}
+	}
+
+	return &types.AttributeValueMemberNULL{Value: true}
+}
+
+func avToJSON(av types.AttributeValue) interface{} {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberM:
+		m := make(map[string]interface{}, len(v.Value))
+		for k, elem := range v.Value {
+			m[k] = avToJSON(elem)
+		}
+
+		return m
+	case *types.AttributeValueMemberL:
+		l := make([]interface{}, len(v.Value))
+		for i, elem := range v.Value {
+			l[i] = avToJSON(elem)
+		}
+
+		return l
+	case *types.AttributeValueMemberN:
+		return json.Number(v.Value)
+	case *types.AttributeValueMemberNS:
+		l := make([]interface{}, len(v.Value))
+		for i, n := range v.Value {
+			l[i] = json.Number(n)
+		}
+
+		return l
+	}
+
+	return ReturnValue{av}.Interface()
+}
+
+// formatJSON returns the JSON text of the value, without escaping HTML characters the way RedisJSON
+// doesn't.
+func formatJSON(v interface{}) (string, error) {
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(v); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// jsonType returns the RedisJSON name of the type of the value.
+func jsonType(av types.AttributeValue) string {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberM:
+		return "object"
+	case *types.AttributeValueMemberL, *types.AttributeValueMemberSS, *types.AttributeValueMemberNS, *types.AttributeValueMemberBS:
+		return "array"
+	case *types.AttributeValueMemberN:
+		if _, err := strconv.ParseInt(v.Value, 10, 64); err == nil {
+			return "integer"
+		}
+
+		return "number"
+	case *types.AttributeValueMemberBOOL:
+		return "boolean"
+	case *types.AttributeValueMemberNULL:
+		return "null"
+	}
+
+	return "string"
+}
+
+// jsonDocument reads the parts of the document at the given paths. The document is returned with only
+// those parts, or nil if the key doesn't exist.
+func (c Client) jsonDocument(key string, paths ...jsonPath) (doc types.AttributeValue, err error) {
+	names := map[string]string{"#" + c.partitionKey: c.partitionKey, "#" + expiryAttribute: expiryAttribute}
+	projections := []string{"#" + c.partitionKey, "#" + expiryAttribute}
+
+	for _, path := range paths {
+		// DynamoDB compacts the projected elements of a list, so the list is projected whole.
+		for i, e := range path {
+			if e.isIndex {
+				path = path[:i]
+				break
+			}
+		}
+
+		projections = append(projections, path.expression(names))
+	}
+
+	resp, err := c.ddb().GetItem(c.ctx, &dynamodb.GetItemInput{
+		ConsistentRead:           aws.Bool(c.consistentReads),
+		ExpressionAttributeNames: names,
+		Key:                      keyDef{pk: key}.toAV(c),
+		ProjectionExpression:     aws.String(strings.Join(projections, ", ")),
+		TableName:                aws.String(c.tableName),
+	})
+	if err != nil || len(resp.Item) == 0 || c.expired(resp.Item, time.Now()) {
+		return nil, err
+	}
+
+	if doc = resp.Item[vk]; doc == nil {
+		// None of the paths exist, but the document does.
+		doc = &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{}}
+	}
+
+	return doc, nil
+}
+
+// jsonFailure explains why a conditional update of the path failed, given the type it needed the
+// value at the path to have, if any.
+func (c Client) jsonFailure(key string, path jsonPath, expected string) error {
+	doc, err := c.jsonDocument(key, path)
+	if err != nil {
+		return err
+	}
+
+	if doc == nil {
+		return ErrNoSuchKey
+	}
+
+	av, ok := path.resolve(doc)
+	if !ok {
+		return ErrNoSuchPath
+	}
+
+	if actual := jsonType(av); expected != "" && actual != expected && !(expected == "number" && actual == "integer") {
+		return fmt.Errorf("%w - expected %v but found %v", ErrWrongJSONType, expected, actual)
+	}
+
+	return ErrConditionFailed
+}
+
+// updateJSON runs an update of the document's item with the expression and condition, built with
+// names and values, and returns the updated attributes.
+func (c Client) updateJSON(key string, update string, condition string, names map[string]string, values map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	input := &dynamodb.UpdateItemInput{
+		ExpressionAttributeNames: names,
+		Key:                      keyDef{pk: key}.toAV(c),
+		ReturnValues:             types.ReturnValueUpdatedNew,
+		TableName:                aws.String(c.tableName),
+		UpdateExpression:         aws.String(update),
+	}
+
+	if condition != "" {
+		input.ConditionExpression = aws.String(condition)
+	}
+
+	if len(values) > 0 {
+		input.ExpressionAttributeValues = values
+	}
+
+	resp, err := c.updateItem(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Attributes, nil
+}
+
+// JSONSET sets the value at the path in the JSON document stored at the key to the JSON text. A new
+// document can only be created at the root, and a value can only be set in an existing object, or
+// replace an existing element of an array. With IfNotExists, the value is only set if the path doesn't
+// exist yet, and with IfAlreadyExists only if it does; ok is false if the value was not set because of
+// either.
+//
+// Works similar to https://redis.io/commands/json.set
+func (c Client) JSONSET(key string, path string, jsonText string, flags ...Flag) (ok bool, err error) {
+	c, finish := c.command("JSON.SET", []string{key}, path, jsonText, flags)
+	defer finish(&err)
+
+	p, err := parseJSONPath(path)
+	if err != nil {
+		return false, err
+	}
+
+	av, err := parseJSON(jsonText)
+	if err != nil {
+		return false, err
+	}
+
+	for _, elem := range p {
+		if !elem.isIndex && strings.HasPrefix(elem.name, reservedKeyPrefix) {
+			return false, ErrReservedKey
+		}
+	}
+
+	// Only the root can create a document, so only a root set records the type.
+	if len(p) == 0 {
+		err = c.claimType(key, TypeJSON)
+	} else {
+		err = c.checkType(key, TypeJSON)
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	names := make(map[string]string)
+	target := p.expression(names)
+
+	var conditions []string
+
+	switch {
+	case len(p) == 0:
+	case p[len(p)-1].isIndex:
+		// DynamoDB appends when setting an index past the end of a list, which JSON.SET doesn't.
+		conditions = append(conditions, fmt.Sprintf("attribute_exists(%v)", target))
+	default:
+		conditions = append(conditions, fmt.Sprintf("attribute_type(%v, :object)", p[:len(p)-1].expression(names)))
+	}
+
+	if Flags(flags).has(IfNotExists) {
+		conditions = append(conditions, fmt.Sprintf("attribute_not_exists(%v)", target))
+	}
+
+	if Flags(flags).has(IfAlreadyExists) {
+		conditions = append(conditions, fmt.Sprintf("attribute_exists(%v)", target))
+	}
+
+	values := map[string]types.AttributeValue{":json": av}
+	if len(p) > 0 && !p[len(p)-1].isIndex {
+		values[":object"] = &types.AttributeValueMemberS{Value: "M"}
+	}
+
+	_, err = c.updateJSON(key, fmt.Sprintf("SET %v = :json", target), strings.Join(conditions, " AND "), names, values)
+	if errors.Is(err, ErrConditionFailed) {
+		if len(p) == 0 {
+			return false, nil
+		}
+
+		expected := "object"
+		if p[len(p)-1].isIndex {
+			expected = "array"
+		}
+
+		if err = c.jsonFailure(key, p[:len(p)-1], expected); errors.Is(err, ErrConditionFailed) {
+			if !p[len(p)-1].isIndex || Flags(flags).has(IfNotExists) {
+				return false, nil
+			}
+
+			if err = c.jsonFailure(key, p, ""); errors.Is(err, ErrConditionFailed) {
+				return false, nil
+			}
+		}
+	}
+
+	return err == nil, err
+}
+
+// JSONGET returns the JSON text of the value at the path in the document stored at the key, or of the
+// whole document if no path is given. With more than one path, it returns a JSON object with the value
+// at each path as a member named after the path. If the key doesn't exist, it returns an empty string;
+// if a path doesn't exist, ErrNoSuchPath.
+//
+// Works similar to https://redis.io/commands/json.get
+func (c Client) JSONGET(key string, paths ...string) (jsonText string, err error) {
+	c, finish := c.command("JSON.GET", []string{key}, paths)
+	defer finish(&err)
+
+	if len(paths) == 0 {
+		paths = []string{"$"}
+	}
+
+	parsed := make([]jsonPath, len(paths))
+	for i, path := range paths {
+		if parsed[i], err = parseJSONPath(path); err != nil {
+			return "", err
+		}
+	}
+
+	if err = c.checkType(key, TypeJSON); err != nil {
+		return "", err
+	}
+
+	doc, err := c.jsonDocument(key, parsed...)
+	if err != nil || doc == nil {
+		return "", err
+	}
+
+	results := make(map[string]interface{}, len(paths))
+
+	for i, p := range parsed {
+		av, ok := p.resolve(doc)
+		if !ok {
+			return "", ErrNoSuchPath
+		}
+
+		results[paths[i]] = avToJSON(av)
+	}
+
+	if len(paths) == 1 {
+		return formatJSON(results[paths[0]])
+	}
+
+	return formatJSON(results)
+}
+
+// JSONDEL deletes the value at the path in the document stored at the key, or the whole key if the path
+// is the root, and returns the number of values deleted.
+//
+// Works similar to https://redis.io/commands/json.del
+func (c Client) JSONDEL(key string, path string) (deleted int64, err error) {
+	c, finish := c.command("JSON.DEL", []string{key}, path)
+	defer finish(&err)
+
+	p, err := parseJSONPath(path)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = c.checkType(key, TypeJSON); err != nil {
+		return 0, err
+	}
+
+	if len(p) == 0 {
+		ok, err := c.del(key)
+		if ok {
+			deleted = 1
+		}
+
+		return deleted, err
+	}
+
+	names := make(map[string]string)
+	target := p.expression(names)
+
+	_, err = c.updateJSON(key, "REMOVE "+target, fmt.Sprintf("attribute_exists(%v)", target), names, nil)
+	if errors.Is(err, ErrConditionFailed) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return 1, nil
+}
+
+// JSONARRAPPEND appends the JSON texts to the array at the path in the document stored at the key, and
+// returns the new length of the array.
+//
+// Works similar to https://redis.io/commands/json.arrappend
+func (c Client) JSONARRAPPEND(key string, path string, jsonTexts ...string) (length int64, err error) {
+	c, finish := c.command("JSON.ARRAPPEND", []string{key}, path, jsonTexts)
+	defer finish(&err)
+
+	p, err := parseJSONPath(path)
+	if err != nil {
+		return 0, err
+	}
+
+	elems := make([]types.AttributeValue, len(jsonTexts))
+	for i, text := range jsonTexts {
+		if elems[i], err = parseJSON(text); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = c.checkType(key, TypeJSON); err != nil {
+		return 0, err
+	}
+
+	names := make(map[string]string)
+	target := p.expression(names)
+
+	attributes, err := c.updateJSON(key,
+		fmt.Sprintf("SET %v = list_append(%v, :elems)", target, target),
+		fmt.Sprintf("attribute_type(%v, :array)", target),
+		names,
+		map[string]types.AttributeValue{
+			":elems": &types.AttributeValueMemberL{Value: elems},
+			":array": &types.AttributeValueMemberS{Value: "L"},
+		})
+	if errors.Is(err, ErrConditionFailed) {
+		return 0, c.jsonFailure(key, p, "array")
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	list, _ := p.resolve(attributes[vk])
+	if l, ok := list.(*types.AttributeValueMemberL); ok {
+		length = int64(len(l.Value))
+	}
+
+	return length, nil
+}
+
+// JSONNUMINCRBY increments the number at the path in the document stored at the key by delta, and
+// returns the new value.
+//
+// Works similar to https://redis.io/commands/json.numincrby
+func (c Client) JSONNUMINCRBY(key string, path string, delta float64) (after float64, err error) {
+	c, finish := c.command("JSON.NUMINCRBY", []string{key}, path, delta)
+	defer finish(&err)
+
+	p, err := parseJSONPath(path)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = c.checkType(key, TypeJSON); err != nil {
+		return 0, err
+	}
+
+	names := make(map[string]string)
+	target := p.expression(names)
+
+	attributes, err := c.updateJSON(key,
+		fmt.Sprintf("SET %v = %v + :delta", target, target),
+		fmt.Sprintf("attribute_type(%v, :number)", target),
+		names,
+		map[string]types.AttributeValue{
+			":delta":  FloatValue{delta}.ToAV(),
+			":number": &types.AttributeValueMemberS{Value: "N"},
+		})
+	if errors.Is(err, ErrConditionFailed) {
+		return 0, c.jsonFailure(key, p, "number")
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	av, _ := p.resolve(attributes[vk])
+
+	return ReturnValue{av}.Float(), nil
+}
+
+// JSONTYPE returns the type of the value at the path in the document stored at the key: object, array,
+// string, integer, number, boolean or null. It returns an empty string if the key or the path doesn't
+// exist.
+//
+// Works similar to https://redis.io/commands/json.type
+func (c Client) JSONTYPE(key string, path string) (jsonTypeName string, err error) {
+	c, finish := c.command("JSON.TYPE", []string{key}, path)
+	defer finish(&err)
+
+	p, err := parseJSONPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	if err = c.checkType(key, TypeJSON); err != nil {
+		return "", err
+	}
+
+	doc, err := c.jsonDocument(key, p)
+	if err != nil || doc == nil {
+		return "", err
+	}
+
+	if av, ok := p.resolve(doc); ok {
+		return jsonType(av), nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,163 @@
+package redimo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	for _, root := range []string{"", "$", "."} {
+		p, err := parseJSONPath(root)
+		assert.NoError(t, err)
+		assert.Empty(t, p)
+	}
+
+	want := jsonPath{{name: "a"}, {name: "b c"}, {index: 2, isIndex: true}, {name: "d"}}
+
+	for _, path := range []string{"$.a['b c'][2].d", `.a["b c"][2].d`, "a['b c'][2].d"} {
+		p, err := parseJSONPath(path)
+		assert.NoError(t, err)
+		assert.Equal(t, want, p)
+	}
+
+	for _, path := range []string{"$..a", "$.a[*]", "$.a[-1]", "$.a[?(@.b)]", "$a", "$.a[0"} {
+		_, err := parseJSONPath(path)
+		assert.Error(t, err, path)
+	}
+}
+
+func TestJSONDocuments(t *testing.T) {
+	c := newClient(t).CheckTypes()
+
+	doc, err := c.JSONGET("doc")
+	assert.NoError(t, err)
+	assert.Equal(t, "", doc)
+
+	ok, err := c.JSONSET("doc", "$.name", `"ada"`)
+	assert.Equal(t, ErrNoSuchKey, err)
+	assert.False(t, ok)
+
+	ok, err = c.JSONSET("doc", "$", `{"name":"ada","age":36,"tags":["math"],"address":{"city":"London"},"admin":true,"nick":null}`)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	keyType, err := c.TYPE("doc")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeJSON, keyType)
+
+	doc, err = c.JSONGET("doc", "$.address")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"city":"London"}`, doc)
+
+	doc, err = c.JSONGET("doc", "name", "$.tags[0]")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"$.tags[0]":"math","name":"ada"}`, doc)
+
+	_, err = c.JSONGET("doc", "$.missing")
+	assert.Equal(t, ErrNoSuchPath, err)
+
+	ok, err = c.JSONSET("doc", "$", `{}`, IfNotExists)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = c.JSONSET("doc", "$.address.zip", `"N1"`, IfAlreadyExists)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = c.JSONSET("doc", "$.address.zip", `"N1 <9>"`, IfNotExists)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = c.JSONSET("doc", "$.tags[0]", `"engines"`)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = c.JSONSET("doc", "$.tags[5]", `"out of range"`)
+	assert.Equal(t, ErrNoSuchPath, err)
+	assert.False(t, ok)
+
+	ok, err = c.JSONSET("doc", "$.missing.zip", `1`)
+	assert.Equal(t, ErrNoSuchPath, err)
+	assert.False(t, ok)
+
+	_, err = c.JSONSET("doc", "$.name.first", `"ada"`)
+	assert.True(t, errors.Is(err, ErrWrongJSONType))
+
+	_, err = c.JSONSET("doc", "$", `{"unterminated"`)
+	assert.Error(t, err)
+
+	length, err := c.JSONARRAPPEND("doc", "$.tags", `"poetry"`, `{"year":1843}`)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), length)
+
+	_, err = c.JSONARRAPPEND("doc", "$.address", `1`)
+	assert.True(t, errors.Is(err, ErrWrongJSONType))
+	assert.Equal(t, "ERR wrong type of path value - expected array but found object", err.Error())
+
+	_, err = c.JSONARRAPPEND("doc", "$.missing", `1`)
+	assert.Equal(t, ErrNoSuchPath, err)
+
+	_, err = c.JSONARRAPPEND("nodoc", "$.tags", `1`)
+	assert.Equal(t, ErrNoSuchKey, err)
+
+	after, err := c.JSONNUMINCRBY("doc", "$.age", 1.5)
+	assert.NoError(t, err)
+	assert.Equal(t, 37.5, after)
+
+	_, err = c.JSONNUMINCRBY("doc", "$.name", 1)
+	assert.True(t, errors.Is(err, ErrWrongJSONType))
+
+	for path, want := range map[string]string{
+		"$":         "object",
+		"$.name":    "string",
+		"$.age":     "number",
+		"$.tags":    "array",
+		"$.tags[2]": "object",
+		"$.admin":   "boolean",
+		"$.nick":    "null",
+		"$.missing": "",
+	} {
+		jsonTypeName, err := c.JSONTYPE("doc", path)
+		assert.NoError(t, err)
+		assert.Equal(t, want, jsonTypeName, path)
+	}
+
+	deleted, err := c.JSONDEL("doc", "$.nick")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	deleted, err = c.JSONDEL("doc", "$.nick")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), deleted)
+
+	doc, err = c.JSONGET("doc")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"address":{"city":"London","zip":"N1 <9>"},"admin":true,"age":37.5,"name":"ada","tags":["engines","poetry",{"year":1843}]}`, doc)
+
+	// JSON documents are a type of their own.
+	_, err = c.GET("doc")
+	assert.Equal(t, ErrWrongType, err)
+
+	_, err = c.SET("str", "value")
+	assert.NoError(t, err)
+
+	_, err = c.JSONSET("str", "$", `{}`)
+	assert.Equal(t, ErrWrongType, err)
+
+	// Keys reserved for the values redimo stores in place of documents are rejected.
+	_, err = c.JSONSET("forged", "$", `{"_redimo/blob":{"hash":"h"}}`)
+	assert.Equal(t, ErrReservedKey, err)
+
+	_, err = c.JSONSET("doc", `$["_redimo/chunks"]`, `1`)
+	assert.Equal(t, ErrReservedKey, err)
+
+	deleted, err = c.JSONDEL("doc", "$")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	jsonTypeName, err := c.JSONTYPE("doc", "$")
+	assert.NoError(t, err)
+	assert.Equal(t, "", jsonTypeName)
+}
@@ -1,128 +1,1649 @@
 package redimo
 
 import (
-	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
-func (c Client) DEL(key string) (deletedFields []string, err error) {
-	fields, err := c.listSortKeys(key)
+// DEL removes the given keys, and returns the number of keys that existed. Up to the client's
+// Concurrency keys are deleted at a time, and the items of each page of a key are deleted up to
+// Concurrency at a time.
+//
+// Cost is O(N) / 1 WCU for every item deleted, plus 1 RCU per 4KB of sort keys listed.
+//
+// Works similar to https://redis.io/commands/del
+func (c Client) DEL(keys ...string) (deletedKeys int64, err error) {
+	c, finish := c.command("DEL", keys)
+	defer finish(&err)
+
+	keys = uniqueKeys(keys)
+	deleted := make([]bool, len(keys))
+
+	err = c.fanOut(len(keys), func(i int) (err error) {
+		deleted[i], err = c.del(keys[i])
+		return
+	})
+
+	for _, ok := range deleted {
+		if ok {
+			deletedKeys++
+		}
+	}
+
+	return deletedKeys, err
+}
+
+// UnlinkResult reports the outcome of UNLINK once all the keys have been deleted.
+type UnlinkResult struct {
+	DeletedKeys int64
+	Err         error
+}
+
+// UNLINK is like DEL, but returns immediately and deletes the keys in the background. The returned
+// channel receives the outcome once the deletion is complete, and is then closed. Cancelling the
+// client's context stops the deletion.
+//
+// Works similar to https://redis.io/commands/unlink
+func (c Client) UNLINK(keys ...string) <-chan UnlinkResult {
+	c, finish := c.command("UNLINK", keys)
+	done := make(chan UnlinkResult, 1)
+
+	go func() {
+		defer close(done)
+
+		deletedKeys, err := c.DEL(keys...)
+		finish(&err)
+		done <- UnlinkResult{DeletedKeys: deletedKeys, Err: err}
+	}()
+
+	return done
+}
+
+// del deletes every item of the key page by page, followed by its bookkeeping partitions, recorded type
+// included, and reports whether the key existed.
+func (c Client) del(key string) (deleted bool, err error) {
+	var groups []string
+
+	if !internalKey(key) {
+		if groups, err = c.xGroups(key); err != nil {
+			return false, err
+		}
+	}
+
+	partitions := c.keyPartitions(key, groups)
+
+	if deleted, err = c.delPartition(partitions[0]); err != nil || internalKey(key) {
+		return deleted, err
+	}
+
+	for _, p := range partitions[1:] {
+		if _, err = c.delPartition(p); err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
+
+// delPartition deletes every live item the partition holds for its key page by page, and reports whether
+// there were any.
+func (c Client) delPartition(p keyPartition) (deleted bool, err error) {
+	var (
+		fields           []string
+		lastEvaluatedKey map[string]types.AttributeValue
+	)
+
+	for {
+		var pointers []blobPointer
+
+		fields, pointers, lastEvaluatedKey, err = c.sortKeysPage(p, lastEvaluatedKey)
+		if err != nil {
+			return deleted, err
+		}
+
+		if c.batchWrites() {
+			err = c.batchDelete(p.pk, fields)
+			deleted = deleted || len(fields) > 0
+		} else {
+			var deletedFields []string
+			deletedFields, err = c.deleteFields(p.pk, fields)
+			deleted = deleted || len(deletedFields) > 0
+		}
+
+		if err != nil {
+			return deleted, err
+		}
+
+		for _, pointer := range pointers {
+			if err = c.releaseBlob(pointer); err != nil {
+				return deleted, err
+			}
+		}
+
+		if len(lastEvaluatedKey) == 0 {
+			return deleted, c.deleteExpiredBlobs(p)
+		}
+	}
+}
+
+// deleteExpiredBlobs deletes the items of the partition that have expired but not been deleted by
+// DynamoDB yet and point to blobs, so that their blobs are released rather than left behind when
+// DynamoDB deletes them. It only reads the partition if the client has a blob store.
+func (c Client) deleteExpiredBlobs(p keyPartition) error {
+	if c.blobs == nil {
+		return nil
+	}
+
+	items, err := c.partitionItems(p.pk)
 	if err != nil {
-		return deletedFields, err
+		return err
+	}
+
+	now := time.Now()
+
+	for _, item := range items {
+		if !p.ownsItem(item, c) || !c.expired(item, now) || len(itemBlobPointers(item)) == 0 {
+			continue
+		}
+
+		if _, err = c.deleteExpired(keyDef{pk: p.pk, sk: parseItem(item, c).sk}.toAV(c), now); err != nil {
+			return err
+		}
 	}
 
-	for _, field := range fields {
-		resp, err := c.ddbClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+	return nil
+}
+
+// deleteFields deletes the given sort keys of the key, up to the client's Concurrency at a time, and
+// returns those that existed.
+func (c Client) deleteFields(key string, fields []string) (deletedFields []string, err error) {
+	deleted := make([]bool, len(fields))
+
+	err = c.fanOut(len(fields), func(i int) error {
+		resp, err := c.ddb().DeleteItem(c.ctx, &dynamodb.DeleteItemInput{
 			Key: keyDef{
 				pk: key,
-				sk: field,
+				sk: fields[i],
 			}.toAV(c),
 			ReturnValues: types.ReturnValueAllOld,
 			TableName:    aws.String(c.tableName),
 		})
+
+		deleted[i] = err == nil && len(resp.Attributes) > 0
+
+		return err
+	})
+
+	for i, field := range fields {
+		if deleted[i] {
+			deletedFields = append(deletedFields, field)
+		}
+	}
+
+	return deletedFields, err
+}
+
+// uniqueKeys returns the keys without duplicates, in the order they first appear.
+func uniqueKeys(keys []string) []string {
+	seen := make(map[string]struct{})
+	unique := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			unique = append(unique, key)
+		}
+	}
+
+	return unique
+}
+
+// keyItems returns the keys of the live items of the key, followed by those of its bookkeeping.
+func (c Client) keyItems(key string) (keys []keyDef, err error) {
+	partitions := []keyPartition{{pk: key}}
+
+	if !internalKey(key) {
+		groups, err := c.xGroups(key)
 		if err != nil {
-			return deletedFields, err
+			return nil, err
 		}
 
-		if len(resp.Attributes) > 0 {
-			deletedFields = append(deletedFields, field)
+		partitions = c.keyPartitions(key, groups)
+	}
+
+	for _, p := range partitions {
+		var (
+			page             []string
+			lastEvaluatedKey map[string]types.AttributeValue
+		)
+
+		for {
+			page, _, lastEvaluatedKey, err = c.sortKeysPage(p, lastEvaluatedKey)
+			if err != nil {
+				return keys, err
+			}
+
+			for _, sk := range page {
+				keys = append(keys, keyDef{pk: p.pk, sk: sk})
+			}
+
+			if len(lastEvaluatedKey) == 0 {
+				break
+			}
 		}
 	}
 
-	return
+	return keys, nil
 }
 
-func (c Client) listSortKeys(key string) (sortKeys []string, err error) {
-	hasMoreResults := true
+// sortKeysPage returns the live sort keys of a single page of the partition that belong to its key,
+// starting after the given key. If the client has a blob store, whole items are read, and the blob
+// pointers they hold are returned too.
+func (c Client) sortKeysPage(p keyPartition, exclusiveStartKey map[string]types.AttributeValue) (sortKeys []string, pointers []blobPointer, lastEvaluatedKey map[string]types.AttributeValue, err error) {
+	builder := newExpresionBuilder()
+	builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(p.pk)})
+	builder.addFilterNotExpired(expiryAttribute, time.Now())
+
+	input := &dynamodb.QueryInput{
+		ConsistentRead:            aws.Bool(c.consistentReads),
+		ExclusiveStartKey:         exclusiveStartKey,
+		ExpressionAttributeNames:  builder.expressionAttributeNames(),
+		ExpressionAttributeValues: builder.expressionAttributeValues(),
+		FilterExpression:          builder.filterExpression(),
+		KeyConditionExpression:    builder.conditionExpression(),
+		TableName:                 aws.String(c.tableName),
+		ProjectionExpression:      aws.String(c.sortKey),
+		Select:                    types.SelectSpecificAttributes,
+	}
+
+	if c.blobs != nil {
+		input.ProjectionExpression, input.Select = nil, types.SelectAllAttributes
+	}
+
+	resp, err := c.ddb().Query(c.ctx, input)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	for _, item := range resp.Items {
+		if !p.ownsItem(item, c) {
+			continue
+		}
+
+		sortKeys = append(sortKeys, parseItem(item, c).sk)
+		pointers = append(pointers, itemBlobPointers(item)...)
+	}
+
+	return sortKeys, pointers, resp.LastEvaluatedKey, nil
+}
+
+// EXISTS returns the number of the given keys that exist. As in Redis, a key given more than once is
+// counted as many times. Up to the client's Concurrency keys are checked at a time.
+//
+// Cost is O(1) / 1 RCU per key, more if the first page of a key holds only expired items.
+//
+// Works similar to https://redis.io/commands/exists
+func (c Client) EXISTS(keys ...string) (count int64, err error) {
+	c, finish := c.command("EXISTS", keys)
+	defer finish(&err)
+
+	exists := make([]bool, len(keys))
+
+	err = c.fanOut(len(keys), func(i int) (err error) {
+		exists[i], err = c.exists(keys[i])
+		return
+	})
+
+	for _, ok := range exists {
+		if ok {
+			count++
+		}
+	}
+
+	return count, err
+}
+
+// exists reports whether the key holds any live item.
+func (c Client) exists(key string) (exists bool, err error) {
 	var lastEvaluatedKey map[string]types.AttributeValue
 
-	for hasMoreResults {
+	for {
 		builder := newExpresionBuilder()
-		builder.addConditionEquality(c.partitionKey, StringValue{key})
+		builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(key)})
+		builder.addFilterNotExpired(expiryAttribute, time.Now())
 
-		resp, err := c.ddbClient.Query(context.TODO(), &dynamodb.QueryInput{
+		resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
 			ConsistentRead:            aws.Bool(c.consistentReads),
 			ExclusiveStartKey:         lastEvaluatedKey,
 			ExpressionAttributeNames:  builder.expressionAttributeNames(),
 			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			FilterExpression:          builder.filterExpression(),
 			KeyConditionExpression:    builder.conditionExpression(),
 			TableName:                 aws.String(c.tableName),
-			ProjectionExpression:      aws.String(c.sortKey),
-			Select:                    types.SelectSpecificAttributes,
 		})
+		if err != nil {
+			return false, err
+		}
+
+		if len(resp.Items) > 0 || len(resp.LastEvaluatedKey) == 0 {
+			return len(resp.Items) > 0, nil
+		}
+
+		lastEvaluatedKey = resp.LastEvaluatedKey
+	}
+}
+
+// KEYS returns all the keys matching the glob-style pattern. It runs SCAN until the whole table has been
+// read, so it is as expensive as a full table scan; prefer SCAN for large tables.
+//
+// Works similar to https://redis.io/commands/keys
+func (c Client) KEYS(pattern string) (keys []string, err error) {
+	c, finish := c.command("KEYS", nil, pattern)
+	defer finish(&err)
+
+	seen := make(map[string]struct{})
+	cursor := ScanStart
 
+	for {
+		var page []string
+
+		cursor, page, err = c.SCAN(cursor, pattern, 1000, "")
 		if err != nil {
-			return sortKeys, err
+			return keys, err
 		}
 
-		for _, item := range resp.Items {
-			parsedItem := parseItem(item, c)
-			sortKeys = append(sortKeys, parsedItem.sk)
+		for _, key := range page {
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				keys = append(keys, key)
+			}
 		}
 
-		if len(resp.LastEvaluatedKey) > 0 {
-			lastEvaluatedKey = resp.LastEvaluatedKey
-		} else {
-			hasMoreResults = false
+		if cursor == ScanStart {
+			return keys, nil
 		}
 	}
+}
 
-	return
+// KeyType is the type of the value stored at a key, as returned by TYPE.
+type KeyType string
+
+const (
+	TypeNone   KeyType = "none"
+	TypeString KeyType = "string"
+	TypeHash   KeyType = "hash"
+	TypeList   KeyType = "list"
+	TypeSet    KeyType = "set"
+	TypeZSet   KeyType = "zset"
+	TypeStream KeyType = "stream"
+	TypeGeo    KeyType = "geo"
+	TypeJSON   KeyType = "ReJSON-RL"
+)
+
+// typeKey is the metadata item recording the type of the key. It lives in the key's internal
+// partition, next to the bookkeeping of lists.
+func typeKey(key string) keyDef {
+	return keyDef{pk: "_redimo/" + key, sk: "_redimo/type"}
 }
 
-func (c Client) EXISTS(key string) (exists bool, err error) {
-	var lastEvaluatedKey map[string]types.AttributeValue
+// internalKey reports whether the key holds redimo's own bookkeeping, which is exempt from type checks.
+func internalKey(key string) bool {
+	return strings.HasPrefix(key, "_redimo/")
+}
+
+// TYPE returns the type of the value stored at the key, or TypeNone if the key does not exist.
+//
+// Clients returned by CheckTypes record the type of every key they write, and fail commands run against
+// a key holding another type with ErrWrongType. Keys written without type checks have their type
+// inferred from their items, and sets and geo keys written that way are reported as TypeZSet.
+//
+// Cost is O(1) / 1 RCU for the recorded type, plus the cost of checking that the key still exists.
+//
+// Works similar to https://redis.io/commands/type
+func (c Client) TYPE(key string) (keyType KeyType, err error) {
+	c, finish := c.command("TYPE", []string{key})
+	defer finish(&err)
+
+	recorded, err := c.recordedType(key)
+	if err != nil {
+		return keyType, err
+	}
+
+	if recorded == TypeNone {
+		return c.keyType(key)
+	}
+
+	exists, err := c.exists(key)
+	if err != nil || !exists {
+		return TypeNone, err
+	}
+
+	return recorded, nil
+}
+
+// SkipTypeChecks returns a copy of the client that neither checks nor records the types of keys. This
+// is the default: commands against a key of another type are not rejected with ErrWrongType, SET
+// doesn't delete what it replaces, and TYPE infers the type of the keys the client creates. It suits
+// applications that always use each key with a single type.
+func (c Client) SkipTypeChecks() Client {
+	c.checkTypes = false
+	return c
+}
+
+// CheckTypes returns a copy of the client that checks and records the types of keys, as Redis does:
+// commands run against a key holding another type fail with ErrWrongType, and SET replaces a key of
+// another type by deleting it first.
+//
+// Checking the type of a key, as every command that reads or writes a single key then does, is a
+// separate read of its recorded type before the command, 1 RCU. A key with no recorded type, or with
+// a recorded type other than the command's, costs a query of its first page on top, and the first
+// write of a type records it for 1 WCU. The check and the command are not atomic: a client that
+// replaces the key with another type in between is not detected, except in transactions, which
+// condition on the recorded type.
+func (c Client) CheckTypes() Client {
+	c.checkTypes = true
+	return c
+}
+
+// typeChecked reports whether commands check the type of the key.
+func (c Client) typeChecked(key string) bool {
+	return c.checkTypes && !internalKey(key)
+}
+
+func (c Client) recordedType(key string) (keyType KeyType, err error) {
+	resp, err := c.ddb().GetItem(c.ctx, &dynamodb.GetItemInput{
+		ConsistentRead: aws.Bool(c.consistentReads),
+		Key:            typeKey(key).toAV(c),
+		TableName:      aws.String(c.tableName),
+	})
+	if err != nil {
+		return keyType, err
+	}
+
+	if len(resp.Item) == 0 || c.expired(resp.Item, time.Now()) {
+		return TypeNone, nil
+	}
+
+	return KeyType(parseItem(resp.Item, c).val.String()), nil
+}
+
+// currentType returns the recorded type of the key, and the type the key actually holds. A recorded type
+// other than expected is verified against the data, because the key may have been emptied or may have
+// expired since, in which case it is reported as TypeNone.
+func (c Client) currentType(key string, expected KeyType) (recorded KeyType, actual KeyType, err error) {
+	recorded, err = c.recordedType(key)
+	if err != nil || recorded == expected {
+		return recorded, recorded, err
+	}
+
+	if recorded == TypeNone {
+		actual, err = c.keyType(key)
+		return recorded, actual, err
+	}
+
+	exists, err := c.exists(key)
+	if err != nil || !exists {
+		return recorded, TypeNone, err
+	}
+
+	return recorded, recorded, nil
+}
+
+// compatibleType reports whether a key holding the actual type can be used as the expected type. As in
+// Redis, geo keys are sorted sets, so sorted set commands accept them. Types inferred for keys written
+// before types were recorded cannot tell sets and geo keys from sorted sets.
+func compatibleType(actual KeyType, expected KeyType, inferred bool) bool {
+	if actual == TypeNone || actual == expected {
+		return true
+	}
+
+	if actual == TypeGeo && expected == TypeZSet {
+		return true
+	}
+
+	return inferred && actual == TypeZSet && (expected == TypeSet || expected == TypeGeo)
+}
+
+// checkType returns ErrWrongType if the key holds a value of a type other than expected.
+func (c Client) checkType(key string, expected KeyType) error {
+	if !c.typeChecked(key) {
+		return nil
+	}
+
+	recorded, actual, err := c.currentType(key, expected)
+	if err != nil {
+		return err
+	}
 
+	if !compatibleType(actual, expected, recorded == TypeNone) {
+		return ErrWrongType
+	}
+
+	return nil
+}
+
+// claimType records the expected type for the key before a write, and returns ErrWrongType if the key
+// holds a value of another type. Recording the type and writing the data are separate operations, so
+// concurrent writers of different types to a new key are not guaranteed to be detected.
+func (c Client) claimType(key string, expected KeyType) error {
+	if !c.typeChecked(key) {
+		return nil
+	}
+
+	recorded, actual, err := c.currentType(key, expected)
+	if err != nil || recorded == expected {
+		return err
+	}
+
+	if !compatibleType(actual, expected, recorded == TypeNone) {
+		return ErrWrongType
+	}
+
+	if actual != TypeNone && recorded != TypeNone {
+		return nil
+	}
+
+	return c.recordType(key, expected, recorded)
+}
+
+// recordType overwrites the recorded type of the key, provided it is still the previously recorded one.
+// Losing that race to another writer is reported as ErrWrongType unless the other writer recorded the
+// same type.
+func (c Client) recordType(key string, keyType KeyType, previous KeyType) error {
 	builder := newExpresionBuilder()
-	builder.addConditionEquality(c.partitionKey, StringValue{key})
+	builder.updateSET(vk, StringValue{string(keyType)})
 
-	resp, err := c.ddbClient.Query(context.TODO(), &dynamodb.QueryInput{
-		ConsistentRead:            aws.Bool(c.consistentReads),
-		ExclusiveStartKey:         lastEvaluatedKey,
+	if previous == TypeNone {
+		builder.addConditionNotExistsOrExpired(c.partitionKey, expiryAttribute, time.Now())
+	} else {
+		builder.condition(fmt.Sprintf("#%v = :previous", vk), vk)
+		builder.values["previous"] = StringValue{string(previous)}.ToAV()
+	}
+
+	_, err := c.ddb().UpdateItem(c.ctx, &dynamodb.UpdateItemInput{
+		ConditionExpression:       builder.conditionExpression(),
 		ExpressionAttributeNames:  builder.expressionAttributeNames(),
 		ExpressionAttributeValues: builder.expressionAttributeValues(),
-		KeyConditionExpression:    builder.conditionExpression(),
+		Key:                       typeKey(key).toAV(c),
 		TableName:                 aws.String(c.tableName),
+		UpdateExpression:          builder.updateExpression(),
 	})
+	if !errors.Is(err, ErrConditionFailed) {
+		return err
+	}
 
+	recorded, err := c.recordedType(key)
 	if err != nil {
-		return exists, err
+		return err
+	}
+
+	if recorded != keyType {
+		return ErrWrongType
+	}
+
+	return nil
+}
+
+// replaceType records the type for a write that replaces whatever the key holds, as SET does. A key of
+// another type is deleted first, and replaced is true. With the IfNotExists flag, a key of another type
+// is left alone and ok is false.
+func (c Client) replaceType(key string, keyType KeyType, flags Flags) (ok bool, replaced bool, err error) {
+	if !c.typeChecked(key) {
+		return true, false, nil
+	}
+
+	recorded, actual, err := c.currentType(key, keyType)
+	if err != nil || recorded == keyType {
+		return err == nil, false, err
+	}
+
+	if actual != TypeNone && actual != keyType {
+		if flags.has(IfNotExists) {
+			return false, false, nil
+		}
+
+		if _, err := c.del(key); err != nil {
+			return false, false, err
+		}
+
+		recorded, replaced = TypeNone, true
+	}
+
+	if err := c.recordType(key, keyType, recorded); err != nil {
+		return false, replaced, err
 	}
 
-	return len(resp.Items) > 0, nil
+	return true, replaced, nil
 }
 
-func (c Client) KEYS(key string) (keys []string, err error) {
+// keyType infers the type of the key from the layout of its first item, for keys that have no recorded
+// type. Sets, sorted sets and geo keys are stored the same way, so they are all reported as TypeZSet.
+func (c Client) keyType(key string) (keyType KeyType, err error) {
 	hasMoreResults := true
 
 	var lastEvaluatedKey map[string]types.AttributeValue
 
 	for hasMoreResults {
 		builder := newExpresionBuilder()
-		builder.addConditionBeginWith(c.partitionKey, StringValue{key})
+		builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(key)})
+		builder.addFilterNotExpired(expiryAttribute, time.Now())
 
-		resp, err := c.ddbClient.Query(context.TODO(), &dynamodb.QueryInput{
+		resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
 			ConsistentRead:            aws.Bool(c.consistentReads),
 			ExclusiveStartKey:         lastEvaluatedKey,
 			ExpressionAttributeNames:  builder.expressionAttributeNames(),
 			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			FilterExpression:          builder.filterExpression(),
 			KeyConditionExpression:    builder.conditionExpression(),
 			TableName:                 aws.String(c.tableName),
-			ProjectionExpression:      aws.String(c.sortKey),
-			Select:                    types.SelectSpecificAttributes,
 		})
 
 		if err != nil {
-			return keys, err
+			return keyType, err
+		}
+
+		if len(resp.Items) > 0 {
+			item := resp.Items[0]
+			_, hasVal := item[vk]
+			_, hasScore := item[c.sortKeyNum]
+			sk := parseKey(item, c).sk
+
+			switch {
+			case sk == "":
+				return TypeString, nil
+			case xidPattern.MatchString(sk):
+				return TypeStream, nil
+			case hasVal && hasScore:
+				return TypeList, nil
+			case hasVal:
+				return TypeHash, nil
+			default:
+				return TypeZSet, nil
+			}
+		}
+
+		if len(resp.LastEvaluatedKey) > 0 {
+			lastEvaluatedKey = resp.LastEvaluatedKey
+		} else {
+			hasMoreResults = false
+		}
+	}
+
+	return TypeNone, nil
+}
+
+var xidPattern = regexp.MustCompile(`^[0-9]{20}-[0-9]{20}$`)
+
+// ScanStart is the cursor that starts a new SCAN. SCAN returns it again once the whole table has been read.
+const ScanStart = "0"
+
+type scanCursor struct {
+	Segments []scanSegmentCursor `json:"s"`
+}
+
+type scanSegmentCursor struct {
+	Done    bool   `json:"d,omitempty"`
+	PK      string `json:"p,omitempty"`
+	SK      string `json:"k,omitempty"`
+	LastKey string `json:"l,omitempty"`
+}
+
+func (sc scanCursor) done() bool {
+	for _, segment := range sc.Segments {
+		if !segment.Done {
+			return false
 		}
+	}
+
+	return true
+}
+
+func (sc scanCursor) encode() string {
+	if sc.done() {
+		return ScanStart
+	}
+
+	b, _ := json.Marshal(sc)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
 
-		for _, item := range resp.Items {
-			parsedItem := parseItem(item, c)
-			keys = append(keys, parsedItem.sk)
+func decodeScanCursor(cursor string, segments int) (sc scanCursor, err error) {
+	if cursor == "" || cursor == ScanStart {
+		return scanCursor{Segments: make([]scanSegmentCursor, segments)}, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(b, &sc)
+	}
+
+	if err != nil || len(sc.Segments) == 0 {
+		return sc, fmt.Errorf("invalid SCAN cursor %q", cursor)
+	}
+
+	return sc, nil
+}
+
+// SCAN incrementally iterates over the keys in the table. Start with the ScanStart cursor, and call SCAN
+// again with the returned cursor until it returns ScanStart. Every key present for the whole iteration is
+// returned at least once; a key may occasionally be returned more than once.
+//
+// The match parameter is a glob-style pattern (as in Redis, with *, ?, [...] and \ escapes) that keys
+// must match; an empty pattern matches every key. Count is a hint for the number of items read from
+// DynamoDB on each call, and defaults to 10. A non-empty keyType only returns keys of that type, at the
+// cost of a TYPE lookup per candidate key, up to the client's Concurrency at a time. Redimo's internal bookkeeping keys are never returned.
+//
+// The table is scanned in parallel segments (see ScanSegments), and the cursor records the position
+// of each segment.
+//
+// Cost is O(N) / 1 RCU per 4KB of data read, where N is the number of items in the table.
+//
+// Works similar to https://redis.io/commands/scan
+func (c Client) SCAN(cursor string, match string, count int32, keyType KeyType) (nextCursor string, keys []string, err error) {
+	c, finish := c.command("SCAN", nil, cursor, match, count, keyType)
+	defer finish(&err)
+
+	sc, err := decodeScanCursor(cursor, c.scanSegments)
+	if err != nil {
+		return cursor, keys, err
+	}
+
+	if count <= 0 {
+		count = 10
+	}
+
+	var active []int
+
+	for i, segment := range sc.Segments {
+		if !segment.Done {
+			active = append(active, i)
 		}
+	}
+
+	limit := count / int32(len(active))
+	if limit < 1 {
+		limit = 1
+	}
+
+	pages := make([][]string, len(sc.Segments))
+	errs := make([]error, len(sc.Segments))
+
+	var wg sync.WaitGroup
+
+	for _, i := range active {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			pages[i], sc.Segments[i], errs[i] = c.scanSegment(i, len(sc.Segments), sc.Segments[i], limit)
+		}(i)
+	}
+
+	wg.Wait()
+
+	for _, i := range active {
+		if errs[i] != nil {
+			return cursor, nil, errs[i]
+		}
+
+		for _, key := range pages[i] {
+			if match == "" || globMatch(match, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	if keyType == "" {
+		return sc.encode(), keys, nil
+	}
+
+	keyTypes := make([]KeyType, len(keys))
+
+	err = c.fanOut(len(keys), func(i int) (err error) {
+		keyTypes[i], err = c.TYPE(keys[i])
+		return err
+	})
+	if err != nil {
+		return cursor, nil, err
+	}
+
+	typed := keys[:0]
+
+	for i, key := range keys {
+		if keyTypes[i] == keyType {
+			typed = append(typed, key)
+		}
+	}
+
+	return sc.encode(), typed, nil
+}
+
+// scanSegment reads one page of a segment of the table and returns the distinct user keys on it.
+func (c Client) scanSegment(segment int, totalSegments int, position scanSegmentCursor, limit int32) (keys []string, next scanSegmentCursor, err error) {
+	builder := newExpresionBuilder()
+	builder.addFilterNotExpired(expiryAttribute, time.Now())
+
+	// Keys of a namespace all begin with it, while its internal keys begin with "_redimo/".
+	if c.namespace != "" {
+		builder.filter(fmt.Sprintf("begins_with(#%v, :namespace)", c.partitionKey), c.partitionKey)
+		builder.values["namespace"] = StringValue{c.namespace}.ToAV()
+	} else {
+		builder.filter(fmt.Sprintf("NOT begins_with(#%v, :internal)", c.partitionKey), c.partitionKey)
+		builder.values["internal"] = StringValue{"_redimo/"}.ToAV()
+	}
+
+	// The position is kept as stored, since the last item evaluated may belong to another namespace.
+	var startKey map[string]types.AttributeValue
+	if position.PK != "" {
+		startKey = keyDef{pk: position.PK, sk: position.SK}.toAV(c.withoutNamespace())
+	}
+
+	resp, err := c.ddb().Scan(c.ctx, &dynamodb.ScanInput{
+		ConsistentRead:            aws.Bool(c.consistentReads),
+		ExclusiveStartKey:         startKey,
+		ExpressionAttributeNames:  builder.expressionAttributeNames(),
+		ExpressionAttributeValues: builder.expressionAttributeValues(),
+		FilterExpression:          builder.filterExpression(),
+		Limit:                     aws.Int32(limit),
+		ProjectionExpression:      aws.String(fmt.Sprintf("#%v", c.partitionKey)),
+		Segment:                   aws.Int32(int32(segment)),
+		TableName:                 aws.String(c.tableName),
+		TotalSegments:             aws.Int32(int32(totalSegments)),
+	})
+	if err != nil {
+		return nil, position, err
+	}
+
+	next = position
+
+	for _, item := range resp.Items {
+		key := parseKey(item, c).pk
+		if key == next.LastKey {
+			continue
+		}
+
+		keys = append(keys, key)
+		next.LastKey = key
+	}
+
+	if len(resp.LastEvaluatedKey) > 0 {
+		lastKey := parseKey(resp.LastEvaluatedKey, c.withoutNamespace())
+		next.PK, next.SK = lastKey.pk, lastKey.sk
+	} else {
+		next = scanSegmentCursor{Done: true}
+	}
+
+	return keys, next, nil
+}
+
+// globMatch reports whether the string matches the Redis glob-style pattern.
+func globMatch(pattern string, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+
+			if len(pattern) == 1 {
+				return true
+			}
+
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+
+			s = s[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 1 {
+				if s[0] != '[' {
+					return false
+				}
+
+				s = s[1:]
+				pattern = pattern[1:]
+
+				continue
+			}
+
+			class := pattern[1 : end+1]
+			negate := class[0] == '^'
+
+			if negate {
+				class = class[1:]
+			}
+
+			matched := false
+
+			for i := 0; i < len(class); i++ {
+				switch {
+				case class[i] == '\\' && i+1 < len(class):
+					i++
+					matched = matched || class[i] == s[0]
+				case i+2 < len(class) && class[i+1] == '-':
+					lo, hi := class[i], class[i+2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+
+					matched = matched || (s[0] >= lo && s[0] <= hi)
+					i += 2
+				default:
+					matched = matched || class[i] == s[0]
+				}
+			}
+
+			if matched == negate {
+				return false
+			}
+
+			s = s[1:]
+			pattern = pattern[end+2:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+
+			s = s[1:]
+			pattern = pattern[1:]
+		}
+	}
+
+	return len(s) == 0
+}
+
+// EXPIRE sets a timeout, in seconds, on the key. Every item of the key (the string value, each hash
+// field, set or sorted set member, or list element) carries the expiry, as do its recorded type, list
+// indexes, stream sequence and consumer groups, so the whole key disappears at once. Returns false if
+// the key does not exist. A timeout that is zero or negative deletes the key.
+//
+// Commands that add to a key read its expiry first, 1 RCU, and stamp it on the items they add, so that
+// they expire with the rest of the key.
+//
+// Cost is O(size) / 1 WCU for each item of the key.
+//
+// Works similar to https://redis.io/commands/expire
+func (c Client) EXPIRE(key string, seconds int64) (ok bool, err error) {
+	c, finish := c.command("EXPIRE", []string{key}, seconds)
+	defer finish(&err)
+
+	return c.expireAt(key, time.Now().Add(time.Duration(seconds)*time.Second))
+}
+
+// PEXPIRE is like EXPIRE, but the timeout is in milliseconds.
+//
+// Works similar to https://redis.io/commands/pexpire
+func (c Client) PEXPIRE(key string, milliseconds int64) (ok bool, err error) {
+	c, finish := c.command("PEXPIRE", []string{key}, milliseconds)
+	defer finish(&err)
+
+	return c.expireAt(key, time.Now().Add(time.Duration(milliseconds)*time.Millisecond))
+}
+
+// EXPIREAT is like EXPIRE, but takes an absolute Unix timestamp in seconds.
+//
+// Works similar to https://redis.io/commands/expireat
+func (c Client) EXPIREAT(key string, unixSeconds int64) (ok bool, err error) {
+	c, finish := c.command("EXPIREAT", []string{key}, unixSeconds)
+	defer finish(&err)
+
+	return c.expireAt(key, time.Unix(unixSeconds, 0))
+}
+
+// PEXPIREAT is like EXPIREAT, but the timestamp is in milliseconds.
+//
+// Works similar to https://redis.io/commands/pexpireat
+func (c Client) PEXPIREAT(key string, unixMilliseconds int64) (ok bool, err error) {
+	c, finish := c.command("PEXPIREAT", []string{key}, unixMilliseconds)
+	defer finish(&err)
+
+	return c.expireAt(key, time.UnixMilli(unixMilliseconds))
+}
+
+func (c Client) expireAt(key string, at time.Time) (ok bool, err error) {
+	if !at.After(time.Now()) {
+		return c.del(key)
+	}
+
+	items, err := c.keyItems(key)
+	if err != nil {
+		return false, err
+	}
+
+	for _, item := range items {
+		builder := newExpresionBuilder()
+		builder.updateSetExpiry(c.ttlAttribute, expiryAV(at))
+		builder.addConditionExists(c.partitionKey)
+
+		_, err := c.updateItem(&dynamodb.UpdateItemInput{
+			ConditionExpression:       builder.conditionExpression(),
+			ExpressionAttributeNames:  builder.expressionAttributeNames(),
+			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			Key:                       item.toAV(c),
+			TableName:                 aws.String(c.tableName),
+			UpdateExpression:          builder.updateExpression(),
+		})
+		if errors.Is(err, ErrConditionFailed) {
+			continue
+		}
+
+		if err != nil {
+			return ok, err
+		}
+
+		ok = ok || item.pk == key
+	}
+
+	return
+}
+
+// TTL returns the remaining time to live of the key, in seconds. Returns -2 if the key does not exist
+// and -1 if the key exists but has no expiry.
+//
+// Works similar to https://redis.io/commands/ttl
+func (c Client) TTL(key string) (seconds int64, err error) {
+	c, finish := c.command("TTL", []string{key})
+	defer finish(&err)
+
+	ms, err := c.PTTL(key)
+	if err != nil || ms < 0 {
+		return ms, err
+	}
+
+	return (ms + 500) / 1000, nil
+}
+
+// PTTL is like TTL, but returns the remaining time to live in milliseconds.
+//
+// Works similar to https://redis.io/commands/pttl
+func (c Client) PTTL(key string) (milliseconds int64, err error) {
+	c, finish := c.command("PTTL", []string{key})
+	defer finish(&err)
+
+	expiry, exists, err := c.currentExpiry(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if !exists {
+		return -2, nil
+	}
+
+	at, ok := parseExpiry(expiry)
+	if !ok {
+		return -1, nil
+	}
+
+	return time.Until(at).Milliseconds(), nil
+}
+
+// PERSIST removes the expiry from the key. Returns false if the key does not exist or has no expiry.
+//
+// Cost is O(size) / 1 WCU for each item of the key.
+//
+// Works similar to https://redis.io/commands/persist
+func (c Client) PERSIST(key string) (ok bool, err error) {
+	c, finish := c.command("PERSIST", []string{key})
+	defer finish(&err)
+
+	items, err := c.keyItems(key)
+	if err != nil {
+		return false, err
+	}
+
+	for _, item := range items {
+		builder := newExpresionBuilder()
+		builder.updateRemoveExpiry(c.ttlAttribute)
+		builder.addConditionGreaterThan(expiryAttribute, ReturnValue{expiryAV(time.Now())})
+
+		_, err := c.ddb().UpdateItem(c.ctx, &dynamodb.UpdateItemInput{
+			ConditionExpression:       builder.conditionExpression(),
+			ExpressionAttributeNames:  builder.expressionAttributeNames(),
+			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			Key:                       item.toAV(c),
+			TableName:                 aws.String(c.tableName),
+			UpdateExpression:          builder.updateExpression(),
+		})
+		if errors.Is(err, ErrConditionFailed) {
+			continue
+		}
+
+		if err != nil {
+			return ok, err
+		}
+
+		ok = ok || item.pk == key
+	}
+
+	return
+}
+
+// expiryAttribute holds the expiry of an item as epoch milliseconds, which is what commands compare to
+// the time they run at. The TTL attribute holds the same expiry rounded up to whole epoch seconds, as
+// DynamoDB's Time to Live expects, so that DynamoDB deletes the item some time after it expires.
+const expiryAttribute = "expiry"
+
+// expiryAV encodes an expiry time as epoch milliseconds, for the expiry attribute.
+func expiryAV(t time.Time) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(t.UnixMilli(), 10)}
+}
+
+// ttlAV encodes an expiry, as held by the expiry attribute, as whole epoch seconds for the TTL
+// attribute. It is rounded up, so that DynamoDB never deletes an item before it expires.
+func ttlAV(expiry types.AttributeValue) types.AttributeValue {
+	at, _ := parseExpiry(expiry)
+	seconds := at.Unix()
+
+	if at.Nanosecond() > 0 {
+		seconds++
+	}
+
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(seconds, 10)}
+}
+
+func parseExpiry(av types.AttributeValue) (at time.Time, ok bool) {
+	n, isN := av.(*types.AttributeValueMemberN)
+	if !isN {
+		return at, false
+	}
+
+	ms, err := strconv.ParseInt(n.Value, 10, 64)
+	if err != nil {
+		return at, false
+	}
+
+	return time.UnixMilli(ms), true
+}
+
+// updateSetExpiry sets the expiry of the item, in both the expiry and the TTL attributes.
+func (b *expressionBuilder) updateSetExpiry(ttlAttribute string, expiry types.AttributeValue) {
+	b.updateSetAV(expiryAttribute, expiry)
+	b.updateSetAV(ttlAttribute, ttlAV(expiry))
+}
+
+// updateRemoveExpiry removes the expiry of the item.
+func (b *expressionBuilder) updateRemoveExpiry(ttlAttribute string) {
+	b.updateREMOVE(expiryAttribute)
+	b.updateREMOVE(ttlAttribute)
+}
+
+// stampExpiry sets the expiry of the item to put.
+func (c Client) stampExpiry(item map[string]types.AttributeValue, expiry types.AttributeValue) {
+	item[expiryAttribute] = expiry
+	item[c.ttlAttribute] = ttlAV(expiry)
+}
+
+// expired reports whether the item carries an expiry at or before now.
+func (c Client) expired(item map[string]types.AttributeValue, now time.Time) bool {
+	at, ok := parseExpiry(item[expiryAttribute])
+	return ok && !at.After(now)
+}
+
+// updateItem runs an UpdateItem against the live item at the input's key. An item that has expired,
+// but has not been deleted by DynamoDB yet, is treated as absent: it is deleted and the update is
+// retried, so conditions and return values see an empty item and the expiry does not carry over.
+func (c Client) updateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	now := time.Now()
+	live := *input
+
+	builder := newExpresionBuilder()
+	builder.addConditionNotExpired(expiryAttribute, now)
+
+	live.ConditionExpression = builder.conditionExpression()
+	if input.ConditionExpression != nil {
+		live.ConditionExpression = aws.String(fmt.Sprintf("(%v) AND %v", *input.ConditionExpression, *live.ConditionExpression))
+	}
+
+	live.ExpressionAttributeNames = builder.expressionAttributeNames()
+	for k, v := range input.ExpressionAttributeNames {
+		live.ExpressionAttributeNames[k] = v
+	}
+
+	live.ExpressionAttributeValues = builder.expressionAttributeValues()
+	for k, v := range input.ExpressionAttributeValues {
+		live.ExpressionAttributeValues[k] = v
+	}
+
+	resp, err := c.ddb().UpdateItem(c.ctx, &live)
+	if !errors.Is(err, ErrConditionFailed) {
+		return resp, err
+	}
+
+	deleted, deleteErr := c.deleteExpired(input.Key, now)
+	if deleteErr != nil {
+		return nil, deleteErr
+	}
+
+	if !deleted {
+		return resp, err
+	}
+
+	return c.ddb().UpdateItem(c.ctx, input)
+}
+
+// deleteExpired deletes the item at the given key if it expired at or before now, and releases the
+// blobs it points to if the client has a blob store.
+func (c Client) deleteExpired(key map[string]types.AttributeValue, now time.Time) (deleted bool, err error) {
+	builder := newExpresionBuilder()
+	builder.condition(fmt.Sprintf("#%v <= :now", expiryAttribute), expiryAttribute)
+	builder.values["now"] = expiryAV(now)
+
+	resp, err := c.ddb().DeleteItem(c.ctx, &dynamodb.DeleteItemInput{
+		ConditionExpression:       builder.conditionExpression(),
+		ExpressionAttributeNames:  builder.expressionAttributeNames(),
+		ExpressionAttributeValues: builder.expressionAttributeValues(),
+		Key:                       key,
+		ReturnValues:              types.ReturnValueAllOld,
+		TableName:                 aws.String(c.tableName),
+	})
+	if errors.Is(err, ErrConditionFailed) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, c.releaseReplaced(itemBlobPointers(resp.Attributes))
+}
+
+// RENAME renames the key to newKey, replacing any value at newKey. Returns ErrNoSuchKey if the key does
+// not exist. Every item of the key moves, along with its bookkeeping: list indexes, stream sequences and
+// consumer groups. Expiries move with the items.
+//
+// The rename is atomic when the items to be written and deleted fit in a single transaction: no more
+// than TransactionActions of them, and no more than DynamoDB's 4 MB in all. Larger keys are moved in several transactions: the items at newKey are cleared,
+// the key's items are copied over, and then deleted. A failure part of the way leaves both keys partially
+// written, and running RENAME again completes the move.
+//
+// Consumer groups created before redimo recorded them are not moved.
+//
+// Cost is O(N) / 1 RCU per 4KB read, and 2 WCU per item written or deleted in a transaction, where N is the
+// number of items of both keys.
+//
+// Works similar to https://redis.io/commands/rename
+func (c Client) RENAME(key string, newKey string) (err error) {
+	c, finish := c.command("RENAME", []string{key, newKey})
+	defer finish(&err)
+
+	if key == newKey {
+		return c.requireKey(key)
+	}
+
+	_, err = c.moveKey(key, newKey, true, true)
+
+	return
+}
+
+// RENAMENX is like RENAME, but only renames the key if newKey does not exist, and returns false otherwise.
+// Whether newKey exists is checked before the rename, not as part of it.
+//
+// Works similar to https://redis.io/commands/renamenx
+func (c Client) RENAMENX(key string, newKey string) (ok bool, err error) {
+	c, finish := c.command("RENAMENX", []string{key, newKey})
+	defer finish(&err)
+
+	if key == newKey {
+		return false, c.requireKey(key)
+	}
+
+	return c.moveKey(key, newKey, false, true)
+}
+
+// COPY copies the value at the source key to the destination key, with the same atomicity and cost as
+// RENAME. Returns false if the source does not exist, or if the destination exists and the Replace flag is
+// not given.
+//
+// Works similar to https://redis.io/commands/copy
+func (c Client) COPY(source string, destination string, flags Flags) (ok bool, err error) {
+	c, finish := c.command("COPY", []string{source, destination}, flags)
+	defer finish(&err)
+
+	if source == destination {
+		return false, ErrSameKey
+	}
+
+	ok, err = c.moveKey(source, destination, flags.has(Replace), false)
+	if err == ErrNoSuchKey {
+		return false, nil
+	}
+
+	return
+}
+
+func (c Client) requireKey(key string) error {
+	exists, err := c.exists(key)
+	if err == nil && !exists {
+		err = ErrNoSuchKey
+	}
+
+	return err
+}
+
+// keyPartition is a partition holding some of a key's items. The partitions of a key's bookkeeping are
+// named after the key, so one may be shared with the bookkeeping of another key: the internal partition of
+// "orders/workers" is the partition of consumer group "workers" of stream "orders". owns tells the sort
+// keys that belong to the key apart, and is nil for the key's own partition, which holds nothing else.
+type keyPartition struct {
+	pk   string
+	owns func(sk string) bool
+}
+
+// keyPartitions returns the partitions holding the key's items and bookkeeping: the key itself, its
+// internal partition (type, list indexes and consumer group registrations), the stream sequence
+// counters, and one partition per consumer group.
+func (c Client) keyPartitions(key string, groups []string) []keyPartition {
+	partitions := []keyPartition{
+		{pk: key},
+		{pk: "_redimo/" + key, owns: isInternalSortKey},
+		{pk: xSequenceKey(key).pk, owns: func(sk string) bool { return sk == xSequenceKey(key).sk }},
+		{pk: xCountKey(key), owns: func(sk string) bool { return sk == "" }},
+	}
+
+	for _, group := range groups {
+		partitions = append(partitions, keyPartition{pk: c.xGroupKey(key, group), owns: isXGroupSortKey})
+	}
+
+	return partitions
+}
+
+// ownsItem reports whether the item of the partition belongs to the key.
+func (p keyPartition) ownsItem(item map[string]types.AttributeValue, c Client) bool {
+	return p.owns == nil || p.owns(parseKey(item, c).sk)
+}
+
+// ownedItems returns the items of the partition that belong to its key.
+func ownedItems(p keyPartition, items []map[string]types.AttributeValue, c Client) []map[string]types.AttributeValue {
+	owned := items[:0]
+
+	for _, item := range items {
+		if p.ownsItem(item, c) {
+			owned = append(owned, item)
+		}
+	}
+
+	return owned
+}
+
+// isInternalSortKey reports whether the sort key is one of those a key's internal partition holds.
+func isInternalSortKey(sk string) bool {
+	switch sk {
+	case typeKey("").sk, ListSKIndexLeft, ListSKIndexRight, ListSKIndexCount:
+		return true
+	}
+
+	return strings.HasPrefix(sk, xGroupsPrefix)
+}
+
+// isXGroupSortKey reports whether the sort key is one of those a consumer group partition holds: the
+// group's cursor and the IDs of its pending entries.
+func isXGroupSortKey(sk string) bool {
+	if sk == xGroupCursorSK {
+		return true
+	}
+
+	parts := strings.Split(sk, "-")
+
+	return len(parts) == 2 && isDigits(parts[0]) && isDigits(parts[1])
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return s != ""
+}
+
+// moveKey copies every partition of the key to the matching partition of newKey, clearing whatever newKey
+// held before, and deletes the key's items if remove is set. Unless replace is set, nothing happens if
+// newKey exists.
+func (c Client) moveKey(key string, newKey string, replace bool, remove bool) (ok bool, err error) {
+	if err = c.requireKey(key); err != nil {
+		return false, err
+	}
+
+	if !replace {
+		exists, err := c.exists(newKey)
+		if err != nil || exists {
+			return false, err
+		}
+	}
+
+	groups, err := c.xGroups(key)
+	if err != nil {
+		return false, err
+	}
+
+	newGroups, err := c.xGroups(newKey)
+	if err != nil {
+		return false, err
+	}
+
+	var puts, clears, deletes []types.TransactWriteItem
+
+	touched := make(map[keyDef]struct{})
+	from, to := c.keyPartitions(key, groups), c.keyPartitions(newKey, groups)
+	now := time.Now()
+
+	var (
+		sourceKeys []keyDef
+		released   []blobPointer
+	)
+
+	for i, p := range from {
+		items, err := c.partitionItems(p.pk)
+		if err != nil {
+			return false, err
+		}
+
+		items = ownedItems(p, items, c)
+
+		var replacedChunks []string
+
+		for _, item := range items {
+			if c.expired(item, now) {
+				continue
+			}
+
+			// A copy is another pointer to the same blobs.
+			if !remove {
+				if err = c.acquireBlobs(item); err != nil {
+					return false, err
+				}
+			}
+
+			// Encrypted values are bound to their key, so they are stored anew for the new one, and what
+			// they replace is released instead of moved.
+			valuePuts, chunkPrefixes, pointers, err := c.rebindItem(item, p.pk, to[i].pk)
+			if err != nil {
+				return false, err
+			}
+
+			puts = append(puts, valuePuts...)
+			replacedChunks = append(replacedChunks, chunkPrefixes...)
+			released = append(released, pointers...)
+		}
+
+		for _, item := range items {
+			sourceKeys = append(sourceKeys, parseKey(item, c))
+
+			if c.expired(item, now) || hasAnyPrefix(parseKey(item, c).sk, replacedChunks) {
+				continue
+			}
+
+			target := keyDef{pk: to[i].pk, sk: parseKey(item, c).sk}
+			touched[target] = struct{}{}
+
+			item[c.partitionKey] = StringValue{c.namespaced(target.pk)}.ToAV()
+			puts = append(puts, types.TransactWriteItem{Put: &types.Put{
+				Item:      item,
+				TableName: aws.String(c.tableName),
+			}})
+		}
+	}
+
+	deleteAction := func(k keyDef) types.TransactWriteItem {
+		touched[k] = struct{}{}
+
+		return types.TransactWriteItem{Delete: &types.Delete{
+			Key:       k.toAV(c),
+			TableName: aws.String(c.tableName),
+		}}
+	}
+
+	for _, p := range c.keyPartitions(newKey, newGroups) {
+		items, err := c.partitionItems(p.pk)
+		if err != nil {
+			return false, err
+		}
+
+		for _, item := range ownedItems(p, items, c) {
+			released = append(released, itemBlobPointers(item)...)
+
+			if k := parseKey(item, c); !isTouched(touched, k) {
+				clears = append(clears, deleteAction(k))
+			}
+		}
+	}
+
+	if remove {
+		for _, k := range sourceKeys {
+			if !isTouched(touched, k) {
+				deletes = append(deletes, deleteAction(k))
+			}
+		}
+	}
+
+	actions := append(append(clears, puts...), deletes...)
+	if len(actions) <= c.transactionActions && transactionSize(actions) <= maxTransactionSize {
+		_, err = c.ddb().TransactWriteItems(c.ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: actions,
+		})
+		if err != nil {
+			return false, err
+		}
+
+		return true, c.releaseReplaced(released)
+	}
+
+	for _, phase := range [][]types.TransactWriteItem{clears, puts, deletes} {
+		for len(phase) > 0 {
+			n, size := 0, 0
+			for n < len(phase) && n < c.transactionActions {
+				size += transactionSize(phase[n : n+1])
+				if n > 0 && size > maxTransactionSize {
+					break
+				}
+
+				n++
+			}
+
+			batch := phase[:n]
+			phase = phase[n:]
+
+			_, err = c.ddb().TransactWriteItems(c.ctx, &dynamodb.TransactWriteItemsInput{
+				TransactItems: batch,
+			})
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+
+	return true, c.releaseReplaced(released)
+}
+
+// releaseReplaced releases the blobs of the items a move replaced. Without a blob store they are left
+// referenced, so that they are never deleted while in use.
+func (c Client) releaseReplaced(pointers []blobPointer) error {
+	if c.blobs == nil {
+		return nil
+	}
+
+	for _, p := range pointers {
+		if err := c.releaseBlob(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isTouched(touched map[keyDef]struct{}, k keyDef) bool {
+	_, ok := touched[k]
+	return ok
+}
+
+// partitionItems reads every item in the partition, including expired items that DynamoDB has not
+// deleted yet.
+func (c Client) partitionItems(pk string) (items []map[string]types.AttributeValue, err error) {
+	hasMoreResults := true
+
+	var lastEvaluatedKey map[string]types.AttributeValue
+
+	for hasMoreResults {
+		builder := newExpresionBuilder()
+		builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(pk)})
+
+		resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
+			ConsistentRead:            aws.Bool(c.consistentReads),
+			ExclusiveStartKey:         lastEvaluatedKey,
+			ExpressionAttributeNames:  builder.expressionAttributeNames(),
+			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			KeyConditionExpression:    builder.conditionExpression(),
+			TableName:                 aws.String(c.tableName),
+		})
+		if err != nil {
+			return items, err
+		}
+
+		items = append(items, resp.Items...)
 
 		if len(resp.LastEvaluatedKey) > 0 {
 			lastEvaluatedKey = resp.LastEvaluatedKey
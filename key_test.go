@@ -1,8 +1,17 @@
 package redimo
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -20,14 +29,823 @@ func TestBasicKey(t *testing.T) {
 
 	exists, err := c.EXISTS("k1")
 	assert.NoError(t, err)
-	assert.True(t, exists)
+	assert.EqualValues(t, 1, exists)
 
-	deletedFields, err := c.DEL("k1")
+	deletedKeys, err := c.DEL("k1")
 	assert.NoError(t, err)
-	assert.Equal(t, 2, len(deletedFields))
-	assert.ElementsMatch(t, []string{"f1", "f2"}, deletedFields)
+	assert.EqualValues(t, 1, deletedKeys)
 
 	exists, err = c.EXISTS("k1")
 	assert.NoError(t, err)
-	assert.False(t, exists)
+	assert.EqualValues(t, 0, exists)
+}
+
+func TestDelBookkeeping(t *testing.T) {
+	c := newClient(t)
+
+	_, err := c.RPUSH("list", StringValue{"e1"}, StringValue{"e2"})
+	assert.NoError(t, err)
+
+	_, err = c.XADD("stream", XAutoID, map[string]Value{"f": StringValue{"1"}})
+	assert.NoError(t, err)
+
+	err = c.XGROUP("stream", "g1", XStart)
+	assert.NoError(t, err)
+
+	_, err = c.XREADGROUP("stream", "g1", "consumer", XReadNew, 1)
+	assert.NoError(t, err)
+
+	deletedKeys, err := c.DEL("list", "stream")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, deletedKeys)
+
+	for _, p := range append(c.keyPartitions("list", nil), c.keyPartitions("stream", []string{"g1"})...) {
+		items, err := c.partitionItems(p.pk)
+		assert.NoError(t, err)
+		assert.Empty(t, items, p.pk)
+	}
+
+	id, err := c.XADD("stream", XAutoID, map[string]Value{"f": StringValue{"2"}})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, id.Seq())
+
+	_, err = c.XREADGROUP("stream", "g1", "consumer", XReadNew, 1)
+	assert.Equal(t, ErrXGroupNotInitialized, err)
+}
+
+func TestMultiKey(t *testing.T) {
+	c := newClient(t).Concurrency(3)
+
+	fields := make(map[string]Value)
+	for i := 0; i < 2500; i++ {
+		fields[strconv.Itoa(i)] = StringValue{"v"}
+	}
+
+	assert.NoError(t, c.HMSET("h1", fields))
+
+	_, err := c.SET("k1", StringValue{"v1"})
+	assert.NoError(t, err)
+
+	_, err = c.SADD("s1", "m1")
+	assert.NoError(t, err)
+
+	count, err := c.EXISTS("h1", "k1", "k1", "nosuchkey")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, count)
+
+	deletedKeys, err := c.DEL("h1", "k1", "k1", "nosuchkey")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, deletedKeys)
+
+	count, err = c.EXISTS("h1", "k1", "s1")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, count)
+
+	keyType, err := c.TYPE("h1")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeNone, keyType)
+
+	result := <-c.UNLINK("s1", "nosuchkey")
+	assert.NoError(t, result.Err)
+	assert.EqualValues(t, 1, result.DeletedKeys)
+
+	count, err = c.EXISTS("s1")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, count)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result = <-c.WithContext(ctx).UNLINK("s1")
+	assert.True(t, errors.Is(result.Err, context.Canceled))
+}
+
+func TestExpire(t *testing.T) {
+	c := newClient(t)
+
+	ok, err := c.EXPIRE("missing", 10)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	ttl, err := c.TTL("missing")
+	assert.NoError(t, err)
+	assert.EqualValues(t, -2, ttl)
+
+	_, err = c.HSET("h1", map[string]Value{"f1": StringValue{"v1"}, "f2": StringValue{"v2"}})
+	assert.NoError(t, err)
+
+	ttl, err = c.TTL("h1")
+	assert.NoError(t, err)
+	assert.EqualValues(t, -1, ttl)
+
+	ok, err = c.EXPIRE("h1", 100)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ttl, err = c.TTL("h1")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 100, ttl)
+
+	pttl, err := c.PTTL("h1")
+	assert.NoError(t, err)
+	assert.InDelta(t, 100000, pttl, 1000)
+
+	ok, err = c.PERSIST("h1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = c.PERSIST("h1")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	ttl, err = c.TTL("h1")
+	assert.NoError(t, err)
+	assert.EqualValues(t, -1, ttl)
+
+	ok, err = c.PEXPIREAT("h1", time.Now().Add(20*time.Millisecond).UnixMilli())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = c.SADD("s1", "m1", "m2")
+	assert.NoError(t, err)
+
+	_, err = c.ZADD("z1", map[string]float64{"m1": 1, "m2": 2}, Flags{})
+	assert.NoError(t, err)
+
+	_, err = c.RPUSH("l1", StringValue{"e1"}, StringValue{"e2"})
+	assert.NoError(t, err)
+
+	for _, key := range []string{"s1", "z1", "l1"} {
+		ok, err = c.PEXPIRE(key, 20)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	fields, err := c.HGETALL("h1")
+	assert.NoError(t, err)
+	assert.Empty(t, fields)
+
+	val, err := c.HGET("h1", "f1")
+	assert.NoError(t, err)
+	assert.False(t, val.Present())
+
+	count, err := c.HLEN("h1")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, count)
+
+	members, err := c.SMEMBERS("s1")
+	assert.NoError(t, err)
+	assert.Empty(t, members)
+
+	isMember, err := c.SISMEMBER("s1", "m1")
+	assert.NoError(t, err)
+	assert.False(t, isMember)
+
+	zMembers, err := c.ZRANGE("z1", 0, -1)
+	assert.NoError(t, err)
+	assert.Empty(t, zMembers)
+
+	_, found, err := c.ZSCORE("z1", "m1")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	length, err := c.LLEN("l1")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, length)
+
+	elements, err := c.LRANGE("l1", 0, -1)
+	assert.NoError(t, err)
+	assert.Empty(t, elements)
+
+	exists, err := c.EXISTS("h1")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, exists)
+
+	ttl, err = c.TTL("h1")
+	assert.NoError(t, err)
+	assert.EqualValues(t, -2, ttl)
+
+	savedFields, err := c.HSET("h1", map[string]Value{"f1": StringValue{"fresh"}})
+	assert.NoError(t, err)
+	assert.Len(t, savedFields, 1)
+
+	fields, err = c.HGETALL("h1")
+	assert.NoError(t, err)
+	assert.Len(t, fields, 1)
+	assert.Equal(t, "fresh", fields["f1"].String())
+
+	ttl, err = c.TTL("h1")
+	assert.NoError(t, err)
+	assert.EqualValues(t, -1, ttl)
+
+	addedMembers, err := c.SADD("s1", "m1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"m1"}, addedMembers)
+
+	ok, err = c.EXPIRE("s1", 0)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	members, err = c.SMEMBERS("s1")
+	assert.NoError(t, err)
+	assert.Empty(t, members)
+}
+
+func TestExpiryAttributes(t *testing.T) {
+	c := newClient(t)
+
+	_, err := c.HSET("h", map[string]Value{"f": StringValue{"v"}})
+	assert.NoError(t, err)
+
+	at := time.Now().Add(time.Hour).Truncate(time.Second).Add(250 * time.Millisecond)
+
+	ok, err := c.PEXPIREAT("h", at.UnixMilli())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	items, err := c.partitionItems("h")
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+
+	// DynamoDB's Time to Live takes whole seconds, so the TTL attribute is rounded up.
+	assert.Equal(t, &types.AttributeValueMemberN{Value: strconv.FormatInt(at.Unix()+1, 10)}, items[0][c.ttlAttribute])
+	assert.Equal(t, &types.AttributeValueMemberN{Value: strconv.FormatInt(at.UnixMilli(), 10)}, items[0][expiryAttribute])
+
+	pttl, err := c.PTTL("h")
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Until(at).Milliseconds(), pttl, 100)
+
+	ok, err = c.PERSIST("h")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	items, err = c.partitionItems("h")
+	assert.NoError(t, err)
+	assert.NotContains(t, items[0], c.ttlAttribute)
+	assert.NotContains(t, items[0], expiryAttribute)
+}
+
+func TestExpireInherited(t *testing.T) {
+	c := newClient(t)
+
+	_, err := c.HSET("h", map[string]Value{"f1": StringValue{"v1"}})
+	assert.NoError(t, err)
+
+	_, err = c.RPUSH("l", StringValue{"e1"})
+	assert.NoError(t, err)
+
+	_, err = c.XADD("stream", XAutoID, map[string]Value{"f": StringValue{"1"}})
+	assert.NoError(t, err)
+
+	err = c.XGROUP("stream", "g1", XStart)
+	assert.NoError(t, err)
+
+	for _, key := range []string{"h", "l", "stream"} {
+		ok, err := c.EXPIRE(key, 3600)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+
+	_, err = c.HSET("h", map[string]Value{"f2": StringValue{"v2"}})
+	assert.NoError(t, err)
+
+	_, err = c.RPUSH("l", StringValue{"e2"})
+	assert.NoError(t, err)
+
+	_, err = c.XADD("stream", XAutoID, map[string]Value{"f": StringValue{"2"}})
+	assert.NoError(t, err)
+
+	_, err = c.XREADGROUP("stream", "g1", "consumer", XReadNew, 1)
+	assert.NoError(t, err)
+
+	// Every item of the keys, bookkeeping included, expires with them.
+	partitions := append(c.keyPartitions("h", nil), c.keyPartitions("l", nil)...)
+	partitions = append(partitions, c.keyPartitions("stream", []string{"g1"})...)
+
+	for _, p := range partitions {
+		items, err := c.partitionItems(p.pk)
+		assert.NoError(t, err)
+
+		for _, item := range ownedItems(p, items, c) {
+			assert.WithinDuration(t, time.Now().Add(time.Hour), c.itemExpiry(item), time.Minute, "%v %v", p.pk, parseKey(item, c).sk)
+			assert.NotNil(t, item[c.ttlAttribute])
+		}
+	}
+
+	ok, err := c.PEXPIRE("stream", 20)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	time.Sleep(30 * time.Millisecond)
+
+	keyType, err := c.TYPE("stream")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeNone, keyType)
+
+	_, err = c.XREADGROUP("stream", "g1", "consumer", XReadNew, 1)
+	assert.Equal(t, ErrXGroupNotInitialized, err)
+
+	id, err := c.XADD("stream", XAutoID, map[string]Value{"f": StringValue{"3"}})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, id.Seq())
+
+	// A key written after it expired starts without an expiry.
+	ttl, err := c.TTL("stream")
+	assert.NoError(t, err)
+	assert.EqualValues(t, -1, ttl)
+}
+
+func TestScan(t *testing.T) {
+	c := newClient(t)
+
+	for i := 0; i < 25; i++ {
+		_, err := c.SET(fmt.Sprintf("user:%02d", i), StringValue{"v"})
+		assert.NoError(t, err)
+	}
+
+	_, err := c.HSET("session:1", map[string]Value{"f1": StringValue{"v1"}, "f2": StringValue{"v2"}, "f3": StringValue{"v3"}})
+	assert.NoError(t, err)
+
+	_, err = c.RPUSH("queue", StringValue{"e1"}, StringValue{"e2"})
+	assert.NoError(t, err)
+
+	err = c.PSETEX("user:expired", 1, StringValue{"v"})
+	assert.NoError(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+
+	scanAll := func(match string, count int32, keyType KeyType) []string {
+		var all []string
+
+		cursor := ScanStart
+		calls := 0
+
+		for {
+			var keys []string
+
+			cursor, keys, err = c.SCAN(cursor, match, count, keyType)
+			assert.NoError(t, err)
+
+			all = append(all, keys...)
+			calls++
+
+			if cursor == ScanStart || calls > 100 {
+				return all
+			}
+		}
+	}
+
+	keys := scanAll("", 3, "")
+	assert.Len(t, keys, 27)
+	assert.Contains(t, keys, "session:1")
+	assert.Contains(t, keys, "queue")
+	assert.NotContains(t, keys, "user:expired")
+
+	for _, key := range keys {
+		assert.False(t, strings.HasPrefix(key, "_redimo/"))
+	}
+
+	keys = scanAll("user:1?", 5, "")
+	assert.ElementsMatch(t, []string{"user:10", "user:11", "user:12", "user:13", "user:14", "user:15", "user:16", "user:17", "user:18", "user:19"}, keys)
+
+	keys = scanAll("*", 100, TypeHash)
+	assert.Equal(t, []string{"session:1"}, keys)
+
+	keys = scanAll("", 100, TypeList)
+	assert.Equal(t, []string{"queue"}, keys)
+
+	keys, err = c.KEYS("user:2[0-2]")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"user:20", "user:21", "user:22"}, keys)
+
+	_, _, err = c.SCAN("not a cursor", "", 10, "")
+	assert.Error(t, err)
+}
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"*", "", true},
+		{"*", "anything/at:all", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "heeeello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"user:*:name", "user:42:name", true},
+		{"user:*:name", "user:42:email", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, globMatch(tt.pattern, tt.s), "%v ~ %v", tt.pattern, tt.s)
+	}
+}
+
+func TestType(t *testing.T) {
+	c := newClient(t).CheckTypes()
+
+	keyType, err := c.TYPE("missing")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeNone, keyType)
+
+	_, err = c.SET("string", StringValue{"v"})
+	assert.NoError(t, err)
+
+	_, err = c.HSET("hash", map[string]Value{"f1": StringValue{"v1"}})
+	assert.NoError(t, err)
+
+	_, err = c.RPUSH("list", StringValue{"e1"})
+	assert.NoError(t, err)
+
+	_, err = c.SADD("set", "m1")
+	assert.NoError(t, err)
+
+	_, err = c.ZADD("zset", map[string]float64{"m1": 1}, Flags{})
+	assert.NoError(t, err)
+
+	_, err = c.XADD("stream", XAutoID, map[string]Value{"f1": StringValue{"v1"}})
+	assert.NoError(t, err)
+
+	_, err = c.GEOADD("geo", map[string]GLocation{"Palermo": {38.115556, 13.361389}})
+	assert.NoError(t, err)
+
+	for key, expected := range map[string]KeyType{
+		"string": TypeString,
+		"hash":   TypeHash,
+		"list":   TypeList,
+		"set":    TypeSet,
+		"zset":   TypeZSet,
+		"stream": TypeStream,
+		"geo":    TypeGeo,
+	} {
+		keyType, err = c.TYPE(key)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, keyType, key)
+	}
+
+	keys, err := c.KEYS("*")
+	assert.NoError(t, err)
+	assert.Len(t, keys, 7)
+
+	cursor, keys, err := c.SCAN(ScanStart, "", 100, TypeSet)
+	assert.NoError(t, err)
+	assert.Equal(t, ScanStart, cursor)
+	assert.Equal(t, []string{"set"}, keys)
+
+	_, err = c.DEL("hash")
+	assert.NoError(t, err)
+
+	keyType, err = c.TYPE("hash")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeNone, keyType)
+
+	_, err = c.ddbClient.PutItem(context.Background(), &dynamodb.PutItemInput{
+		Item: map[string]types.AttributeValue{
+			c.partitionKey: StringValue{"legacy"}.ToAV(),
+			c.sortKey:      StringValue{"f1"}.ToAV(),
+			vk:             StringValue{"v1"}.ToAV(),
+		},
+		TableName: aws.String(c.tableName),
+	})
+	assert.NoError(t, err)
+
+	keyType, err = c.TYPE("legacy")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeHash, keyType)
+
+	_, err = c.SADD("legacy", "m1")
+	assert.Equal(t, ErrWrongType, err)
+}
+
+func TestWrongType(t *testing.T) {
+	c := newClient(t).CheckTypes()
+
+	_, err := c.SET("string", StringValue{"v"})
+	assert.NoError(t, err)
+
+	_, err = c.HSET("hash", map[string]Value{"f1": StringValue{"v1"}})
+	assert.NoError(t, err)
+
+	_, err = c.ZADD("zset", map[string]float64{"m1": 1}, Flags{})
+	assert.NoError(t, err)
+
+	_, err = c.GEOADD("geo", map[string]GLocation{"Palermo": {38.115556, 13.361389}})
+	assert.NoError(t, err)
+
+	_, err = c.HSET("string", map[string]Value{"f1": StringValue{"v1"}})
+	assert.Equal(t, ErrWrongType, err)
+
+	_, err = c.INCR("hash")
+	assert.Equal(t, ErrWrongType, err)
+
+	_, err = c.GET("hash")
+	assert.Equal(t, ErrWrongType, err)
+
+	_, err = c.HGETALL("zset")
+	assert.Equal(t, ErrWrongType, err)
+
+	_, err = c.LPUSH("hash", StringValue{"e1"})
+	assert.Equal(t, ErrWrongType, err)
+
+	_, err = c.SADD("zset", "m1")
+	assert.Equal(t, ErrWrongType, err)
+
+	_, err = c.XADD("zset", XAutoID, map[string]Value{"f1": StringValue{"v1"}})
+	assert.Equal(t, ErrWrongType, err)
+
+	_, err = c.GEOPOS("zset", "m1")
+	assert.Equal(t, ErrWrongType, err)
+
+	count, err := c.ZCARD("geo")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, count)
+
+	values, err := c.MGET("string", "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, "v", values["string"].String())
+	assert.False(t, values["hash"].Present())
+
+	ok, err := c.SETNX("hash", StringValue{"v"})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = c.SET("hash", StringValue{"v"})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	keyType, err := c.TYPE("hash")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeString, keyType)
+
+	_, err = c.HGET("hash", "f1")
+	assert.Equal(t, ErrWrongType, err)
+
+	_, err = c.ZREM("zset", "m1")
+	assert.NoError(t, err)
+
+	_, err = c.RPUSH("zset", StringValue{"e1"})
+	assert.NoError(t, err)
+
+	keyType, err = c.TYPE("zset")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeList, keyType)
+
+	ok, err = c.PEXPIRE("geo", 20)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	time.Sleep(30 * time.Millisecond)
+
+	_, err = c.HSET("geo", map[string]Value{"f1": StringValue{"v1"}})
+	assert.NoError(t, err)
+
+	keyType, err = c.TYPE("geo")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeHash, keyType)
+}
+
+func TestSkipTypeChecks(t *testing.T) {
+	// Types are neither checked nor recorded by default.
+	unchecked := newClient(t)
+	c := unchecked.CheckTypes()
+
+	_, err := unchecked.HSET("hash", map[string]Value{"f1": StringValue{"v1"}})
+	assert.NoError(t, err)
+
+	recorded, err := c.recordedType("hash")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeNone, recorded)
+
+	keyType, err := c.TYPE("hash")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeHash, keyType)
+
+	_, err = c.GET("hash")
+	assert.Equal(t, ErrWrongType, err)
+
+	val, err := c.SkipTypeChecks().GET("hash")
+	assert.NoError(t, err)
+	assert.False(t, val.Present())
+
+	_, err = c.SET("string", StringValue{"v"})
+	assert.NoError(t, err)
+
+	_, err = unchecked.CheckTypes().HGET("string", "f1")
+	assert.Equal(t, ErrWrongType, err)
+}
+
+func TestRename(t *testing.T) {
+	c := newClient(t)
+
+	err := c.RENAME("missing", "other")
+	assert.Equal(t, ErrNoSuchKey, err)
+
+	_, err = c.HSET("h1", map[string]Value{"f1": StringValue{"v1"}, "f2": StringValue{"v2"}})
+	assert.NoError(t, err)
+
+	_, err = c.SET("h2", StringValue{"replaced"})
+	assert.NoError(t, err)
+
+	err = c.RENAME("h1", "h2")
+	assert.NoError(t, err)
+
+	exists, err := c.EXISTS("h1")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, exists)
+
+	keyType, err := c.TYPE("h2")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeHash, keyType)
+
+	fields, err := c.HGETALL("h2")
+	assert.NoError(t, err)
+	assert.Len(t, fields, 2)
+	assert.Equal(t, "v1", fields["f1"].String())
+
+	_, err = c.RPUSH("l1", StringValue{"e1"}, StringValue{"e2"})
+	assert.NoError(t, err)
+
+	ok, err := c.RENAMENX("l1", "h2")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = c.RENAMENX("l1", "l2")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = c.RPUSH("l2", StringValue{"e3"})
+	assert.NoError(t, err)
+
+	_, err = c.LPUSH("l2", StringValue{"e0"})
+	assert.NoError(t, err)
+
+	elements, err := c.LRANGE("l2", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"e0", "e1", "e2", "e3"}, stringValues(elements))
+
+	_, err = c.XADD("s1", XAutoID, map[string]Value{"f": StringValue{"1"}})
+	assert.NoError(t, err)
+
+	err = c.XGROUP("s1", "g1", XStart)
+	assert.NoError(t, err)
+
+	_, err = c.XADD("s1", XAutoID, map[string]Value{"f": StringValue{"2"}})
+	assert.NoError(t, err)
+
+	items, err := c.XREADGROUP("s1", "g1", "consumer", XReadNewAutoACK, 1)
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+
+	err = c.TransactionActions(2).RENAME("s1", "s2")
+	assert.NoError(t, err)
+
+	items, err = c.XREADGROUP("s2", "g1", "consumer", XReadNewAutoACK, 1)
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, "2", items[0].Fields["f"].String())
+
+	_, err = c.XREADGROUP("s1", "g1", "consumer", XReadNewAutoACK, 1)
+	assert.Equal(t, ErrXGroupNotInitialized, err)
+
+	id, err := c.XADD("s2", XAutoID, map[string]Value{"f": StringValue{"3"}})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, id.Seq())
+
+	// A key larger than DynamoDB's 4 MB transaction size is moved in several transactions.
+	large := make(map[string]Value)
+	for i := 0; i < 12; i++ {
+		large[fmt.Sprintf("f%v", i)] = StringValue{strings.Repeat("x", 350*1024)}
+	}
+
+	_, err = c.HSET("large", large)
+	assert.NoError(t, err)
+
+	err = c.RENAME("large", "moved")
+	assert.NoError(t, err)
+
+	length, err := c.HLEN("moved")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 12, length)
+}
+
+func TestCopy(t *testing.T) {
+	c := newClient(t).CheckTypes()
+
+	ok, err := c.COPY("missing", "other", Flags{})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = c.ZADD("z1", map[string]float64{"m1": 1, "m2": 2}, Flags{})
+	assert.NoError(t, err)
+
+	_, err = c.EXPIRE("z1", 100)
+	assert.NoError(t, err)
+
+	_, err = c.SADD("z2", "m3")
+	assert.NoError(t, err)
+
+	_, err = c.COPY("z1", "z1", Flags{})
+	assert.Equal(t, ErrSameKey, err)
+
+	ok, err = c.COPY("z1", "z2", Flags{})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = c.COPY("z1", "z2", Flags{Replace})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	for _, key := range []string{"z1", "z2"} {
+		members, err := c.ZRANGE(key, 0, -1)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]float64{"m1": 1, "m2": 2}, members)
+
+		ttl, err := c.TTL(key)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 100, ttl)
+	}
+
+	_, err = c.SMEMBERS("z2")
+	assert.Equal(t, ErrWrongType, err)
+}
+
+func stringValues(values []ReturnValue) (strs []string) {
+	for _, v := range values {
+		strs = append(strs, v.String())
+	}
+
+	return
+}
+
+func TestDelSharedBookkeepingPartitions(t *testing.T) {
+	c := newClient(t)
+
+	_, err := c.XADD("orders", XAutoID, map[string]Value{"f": StringValue{"1"}})
+	assert.NoError(t, err)
+
+	err = c.XGROUP("orders", "workers", XStart)
+	assert.NoError(t, err)
+
+	_, err = c.XREADGROUP("orders", "workers", "consumer", XReadNew, 1)
+	assert.NoError(t, err)
+
+	// The bookkeeping of these keys shares partitions with the sequence and the consumer group of orders.
+	_, err = c.SET("seq/orders", StringValue{"v"})
+	assert.NoError(t, err)
+
+	_, err = c.HSET("orders/workers", map[string]Value{"f": StringValue{"v"}})
+	assert.NoError(t, err)
+
+	err = c.RENAME("seq/orders", "seq/renamed")
+	assert.NoError(t, err)
+
+	_, err = c.COPY("orders/workers", "orders/copied", nil)
+	assert.NoError(t, err)
+
+	deletedKeys, err := c.DEL("seq/renamed", "orders/workers", "orders/copied")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, deletedKeys)
+
+	id, err := c.XADD("orders", XAutoID, map[string]Value{"f": StringValue{"2"}})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, id.Seq())
+
+	items, err := c.XREADGROUP("orders", "workers", "consumer", XReadNew, 1)
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, id, items[0].ID)
+
+	items, err = c.XREADGROUP("orders", "workers", "consumer", XReadPending, 10)
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+
+	// Deleting the stream leaves the other keys alone.
+	_, err = c.SET("seq/orders", StringValue{"v"})
+	assert.NoError(t, err)
+
+	_, err = c.HSET("orders/workers", map[string]Value{"f": StringValue{"v"}})
+	assert.NoError(t, err)
+
+	deletedKeys, err = c.DEL("orders")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, deletedKeys)
+
+	keyType, err := c.TYPE("seq/orders")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeString, keyType)
+
+	keyType, err = c.TYPE("orders/workers")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeHash, keyType)
 }
@@ -1,12 +1,12 @@
 package redimo
 
 import (
-	"context"
 	"encoding/base64"
 	"fmt"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
@@ -27,6 +27,13 @@ const (
 )
 
 func (c Client) LINDEX(key string, index int64) (element ReturnValue, err error) {
+	c, finish := c.command("LINDEX", []string{key}, index)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeList); err != nil {
+		return
+	}
+
 	elements, err := c.lRange(key, index, index, true)
 
 	if err != nil || len(elements) == 0 {
@@ -37,11 +44,24 @@ func (c Client) LINDEX(key string, index int64) (element ReturnValue, err error)
 }
 
 func (c Client) LLEN(key string) (length int64, err error) {
-	count, err := c.lLen(key)
-	return int64(count), err
+	c, finish := c.command("LLEN", []string{key})
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeList); err != nil {
+		return
+	}
+
+	return c.lLen(key)
 }
 
 func (c Client) LPOP(key string) (element ReturnValue, err error) {
+	c, finish := c.command("LPOP", []string{key})
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeList); err != nil {
+		return
+	}
+
 	_, items, err := c.lGeneralRangeWithItems(key, 0, 1, true, c.sortKeyNum)
 
 	if err != nil || len(items) == 0 {
@@ -49,7 +69,7 @@ func (c Client) LPOP(key string) (element ReturnValue, err error) {
 	}
 
 	// delete item 0
-	_, err = c.ddbClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+	_, err = c.ddb().DeleteItem(c.ctx, &dynamodb.DeleteItemInput{
 		Key:       keyDef{pk: key, sk: items[0][c.sortKey].(*types.AttributeValueMemberS).Value}.toAV(c),
 		TableName: aws.String(c.tableName),
 	})
@@ -74,30 +94,32 @@ func (c Client) createRightIndex(key string) (index int64, err error) {
 	return int64(v), err
 }
 
-func (c Client) lLen(key string) (count int32, err error) {
+func (c Client) lLen(key string) (length int64, err error) {
 	hasMoreResults := true
 
 	var lastEvaluatedKey map[string]types.AttributeValue
 
 	for hasMoreResults {
 		builder := newExpresionBuilder()
-		builder.addConditionEquality(c.partitionKey, StringValue{key})
+		builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(key)})
+		builder.addFilterNotExpired(expiryAttribute, time.Now())
 
-		resp, err := c.ddbClient.Query(context.TODO(), &dynamodb.QueryInput{
+		resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
 			ConsistentRead:            aws.Bool(c.consistentReads),
 			ExclusiveStartKey:         lastEvaluatedKey,
 			ExpressionAttributeNames:  builder.expressionAttributeNames(),
 			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			FilterExpression:          builder.filterExpression(),
 			KeyConditionExpression:    builder.conditionExpression(),
 			TableName:                 aws.String(c.tableName),
 			Select:                    types.SelectCount,
 		})
 
 		if err != nil {
-			return count, err
+			return length, err
 		}
 
-		count += resp.ScannedCount
+		length += int64(resp.Count)
 
 		if len(resp.LastEvaluatedKey) > 0 {
 			lastEvaluatedKey = resp.LastEvaluatedKey
@@ -110,6 +132,9 @@ func (c Client) lLen(key string) (count int32, err error) {
 }
 
 func (c Client) LPUSH(key string, vElements ...interface{}) (newLength int64, err error) {
+	c, finish := c.command("LPUSH", []string{key}, vElements)
+	defer finish(&err)
+
 	return c.lPush(key, true, vElements...)
 }
 
@@ -120,12 +145,24 @@ func genSk(val string, index int64) string {
 }
 
 func (c Client) lPush(key string, left bool, vElements ...interface{}) (newLength int64, err error) {
-	length, err := c.LLEN(key)
+	if c, err = c.inheritExpiry(key); err != nil {
+		return
+	}
+
+	if err = c.claimType(key, TypeList); err != nil {
+		return
+	}
+
+	length, err := c.lLen(key)
 
 	if err != nil {
 		return length, err
 	}
 
+	if c.batchWrites() && len(vElements) > 0 {
+		return length + int64(len(vElements)), c.batchPush(key, left, vElements...)
+	}
+
 	for index, e := range vElements {
 		builder := newExpresionBuilder()
 
@@ -145,7 +182,7 @@ func (c Client) lPush(key string, left bool, vElements ...interface{}) (newLengt
 		builder.updateSetAV(c.sortKeyNum, zScore{float64(score)}.ToAV())
 		builder.updateSetAV(vk, e.(StringValue).ToAV())
 
-		_, err = c.ddbClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		_, err = c.updateItem(&dynamodb.UpdateItemInput{
 			ConditionExpression:       builder.conditionExpression(),
 			ExpressionAttributeNames:  builder.expressionAttributeNames(),
 			ExpressionAttributeValues: builder.expressionAttributeValues(),
@@ -155,10 +192,6 @@ func (c Client) lPush(key string, left bool, vElements ...interface{}) (newLengt
 			UpdateExpression:          builder.updateExpression(),
 		})
 
-		if conditionFailureError(err) {
-			continue
-		}
-
 		if err != nil {
 			return length + int64(index), err
 		}
@@ -167,12 +200,48 @@ func (c Client) lPush(key string, left bool, vElements ...interface{}) (newLengt
 	return length + int64(len(vElements)), nil
 }
 
+// batchPush reserves an index for every element with a single increment of the list's counter, and
+// writes the elements with BatchWriteItem.
+func (c Client) batchPush(key string, left bool, vElements ...interface{}) error {
+	n := int64(len(vElements))
+	field, delta := ListSKIndexRight, n
+
+	if left {
+		field, delta = ListSKIndexLeft, -n
+	}
+
+	last, err := c.HINCRBY(fmt.Sprintf("_redimo/%v", key), field, delta)
+	if err != nil {
+		return err
+	}
+
+	requests := make([]types.WriteRequest, len(vElements))
+
+	for i, e := range vElements {
+		// Elements get the indexes they would have got when pushed one by one.
+		score := last - n + 1 + int64(i)
+		if left {
+			score = last + n - 1 - int64(i)
+		}
+
+		item := keyDef{pk: key, sk: genSk(e.(StringValue).S, score)}.toAV(c)
+		item[c.sortKeyNum] = zScore{float64(score)}.ToAV()
+		item[vk] = e.(StringValue).ToAV()
+		requests[i] = putRequest(item)
+	}
+
+	return c.batchWrite(requests)
+}
+
 func (c Client) RPUSH(key string, vElements ...interface{}) (newLength int64, err error) {
+	c, finish := c.command("RPUSH", []string{key}, vElements)
+	defer finish(&err)
+
 	return c.lPush(key, false, vElements...)
 }
 
 func (c Client) lRange(key string, start int64, end int64, forward bool) (elements []ReturnValue, err error) {
-	llen, err := c.LLEN(key)
+	llen, err := c.lLen(key)
 	if err != nil {
 		return elements, err
 	}
@@ -217,18 +286,20 @@ func (c Client) lGeneralRange(key string, offset int64, count int64, forward boo
 		}
 
 		builder := newExpresionBuilder()
-		builder.addConditionEquality(c.partitionKey, StringValue{key})
+		builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(key)})
+		builder.addFilterNotExpired(expiryAttribute, time.Now())
 
 		var queryIndex *string
 		if attribute == c.sortKeyNum {
 			queryIndex = aws.String(c.indexName)
 		}
 
-		resp, err := c.ddbClient.Query(context.TODO(), &dynamodb.QueryInput{
+		resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
 			ConsistentRead:            aws.Bool(c.consistentReads),
 			ExclusiveStartKey:         lastKey,
 			ExpressionAttributeNames:  builder.expressionAttributeNames(),
 			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			FilterExpression:          builder.filterExpression(),
 			IndexName:                 queryIndex,
 			KeyConditionExpression:    builder.conditionExpression(),
 			Limit:                     queryLimit,
@@ -278,7 +349,7 @@ func (c Client) lGeneralRangeWithItems(key string,
 	offset int64, count int64,
 	forward bool, attribute string) (elements []ReturnValue, items []map[string]types.AttributeValue, err error) {
 
-	llen, err := c.LLEN(key)
+	llen, err := c.lLen(key)
 	if err != nil {
 		return elements, items, err
 	}
@@ -328,18 +399,20 @@ func (c Client) lGeneralRangeWithItems_(key string,
 		}
 
 		builder := newExpresionBuilder()
-		builder.addConditionEquality(c.partitionKey, StringValue{key})
+		builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(key)})
+		builder.addFilterNotExpired(expiryAttribute, time.Now())
 
 		var queryIndex *string
 		if attribute == c.sortKeyNum {
 			queryIndex = aws.String(c.indexName)
 		}
 
-		resp, err := c.ddbClient.Query(context.TODO(), &dynamodb.QueryInput{
+		resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
 			ConsistentRead:            aws.Bool(c.consistentReads),
 			ExclusiveStartKey:         lastKey,
 			ExpressionAttributeNames:  builder.expressionAttributeNames(),
 			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			FilterExpression:          builder.filterExpression(),
 			IndexName:                 queryIndex,
 			KeyConditionExpression:    builder.conditionExpression(),
 			Limit:                     queryLimit,
@@ -374,10 +447,24 @@ func (c Client) lGeneralRangeWithItems_(key string,
 }
 
 func (c Client) LRANGE(key string, start, stop int64) (elements []ReturnValue, err error) {
+	c, finish := c.command("LRANGE", []string{key}, start, stop)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeList); err != nil {
+		return
+	}
+
 	return c.lRange(key, start, stop, true)
 }
 
 func (c Client) RPOP(key string) (element ReturnValue, err error) {
+	c, finish := c.command("RPOP", []string{key})
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeList); err != nil {
+		return
+	}
+
 	_, items, err := c.lGeneralRangeWithItems(key, 0, 1, false, c.sortKeyNum)
 
 	if err != nil || len(items) == 0 {
@@ -387,7 +474,7 @@ func (c Client) RPOP(key string) (element ReturnValue, err error) {
 	// delete item 0
 	sk := items[0][c.sortKey].(*types.AttributeValueMemberS).Value
 
-	result, err := c.ddbClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+	result, err := c.ddb().DeleteItem(c.ctx, &dynamodb.DeleteItemInput{
 		Key:          keyDef{pk: key, sk: sk}.toAV(c),
 		TableName:    aws.String(c.tableName),
 		ReturnValues: types.ReturnValueAllOld,
@@ -406,7 +493,10 @@ func (c Client) RPOP(key string) (element ReturnValue, err error) {
 }
 
 func (c Client) LPUSHX(key string, vElements ...interface{}) (newLength int64, err error) {
-	exist, err := c.EXISTS(key)
+	c, finish := c.command("LPUSHX", []string{key}, vElements)
+	defer finish(&err)
+
+	exist, err := c.exists(key)
 
 	if err != nil || !exist {
 		return 0, err
@@ -416,7 +506,10 @@ func (c Client) LPUSHX(key string, vElements ...interface{}) (newLength int64, e
 }
 
 func (c Client) RPUSHX(key string, vElements ...interface{}) (newLength int64, err error) {
-	exist, err := c.EXISTS(key)
+	c, finish := c.command("RPUSHX", []string{key}, vElements)
+	defer finish(&err)
+
+	exist, err := c.exists(key)
 
 	if err != nil || !exist {
 		return 0, err
@@ -426,6 +519,13 @@ func (c Client) RPUSHX(key string, vElements ...interface{}) (newLength int64, e
 }
 
 func (c Client) RPOPLPUSH(sourceKey string, destinationKey string) (element ReturnValue, err error) {
+	c, finish := c.command("RPOPLPUSH", []string{sourceKey, destinationKey})
+	defer finish(&err)
+
+	if err = c.checkType(destinationKey, TypeList); err != nil {
+		return
+	}
+
 	element, err = c.RPOP(sourceKey)
 
 	if err != nil {
@@ -442,6 +542,13 @@ func (c Client) RPOPLPUSH(sourceKey string, destinationKey string) (element Retu
 }
 
 func (c Client) LSET(key string, index int64, element string) (ok bool, err error) {
+	c, finish := c.command("LSET", []string{key}, index, element)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeList); err != nil {
+		return
+	}
+
 	// get the element at the index
 	_, items, err := c.lGeneralRangeWithItems(key, index, 1, true, c.sortKeyNum)
 
@@ -458,7 +565,7 @@ func (c Client) LSET(key string, index int64, element string) (ok bool, err erro
 	}
 
 	// delete old
-	_, err = c.ddbClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+	_, err = c.ddb().DeleteItem(c.ctx, &dynamodb.DeleteItemInput{
 		Key:       keyDef{pk: key, sk: item[c.sortKey].(*types.AttributeValueMemberS).Value}.toAV(c),
 		TableName: aws.String(c.tableName),
 	})
@@ -472,7 +579,7 @@ func (c Client) LSET(key string, index int64, element string) (ok bool, err erro
 		return false, err
 	}
 
-	_, err = c.ddbClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+	_, err = c.updateItem(&dynamodb.UpdateItemInput{
 		ConditionExpression:       builder.conditionExpression(),
 		ExpressionAttributeNames:  builder.expressionAttributeNames(),
 		ExpressionAttributeValues: builder.expressionAttributeValues(),
@@ -492,7 +599,7 @@ func (c Client) LSET(key string, index int64, element string) (ok bool, err erro
 func (c Client) lGeneralRangeWithItemsByMember(key string,
 	start int64, end int64,
 	forward bool, member string) (elements []ReturnValue, items []map[string]types.AttributeValue, err error) {
-	llen, err := c.LLEN(key)
+	llen, err := c.lLen(key)
 	if err != nil {
 		return elements, items, err
 	}
@@ -537,16 +644,18 @@ func (c Client) lGeneralRangeWithItemsByMember_(key string, offset int64, count
 		}
 
 		builder := newExpresionBuilder()
-		builder.addConditionEquality(c.partitionKey, StringValue{key})
+		builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(key)})
 
 		b64 := base64.StdEncoding.EncodeToString([]byte(member))
 		builder.addConditionBeginWith(c.sortKey, StringValue{fmt.Sprintf("%v|", b64)})
+		builder.addFilterNotExpired(expiryAttribute, time.Now())
 
-		resp, err := c.ddbClient.Query(context.TODO(), &dynamodb.QueryInput{
+		resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
 			ConsistentRead:            aws.Bool(c.consistentReads),
 			ExclusiveStartKey:         lastKey,
 			ExpressionAttributeNames:  builder.expressionAttributeNames(),
 			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			FilterExpression:          builder.filterExpression(),
 			KeyConditionExpression:    builder.conditionExpression(),
 			Limit:                     queryLimit,
 			ScanIndexForward:          aws.Bool(forward),
@@ -616,6 +725,13 @@ func (c Client) getLRemItems(key string, member string, count int64) (newItems [
 
 // LREM removes [count] items from the list [key] that match [vElement]
 func (c Client) LREM(key string, count int64, vElement interface{}) (newLength int64, success bool, err error) {
+	c, finish := c.command("LREM", []string{key}, count, vElement)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeList); err != nil {
+		return
+	}
+
 	member := vElement.(StringValue).ToAV().(*types.AttributeValueMemberS).Value
 	var items []map[string]types.AttributeValue
 
@@ -637,7 +753,7 @@ func (c Client) LREM(key string, count int64, vElement interface{}) (newLength i
 	for i := int64(0); i < count; i++ {
 		item := items[i]
 
-		_, err = c.ddbClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		_, err = c.ddb().DeleteItem(c.ctx, &dynamodb.DeleteItemInput{
 			Key:       keyDef{pk: key, sk: item[c.sortKey].(*types.AttributeValueMemberS).Value}.toAV(c),
 			TableName: aws.String(c.tableName),
 		})
@@ -647,7 +763,7 @@ func (c Client) LREM(key string, count int64, vElement interface{}) (newLength i
 		}
 	}
 
-	newLength, err = c.LLEN(key)
+	newLength, err = c.lLen(key)
 	if err != nil {
 		return 0, false, err
 	}
@@ -682,7 +798,7 @@ func (c Client) normalizeStartStop(llen int64, start int64, stop int64) (int64,
 }
 
 func (c Client) lDelete(key string, start int64, stop int64) (newLength int64, err error) {
-	llen, err := c.LLEN(key)
+	llen, err := c.lLen(key)
 	if err != nil {
 		return llen, err
 	}
@@ -704,7 +820,7 @@ func (c Client) lDelete(key string, start int64, stop int64) (newLength int64, e
 	removeCount := int64(0)
 
 	for _, item := range items {
-		_, err = c.ddbClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		_, err = c.ddb().DeleteItem(c.ctx, &dynamodb.DeleteItemInput{
 			Key:       keyDef{pk: key, sk: item[c.sortKey].(*types.AttributeValueMemberS).Value}.toAV(c),
 			TableName: aws.String(c.tableName),
 		})
@@ -716,12 +832,19 @@ func (c Client) lDelete(key string, start int64, stop int64) (newLength int64, e
 		removeCount++
 	}
 
-	llen, err = c.LLEN(key)
+	llen, err = c.lLen(key)
 	return llen, err
 }
 
 func (c Client) LTRIM(key string, start int64, stop int64) (newLength int64, err error) {
-	llen, err := c.LLEN(key)
+	c, finish := c.command("LTRIM", []string{key}, start, stop)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeList); err != nil {
+		return
+	}
+
+	llen, err := c.lLen(key)
 	if err != nil {
 		return llen, err
 	}
@@ -0,0 +1,173 @@
+package memdb
+
+import (
+	"math"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// usage is the capacity consumed by a request on one table, split between the table and its indexes.
+type usage struct {
+	table   float64
+	indexes map[string]float64
+}
+
+// readUnits returns the read capacity units of reading the given number of bytes: one per 4 KB, at
+// least one, halved for eventually consistent reads.
+func readUnits(bytes int, consistent bool) float64 {
+	units := math.Max(1, math.Ceil(float64(bytes)/4096))
+	if !consistent {
+		units /= 2
+	}
+
+	return units
+}
+
+// writeUnits returns the write capacity units of writing an item of the given size: one per KB, at
+// least one.
+func writeUnits(bytes int) float64 {
+	return math.Max(1, math.Ceil(float64(bytes)/1024))
+}
+
+// writeUsage returns the capacity consumed by the outcome of a write. The table is charged for the
+// larger of the old and new item, and every index for the entries it deletes and puts.
+func (w *write) writeUsage(r result) usage {
+	u := usage{table: writeUnits(maxInt(r.old.size(), r.new.size())), indexes: make(map[string]float64)}
+
+	for name, idx := range w.table.indexes {
+		oldIn, newIn := idx.contains(r.old), idx.contains(r.new)
+
+		switch {
+		case oldIn && newIn && !idx.sameKeys(r.old, r.new):
+			u.indexes[name] = writeUnits(r.old.size()) + writeUnits(r.new.size())
+		case newIn:
+			u.indexes[name] = writeUnits(r.new.size())
+		case oldIn:
+			u.indexes[name] = writeUnits(r.old.size())
+		}
+	}
+
+	return u
+}
+
+func (u *usage) add(other usage, factor float64) {
+	u.table += other.table * factor
+
+	for name, units := range other.indexes {
+		if u.indexes == nil {
+			u.indexes = make(map[string]float64)
+		}
+
+		u.indexes[name] += units * factor
+	}
+}
+
+// consumedCapacity reports the usage as requested by ReturnConsumedCapacity, or returns nil if it was
+// not requested.
+func (t *table) consumedCapacity(mode types.ReturnConsumedCapacity, u usage, read bool) *types.ConsumedCapacity {
+	if mode == "" || mode == types.ReturnConsumedCapacityNone {
+		return nil
+	}
+
+	capacity := func(units float64) *types.Capacity {
+		c := &types.Capacity{CapacityUnits: aws.Float64(units)}
+		if read {
+			c.ReadCapacityUnits = aws.Float64(units)
+		} else {
+			c.WriteCapacityUnits = aws.Float64(units)
+		}
+
+		return c
+	}
+
+	total := u.table
+	for _, units := range u.indexes {
+		total += units
+	}
+
+	cc := &types.ConsumedCapacity{TableName: aws.String(t.name), CapacityUnits: aws.Float64(total)}
+	if mode != types.ReturnConsumedCapacityIndexes {
+		return cc
+	}
+
+	if read {
+		cc.ReadCapacityUnits = aws.Float64(total)
+	} else {
+		cc.WriteCapacityUnits = aws.Float64(total)
+	}
+
+	cc.Table = capacity(u.table)
+
+	for name, units := range u.indexes {
+		if t.indexes[name].local {
+			if cc.LocalSecondaryIndexes == nil {
+				cc.LocalSecondaryIndexes = make(map[string]types.Capacity)
+			}
+
+			cc.LocalSecondaryIndexes[name] = *capacity(units)
+		} else {
+			if cc.GlobalSecondaryIndexes == nil {
+				cc.GlobalSecondaryIndexes = make(map[string]types.Capacity)
+			}
+
+			cc.GlobalSecondaryIndexes[name] = *capacity(units)
+		}
+	}
+
+	return cc
+}
+
+// consumedCapacities reports the usage of a request that spans tables, ordered by table name.
+func consumedCapacities(mode types.ReturnConsumedCapacity, usages map[*table]usage, read bool) []types.ConsumedCapacity {
+	tables := make([]*table, 0, len(usages))
+	for t := range usages {
+		tables = append(tables, t)
+	}
+
+	sort.Slice(tables, func(i, j int) bool { return tables[i].name < tables[j].name })
+
+	var capacities []types.ConsumedCapacity
+
+	for _, t := range tables {
+		if cc := t.consumedCapacity(mode, usages[t], read); cc != nil {
+			capacities = append(capacities, *cc)
+		}
+	}
+
+	return capacities
+}
+
+// contains reports whether the item has an entry in the index.
+func (idx *index) contains(it item) bool {
+	if it == nil {
+		return false
+	}
+
+	for _, k := range idx.keys() {
+		if _, ok := it[k.name]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (idx *index) sameKeys(a, b item) bool {
+	for _, k := range idx.keys() {
+		if encodeKey(a[k.name]) != encodeKey(b[k.name]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
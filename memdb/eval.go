@@ -0,0 +1,589 @@
+package memdb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// resolve walks the document path inside the item. found is false if any step of the path
+// does not exist.
+func resolve(it item, path docPath) (av types.AttributeValue, found bool) {
+	if len(path) == 0 || path[0].isIndex {
+		return nil, false
+	}
+
+	av, found = it[path[0].name]
+
+	for _, e := range path[1:] {
+		if !found {
+			return nil, false
+		}
+
+		switch cur := av.(type) {
+		case *types.AttributeValueMemberM:
+			if e.isIndex {
+				return nil, false
+			}
+
+			av, found = cur.Value[e.name]
+		case *types.AttributeValueMemberL:
+			if !e.isIndex || e.index >= len(cur.Value) {
+				return nil, false
+			}
+
+			av, found = cur.Value[e.index], true
+		default:
+			return nil, false
+		}
+	}
+
+	return av, found
+}
+
+func evalOperand(it item, op operand) (types.AttributeValue, bool, error) {
+	switch op := op.(type) {
+	case valueOperand:
+		return op.av, true, nil
+	case docPath:
+		av, found := resolve(it, op)
+		return av, found, nil
+	case sizeOperand:
+		av, found := resolve(it, op.path)
+		if !found {
+			return nil, false, nil
+		}
+
+		var size int
+
+		switch av := av.(type) {
+		case *types.AttributeValueMemberS:
+			size = utf8.RuneCountInString(av.Value)
+		case *types.AttributeValueMemberB:
+			size = len(av.Value)
+		case *types.AttributeValueMemberSS:
+			size = len(av.Value)
+		case *types.AttributeValueMemberNS:
+			size = len(av.Value)
+		case *types.AttributeValueMemberBS:
+			size = len(av.Value)
+		case *types.AttributeValueMemberL:
+			size = len(av.Value)
+		case *types.AttributeValueMemberM:
+			size = len(av.Value)
+		default:
+			return nil, false, fmt.Errorf("invalid ConditionExpression: incorrect operand type for operator or function; operator or function: size, operand type: %v", typeOf(av))
+		}
+
+		return &types.AttributeValueMemberN{Value: strconv.Itoa(size)}, true, nil
+	case ifNotExistsOperand:
+		if av, found := resolve(it, op.path); found {
+			return av, true, nil
+		}
+
+		return evalOperand(it, op.fallback)
+	case listAppendOperand:
+		left, lok, err := evalOperand(it, op.left)
+		if err != nil {
+			return nil, false, err
+		}
+
+		right, rok, err := evalOperand(it, op.right)
+		if err != nil {
+			return nil, false, err
+		}
+
+		ll, lIsList := left.(*types.AttributeValueMemberL)
+		rl, rIsList := right.(*types.AttributeValueMemberL)
+
+		if !lok || !rok {
+			return nil, false, fmt.Errorf("the provided expression refers to an attribute that does not exist in the item")
+		}
+
+		if !lIsList || !rIsList {
+			return nil, false, fmt.Errorf("an operand in the update expression has an incorrect data type")
+		}
+
+		out := append(append([]types.AttributeValue{}, ll.Value...), rl.Value...)
+
+		return &types.AttributeValueMemberL{Value: out}, true, nil
+	case arithmeticOperand:
+		left, lok, err := evalOperand(it, op.left)
+		if err != nil {
+			return nil, false, err
+		}
+
+		right, rok, err := evalOperand(it, op.right)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if !lok || !rok {
+			return nil, false, fmt.Errorf("the provided expression refers to an attribute that does not exist in the item")
+		}
+
+		ln, lIsN := left.(*types.AttributeValueMemberN)
+		rn, rIsN := right.(*types.AttributeValueMemberN)
+
+		if !lIsN || !rIsN {
+			return nil, false, fmt.Errorf("an operand in the update expression has an incorrect data type")
+		}
+
+		lr, err := parseNumber(ln.Value)
+		if err != nil {
+			return nil, false, err
+		}
+
+		rr, err := parseNumber(rn.Value)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if op.op == "+" {
+			lr.Add(lr, rr)
+		} else {
+			lr.Sub(lr, rr)
+		}
+
+		return &types.AttributeValueMemberN{Value: formatNumber(lr)}, true, nil
+	}
+
+	return nil, false, fmt.Errorf("unsupported operand %T", op)
+}
+
+// evalCondition evaluates the condition against the item. A nil item represents an item that does
+// not exist, against which every attribute is missing.
+func evalCondition(it item, cond condition) (bool, error) {
+	switch cond := cond.(type) {
+	case andCond:
+		left, err := evalCondition(it, cond.left)
+		if err != nil || !left {
+			return false, err
+		}
+
+		return evalCondition(it, cond.right)
+	case orCond:
+		left, err := evalCondition(it, cond.left)
+		if err != nil || left {
+			return left, err
+		}
+
+		return evalCondition(it, cond.right)
+	case notCond:
+		inner, err := evalCondition(it, cond.cond)
+		return !inner, err
+	case compareCond:
+		left, lok, err := evalOperand(it, cond.left)
+		if err != nil {
+			return false, err
+		}
+
+		right, rok, err := evalOperand(it, cond.right)
+		if err != nil || !lok || !rok {
+			return false, err
+		}
+
+		switch cond.op {
+		case "=":
+			return equal(left, right), nil
+		case "<>":
+			return !equal(left, right), nil
+		}
+
+		c, ok := compare(left, right)
+		if !ok {
+			return false, nil
+		}
+
+		switch cond.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		case ">=":
+			return c >= 0, nil
+		}
+	case betweenCond:
+		value, vok, err := evalOperand(it, cond.value)
+		if err != nil {
+			return false, err
+		}
+
+		low, lok, err := evalOperand(it, cond.low)
+		if err != nil {
+			return false, err
+		}
+
+		high, hok, err := evalOperand(it, cond.high)
+		if err != nil || !vok || !lok || !hok {
+			return false, err
+		}
+
+		if c, ok := compare(low, high); ok && c > 0 {
+			return false, fmt.Errorf("invalid ConditionExpression: the BETWEEN operator requires upper bound to be greater than or equal to lower bound")
+		}
+
+		cl, okl := compare(value, low)
+		ch, okh := compare(value, high)
+
+		return okl && okh && cl >= 0 && ch <= 0, nil
+	case inCond:
+		value, found, err := evalOperand(it, cond.value)
+		if err != nil || !found {
+			return false, err
+		}
+
+		for _, option := range cond.options {
+			ov, ok, err := evalOperand(it, option)
+			if err != nil {
+				return false, err
+			}
+
+			if ok && equal(value, ov) {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	case functionCond:
+		return evalFunction(it, cond)
+	}
+
+	return false, fmt.Errorf("unsupported condition %T", cond)
+}
+
+func evalFunction(it item, fn functionCond) (bool, error) {
+	av, found := resolve(it, fn.path)
+
+	var arg types.AttributeValue
+
+	if fn.arg != nil {
+		var argFound bool
+		var err error
+
+		arg, argFound, err = evalOperand(it, fn.arg)
+		if err != nil {
+			return false, err
+		}
+
+		if !argFound {
+			return false, nil
+		}
+	}
+
+	switch fn.name {
+	case "attribute_exists":
+		return found, nil
+	case "attribute_not_exists":
+		return !found, nil
+	case "attribute_type":
+		s, ok := arg.(*types.AttributeValueMemberS)
+		if !ok {
+			return false, fmt.Errorf("invalid ConditionExpression: incorrect operand type for operator or function; operator or function: attribute_type")
+		}
+
+		return found && typeOf(av) == s.Value, nil
+	case "begins_with":
+		if !found {
+			return false, nil
+		}
+
+		switch av := av.(type) {
+		case *types.AttributeValueMemberS:
+			prefix, ok := arg.(*types.AttributeValueMemberS)
+			return ok && strings.HasPrefix(av.Value, prefix.Value), nil
+		case *types.AttributeValueMemberB:
+			prefix, ok := arg.(*types.AttributeValueMemberB)
+			return ok && strings.HasPrefix(string(av.Value), string(prefix.Value)), nil
+		}
+
+		return false, nil
+	case "contains":
+		if !found {
+			return false, nil
+		}
+
+		switch av := av.(type) {
+		case *types.AttributeValueMemberS:
+			sub, ok := arg.(*types.AttributeValueMemberS)
+			return ok && strings.Contains(av.Value, sub.Value), nil
+		case *types.AttributeValueMemberB:
+			sub, ok := arg.(*types.AttributeValueMemberB)
+			return ok && strings.Contains(string(av.Value), string(sub.Value)), nil
+		case *types.AttributeValueMemberSS, *types.AttributeValueMemberNS, *types.AttributeValueMemberBS:
+			var key string
+
+			switch arg := arg.(type) {
+			case *types.AttributeValueMemberS:
+				key = arg.Value
+			case *types.AttributeValueMemberN:
+				key = canonicalNumber(arg.Value)
+			case *types.AttributeValueMemberB:
+				key = string(arg.Value)
+			default:
+				return false, nil
+			}
+
+			_, ok := setKeys(av)[key]
+
+			return ok && typeOf(av) == typeOf(arg)+"S", nil
+		case *types.AttributeValueMemberL:
+			for _, e := range av.Value {
+				if equal(e, arg) {
+					return true, nil
+				}
+			}
+		}
+
+		return false, nil
+	}
+
+	return false, fmt.Errorf("invalid ConditionExpression: invalid function name; function: %v", fn.name)
+}
+
+// applyUpdate applies the update expression to a copy of the item. All operands are evaluated
+// against the item as it was before the update, like DynamoDB does.
+func applyUpdate(old item, u *updateExpr) (item, error) {
+	it := old.clone()
+	if it == nil {
+		it = make(item)
+	}
+
+	type assignment struct {
+		path  docPath
+		value types.AttributeValue
+	}
+
+	var assignments []assignment
+
+	for _, a := range u.sets {
+		value, found, err := evalOperand(old, a.value)
+		if err != nil {
+			return nil, err
+		}
+
+		if !found {
+			return nil, fmt.Errorf("the provided expression refers to an attribute that does not exist in the item")
+		}
+
+		assignments = append(assignments, assignment{path: a.path, value: cloneAV(value)})
+	}
+
+	for _, a := range u.adds {
+		current, found := resolve(old, a.path)
+
+		if !found {
+			assignments = append(assignments, assignment{path: a.path, value: cloneAV(a.value)})
+			continue
+		}
+
+		switch value := a.value.(type) {
+		case *types.AttributeValueMemberN:
+			cn, ok := current.(*types.AttributeValueMemberN)
+			if !ok {
+				return nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+			}
+
+			cr, err := parseNumber(cn.Value)
+			if err != nil {
+				return nil, err
+			}
+
+			dr, err := parseNumber(value.Value)
+			if err != nil {
+				return nil, err
+			}
+
+			assignments = append(assignments, assignment{path: a.path, value: &types.AttributeValueMemberN{Value: formatNumber(cr.Add(cr, dr))}})
+		case *types.AttributeValueMemberSS, *types.AttributeValueMemberNS, *types.AttributeValueMemberBS:
+			if typeOf(current) != typeOf(value) {
+				return nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+			}
+
+			assignments = append(assignments, assignment{path: a.path, value: setUnion(current, value)})
+		default:
+			return nil, fmt.Errorf("invalid UpdateExpression: incorrect operand type for operator or function; operator: ADD, operand type: %v", typeOf(value))
+		}
+	}
+
+	var removals []docPath
+
+	for _, a := range u.deletes {
+		switch a.value.(type) {
+		case *types.AttributeValueMemberSS, *types.AttributeValueMemberNS, *types.AttributeValueMemberBS:
+		default:
+			return nil, fmt.Errorf("invalid UpdateExpression: incorrect operand type for operator or function; operator: DELETE, operand type: %v", typeOf(a.value))
+		}
+
+		current, found := resolve(old, a.path)
+		if !found {
+			continue
+		}
+
+		if typeOf(current) != typeOf(a.value) {
+			return nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+		}
+
+		if remaining := setDifference(current, a.value); remaining != nil {
+			assignments = append(assignments, assignment{path: a.path, value: remaining})
+		} else {
+			removals = append(removals, a.path)
+		}
+	}
+
+	for _, a := range u.removes {
+		removals = append(removals, a.path)
+	}
+
+	for _, a := range assignments {
+		if err := assign(it, a.path, a.value); err != nil {
+			return nil, err
+		}
+	}
+
+	// List element removals shift later elements, so remove higher indexes first.
+	sort.SliceStable(removals, func(i, j int) bool {
+		return removalIndex(removals[i]) > removalIndex(removals[j])
+	})
+
+	for _, path := range removals {
+		remove(it, path)
+	}
+
+	return it, nil
+}
+
+func removalIndex(path docPath) int {
+	if last := path[len(path)-1]; last.isIndex {
+		return last.index
+	}
+
+	return -1
+}
+
+var errInvalidDocumentPath = fmt.Errorf("the document path provided in the update expression is invalid for update")
+
+func assign(it item, path docPath, value types.AttributeValue) error {
+	if len(path) == 1 {
+		it[path[0].name] = value
+		return nil
+	}
+
+	parent, found := resolve(it, path[:len(path)-1])
+	if !found {
+		return errInvalidDocumentPath
+	}
+
+	last := path[len(path)-1]
+
+	switch parent := parent.(type) {
+	case *types.AttributeValueMemberM:
+		if last.isIndex {
+			return errInvalidDocumentPath
+		}
+
+		parent.Value[last.name] = value
+	case *types.AttributeValueMemberL:
+		if !last.isIndex {
+			return errInvalidDocumentPath
+		}
+
+		if last.index >= len(parent.Value) {
+			parent.Value = append(parent.Value, value)
+		} else {
+			parent.Value[last.index] = value
+		}
+	default:
+		return errInvalidDocumentPath
+	}
+
+	return nil
+}
+
+func remove(it item, path docPath) {
+	if len(path) == 1 {
+		delete(it, path[0].name)
+		return
+	}
+
+	parent, found := resolve(it, path[:len(path)-1])
+	if !found {
+		return
+	}
+
+	last := path[len(path)-1]
+
+	switch parent := parent.(type) {
+	case *types.AttributeValueMemberM:
+		delete(parent.Value, last.name)
+	case *types.AttributeValueMemberL:
+		if last.isIndex && last.index < len(parent.Value) {
+			parent.Value = append(parent.Value[:last.index], parent.Value[last.index+1:]...)
+		}
+	}
+}
+
+// project copies the given paths out of the item. Nested paths produce nested maps and lists that
+// only contain the requested elements, like a DynamoDB ProjectionExpression.
+func project(it item, paths []docPath) item {
+	out := make(item)
+
+	for _, path := range paths {
+		av, found := resolve(it, path)
+		if !found {
+			continue
+		}
+
+		projectInto(out, path, cloneAV(av))
+	}
+
+	return out
+}
+
+func projectInto(out item, path docPath, value types.AttributeValue) {
+	if len(path) == 1 {
+		out[path[0].name] = value
+		return
+	}
+
+	head := path[0].name
+	out[head] = projectNested(out[head], path[1:], value)
+}
+
+func projectNested(container types.AttributeValue, path docPath, value types.AttributeValue) types.AttributeValue {
+	e := path[0]
+
+	if e.isIndex {
+		l, ok := container.(*types.AttributeValueMemberL)
+		if !ok {
+			l = &types.AttributeValueMemberL{}
+		}
+
+		if len(path) == 1 {
+			l.Value = append(l.Value, value)
+		} else {
+			l.Value = append(l.Value, projectNested(nil, path[1:], value))
+		}
+
+		return l
+	}
+
+	m, ok := container.(*types.AttributeValueMemberM)
+	if !ok {
+		m = &types.AttributeValueMemberM{Value: make(map[string]types.AttributeValue)}
+	}
+
+	if len(path) == 1 {
+		m.Value[e.name] = value
+	} else {
+		m.Value[e.name] = projectNested(m.Value[e.name], path[1:], value)
+	}
+
+	return m
+}
@@ -0,0 +1,899 @@
+package memdb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// This file implements a parser for the DynamoDB expression language: condition, filter and key
+// condition expressions, update expressions and projection expressions. Placeholders are resolved
+// while parsing, and every placeholder that is used is recorded so that unused names and values
+// can be rejected the same way DynamoDB rejects them.
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokName
+	tokValue
+	tokNumber
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+
+	runes := []rune(expr)
+	isWord := func(r rune) bool {
+		return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '#' || r == ':':
+			j := i + 1
+			for j < len(runes) && isWord(runes[j]) {
+				j++
+			}
+
+			if j == i+1 {
+				return nil, fmt.Errorf("invalid expression: syntax error; token: %q", string(r))
+			}
+
+			kind := tokName
+			if r == ':' {
+				kind = tokValue
+			}
+
+			tokens = append(tokens, token{kind: kind, text: string(runes[i:j])})
+			i = j
+		case unicode.IsDigit(r):
+			j := i
+			for j < len(runes) && unicode.IsDigit(runes[j]) {
+				j++
+			}
+
+			tokens = append(tokens, token{kind: tokNumber, text: string(runes[i:j])})
+			i = j
+		case isWord(r):
+			j := i
+			for j < len(runes) && isWord(runes[j]) {
+				j++
+			}
+
+			tokens = append(tokens, token{kind: tokIdent, text: string(runes[i:j])})
+			i = j
+		case r == '<' && i+1 < len(runes) && (runes[i+1] == '=' || runes[i+1] == '>'):
+			tokens = append(tokens, token{kind: tokPunct, text: string(runes[i : i+2])})
+			i += 2
+		case r == '>' && i+1 < len(runes) && runes[i+1] == '=':
+			tokens = append(tokens, token{kind: tokPunct, text: ">="})
+			i += 2
+		case strings.ContainsRune("()[],.=<>+-", r):
+			tokens = append(tokens, token{kind: tokPunct, text: string(r)})
+			i++
+		default:
+			return nil, fmt.Errorf("invalid expression: syntax error; token: %q", string(r))
+		}
+	}
+
+	return append(tokens, token{kind: tokEOF}), nil
+}
+
+// pathElem is one step of a document path: either a map member / top level attribute name,
+// or a list index.
+type pathElem struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+type docPath []pathElem
+
+func (p docPath) String() string {
+	var sb strings.Builder
+
+	for i, e := range p {
+		switch {
+		case e.isIndex:
+			sb.WriteString("[" + strconv.Itoa(e.index) + "]")
+		case i > 0:
+			sb.WriteString("." + e.name)
+		default:
+			sb.WriteString(e.name)
+		}
+	}
+
+	return sb.String()
+}
+
+// overlaps reports whether one path is a prefix of the other.
+func (p docPath) overlaps(o docPath) bool {
+	n := len(p)
+	if len(o) < n {
+		n = len(o)
+	}
+
+	for i := 0; i < n; i++ {
+		if p[i] != o[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// operand is anything that evaluates to a value: a document path, a literal value placeholder
+// or one of the value-producing functions.
+type operand interface{}
+
+type valueOperand struct {
+	av types.AttributeValue
+}
+
+type sizeOperand struct {
+	path docPath
+}
+
+type ifNotExistsOperand struct {
+	path     docPath
+	fallback operand
+}
+
+type listAppendOperand struct {
+	left, right operand
+}
+
+type arithmeticOperand struct {
+	op          string
+	left, right operand
+}
+
+// condition nodes.
+type condition interface{}
+
+type compareCond struct {
+	op          string
+	left, right operand
+}
+
+type betweenCond struct {
+	value, low, high operand
+}
+
+type inCond struct {
+	value   operand
+	options []operand
+}
+
+type functionCond struct {
+	name string
+	path docPath
+	arg  operand
+}
+
+type andCond struct {
+	left, right condition
+}
+
+type orCond struct {
+	left, right condition
+}
+
+type notCond struct {
+	cond condition
+}
+
+// update actions.
+type setAction struct {
+	path  docPath
+	value operand
+}
+
+type removeAction struct {
+	path docPath
+}
+
+type addAction struct {
+	path  docPath
+	value types.AttributeValue
+}
+
+type deleteAction struct {
+	path  docPath
+	value types.AttributeValue
+}
+
+type updateExpr struct {
+	sets    []setAction
+	removes []removeAction
+	adds    []addAction
+	deletes []deleteAction
+}
+
+// placeholders resolves the expression attribute names and values of a single request, and
+// remembers which of them were used.
+type placeholders struct {
+	names      map[string]string
+	values     map[string]types.AttributeValue
+	usedNames  map[string]struct{}
+	usedValues map[string]struct{}
+}
+
+func newPlaceholders(names map[string]string, values map[string]types.AttributeValue) *placeholders {
+	return &placeholders{
+		names:      names,
+		values:     values,
+		usedNames:  make(map[string]struct{}),
+		usedValues: make(map[string]struct{}),
+	}
+}
+
+func (ph *placeholders) name(n string) (string, error) {
+	resolved, ok := ph.names[n]
+	if !ok {
+		return "", fmt.Errorf("invalid expression: an expression attribute name used in the document path is not defined; attribute name: %v", n)
+	}
+
+	ph.usedNames[n] = struct{}{}
+
+	return resolved, nil
+}
+
+func (ph *placeholders) value(v string) (types.AttributeValue, error) {
+	av, ok := ph.values[v]
+	if !ok {
+		return nil, fmt.Errorf("invalid expression: an expression attribute value used in expression is not defined; attribute value: %v", v)
+	}
+
+	ph.usedValues[v] = struct{}{}
+
+	return normalize(av)
+}
+
+// checkUnused rejects names and values that were supplied but never referenced.
+func (ph *placeholders) checkUnused() error {
+	for n := range ph.names {
+		if _, ok := ph.usedNames[n]; !ok {
+			return fmt.Errorf("value provided in ExpressionAttributeNames unused in expressions: keys: {%v}", n)
+		}
+	}
+
+	for v := range ph.values {
+		if _, ok := ph.usedValues[v]; !ok {
+			return fmt.Errorf("value provided in ExpressionAttributeValues unused in expressions: keys: {%v}", v)
+		}
+	}
+
+	return nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	ph     *placeholders
+}
+
+func newParser(expr string, ph *placeholders) (*parser, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &parser{tokens: tokens, ph: ph}, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) peekAt(offset int) token {
+	if p.pos+offset >= len(p.tokens) {
+		return token{kind: tokEOF}
+	}
+
+	return p.tokens[p.pos+offset]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *parser) isKeyword(kw string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && strings.EqualFold(t.text, kw)
+}
+
+func (p *parser) isPunct(s string) bool {
+	t := p.peek()
+	return t.kind == tokPunct && t.text == s
+}
+
+func (p *parser) expectPunct(s string) error {
+	if !p.isPunct(s) {
+		return p.syntaxError()
+	}
+
+	p.next()
+
+	return nil
+}
+
+func (p *parser) syntaxError() error {
+	t := p.peek()
+	if t.kind == tokEOF {
+		return fmt.Errorf("invalid expression: syntax error; token: <EOF>")
+	}
+
+	return fmt.Errorf("invalid expression: syntax error; token: %q", t.text)
+}
+
+func (p *parser) expectEOF() error {
+	if p.peek().kind != tokEOF {
+		return p.syntaxError()
+	}
+
+	return nil
+}
+
+func (p *parser) parsePath() (docPath, error) {
+	var path docPath
+
+	name, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+
+	path = append(path, pathElem{name: name})
+
+	for {
+		switch {
+		case p.isPunct("."):
+			p.next()
+
+			name, err := p.parseName()
+			if err != nil {
+				return nil, err
+			}
+
+			path = append(path, pathElem{name: name})
+		case p.isPunct("["):
+			p.next()
+
+			t := p.next()
+			if t.kind != tokNumber {
+				return nil, fmt.Errorf("invalid expression: list index must be a number; token: %q", t.text)
+			}
+
+			idx, err := strconv.Atoi(t.text)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := p.expectPunct("]"); err != nil {
+				return nil, err
+			}
+
+			path = append(path, pathElem{index: idx, isIndex: true})
+		default:
+			return path, nil
+		}
+	}
+}
+
+func (p *parser) parseName() (string, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokIdent:
+		return t.text, nil
+	case tokName:
+		return p.ph.name(t.text)
+	}
+
+	p.pos--
+
+	return "", p.syntaxError()
+}
+
+// parseOperand parses an operand usable in a condition: a path, a value or size(path).
+func (p *parser) parseOperand() (operand, error) {
+	t := p.peek()
+
+	switch {
+	case t.kind == tokValue:
+		p.next()
+
+		av, err := p.ph.value(t.text)
+		if err != nil {
+			return nil, err
+		}
+
+		return valueOperand{av: av}, nil
+	case t.kind == tokIdent && strings.EqualFold(t.text, "size") && p.peekAt(1).text == "(":
+		p.next()
+		p.next()
+
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+
+		return sizeOperand{path: path}, nil
+	case t.kind == tokIdent || t.kind == tokName:
+		return p.parsePath()
+	}
+
+	return nil, p.syntaxError()
+}
+
+func (p *parser) parseCondition() (condition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isKeyword("OR") {
+		p.next()
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = orCond{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (condition, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isKeyword("AND") {
+		p.next()
+
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		left = andCond{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (condition, error) {
+	if p.isKeyword("NOT") {
+		p.next()
+
+		cond, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return notCond{cond: cond}, nil
+	}
+
+	return p.parsePredicate()
+}
+
+var conditionFunctions = map[string]int{
+	"attribute_exists":     1,
+	"attribute_not_exists": 1,
+	"attribute_type":       2,
+	"begins_with":          2,
+	"contains":             2,
+}
+
+func (p *parser) parsePredicate() (condition, error) {
+	if p.isPunct("(") {
+		p.next()
+
+		cond, err := p.parseCondition()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+
+		return cond, nil
+	}
+
+	t := p.peek()
+	if t.kind == tokIdent && p.peekAt(1).text == "(" {
+		if argc, ok := conditionFunctions[strings.ToLower(t.text)]; ok {
+			p.next()
+			p.next()
+
+			path, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+
+			fn := functionCond{name: strings.ToLower(t.text), path: path}
+
+			if argc == 2 {
+				if err := p.expectPunct(","); err != nil {
+					return nil, err
+				}
+
+				if fn.arg, err = p.parseOperand(); err != nil {
+					return nil, err
+				}
+			}
+
+			if err := p.expectPunct(")"); err != nil {
+				return nil, err
+			}
+
+			return fn, nil
+		}
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.isKeyword("BETWEEN"):
+		p.next()
+
+		low, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.isKeyword("AND") {
+			return nil, p.syntaxError()
+		}
+
+		p.next()
+
+		high, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+
+		return betweenCond{value: left, low: low, high: high}, nil
+	case p.isKeyword("IN"):
+		p.next()
+
+		if err := p.expectPunct("("); err != nil {
+			return nil, err
+		}
+
+		in := inCond{value: left}
+
+		for {
+			option, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+
+			in.options = append(in.options, option)
+
+			if !p.isPunct(",") {
+				break
+			}
+
+			p.next()
+		}
+
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+
+		return in, nil
+	}
+
+	t = p.peek()
+	if t.kind == tokPunct {
+		switch t.text {
+		case "=", "<>", "<", "<=", ">", ">=":
+			p.next()
+
+			right, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+
+			return compareCond{op: t.text, left: left, right: right}, nil
+		}
+	}
+
+	return nil, p.syntaxError()
+}
+
+// parseSetValue parses the right hand side of a SET action.
+func (p *parser) parseSetValue() (operand, error) {
+	left, err := p.parseSetOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.isPunct("+") || p.isPunct("-") {
+		op := p.next().text
+
+		right, err := p.parseSetOperand()
+		if err != nil {
+			return nil, err
+		}
+
+		return arithmeticOperand{op: op, left: left, right: right}, nil
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseSetOperand() (operand, error) {
+	t := p.peek()
+
+	if t.kind == tokIdent && p.peekAt(1).text == "(" {
+		switch strings.ToLower(t.text) {
+		case "if_not_exists":
+			p.next()
+			p.next()
+
+			path, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+
+			if err := p.expectPunct(","); err != nil {
+				return nil, err
+			}
+
+			fallback, err := p.parseSetOperand()
+			if err != nil {
+				return nil, err
+			}
+
+			if err := p.expectPunct(")"); err != nil {
+				return nil, err
+			}
+
+			return ifNotExistsOperand{path: path, fallback: fallback}, nil
+		case "list_append":
+			p.next()
+			p.next()
+
+			left, err := p.parseSetOperand()
+			if err != nil {
+				return nil, err
+			}
+
+			if err := p.expectPunct(","); err != nil {
+				return nil, err
+			}
+
+			right, err := p.parseSetOperand()
+			if err != nil {
+				return nil, err
+			}
+
+			if err := p.expectPunct(")"); err != nil {
+				return nil, err
+			}
+
+			return listAppendOperand{left: left, right: right}, nil
+		}
+
+		return nil, fmt.Errorf("invalid UpdateExpression: invalid function name; function: %v", t.text)
+	}
+
+	if t.kind == tokValue {
+		p.next()
+
+		av, err := p.ph.value(t.text)
+		if err != nil {
+			return nil, err
+		}
+
+		return valueOperand{av: av}, nil
+	}
+
+	return p.parsePath()
+}
+
+var updateSections = []string{"SET", "REMOVE", "ADD", "DELETE"}
+
+func (p *parser) sectionKeyword() string {
+	for _, kw := range updateSections {
+		if p.isKeyword(kw) {
+			return kw
+		}
+	}
+
+	return ""
+}
+
+func (p *parser) parseUpdate() (*updateExpr, error) {
+	u := &updateExpr{}
+	seen := make(map[string]bool)
+
+	if p.peek().kind == tokEOF {
+		return nil, fmt.Errorf("invalid UpdateExpression: the expression can not be empty")
+	}
+
+	for p.peek().kind != tokEOF {
+		section := p.sectionKeyword()
+		if section == "" {
+			return nil, p.syntaxError()
+		}
+
+		if seen[section] {
+			return nil, fmt.Errorf("invalid UpdateExpression: the %q section can only be used once in an update expression", section)
+		}
+
+		seen[section] = true
+		p.next()
+
+		for {
+			path, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+
+			switch section {
+			case "SET":
+				if err := p.expectPunct("="); err != nil {
+					return nil, err
+				}
+
+				value, err := p.parseSetValue()
+				if err != nil {
+					return nil, err
+				}
+
+				u.sets = append(u.sets, setAction{path: path, value: value})
+			case "REMOVE":
+				u.removes = append(u.removes, removeAction{path: path})
+			case "ADD", "DELETE":
+				t := p.next()
+				if t.kind != tokValue {
+					p.pos--
+					return nil, p.syntaxError()
+				}
+
+				av, err := p.ph.value(t.text)
+				if err != nil {
+					return nil, err
+				}
+
+				if section == "ADD" {
+					u.adds = append(u.adds, addAction{path: path, value: av})
+				} else {
+					u.deletes = append(u.deletes, deleteAction{path: path, value: av})
+				}
+			}
+
+			if !p.isPunct(",") {
+				break
+			}
+
+			p.next()
+		}
+	}
+
+	return u, u.checkOverlaps()
+}
+
+func (u *updateExpr) paths() []docPath {
+	var paths []docPath
+
+	for _, a := range u.sets {
+		paths = append(paths, a.path)
+	}
+
+	for _, a := range u.removes {
+		paths = append(paths, a.path)
+	}
+
+	for _, a := range u.adds {
+		paths = append(paths, a.path)
+	}
+
+	for _, a := range u.deletes {
+		paths = append(paths, a.path)
+	}
+
+	return paths
+}
+
+func (u *updateExpr) checkOverlaps() error {
+	paths := u.paths()
+
+	for i := range paths {
+		for j := i + 1; j < len(paths); j++ {
+			if paths[i].overlaps(paths[j]) {
+				return fmt.Errorf("invalid UpdateExpression: two document paths overlap with each other; must remove or rewrite one of these paths; path one: [%v], path two: [%v]", paths[i], paths[j])
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *parser) parseProjection() ([]docPath, error) {
+	var paths []docPath
+
+	for {
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+
+		paths = append(paths, path)
+
+		if !p.isPunct(",") {
+			break
+		}
+
+		p.next()
+	}
+
+	return paths, p.expectEOF()
+}
+
+func parseCondition(expr string, ph *placeholders) (condition, error) {
+	p, err := newParser(expr, ph)
+	if err != nil {
+		return nil, err
+	}
+
+	cond, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+
+	return cond, p.expectEOF()
+}
+
+func parseUpdate(expr string, ph *placeholders) (*updateExpr, error) {
+	p, err := newParser(expr, ph)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.parseUpdate()
+}
+
+func parseProjection(expr string, ph *placeholders) ([]docPath, error) {
+	p, err := newParser(expr, ph)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.parseProjection()
+}
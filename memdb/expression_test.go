@@ -0,0 +1,120 @@
+package memdb
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditions(t *testing.T) {
+	it := item{
+		"pk":   s("k"),
+		"val":  n("10"),
+		"tags": &types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+		"doc": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"list": &types.AttributeValueMemberL{Value: []types.AttributeValue{s("x"), n("2")}},
+		}},
+	}
+
+	values := map[string]types.AttributeValue{
+		":five": n("5"),
+		":ten":  n("10.0"),
+		":x":    s("x"),
+		":a":    s("a"),
+		":k":    s("k"),
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"val > :five", true},
+		{"val = :ten", true},
+		{"val <> :ten", false},
+		{"val BETWEEN :five AND :ten", true},
+		{"NOT val < :ten", true},
+		{"val < :five OR pk = :k", true},
+		{"val < :five AND pk = :k", false},
+		{"(val < :five OR pk = :k) AND attribute_exists(tags)", true},
+		{"attribute_not_exists(missing)", true},
+		{"attribute_type(tags, :x)", false},
+		{"contains(tags, :a)", true},
+		{"begins_with(pk, :k)", true},
+		{"doc.list[0] = :x", true},
+		{"size(doc.list) = :five", false},
+		{"size(tags) < :five", true},
+		{"pk IN (:x, :k)", true},
+		{"missing = :x", false},
+	}
+
+	for _, tt := range tests {
+		ph := newPlaceholders(nil, values)
+		cond, err := parseCondition(tt.expr, ph)
+		assert.NoError(t, err, tt.expr)
+
+		got, err := evalCondition(it, cond)
+		assert.NoError(t, err, tt.expr)
+		assert.Equal(t, tt.want, got, tt.expr)
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	values := map[string]types.AttributeValue{":v": s("v")}
+
+	for _, expr := range []string{
+		"",
+		"val =",
+		"val = :missing",
+		"#missing = :v",
+		"val = :v AND",
+		"unknown_function(val)",
+		"(val = :v",
+	} {
+		_, err := parseCondition(expr, newPlaceholders(nil, values))
+		assert.Error(t, err, expr)
+	}
+
+	for _, expr := range []string{
+		"SET a = :v REMOVE a",
+		"SET a = :v SET b = :v",
+		"ADD a",
+		"DELETE",
+	} {
+		_, err := parseUpdate(expr, newPlaceholders(nil, values))
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestUpdates(t *testing.T) {
+	it := item{
+		"pk":   s("k"),
+		"list": &types.AttributeValueMemberL{Value: []types.AttributeValue{s("a"), s("b"), s("c")}},
+		"tags": &types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+	}
+
+	values := map[string]types.AttributeValue{
+		":tail": &types.AttributeValueMemberL{Value: []types.AttributeValue{s("d")}},
+		":tags": &types.AttributeValueMemberSS{Value: []string{"b", "c"}},
+		":one":  n("1"),
+	}
+
+	u, err := parseUpdate("SET n = :one + :one REMOVE list[0], list[2] ADD tags :tags", newPlaceholders(nil, values))
+	assert.NoError(t, err)
+
+	out, err := applyUpdate(it, u)
+	assert.NoError(t, err)
+	assert.Equal(t, &types.AttributeValueMemberL{Value: []types.AttributeValue{s("b")}}, out["list"])
+	assert.Equal(t, n("2"), out["n"])
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, out["tags"].(*types.AttributeValueMemberSS).Value)
+
+	assert.Len(t, it["list"].(*types.AttributeValueMemberL).Value, 3)
+
+	u, err = parseUpdate("SET list = list_append(list, :tail) DELETE tags :tags", newPlaceholders(nil, values))
+	assert.NoError(t, err)
+
+	out, err = applyUpdate(it, u)
+	assert.NoError(t, err)
+	assert.Len(t, out["list"].(*types.AttributeValueMemberL).Value, 4)
+	assert.Equal(t, &types.AttributeValueMemberSS{Value: []string{"a"}}, out["tags"])
+}
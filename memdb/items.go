@@ -0,0 +1,767 @@
+package memdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// write is a prepared single-item write: the item it targets, the condition it must satisfy and
+// the function that computes the new version of the item. Single-item operations and transactions
+// both prepare writes first and then apply them, so they share validation and semantics.
+type write struct {
+	table     *table
+	hash, rng string
+	cond      condition
+	// apply computes the new item from the old one (which is nil if it does not exist). A nil new
+	// item deletes the stored item. Condition checks leave apply nil.
+	apply func(old item) (item, error)
+	// touched lists the top level attributes named by an update expression, for UPDATED_OLD / UPDATED_NEW.
+	touched []string
+}
+
+// result is the outcome of executing a write.
+type result struct {
+	old, new item
+}
+
+func parseOptionalCondition(expr *string, ph *placeholders) (condition, error) {
+	if expr == nil {
+		return nil, nil
+	}
+
+	if strings.TrimSpace(*expr) == "" {
+		return nil, validationError("Invalid ConditionExpression: The expression can not be empty;")
+	}
+
+	cond, err := parseCondition(*expr, ph)
+	if err != nil {
+		return nil, validationError("Invalid ConditionExpression: %v", err)
+	}
+
+	return cond, nil
+}
+
+func checkPlaceholders(ph *placeholders) error {
+	if err := ph.checkUnused(); err != nil {
+		return validationError("%v", err)
+	}
+
+	return nil
+}
+
+func (db *DB) preparePut(tableName *string, it map[string]types.AttributeValue, condExpr *string,
+	names map[string]string, values map[string]types.AttributeValue) (*write, error) {
+	t, err := db.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	newItem := make(item, len(it))
+
+	for k, v := range it {
+		if newItem[k], err = normalize(v); err != nil {
+			return nil, validationError("One or more parameter values were invalid: %v", err)
+		}
+	}
+
+	if err := t.validateItem(newItem); err != nil {
+		return nil, err
+	}
+
+	hash, rng, err := t.primaryKey(t.keyOf(newItem))
+	if err != nil {
+		return nil, err
+	}
+
+	ph := newPlaceholders(names, values)
+
+	cond, err := parseOptionalCondition(condExpr, ph)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkPlaceholders(ph); err != nil {
+		return nil, err
+	}
+
+	return &write{
+		table: t,
+		hash:  hash,
+		rng:   rng,
+		cond:  cond,
+		apply: func(old item) (item, error) {
+			return newItem.clone(), nil
+		},
+	}, nil
+}
+
+func (db *DB) prepareUpdate(tableName *string, key map[string]types.AttributeValue, condExpr *string, updateExpression *string,
+	names map[string]string, values map[string]types.AttributeValue) (*write, error) {
+	t, err := db.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, rng, err := t.primaryKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	ph := newPlaceholders(names, values)
+
+	cond, err := parseOptionalCondition(condExpr, ph)
+	if err != nil {
+		return nil, err
+	}
+
+	var update *updateExpr
+
+	if updateExpression != nil {
+		if update, err = parseUpdate(*updateExpression, ph); err != nil {
+			return nil, validationError("Invalid UpdateExpression: %v", err)
+		}
+	}
+
+	if err := checkPlaceholders(ph); err != nil {
+		return nil, err
+	}
+
+	w := &write{table: t, hash: hash, rng: rng, cond: cond}
+
+	if update != nil {
+		for _, path := range update.paths() {
+			name := path[0].name
+			if _, isKey := key[name]; isKey {
+				return nil, validationError("One or more parameter values were invalid: Cannot update attribute %v. This attribute is part of the key", name)
+			}
+
+			w.touched = append(w.touched, name)
+		}
+	}
+
+	w.apply = func(old item) (item, error) {
+		if old == nil {
+			old = make(item)
+			for k, v := range key {
+				old[k] = cloneAV(v)
+			}
+		}
+
+		if update == nil {
+			return old.clone(), nil
+		}
+
+		return applyUpdate(old, update)
+	}
+
+	return w, nil
+}
+
+func (db *DB) prepareDelete(tableName *string, key map[string]types.AttributeValue, condExpr *string,
+	names map[string]string, values map[string]types.AttributeValue) (*write, error) {
+	w, err := db.prepareConditionCheck(tableName, key, condExpr, names, values)
+	if err != nil {
+		return nil, err
+	}
+
+	w.apply = func(old item) (item, error) {
+		return nil, nil
+	}
+
+	return w, nil
+}
+
+func (db *DB) prepareConditionCheck(tableName *string, key map[string]types.AttributeValue, condExpr *string,
+	names map[string]string, values map[string]types.AttributeValue) (*write, error) {
+	t, err := db.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, rng, err := t.primaryKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	ph := newPlaceholders(names, values)
+
+	cond, err := parseOptionalCondition(condExpr, ph)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkPlaceholders(ph); err != nil {
+		return nil, err
+	}
+
+	return &write{table: t, hash: hash, rng: rng, cond: cond}, nil
+}
+
+// evaluate checks the condition and computes the new item without storing anything.
+// conditionFailed is true if the condition did not hold.
+func (w *write) evaluate() (r result, conditionFailed bool, err error) {
+	r.old = w.table.get(w.hash, w.rng)
+
+	if w.cond != nil {
+		ok, err := evalCondition(r.old, w.cond)
+		if err != nil {
+			return r, false, validationError("Invalid ConditionExpression: %v", err)
+		}
+
+		if !ok {
+			return r, true, nil
+		}
+	}
+
+	if w.apply == nil {
+		r.new = r.old
+		return r, false, nil
+	}
+
+	if r.new, err = w.apply(r.old); err != nil {
+		return r, false, validationError("%v", err)
+	}
+
+	if r.new != nil {
+		if err := w.table.validateItem(r.new); err != nil {
+			return r, false, err
+		}
+	}
+
+	return r, false, nil
+}
+
+func (w *write) commit(r result) {
+	if w.apply == nil {
+		return
+	}
+
+	if r.new == nil {
+		w.table.delete(w.hash, w.rng)
+	} else {
+		w.table.put(w.hash, w.rng, r.new)
+	}
+}
+
+// execute evaluates and commits a single write, translating a failed condition into a
+// ConditionalCheckFailedException.
+func (w *write) execute() (result, error) {
+	r, conditionFailed, err := w.evaluate()
+	if err != nil {
+		return r, err
+	}
+
+	if conditionFailed {
+		return r, &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+	}
+
+	w.commit(r)
+
+	return r, nil
+}
+
+func (w *write) returnValues(r result, rv types.ReturnValue) (map[string]types.AttributeValue, error) {
+	switch rv {
+	case "", types.ReturnValueNone:
+		return nil, nil
+	case types.ReturnValueAllOld:
+		return r.old.clone(), nil
+	case types.ReturnValueAllNew:
+		return r.new.clone(), nil
+	case types.ReturnValueUpdatedOld, types.ReturnValueUpdatedNew:
+		source := r.old
+		if rv == types.ReturnValueUpdatedNew {
+			source = r.new
+		}
+
+		var out item
+
+		for _, name := range w.touched {
+			if av, ok := source[name]; ok {
+				if out == nil {
+					out = make(item)
+				}
+
+				out[name] = cloneAV(av)
+			}
+		}
+
+		return out, nil
+	}
+
+	return nil, validationError("1 validation error detected: Value '%v' at 'returnValues' failed to satisfy constraint", rv)
+}
+
+// GetItem returns the item with the given key, optionally projected.
+func (db *DB) GetItem(ctx context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if err := db.checkContext(ctx); err != nil {
+		return nil, operationError("GetItem", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	it, size, err := db.getItem(params.TableName, params.Key, params.ProjectionExpression, params.ExpressionAttributeNames)
+	if err != nil {
+		return nil, operationError("GetItem", err)
+	}
+
+	t, _ := db.table(params.TableName)
+	consumed := t.consumedCapacity(params.ReturnConsumedCapacity, usage{table: readUnits(size, aws.ToBool(params.ConsistentRead))}, true)
+
+	return &dynamodb.GetItemOutput{Item: it, ConsumedCapacity: consumed}, nil
+}
+
+// getItem returns the item with the given key, optionally projected, and the size of the whole item.
+func (db *DB) getItem(tableName *string, key map[string]types.AttributeValue, projection *string, names map[string]string) (map[string]types.AttributeValue, int, error) {
+	t, err := db.table(tableName)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hash, rng, err := t.primaryKey(key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ph := newPlaceholders(names, nil)
+
+	var paths []docPath
+
+	if projection != nil {
+		if paths, err = parseProjection(*projection, ph); err != nil {
+			return nil, 0, validationError("Invalid ProjectionExpression: %v", err)
+		}
+	}
+
+	if err := checkPlaceholders(ph); err != nil {
+		return nil, 0, err
+	}
+
+	it := t.get(hash, rng)
+	if it == nil {
+		return nil, 0, nil
+	}
+
+	if paths != nil {
+		return project(it, paths), it.size(), nil
+	}
+
+	return it.clone(), it.size(), nil
+}
+
+// PutItem replaces the item with the same key, subject to the optional condition.
+func (db *DB) PutItem(ctx context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if err := db.checkContext(ctx); err != nil {
+		return nil, operationError("PutItem", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	w, err := db.preparePut(params.TableName, params.Item, params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, operationError("PutItem", err)
+	}
+
+	if params.ReturnValues != "" && params.ReturnValues != types.ReturnValueNone && params.ReturnValues != types.ReturnValueAllOld {
+		return nil, operationError("PutItem", validationError("ReturnValues can only be ALL_OLD or NONE"))
+	}
+
+	r, err := w.execute()
+	if err != nil {
+		return nil, operationError("PutItem", err)
+	}
+
+	attributes, err := w.returnValues(r, params.ReturnValues)
+	consumed := w.table.consumedCapacity(params.ReturnConsumedCapacity, w.writeUsage(r), false)
+
+	return &dynamodb.PutItemOutput{Attributes: attributes, ConsumedCapacity: consumed}, operationError("PutItem", err)
+}
+
+// UpdateItem creates or edits the item with the given key, subject to the optional condition.
+func (db *DB) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if err := db.checkContext(ctx); err != nil {
+		return nil, operationError("UpdateItem", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	w, err := db.prepareUpdate(params.TableName, params.Key, params.ConditionExpression, params.UpdateExpression,
+		params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, operationError("UpdateItem", err)
+	}
+
+	r, err := w.execute()
+	if err != nil {
+		return nil, operationError("UpdateItem", err)
+	}
+
+	attributes, err := w.returnValues(r, params.ReturnValues)
+	consumed := w.table.consumedCapacity(params.ReturnConsumedCapacity, w.writeUsage(r), false)
+
+	return &dynamodb.UpdateItemOutput{Attributes: attributes, ConsumedCapacity: consumed}, operationError("UpdateItem", err)
+}
+
+// DeleteItem removes the item with the given key, subject to the optional condition.
+func (db *DB) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	if err := db.checkContext(ctx); err != nil {
+		return nil, operationError("DeleteItem", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	w, err := db.prepareDelete(params.TableName, params.Key, params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, operationError("DeleteItem", err)
+	}
+
+	if params.ReturnValues != "" && params.ReturnValues != types.ReturnValueNone && params.ReturnValues != types.ReturnValueAllOld {
+		return nil, operationError("DeleteItem", validationError("ReturnValues can only be ALL_OLD or NONE"))
+	}
+
+	r, err := w.execute()
+	if err != nil {
+		return nil, operationError("DeleteItem", err)
+	}
+
+	attributes, err := w.returnValues(r, params.ReturnValues)
+	consumed := w.table.consumedCapacity(params.ReturnConsumedCapacity, w.writeUsage(r), false)
+
+	return &dynamodb.DeleteItemOutput{Attributes: attributes, ConsumedCapacity: consumed}, operationError("DeleteItem", err)
+}
+
+// TransactWriteItems applies all the given writes atomically. If any condition fails, nothing is written
+// and a TransactionCanceledException listing the reason for every action is returned.
+func (db *DB) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	if err := db.checkContext(ctx); err != nil {
+		return nil, operationError("TransactWriteItems", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	usages, err := db.transactWrite(params.TransactItems)
+	if err != nil {
+		return nil, operationError("TransactWriteItems", err)
+	}
+
+	return &dynamodb.TransactWriteItemsOutput{
+		ConsumedCapacity: consumedCapacities(params.ReturnConsumedCapacity, usages, false),
+	}, nil
+}
+
+// transactWrite applies the actions atomically, and returns the capacity they consumed per table.
+// Transactional writes consume twice the capacity of standard ones.
+func (db *DB) transactWrite(actions []types.TransactWriteItem) (map[*table]usage, error) {
+	if len(actions) == 0 || len(actions) > maxTransactionActions {
+		return nil, validationError("1 validation error detected: Value at 'transactItems' failed to satisfy constraint: Member must have length less than or equal to %v", maxTransactionActions)
+	}
+
+	size := 0
+	for _, action := range actions {
+		switch {
+		case action.Put != nil:
+			size += item(action.Put.Item).size()
+		case action.Update != nil:
+			size += item(action.Update.Key).size() + item(action.Update.ExpressionAttributeValues).size()
+		case action.Delete != nil:
+			size += item(action.Delete.Key).size() + item(action.Delete.ExpressionAttributeValues).size()
+		case action.ConditionCheck != nil:
+			size += item(action.ConditionCheck.Key).size() + item(action.ConditionCheck.ExpressionAttributeValues).size()
+		}
+	}
+
+	if size > maxTransactionSize {
+		return nil, validationError("Transaction request cannot be larger than 4 MB")
+	}
+
+	writes := make([]*write, len(actions))
+	returnOnFailure := make([]types.ReturnValuesOnConditionCheckFailure, len(actions))
+	seen := make(map[string]struct{})
+
+	for i, action := range actions {
+		var w *write
+		var err error
+
+		switch {
+		case action.Put != nil:
+			a := action.Put
+			w, err = db.preparePut(a.TableName, a.Item, a.ConditionExpression, a.ExpressionAttributeNames, a.ExpressionAttributeValues)
+			returnOnFailure[i] = a.ReturnValuesOnConditionCheckFailure
+		case action.Update != nil:
+			a := action.Update
+			w, err = db.prepareUpdate(a.TableName, a.Key, a.ConditionExpression, a.UpdateExpression, a.ExpressionAttributeNames, a.ExpressionAttributeValues)
+			returnOnFailure[i] = a.ReturnValuesOnConditionCheckFailure
+		case action.Delete != nil:
+			a := action.Delete
+			w, err = db.prepareDelete(a.TableName, a.Key, a.ConditionExpression, a.ExpressionAttributeNames, a.ExpressionAttributeValues)
+			returnOnFailure[i] = a.ReturnValuesOnConditionCheckFailure
+		case action.ConditionCheck != nil:
+			a := action.ConditionCheck
+			if a.ConditionExpression == nil {
+				return nil, validationError("ConditionExpression is required for ConditionCheck")
+			}
+
+			w, err = db.prepareConditionCheck(a.TableName, a.Key, a.ConditionExpression, a.ExpressionAttributeNames, a.ExpressionAttributeValues)
+			returnOnFailure[i] = a.ReturnValuesOnConditionCheckFailure
+		default:
+			return nil, validationError("TransactItems can only contain one of Check, Put, Update or Delete")
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		id := fmt.Sprintf("%v\x00%v\x00%v", w.table.name, w.hash, w.rng)
+		if _, dup := seen[id]; dup {
+			return nil, validationError("Transaction request cannot include multiple operations on one item")
+		}
+
+		seen[id] = struct{}{}
+		writes[i] = w
+	}
+
+	results := make([]result, len(writes))
+	reasons := make([]types.CancellationReason, len(writes))
+	cancelled := false
+
+	for i, w := range writes {
+		r, conditionFailed, err := w.evaluate()
+		results[i] = r
+		reasons[i] = types.CancellationReason{Code: aws.String("None")}
+
+		switch {
+		case err != nil:
+			cancelled = true
+			reasons[i] = types.CancellationReason{Code: aws.String("ValidationError"), Message: aws.String(errorMessage(err))}
+		case conditionFailed:
+			cancelled = true
+			reasons[i] = types.CancellationReason{Code: aws.String("ConditionalCheckFailed"), Message: aws.String("The conditional request failed")}
+
+			if returnOnFailure[i] == types.ReturnValuesOnConditionCheckFailureAllOld && r.old != nil {
+				reasons[i].Item = r.old.clone()
+			}
+		}
+	}
+
+	if cancelled {
+		codes := make([]string, len(reasons))
+		for i, reason := range reasons {
+			codes[i] = aws.ToString(reason.Code)
+		}
+
+		return nil, &types.TransactionCanceledException{
+			Message:             aws.String(fmt.Sprintf("Transaction cancelled, please refer cancellation reasons for specific reasons [%v]", strings.Join(codes, ", "))),
+			CancellationReasons: reasons,
+		}
+	}
+
+	usages := make(map[*table]usage)
+
+	for i, w := range writes {
+		w.commit(results[i])
+
+		u := usages[w.table]
+		u.add(w.writeUsage(results[i]), 2)
+		usages[w.table] = u
+	}
+
+	return usages, nil
+}
+
+// BatchWriteItem puts and deletes the given items. Unlike a transaction, each write is applied on its own,
+// but the emulator never leaves any unprocessed. The whole batch is rejected if it is invalid, has more
+// than 25 requests or touches the same item twice.
+func (db *DB) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	if err := db.checkContext(ctx); err != nil {
+		return nil, operationError("BatchWriteItem", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	usages, err := db.batchWrite(params.RequestItems)
+	if err != nil {
+		return nil, operationError("BatchWriteItem", err)
+	}
+
+	return &dynamodb.BatchWriteItemOutput{
+		ConsumedCapacity: consumedCapacities(params.ReturnConsumedCapacity, usages, false),
+	}, nil
+}
+
+func (db *DB) batchWrite(requestItems map[string][]types.WriteRequest) (map[*table]usage, error) {
+	var writes []*write
+
+	seen := make(map[string]struct{})
+
+	for tableName, requests := range requestItems {
+		tableName := tableName
+
+		for _, request := range requests {
+			var w *write
+			var err error
+
+			switch {
+			case request.PutRequest != nil && request.DeleteRequest == nil:
+				w, err = db.preparePut(&tableName, request.PutRequest.Item, nil, nil, nil)
+			case request.DeleteRequest != nil && request.PutRequest == nil:
+				w, err = db.prepareDelete(&tableName, request.DeleteRequest.Key, nil, nil, nil)
+			default:
+				return nil, validationError("WriteRequest must contain exactly one of PutRequest or DeleteRequest")
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			id := fmt.Sprintf("%v\x00%v\x00%v", w.table.name, w.hash, w.rng)
+			if _, dup := seen[id]; dup {
+				return nil, validationError("Provided list of item keys contains duplicates")
+			}
+
+			seen[id] = struct{}{}
+			writes = append(writes, w)
+		}
+	}
+
+	if len(writes) == 0 || len(writes) > maxBatchWriteRequests {
+		return nil, validationError("1 validation error detected: Value at 'requestItems' failed to satisfy constraint: Member must have length less than or equal to %v", maxBatchWriteRequests)
+	}
+
+	usages := make(map[*table]usage)
+
+	for _, w := range writes {
+		r, err := w.execute()
+		if err != nil {
+			return nil, err
+		}
+
+		u := usages[w.table]
+		u.add(w.writeUsage(r), 1)
+		usages[w.table] = u
+	}
+
+	return usages, nil
+}
+
+func errorMessage(err error) string {
+	type messager interface {
+		ErrorMessage() string
+	}
+
+	if m, ok := err.(messager); ok {
+		return m.ErrorMessage()
+	}
+
+	return err.Error()
+}
+
+// BatchGetItem returns the items with the given keys, optionally projected, leaving out those that don't
+// exist. The emulator never leaves any keys unprocessed. The whole batch is rejected if it is invalid,
+// has more than 100 keys or names the same item twice.
+func (db *DB) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	if err := db.checkContext(ctx); err != nil {
+		return nil, operationError("BatchGetItem", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	out := &dynamodb.BatchGetItemOutput{Responses: make(map[string][]map[string]types.AttributeValue)}
+	usages := make(map[*table]usage)
+	seen := make(map[string]struct{})
+
+	for tableName, request := range params.RequestItems {
+		tableName := tableName
+
+		t, err := db.table(&tableName)
+		if err != nil {
+			return nil, operationError("BatchGetItem", err)
+		}
+
+		for _, key := range request.Keys {
+			hash, rng, err := t.primaryKey(key)
+			if err != nil {
+				return nil, operationError("BatchGetItem", err)
+			}
+
+			id := fmt.Sprintf("%v\x00%v\x00%v", t.name, hash, rng)
+			if _, dup := seen[id]; dup {
+				return nil, operationError("BatchGetItem", validationError("Provided list of item keys contains duplicates"))
+			}
+
+			seen[id] = struct{}{}
+
+			it, size, err := db.getItem(&tableName, key, request.ProjectionExpression, request.ExpressionAttributeNames)
+			if err != nil {
+				return nil, operationError("BatchGetItem", err)
+			}
+
+			if it != nil {
+				out.Responses[tableName] = append(out.Responses[tableName], it)
+			}
+
+			u := usages[t]
+			u.add(usage{table: readUnits(size, aws.ToBool(request.ConsistentRead))}, 1)
+			usages[t] = u
+		}
+	}
+
+	if len(seen) == 0 || len(seen) > maxBatchGetKeys {
+		return nil, operationError("BatchGetItem", validationError("1 validation error detected: Value at 'requestItems' failed to satisfy constraint: Member must have length less than or equal to %v", maxBatchGetKeys))
+	}
+
+	out.ConsumedCapacity = consumedCapacities(params.ReturnConsumedCapacity, usages, true)
+
+	return out, nil
+}
+
+// TransactGetItems reads all the given items from a single consistent snapshot.
+func (db *DB) TransactGetItems(ctx context.Context, params *dynamodb.TransactGetItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactGetItemsOutput, error) {
+	if err := db.checkContext(ctx); err != nil {
+		return nil, operationError("TransactGetItems", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if len(params.TransactItems) == 0 || len(params.TransactItems) > maxTransactionActions {
+		return nil, operationError("TransactGetItems", validationError("1 validation error detected: Value at 'transactItems' failed to satisfy constraint: Member must have length less than or equal to %v", maxTransactionActions))
+	}
+
+	out := &dynamodb.TransactGetItemsOutput{Responses: make([]types.ItemResponse, len(params.TransactItems))}
+	usages := make(map[*table]usage)
+
+	for i, action := range params.TransactItems {
+		if action.Get == nil {
+			return nil, operationError("TransactGetItems", validationError("TransactItems can only contain Get"))
+		}
+
+		it, size, err := db.getItem(action.Get.TableName, action.Get.Key, action.Get.ProjectionExpression, action.Get.ExpressionAttributeNames)
+		if err != nil {
+			return nil, operationError("TransactGetItems", err)
+		}
+
+		out.Responses[i] = types.ItemResponse{Item: it}
+
+		// Transactional reads consume twice the capacity of strongly consistent ones.
+		t, _ := db.table(action.Get.TableName)
+		u := usages[t]
+		u.add(usage{table: readUnits(size, true)}, 2)
+		usages[t] = u
+	}
+
+	out.ConsumedCapacity = consumedCapacities(params.ReturnConsumedCapacity, usages, true)
+
+	return out, nil
+}
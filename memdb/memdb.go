@@ -0,0 +1,535 @@
+// Package memdb is an in-process emulator of the parts of the DynamoDB API that redimo uses. It is meant
+// for unit tests and local development, where running DynamoDB Local (and a JVM) is inconvenient.
+//
+// The emulator honours table key schemas and local / global secondary indexes, evaluates condition,
+// filter, key condition, update and projection expressions, paginates query and scan results through
+// LastEvaluatedKey and ExclusiveStartKey, and applies TransactWriteItems atomically, cancelling the
+// whole transaction with a TransactionCanceledException when any condition fails. BatchWriteItem applies
+// every request and never returns unprocessed items.
+//
+// When asked with ReturnConsumedCapacity, operations report the capacity units DynamoDB would charge for
+// them, per table and per index: reads per 4 KB, halved for eventually consistent reads, writes per 1 KB,
+// and transactions at twice the cost.
+//
+// Errors are the same typed errors the AWS SDK returns (types.ConditionalCheckFailedException,
+// types.ResourceNotFoundException and so on), wrapped in a smithy.OperationError, so code that inspects
+// errors with errors.As behaves identically against the emulator and against DynamoDB.
+//
+// Usage:
+//
+//	client := redimo.NewClient(memdb.New())
+//
+// All state lives in memory and is lost when the DB is garbage collected.
+package memdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+// maxItemSize is DynamoDB's 400 KB item size limit.
+const maxItemSize = 400 * 1024
+
+// maxTransactionActions is the maximum number of actions in a TransactWriteItems or TransactGetItems call.
+const maxTransactionActions = 100
+
+// maxTransactionSize is the maximum total size of the items and values in a TransactWriteItems call.
+const maxTransactionSize = 4 * 1024 * 1024
+
+// maxBatchGetKeys is the maximum number of keys in a BatchGetItem call.
+const maxBatchGetKeys = 100
+
+// maxBatchWriteRequests is the maximum number of put and delete requests in a BatchWriteItem call.
+const maxBatchWriteRequests = 25
+
+// DB is an in-memory DynamoDB. It is safe for concurrent use, and every operation is atomic.
+type DB struct {
+	mu       sync.Mutex
+	tables   map[string]*table
+	pageSize int
+}
+
+// Option configures a DB.
+type Option func(db *DB)
+
+// PageSize limits the number of items a single Query evaluates before returning a LastEvaluatedKey,
+// standing in for DynamoDB's 1 MB page limit. Small page sizes are useful to exercise pagination.
+func PageSize(items int) Option {
+	return func(db *DB) {
+		db.pageSize = items
+	}
+}
+
+// New creates an empty in-memory DynamoDB.
+func New(options ...Option) *DB {
+	db := &DB{
+		tables:   make(map[string]*table),
+		pageSize: 1000,
+	}
+
+	for _, option := range options {
+		option(db)
+	}
+
+	return db
+}
+
+type keyAttr struct {
+	name string
+	typ  types.ScalarAttributeType
+}
+
+type index struct {
+	name       string
+	hashKey    keyAttr
+	rangeKey   *keyAttr
+	projection types.Projection
+	local      bool
+}
+
+type table struct {
+	name       string
+	created    time.Time
+	billing    types.BillingMode
+	throughput *types.ProvisionedThroughput
+	attributes []types.AttributeDefinition
+	hashKey    keyAttr
+	rangeKey   *keyAttr
+	indexes    map[string]*index
+	partitions map[string]map[string]item
+
+	// Settings that the emulator records and reports, but does not act on.
+	streamViewType      types.StreamViewType
+	sse                 bool
+	ttlAttribute        string
+	pointInTimeRecovery bool
+	tags                map[string]string
+}
+
+func validationError(format string, args ...interface{}) error {
+	return &smithy.GenericAPIError{
+		Code:    "ValidationException",
+		Message: fmt.Sprintf(format, args...),
+		Fault:   smithy.FaultClient,
+	}
+}
+
+func operationError(operation string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &smithy.OperationError{
+		ServiceID:     dynamodb.ServiceID,
+		OperationName: operation,
+		Err:           err,
+	}
+}
+
+func (db *DB) table(name *string) (*table, error) {
+	t, ok := db.tables[aws.ToString(name)]
+	if !ok {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("Requested resource not found")}
+	}
+
+	return t, nil
+}
+
+// encodeKey turns a key attribute value into a string usable as a map key. Numbers are
+// normalized first, so 1 and 1.0 address the same item.
+func encodeKey(av types.AttributeValue) string {
+	switch av := av.(type) {
+	case *types.AttributeValueMemberS:
+		return "S" + av.Value
+	case *types.AttributeValueMemberN:
+		return "N" + canonicalNumber(av.Value)
+	case *types.AttributeValueMemberB:
+		return "B" + string(av.Value)
+	}
+
+	return ""
+}
+
+func (k keyAttr) validate(av types.AttributeValue, present bool) error {
+	if !present {
+		return validationError("One or more parameter values were invalid: Missing the key %v in the item", k.name)
+	}
+
+	if typeOf(av) != string(k.typ) {
+		return validationError("One or more parameter values were invalid: Type mismatch for key %v expected: %v actual: %v", k.name, k.typ, typeOf(av))
+	}
+
+	switch av := av.(type) {
+	case *types.AttributeValueMemberS:
+		if av.Value == "" {
+			return validationError("One or more parameter values are not valid. The AttributeValue for a key attribute cannot contain an empty string value. Key: %v", k.name)
+		}
+	case *types.AttributeValueMemberB:
+		if len(av.Value) == 0 {
+			return validationError("One or more parameter values are not valid. The AttributeValue for a key attribute cannot contain an empty binary value. Key: %v", k.name)
+		}
+	}
+
+	return nil
+}
+
+// primaryKey validates a key map (as passed to GetItem, UpdateItem or DeleteItem) and returns
+// the encoded partition and sort keys.
+func (t *table) primaryKey(key map[string]types.AttributeValue) (hash string, rng string, err error) {
+	expected := 1
+	if t.rangeKey != nil {
+		expected = 2
+	}
+
+	if len(key) != expected {
+		return "", "", validationError("The provided key element does not match the schema")
+	}
+
+	hav, ok := key[t.hashKey.name]
+	if err := t.hashKey.validate(hav, ok); err != nil {
+		return "", "", validationError("The provided key element does not match the schema")
+	}
+
+	hash = encodeKey(hav)
+
+	if t.rangeKey != nil {
+		rav, ok := key[t.rangeKey.name]
+		if err := t.rangeKey.validate(rav, ok); err != nil {
+			return "", "", validationError("The provided key element does not match the schema")
+		}
+
+		rng = encodeKey(rav)
+	}
+
+	return hash, rng, nil
+}
+
+// keyOf extracts the primary key attributes of an item.
+func (t *table) keyOf(it item) map[string]types.AttributeValue {
+	key := map[string]types.AttributeValue{t.hashKey.name: cloneAV(it[t.hashKey.name])}
+	if t.rangeKey != nil {
+		key[t.rangeKey.name] = cloneAV(it[t.rangeKey.name])
+	}
+
+	return key
+}
+
+func (t *table) get(hash, rng string) item {
+	return t.partitions[hash][rng]
+}
+
+func (t *table) put(hash, rng string, it item) {
+	partition, ok := t.partitions[hash]
+	if !ok {
+		partition = make(map[string]item)
+		t.partitions[hash] = partition
+	}
+
+	partition[rng] = it
+}
+
+func (t *table) delete(hash, rng string) {
+	partition := t.partitions[hash]
+	delete(partition, rng)
+
+	if len(partition) == 0 {
+		delete(t.partitions, hash)
+	}
+}
+
+// validateItem checks a complete item before it is stored: key attributes must be present and
+// well-typed, index key attributes (if present) must have the declared type, and the item must
+// fit in DynamoDB's item size limit.
+func (t *table) validateItem(it item) error {
+	hav, ok := it[t.hashKey.name]
+	if err := t.hashKey.validate(hav, ok); err != nil {
+		return err
+	}
+
+	if t.rangeKey != nil {
+		rav, ok := it[t.rangeKey.name]
+		if err := t.rangeKey.validate(rav, ok); err != nil {
+			return err
+		}
+	}
+
+	for _, idx := range t.indexes {
+		for _, k := range idx.keys() {
+			if av, ok := it[k.name]; ok && typeOf(av) != string(k.typ) {
+				return validationError("One or more parameter values were invalid: Type mismatch for Index Key %v Expected: %v Actual: %v IndexName: %v", k.name, k.typ, typeOf(av), idx.name)
+			}
+		}
+	}
+
+	for name, av := range it {
+		if av == nil {
+			return validationError("Supplied AttributeValue is empty, must contain exactly one of the supported datatypes for attribute %v", name)
+		}
+	}
+
+	if it.size() > maxItemSize {
+		return validationError("Item size has exceeded the maximum allowed size")
+	}
+
+	return nil
+}
+
+func (idx *index) keys() []keyAttr {
+	keys := []keyAttr{idx.hashKey}
+	if idx.rangeKey != nil {
+		keys = append(keys, *idx.rangeKey)
+	}
+
+	return keys
+}
+
+func (db *DB) checkContext(ctx context.Context) error {
+	if ctx == nil {
+		return nil
+	}
+
+	return ctx.Err()
+}
+
+// CreateTable creates a table with the given key schema and secondary indexes. The table is ACTIVE as soon
+// as the call returns.
+func (db *DB) CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	if err := db.checkContext(ctx); err != nil {
+		return nil, operationError("CreateTable", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.createTable(params)
+	if err != nil {
+		return nil, operationError("CreateTable", err)
+	}
+
+	return &dynamodb.CreateTableOutput{TableDescription: t.describe()}, nil
+}
+
+func (db *DB) createTable(params *dynamodb.CreateTableInput) (*table, error) {
+	name := aws.ToString(params.TableName)
+	if len(name) < 3 || len(name) > 255 {
+		return nil, validationError("TableName must be at least 3 characters long and at most 255 characters long")
+	}
+
+	if _, exists := db.tables[name]; exists {
+		return nil, &types.ResourceInUseException{Message: aws.String("Cannot create preexisting table")}
+	}
+
+	attrTypes := make(map[string]types.ScalarAttributeType)
+	for _, def := range params.AttributeDefinitions {
+		attrTypes[aws.ToString(def.AttributeName)] = def.AttributeType
+	}
+
+	keySchema := func(schema []types.KeySchemaElement) (keyAttr, *keyAttr, error) {
+		return parseKeySchema(attrTypes, schema)
+	}
+
+	t := &table{
+		name:       name,
+		created:    time.Now(),
+		billing:    params.BillingMode,
+		throughput: params.ProvisionedThroughput,
+		attributes: params.AttributeDefinitions,
+		indexes:    make(map[string]*index),
+		partitions: make(map[string]map[string]item),
+		tags:       make(map[string]string),
+	}
+
+	if params.StreamSpecification != nil && aws.ToBool(params.StreamSpecification.StreamEnabled) {
+		t.streamViewType = params.StreamSpecification.StreamViewType
+	}
+
+	if params.SSESpecification != nil {
+		t.sse = aws.ToBool(params.SSESpecification.Enabled)
+	}
+
+	for _, tag := range params.Tags {
+		t.tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	if t.billing == "" {
+		t.billing = types.BillingModeProvisioned
+	}
+
+	var err error
+
+	t.hashKey, t.rangeKey, err = keySchema(params.KeySchema)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, lsi := range params.LocalSecondaryIndexes {
+		hash, rng, err := keySchema(lsi.KeySchema)
+		if err != nil {
+			return nil, err
+		}
+
+		if hash != t.hashKey {
+			return nil, validationError("One or more parameter values were invalid: Index KeySchema does not have the same leading hash key as table KeySchema for index: %v", aws.ToString(lsi.IndexName))
+		}
+
+		t.indexes[aws.ToString(lsi.IndexName)] = &index{
+			name:       aws.ToString(lsi.IndexName),
+			hashKey:    hash,
+			rangeKey:   rng,
+			projection: projectionOrDefault(lsi.Projection),
+			local:      true,
+		}
+	}
+
+	for _, gsi := range params.GlobalSecondaryIndexes {
+		hash, rng, err := keySchema(gsi.KeySchema)
+		if err != nil {
+			return nil, err
+		}
+
+		t.indexes[aws.ToString(gsi.IndexName)] = &index{
+			name:       aws.ToString(gsi.IndexName),
+			hashKey:    hash,
+			rangeKey:   rng,
+			projection: projectionOrDefault(gsi.Projection),
+		}
+	}
+
+	db.tables[name] = t
+
+	return t, nil
+}
+
+func parseKeySchema(attrTypes map[string]types.ScalarAttributeType, schema []types.KeySchemaElement) (hash keyAttr, rng *keyAttr, err error) {
+	for _, el := range schema {
+		name := aws.ToString(el.AttributeName)
+
+		typ, ok := attrTypes[name]
+		if !ok {
+			return hash, rng, validationError("One or more parameter values were invalid: Some index key attributes are not defined in AttributeDefinitions. Keys: [%v]", name)
+		}
+
+		switch el.KeyType {
+		case types.KeyTypeHash:
+			hash = keyAttr{name: name, typ: typ}
+		case types.KeyTypeRange:
+			rng = &keyAttr{name: name, typ: typ}
+		}
+	}
+
+	if hash.name == "" {
+		return hash, rng, validationError("Invalid KeySchema: The first KeySchemaElement is not a HASH key type")
+	}
+
+	return hash, rng, nil
+}
+
+func projectionOrDefault(p *types.Projection) types.Projection {
+	if p == nil {
+		return types.Projection{ProjectionType: types.ProjectionTypeAll}
+	}
+
+	return *p
+}
+
+func (t *table) describe() *types.TableDescription {
+	keySchema := func(hash keyAttr, rng *keyAttr) []types.KeySchemaElement {
+		schema := []types.KeySchemaElement{{AttributeName: aws.String(hash.name), KeyType: types.KeyTypeHash}}
+		if rng != nil {
+			schema = append(schema, types.KeySchemaElement{AttributeName: aws.String(rng.name), KeyType: types.KeyTypeRange})
+		}
+
+		return schema
+	}
+
+	var count, size int64
+
+	for _, partition := range t.partitions {
+		for _, it := range partition {
+			count++
+			size += int64(it.size())
+		}
+	}
+
+	desc := &types.TableDescription{
+		AttributeDefinitions: t.attributes,
+		BillingModeSummary:   &types.BillingModeSummary{BillingMode: t.billing},
+		CreationDateTime:     aws.Time(t.created),
+		ItemCount:            aws.Int64(count),
+		KeySchema:            keySchema(t.hashKey, t.rangeKey),
+		TableArn:             aws.String(t.arn()),
+		TableName:            aws.String(t.name),
+		TableSizeBytes:       aws.Int64(size),
+		TableStatus:          types.TableStatusActive,
+	}
+
+	if t.streamViewType != "" {
+		desc.StreamSpecification = &types.StreamSpecification{StreamEnabled: aws.Bool(true), StreamViewType: t.streamViewType}
+		desc.LatestStreamArn = aws.String(t.arn() + "/stream/" + t.created.UTC().Format("2006-01-02T15:04:05.000"))
+	}
+
+	if t.sse {
+		desc.SSEDescription = &types.SSEDescription{Status: types.SSEStatusEnabled, SSEType: types.SSETypeKms}
+	}
+
+	if t.throughput != nil {
+		desc.ProvisionedThroughput = &types.ProvisionedThroughputDescription{
+			ReadCapacityUnits:  t.throughput.ReadCapacityUnits,
+			WriteCapacityUnits: t.throughput.WriteCapacityUnits,
+		}
+	}
+
+	names := make([]string, 0, len(t.indexes))
+	for name := range t.indexes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		idx := t.indexes[name]
+		projection := idx.projection
+
+		if idx.local {
+			desc.LocalSecondaryIndexes = append(desc.LocalSecondaryIndexes, types.LocalSecondaryIndexDescription{
+				IndexName:  aws.String(idx.name),
+				KeySchema:  keySchema(idx.hashKey, idx.rangeKey),
+				Projection: &projection,
+			})
+		} else {
+			desc.GlobalSecondaryIndexes = append(desc.GlobalSecondaryIndexes, types.GlobalSecondaryIndexDescription{
+				IndexName:   aws.String(idx.name),
+				IndexStatus: types.IndexStatusActive,
+				KeySchema:   keySchema(idx.hashKey, idx.rangeKey),
+				Projection:  &projection,
+			})
+		}
+	}
+
+	return desc
+}
+
+// DescribeTable returns the description of an existing table, or a ResourceNotFoundException.
+func (db *DB) DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	if err := db.checkContext(ctx); err != nil {
+		return nil, operationError("DescribeTable", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(params.TableName)
+	if err != nil {
+		return nil, operationError("DescribeTable", err)
+	}
+
+	return &dynamodb.DescribeTableOutput{Table: t.describe()}, nil
+}
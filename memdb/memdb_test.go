@@ -0,0 +1,529 @@
+package memdb
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTable(t *testing.T, options ...Option) *DB {
+	db := New(options...)
+	_, err := db.CreateTable(context.Background(), &dynamodb.CreateTableInput{
+		TableName: aws.String("redimo"),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("pk"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("sk"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("skN"), AttributeType: types.ScalarAttributeTypeN},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("pk"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("sk"), KeyType: types.KeyTypeRange},
+		},
+		LocalSecondaryIndexes: []types.LocalSecondaryIndex{{
+			IndexName: aws.String("idx"),
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String("pk"), KeyType: types.KeyTypeHash},
+				{AttributeName: aws.String("skN"), KeyType: types.KeyTypeRange},
+			},
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeKeysOnly},
+		}},
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	assert.NoError(t, err)
+
+	return db
+}
+
+func key(pk, sk string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: pk},
+		"sk": &types.AttributeValueMemberS{Value: sk},
+	}
+}
+
+func s(v string) types.AttributeValue { return &types.AttributeValueMemberS{Value: v} }
+func n(v string) types.AttributeValue { return &types.AttributeValueMemberN{Value: v} }
+
+func TestTables(t *testing.T) {
+	db := newTable(t)
+	ctx := context.Background()
+
+	out, err := db.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String("redimo")})
+	assert.NoError(t, err)
+	assert.Equal(t, types.TableStatusActive, out.Table.TableStatus)
+	assert.Len(t, out.Table.LocalSecondaryIndexes, 1)
+
+	_, err = db.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String("missing")})
+	var notFound *types.ResourceNotFoundException
+	assert.True(t, errors.As(err, &notFound))
+
+	_, err = db.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:            aws.String("redimo"),
+		AttributeDefinitions: []types.AttributeDefinition{{AttributeName: aws.String("pk"), AttributeType: types.ScalarAttributeTypeS}},
+		KeySchema:            []types.KeySchemaElement{{AttributeName: aws.String("pk"), KeyType: types.KeyTypeHash}},
+	})
+	var inUse *types.ResourceInUseException
+	assert.True(t, errors.As(err, &inUse))
+}
+
+func TestItems(t *testing.T) {
+	db := newTable(t)
+	ctx := context.Background()
+
+	_, err := db.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("redimo"),
+		Item:      map[string]types.AttributeValue{"pk": s("k"), "sk": s("a"), "val": s("hello")},
+	})
+	assert.NoError(t, err)
+
+	_, err = db.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                aws.String("redimo"),
+		Item:                     map[string]types.AttributeValue{"pk": s("k"), "sk": s("a"), "val": s("other")},
+		ConditionExpression:      aws.String("attribute_not_exists(#pk)"),
+		ExpressionAttributeNames: map[string]string{"#pk": "pk"},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	assert.True(t, errors.As(err, &conditionFailed))
+
+	_, err = db.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("redimo"),
+		Item:      map[string]types.AttributeValue{"pk": s("k"), "val": s("hello")},
+	})
+	assert.Error(t, err)
+
+	got, err := db.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String("redimo"), Key: key("k", "a")})
+	assert.NoError(t, err)
+	assert.Equal(t, s("hello"), got.Item["val"])
+
+	update, err := db.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String("redimo"),
+		Key:                       key("k", "counter"),
+		UpdateExpression:          aws.String("ADD #val :delta SET #skN = if_not_exists(#skN, :zero) + :delta"),
+		ExpressionAttributeNames:  map[string]string{"#val": "val", "#skN": "skN"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":delta": n("1.50"), ":zero": n("0")},
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, n("1.5"), update.Attributes["val"])
+	assert.Equal(t, n("1.5"), update.Attributes["skN"])
+
+	update, err = db.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String("redimo"),
+		Key:                       key("k", "counter"),
+		UpdateExpression:          aws.String("ADD #val :delta"),
+		ConditionExpression:       aws.String("#val < :max"),
+		ExpressionAttributeNames:  map[string]string{"#val": "val"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":delta": n("-0.25"), ":max": n("2")},
+		ReturnValues:              types.ReturnValueUpdatedOld,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]types.AttributeValue{"val": n("1.5")}, update.Attributes)
+
+	_, err = db.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String("redimo"),
+		Key:                       key("k", "counter"),
+		UpdateExpression:          aws.String("SET #sk = :v"),
+		ExpressionAttributeNames:  map[string]string{"#sk": "sk"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":v": s("x")},
+	})
+	assert.Error(t, err)
+
+	_, err = db.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String("redimo"),
+		Key:                       key("k", "counter"),
+		UpdateExpression:          aws.String("SET #val = :v"),
+		ExpressionAttributeNames:  map[string]string{"#val": "val"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":v": s("x"), ":unused": s("y")},
+	})
+	assert.Error(t, err)
+
+	deleted, err := db.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:    aws.String("redimo"),
+		Key:          key("k", "a"),
+		ReturnValues: types.ReturnValueAllOld,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, s("hello"), deleted.Attributes["val"])
+
+	got, err = db.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String("redimo"), Key: key("k", "a")})
+	assert.NoError(t, err)
+	assert.Nil(t, got.Item)
+}
+
+func TestQuery(t *testing.T) {
+	db := newTable(t, PageSize(3))
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		_, err := db.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String("redimo"),
+			Item: map[string]types.AttributeValue{
+				"pk":  s("k"),
+				"sk":  s("m" + strconv.Itoa(i)),
+				"skN": n(strconv.Itoa(100 - i)),
+				"val": s("v" + strconv.Itoa(i)),
+			},
+		})
+		assert.NoError(t, err)
+	}
+
+	query := func(input dynamodb.QueryInput) (items []map[string]types.AttributeValue, pages int) {
+		for {
+			out, err := db.Query(ctx, &input)
+			assert.NoError(t, err)
+
+			items = append(items, out.Items...)
+			pages++
+
+			if len(out.LastEvaluatedKey) == 0 {
+				return items, pages
+			}
+
+			input.ExclusiveStartKey = out.LastEvaluatedKey
+		}
+	}
+
+	items, pages := query(dynamodb.QueryInput{
+		TableName:                 aws.String("redimo"),
+		KeyConditionExpression:    aws.String("#pk = :pk AND begins_with(#sk, :prefix)"),
+		ExpressionAttributeNames:  map[string]string{"#pk": "pk", "#sk": "sk"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":pk": s("k"), ":prefix": s("m")},
+	})
+	assert.Len(t, items, 10)
+	assert.Equal(t, 4, pages)
+	assert.Equal(t, s("m0"), items[0]["sk"])
+	assert.Equal(t, s("m9"), items[9]["sk"])
+
+	items, _ = query(dynamodb.QueryInput{
+		TableName:                 aws.String("redimo"),
+		IndexName:                 aws.String("idx"),
+		KeyConditionExpression:    aws.String("#pk = :pk AND #skN BETWEEN :low AND :high"),
+		ExpressionAttributeNames:  map[string]string{"#pk": "pk", "#skN": "skN"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":pk": s("k"), ":low": n("92"), ":high": n("95")},
+	})
+	assert.Len(t, items, 4)
+	assert.Equal(t, s("m8"), items[0]["sk"])
+	assert.Nil(t, items[0]["val"])
+
+	items, _ = query(dynamodb.QueryInput{
+		TableName:                 aws.String("redimo"),
+		IndexName:                 aws.String("idx"),
+		KeyConditionExpression:    aws.String("#pk = :pk"),
+		FilterExpression:          aws.String("#val IN (:a, :b)"),
+		ExpressionAttributeNames:  map[string]string{"#pk": "pk", "#val": "val"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":pk": s("k"), ":a": s("v1"), ":b": s("v7")},
+		ScanIndexForward:          aws.Bool(false),
+		Select:                    types.SelectAllAttributes,
+	})
+	assert.Len(t, items, 2)
+	assert.Equal(t, s("v1"), items[0]["val"])
+
+	out, err := db.Query(ctx, &dynamodb.QueryInput{
+		TableName:                 aws.String("redimo"),
+		KeyConditionExpression:    aws.String("#pk = :pk"),
+		ExpressionAttributeNames:  map[string]string{"#pk": "pk"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":pk": s("k")},
+		Limit:                     aws.Int32(2),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, out.Items, 2)
+	assert.NotEmpty(t, out.LastEvaluatedKey)
+
+	_, err = db.Query(ctx, &dynamodb.QueryInput{
+		TableName:                 aws.String("redimo"),
+		KeyConditionExpression:    aws.String("#sk = :sk"),
+		ExpressionAttributeNames:  map[string]string{"#sk": "sk"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":sk": s("m1")},
+	})
+	assert.Error(t, err)
+}
+
+func TestTransactions(t *testing.T) {
+	db := newTable(t)
+	ctx := context.Background()
+
+	_, err := db.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{
+				TableName: aws.String("redimo"),
+				Item:      map[string]types.AttributeValue{"pk": s("k"), "sk": s("a"), "val": s("1")},
+			}},
+			{Update: &types.Update{
+				TableName:                 aws.String("redimo"),
+				Key:                       key("k", "b"),
+				UpdateExpression:          aws.String("SET #val = :v"),
+				ExpressionAttributeNames:  map[string]string{"#val": "val"},
+				ExpressionAttributeValues: map[string]types.AttributeValue{":v": s("2")},
+			}},
+		},
+	})
+	assert.NoError(t, err)
+
+	_, err = db.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Delete: &types.Delete{
+				TableName: aws.String("redimo"),
+				Key:       key("k", "a"),
+			}},
+			{ConditionCheck: &types.ConditionCheck{
+				TableName:                 aws.String("redimo"),
+				Key:                       key("k", "b"),
+				ConditionExpression:       aws.String("#val = :v"),
+				ExpressionAttributeNames:  map[string]string{"#val": "val"},
+				ExpressionAttributeValues: map[string]types.AttributeValue{":v": s("3")},
+			}},
+		},
+	})
+
+	var canceled *types.TransactionCanceledException
+	assert.True(t, errors.As(err, &canceled))
+	assert.Len(t, canceled.CancellationReasons, 2)
+	assert.Equal(t, "None", aws.ToString(canceled.CancellationReasons[0].Code))
+	assert.Equal(t, "ConditionalCheckFailed", aws.ToString(canceled.CancellationReasons[1].Code))
+
+	got, err := db.TransactGetItems(ctx, &dynamodb.TransactGetItemsInput{
+		TransactItems: []types.TransactGetItem{
+			{Get: &types.Get{TableName: aws.String("redimo"), Key: key("k", "a")}},
+			{Get: &types.Get{TableName: aws.String("redimo"), Key: key("k", "c")}},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, s("1"), got.Responses[0].Item["val"])
+	assert.Nil(t, got.Responses[1].Item)
+
+	_, err = db.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Delete: &types.Delete{TableName: aws.String("redimo"), Key: key("k", "a")}},
+			{Delete: &types.Delete{TableName: aws.String("redimo"), Key: key("k", "a")}},
+		},
+	})
+	assert.Error(t, err)
+
+	large := make([]types.TransactWriteItem, 11)
+	for i := range large {
+		large[i] = types.TransactWriteItem{Put: &types.Put{
+			TableName: aws.String("redimo"),
+			Item:      map[string]types.AttributeValue{"pk": s("large"), "sk": s(strconv.Itoa(i)), "val": s(strings.Repeat("x", 390*1024))},
+		}}
+	}
+
+	_, err = db.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: large})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Transaction request cannot be larger than 4 MB")
+}
+
+func TestBatchWriteItem(t *testing.T) {
+	db := newTable(t)
+	ctx := context.Background()
+
+	_, err := db.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("redimo"),
+		Item:      map[string]types.AttributeValue{"pk": s("k"), "sk": s("a"), "val": s("1")},
+	})
+	assert.NoError(t, err)
+
+	out, err := db.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]types.WriteRequest{"redimo": {
+			{DeleteRequest: &types.DeleteRequest{Key: key("k", "a")}},
+			{PutRequest: &types.PutRequest{Item: map[string]types.AttributeValue{"pk": s("k"), "sk": s("b"), "val": s("2")}}},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, out.UnprocessedItems)
+
+	got, err := db.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String("redimo"), Key: key("k", "a")})
+	assert.NoError(t, err)
+	assert.Nil(t, got.Item)
+
+	got, err = db.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String("redimo"), Key: key("k", "b")})
+	assert.NoError(t, err)
+	assert.Equal(t, s("2"), got.Item["val"])
+
+	_, err = db.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]types.WriteRequest{"redimo": {
+			{DeleteRequest: &types.DeleteRequest{Key: key("k", "b")}},
+			{PutRequest: &types.PutRequest{Item: map[string]types.AttributeValue{"pk": s("k"), "sk": s("b")}}},
+		}},
+	})
+	assert.Error(t, err)
+
+	var requests []types.WriteRequest
+	for i := 0; i < 26; i++ {
+		requests = append(requests, types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: key("k", strconv.Itoa(i))}})
+	}
+
+	_, err = db.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: map[string][]types.WriteRequest{"redimo": requests}})
+	assert.Error(t, err)
+
+	got, err = db.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String("redimo"), Key: key("k", "b")})
+	assert.NoError(t, err)
+	assert.Equal(t, s("2"), got.Item["val"])
+}
+
+func TestBatchGetItem(t *testing.T) {
+	db := newTable(t)
+	ctx := context.Background()
+
+	for _, sk := range []string{"a", "b"} {
+		_, err := db.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String("redimo"),
+			Item:      map[string]types.AttributeValue{"pk": s("k"), "sk": s(sk), "val": s(sk + "1"), "other": s("x")},
+		})
+		assert.NoError(t, err)
+	}
+
+	out, err := db.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]types.KeysAndAttributes{"redimo": {
+			Keys:                     []map[string]types.AttributeValue{key("k", "a"), key("k", "missing"), key("k", "b")},
+			ExpressionAttributeNames: map[string]string{"#sk": "sk", "#val": "val"},
+			ProjectionExpression:     aws.String("#sk, #val"),
+			ConsistentRead:           aws.Bool(true),
+		}},
+		ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, out.UnprocessedKeys)
+	assert.ElementsMatch(t, []map[string]types.AttributeValue{
+		{"sk": s("a"), "val": s("a1")},
+		{"sk": s("b"), "val": s("b1")},
+	}, out.Responses["redimo"])
+	assert.Equal(t, 3.0, aws.ToFloat64(out.ConsumedCapacity[0].CapacityUnits))
+
+	_, err = db.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]types.KeysAndAttributes{"redimo": {
+			Keys: []map[string]types.AttributeValue{key("k", "a"), key("k", "a")},
+		}},
+	})
+	assert.Error(t, err)
+
+	var keys []map[string]types.AttributeValue
+	for i := 0; i < 101; i++ {
+		keys = append(keys, key("k", strconv.Itoa(i)))
+	}
+
+	_, err = db.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]types.KeysAndAttributes{"redimo": {Keys: keys}},
+	})
+	assert.Error(t, err)
+}
+
+func TestConsumedCapacity(t *testing.T) {
+	db := newTable(t)
+	ctx := context.Background()
+
+	put, err := db.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:              aws.String("redimo"),
+		Item:                   map[string]types.AttributeValue{"pk": s("k"), "sk": s("a"), "skN": n("1"), "val": s(strings.Repeat("x", 1500))},
+		ReturnConsumedCapacity: types.ReturnConsumedCapacityIndexes,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, aws.ToFloat64(put.ConsumedCapacity.Table.WriteCapacityUnits))
+	assert.Equal(t, 2.0, aws.ToFloat64(put.ConsumedCapacity.LocalSecondaryIndexes["idx"].WriteCapacityUnits))
+	assert.Equal(t, 4.0, aws.ToFloat64(put.ConsumedCapacity.CapacityUnits))
+
+	get, err := db.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:              aws.String("redimo"),
+		Key:                    key("k", "a"),
+		ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, get.ConsumedCapacity.Table)
+	assert.Equal(t, 0.5, aws.ToFloat64(get.ConsumedCapacity.CapacityUnits))
+
+	get, err = db.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String("redimo"), Key: key("k", "a")})
+	assert.NoError(t, err)
+	assert.Nil(t, get.ConsumedCapacity)
+
+	query, err := db.Query(ctx, &dynamodb.QueryInput{
+		TableName:                 aws.String("redimo"),
+		IndexName:                 aws.String("idx"),
+		KeyConditionExpression:    aws.String("pk = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":pk": s("k")},
+		ConsistentRead:            aws.Bool(true),
+		ReturnConsumedCapacity:    types.ReturnConsumedCapacityIndexes,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, aws.ToFloat64(query.ConsumedCapacity.LocalSecondaryIndexes["idx"].ReadCapacityUnits))
+	assert.Equal(t, 0.0, aws.ToFloat64(query.ConsumedCapacity.Table.ReadCapacityUnits))
+
+	tx, err := db.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Delete: &types.Delete{TableName: aws.String("redimo"), Key: key("k", "a")}},
+			{Put: &types.Put{TableName: aws.String("redimo"), Item: map[string]types.AttributeValue{"pk": s("k"), "sk": s("b")}}},
+		},
+		ReturnConsumedCapacity: types.ReturnConsumedCapacityIndexes,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, tx.ConsumedCapacity, 1)
+	assert.Equal(t, 6.0, aws.ToFloat64(tx.ConsumedCapacity[0].Table.WriteCapacityUnits))
+	assert.Equal(t, 4.0, aws.ToFloat64(tx.ConsumedCapacity[0].LocalSecondaryIndexes["idx"].WriteCapacityUnits))
+}
+
+func TestContext(t *testing.T) {
+	db := newTable(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := db.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String("redimo"), Key: key("k", "a")})
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestScan(t *testing.T) {
+	db := newTable(t)
+	ctx := context.Background()
+
+	for i := 0; i < 20; i++ {
+		_, err := db.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String("redimo"),
+			Item:      map[string]types.AttributeValue{"pk": s("k" + strconv.Itoa(i%7)), "sk": s(strconv.Itoa(i)), "val": n(strconv.Itoa(i))},
+		})
+		assert.NoError(t, err)
+	}
+
+	seen := make(map[string]int)
+
+	for segment := int32(0); segment < 3; segment++ {
+		input := &dynamodb.ScanInput{
+			TableName:                 aws.String("redimo"),
+			Segment:                   aws.Int32(segment),
+			TotalSegments:             aws.Int32(3),
+			Limit:                     aws.Int32(2),
+			FilterExpression:          aws.String("#val >= :min"),
+			ExpressionAttributeNames:  map[string]string{"#val": "val"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{":min": n("5")},
+		}
+
+		for {
+			out, err := db.Scan(ctx, input)
+			assert.NoError(t, err)
+			assert.LessOrEqual(t, int(out.ScannedCount), 2)
+
+			for _, item := range out.Items {
+				seen[item["sk"].(*types.AttributeValueMemberS).Value]++
+			}
+
+			if len(out.LastEvaluatedKey) == 0 {
+				break
+			}
+
+			input.ExclusiveStartKey = out.LastEvaluatedKey
+		}
+	}
+
+	assert.Len(t, seen, 15)
+
+	for sk, count := range seen {
+		assert.Equal(t, 1, count, sk)
+	}
+
+	_, err := db.Scan(ctx, &dynamodb.ScanInput{TableName: aws.String("redimo"), Segment: aws.Int32(3), TotalSegments: aws.Int32(3)})
+	assert.Error(t, err)
+}
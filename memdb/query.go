@@ -0,0 +1,417 @@
+package memdb
+
+import (
+	"context"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// keyCondition is a parsed KeyConditionExpression: an equality on the partition key and an optional
+// condition on the sort key.
+type keyCondition struct {
+	hash      types.AttributeValue
+	rangeCond condition
+}
+
+func flattenAnd(cond condition) []condition {
+	if and, ok := cond.(andCond); ok {
+		return append(flattenAnd(and.left), flattenAnd(and.right)...)
+	}
+
+	return []condition{cond}
+}
+
+func singleName(op operand) (string, bool) {
+	path, ok := op.(docPath)
+	if !ok || len(path) != 1 || path[0].isIndex {
+		return "", false
+	}
+
+	return path[0].name, true
+}
+
+func parseKeyCondition(expr string, ph *placeholders, hashKey keyAttr, rangeKey *keyAttr) (*keyCondition, error) {
+	cond, err := parseCondition(expr, ph)
+	if err != nil {
+		return nil, validationError("Invalid KeyConditionExpression: %v", err)
+	}
+
+	kc := &keyCondition{}
+
+	for _, part := range flattenAnd(cond) {
+		var name string
+		var ok bool
+
+		switch part := part.(type) {
+		case compareCond:
+			if name, ok = singleName(part.left); !ok {
+				return nil, validationError("Invalid KeyConditionExpression: Query key condition not supported")
+			}
+
+			if name == hashKey.name {
+				value, isValue := part.right.(valueOperand)
+				if part.op != "=" || !isValue {
+					return nil, validationError("Query key condition not supported")
+				}
+
+				if kc.hash != nil {
+					return nil, validationError("KeyConditionExpressions must only contain one condition per key")
+				}
+
+				kc.hash = value.av
+
+				continue
+			}
+
+			if part.op == "<>" {
+				return nil, validationError("Invalid KeyConditionExpression: Invalid operator used in KeyConditionExpression: <>")
+			}
+		case betweenCond:
+			name, ok = singleName(part.value)
+		case functionCond:
+			if part.name != "begins_with" || len(part.path) != 1 {
+				return nil, validationError("Invalid KeyConditionExpression: Invalid operator used in KeyConditionExpression: %v", part.name)
+			}
+
+			name, ok = part.path[0].name, true
+		default:
+			return nil, validationError("Invalid KeyConditionExpression: Query key condition not supported")
+		}
+
+		if !ok || rangeKey == nil || name != rangeKey.name {
+			return nil, validationError("Query condition missed key schema element")
+		}
+
+		if kc.rangeCond != nil {
+			return nil, validationError("KeyConditionExpressions must only contain one condition per key")
+		}
+
+		kc.rangeCond = part
+	}
+
+	if kc.hash == nil {
+		return nil, validationError("Query condition missed key schema element: %v", hashKey.name)
+	}
+
+	if typeOf(kc.hash) != string(hashKey.typ) {
+		return nil, validationError("One or more parameter values were invalid: Condition parameter type does not match schema type")
+	}
+
+	return kc, nil
+}
+
+// view describes what a query reads: either the base table or one of its indexes.
+type view struct {
+	table *table
+	index *index
+}
+
+func (v view) hashKey() keyAttr {
+	if v.index != nil {
+		return v.index.hashKey
+	}
+
+	return v.table.hashKey
+}
+
+func (v view) rangeKey() *keyAttr {
+	if v.index != nil {
+		return v.index.rangeKey
+	}
+
+	return v.table.rangeKey
+}
+
+// keyOf returns the attributes that make up a LastEvaluatedKey for the view: the table key plus the
+// index key.
+func (v view) keyOf(it item) map[string]types.AttributeValue {
+	key := v.table.keyOf(it)
+
+	if v.index != nil {
+		for _, k := range v.index.keys() {
+			key[k.name] = cloneAV(it[k.name])
+		}
+	}
+
+	return key
+}
+
+// less orders items (or keys) within a partition of the view: by the view's sort key, then by the
+// table's primary key so the order is total even when index sort keys collide.
+func (v view) less(a, b map[string]types.AttributeValue) bool {
+	if rk := v.rangeKey(); rk != nil {
+		if c, _ := compare(a[rk.name], b[rk.name]); c != 0 {
+			return c < 0
+		}
+	}
+
+	if v.index != nil {
+		if ha, hb := encodeKey(a[v.table.hashKey.name]), encodeKey(b[v.table.hashKey.name]); ha != hb {
+			return ha < hb
+		}
+
+		if v.table.rangeKey != nil {
+			c, _ := compare(a[v.table.rangeKey.name], b[v.table.rangeKey.name])
+			return c < 0
+		}
+	}
+
+	return false
+}
+
+// candidates returns the items in the partition with the given hash key that are present in the view.
+func (v view) candidates(hash types.AttributeValue) []item {
+	var out []item
+
+	hashName := v.hashKey().name
+	encoded := encodeKey(hash)
+
+	collect := func(partition map[string]item) {
+		for _, it := range partition {
+			if v.index != nil {
+				present := true
+
+				for _, k := range v.index.keys() {
+					if _, ok := it[k.name]; !ok {
+						present = false
+					}
+				}
+
+				if !present {
+					continue
+				}
+			}
+
+			if encodeKey(it[hashName]) == encoded {
+				out = append(out, it)
+			}
+		}
+	}
+
+	if hashName == v.table.hashKey.name {
+		collect(v.table.partitions[encoded])
+	} else {
+		for _, partition := range v.table.partitions {
+			collect(partition)
+		}
+	}
+
+	return out
+}
+
+// projectedAttributes returns the attributes of the item visible through an index with
+// ALL_PROJECTED_ATTRIBUTES.
+func (v view) projectedAttributes(it item) item {
+	if v.index == nil || v.index.projection.ProjectionType == types.ProjectionTypeAll {
+		return it.clone()
+	}
+
+	out := item(v.keyOf(it))
+
+	if v.index.projection.ProjectionType == types.ProjectionTypeInclude {
+		for _, name := range v.index.projection.NonKeyAttributes {
+			if av, ok := it[name]; ok {
+				out[name] = cloneAV(av)
+			}
+		}
+	}
+
+	return out
+}
+
+// Query reads the items of a single partition of a table or index, in sort key order.
+func (db *DB) Query(ctx context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	if err := db.checkContext(ctx); err != nil {
+		return nil, operationError("Query", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	out, err := db.query(params)
+
+	return out, operationError("Query", err)
+}
+
+func (db *DB) query(params *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	t, err := db.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	v := view{table: t}
+
+	if params.IndexName != nil {
+		idx, ok := t.indexes[aws.ToString(params.IndexName)]
+		if !ok {
+			return nil, validationError("The table does not have the specified index: %v", aws.ToString(params.IndexName))
+		}
+
+		if !idx.local && aws.ToBool(params.ConsistentRead) {
+			return nil, validationError("Consistent reads are not supported on global secondary indexes")
+		}
+
+		v.index = idx
+	}
+
+	if params.Limit != nil && *params.Limit < 1 {
+		return nil, validationError("1 validation error detected: Value '%v' at 'limit' failed to satisfy constraint: Member must have value greater than or equal to 1", *params.Limit)
+	}
+
+	if params.KeyConditionExpression == nil {
+		return nil, validationError("Either the KeyConditions or KeyConditionExpression parameter must be specified in the request.")
+	}
+
+	ph := newPlaceholders(params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+
+	kc, err := parseKeyCondition(*params.KeyConditionExpression, ph, v.hashKey(), v.rangeKey())
+	if err != nil {
+		return nil, err
+	}
+
+	var filter condition
+
+	if params.FilterExpression != nil {
+		if filter, err = parseCondition(*params.FilterExpression, ph); err != nil {
+			return nil, validationError("Invalid FilterExpression: %v", err)
+		}
+	}
+
+	var paths []docPath
+
+	if params.ProjectionExpression != nil {
+		if paths, err = parseProjection(*params.ProjectionExpression, ph); err != nil {
+			return nil, validationError("Invalid ProjectionExpression: %v", err)
+		}
+	}
+
+	if err := checkPlaceholders(ph); err != nil {
+		return nil, err
+	}
+
+	selection := params.Select
+
+	switch {
+	case paths != nil && selection != "" && selection != types.SelectSpecificAttributes:
+		return nil, validationError("Cannot specify the ProjectionExpression when choosing to get %v", selection)
+	case paths == nil && selection == types.SelectSpecificAttributes:
+		return nil, validationError("ProjectionExpression must be specified when choosing to get SPECIFIC_ATTRIBUTES")
+	case selection == types.SelectAllAttributes && v.index != nil && !v.index.local && v.index.projection.ProjectionType != types.ProjectionTypeAll:
+		return nil, validationError("One or more parameter values were invalid: Select type ALL_ATTRIBUTES is not supported for global secondary index %v because its projection type is not ALL", v.index.name)
+	}
+
+	var matched []item
+
+	for _, it := range v.candidates(kc.hash) {
+		if kc.rangeCond != nil {
+			ok, err := evalCondition(it, kc.rangeCond)
+			if err != nil {
+				return nil, validationError("Invalid KeyConditionExpression: %v", err)
+			}
+
+			if !ok {
+				continue
+			}
+		}
+
+		matched = append(matched, it)
+	}
+
+	forward := params.ScanIndexForward == nil || *params.ScanIndexForward
+
+	sort.Slice(matched, func(i, j int) bool {
+		if forward {
+			return v.less(matched[i], matched[j])
+		}
+
+		return v.less(matched[j], matched[i])
+	})
+
+	if len(params.ExclusiveStartKey) > 0 {
+		start := params.ExclusiveStartKey
+
+		pos := sort.Search(len(matched), func(i int) bool {
+			if forward {
+				return v.less(start, matched[i])
+			}
+
+			return v.less(matched[i], start)
+		})
+		matched = matched[pos:]
+	}
+
+	pageSize := db.pageSize
+	limited := false
+
+	if params.Limit != nil && int(*params.Limit) <= pageSize {
+		pageSize = int(*params.Limit)
+		limited = true
+	}
+
+	out := &dynamodb.QueryOutput{}
+
+	// scannedBytes is charged to the table or index queried, fetchedBytes to the table for the
+	// attributes an index query fetches from it.
+	scannedBytes, fetchedBytes := 0, 0
+
+	for i, it := range matched {
+		out.ScannedCount++
+		scannedBytes += v.projectedAttributes(it).size()
+
+		include := true
+
+		if filter != nil {
+			if include, err = evalCondition(it, filter); err != nil {
+				return nil, validationError("Invalid FilterExpression: %v", err)
+			}
+		}
+
+		if include {
+			out.Count++
+
+			switch {
+			case selection == types.SelectCount:
+			case paths != nil:
+				out.Items = append(out.Items, project(it, paths))
+			case selection == types.SelectAllAttributes:
+				out.Items = append(out.Items, it.clone())
+
+				if v.index != nil {
+					fetchedBytes += it.size()
+				}
+			default:
+				out.Items = append(out.Items, v.projectedAttributes(it))
+			}
+		}
+
+		if int(out.ScannedCount) == pageSize {
+			if limited || i < len(matched)-1 {
+				out.LastEvaluatedKey = v.keyOf(it)
+			}
+
+			break
+		}
+	}
+
+	if out.Items == nil && selection != types.SelectCount {
+		out.Items = []map[string]types.AttributeValue{}
+	}
+
+	consistent := aws.ToBool(params.ConsistentRead)
+	u := usage{table: readUnits(scannedBytes, consistent)}
+
+	if v.index != nil {
+		u = usage{indexes: map[string]float64{v.index.name: readUnits(scannedBytes, consistent)}}
+
+		if fetchedBytes > 0 {
+			u.table = readUnits(fetchedBytes, consistent)
+		}
+	}
+
+	out.ConsumedCapacity = t.consumedCapacity(params.ReturnConsumedCapacity, u, true)
+
+	return out, nil
+}
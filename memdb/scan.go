@@ -0,0 +1,193 @@
+package memdb
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// scanPosition orders the items of a table the way a Scan visits them: partitions in the order of a
+// hash of their partition key, and items within a partition in sort key order. A partition always
+// belongs to exactly one segment of a parallel scan.
+type scanPosition struct {
+	bucket uint32
+	hash   string
+	rng    types.AttributeValue
+}
+
+func (t *table) scanPosition(key map[string]types.AttributeValue) scanPosition {
+	hash := encodeKey(key[t.hashKey.name])
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(hash))
+
+	pos := scanPosition{bucket: h.Sum32(), hash: hash}
+	if t.rangeKey != nil {
+		pos.rng = key[t.rangeKey.name]
+	}
+
+	return pos
+}
+
+func (p scanPosition) less(o scanPosition) bool {
+	if p.bucket != o.bucket {
+		return p.bucket < o.bucket
+	}
+
+	if p.hash != o.hash {
+		return p.hash < o.hash
+	}
+
+	c, _ := compare(p.rng, o.rng)
+
+	return c < 0
+}
+
+// Scan reads every item of a table, optionally split into segments for a parallel scan.
+func (db *DB) Scan(ctx context.Context, params *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	if err := db.checkContext(ctx); err != nil {
+		return nil, operationError("Scan", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	out, err := db.scan(params)
+
+	return out, operationError("Scan", err)
+}
+
+func (db *DB) scan(params *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	t, err := db.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.IndexName != nil {
+		return nil, validationError("Scan on secondary indexes is not supported by memdb")
+	}
+
+	if params.Limit != nil && *params.Limit < 1 {
+		return nil, validationError("1 validation error detected: Value '%v' at 'limit' failed to satisfy constraint: Member must have value greater than or equal to 1", *params.Limit)
+	}
+
+	segment, totalSegments := int32(0), int32(1)
+
+	if params.TotalSegments != nil || params.Segment != nil {
+		if params.TotalSegments == nil || params.Segment == nil {
+			return nil, validationError("The TotalSegments parameter is required but was not present in the request when Segment parameter is present")
+		}
+
+		segment, totalSegments = *params.Segment, *params.TotalSegments
+
+		if totalSegments < 1 || totalSegments > 1000000 || segment < 0 || segment >= totalSegments {
+			return nil, validationError("The Segment parameter is zero-based and must be less than parameter TotalSegments: Segment: %v is not less than TotalSegments: %v", segment, totalSegments)
+		}
+	}
+
+	ph := newPlaceholders(params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+
+	var filter condition
+
+	if params.FilterExpression != nil {
+		if filter, err = parseCondition(*params.FilterExpression, ph); err != nil {
+			return nil, validationError("Invalid FilterExpression: %v", err)
+		}
+	}
+
+	var paths []docPath
+
+	if params.ProjectionExpression != nil {
+		if paths, err = parseProjection(*params.ProjectionExpression, ph); err != nil {
+			return nil, validationError("Invalid ProjectionExpression: %v", err)
+		}
+	}
+
+	if err := checkPlaceholders(ph); err != nil {
+		return nil, err
+	}
+
+	type positioned struct {
+		pos scanPosition
+		it  item
+	}
+
+	var matched []positioned
+
+	for _, partition := range t.partitions {
+		for _, it := range partition {
+			pos := t.scanPosition(it)
+			if int32(pos.bucket%uint32(totalSegments)) == segment {
+				matched = append(matched, positioned{pos: pos, it: it})
+			}
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].pos.less(matched[j].pos)
+	})
+
+	if len(params.ExclusiveStartKey) > 0 {
+		start := t.scanPosition(params.ExclusiveStartKey)
+		pos := sort.Search(len(matched), func(i int) bool {
+			return start.less(matched[i].pos)
+		})
+		matched = matched[pos:]
+	}
+
+	pageSize := db.pageSize
+	limited := false
+
+	if params.Limit != nil && int(*params.Limit) <= pageSize {
+		pageSize = int(*params.Limit)
+		limited = true
+	}
+
+	out := &dynamodb.ScanOutput{}
+	scannedBytes := 0
+
+	for i, m := range matched {
+		out.ScannedCount++
+		scannedBytes += m.it.size()
+
+		include := true
+
+		if filter != nil {
+			if include, err = evalCondition(m.it, filter); err != nil {
+				return nil, validationError("Invalid FilterExpression: %v", err)
+			}
+		}
+
+		if include {
+			out.Count++
+
+			switch {
+			case params.Select == types.SelectCount:
+			case paths != nil:
+				out.Items = append(out.Items, project(m.it, paths))
+			default:
+				out.Items = append(out.Items, m.it.clone())
+			}
+		}
+
+		if int(out.ScannedCount) == pageSize {
+			if limited || i < len(matched)-1 {
+				out.LastEvaluatedKey = t.keyOf(m.it)
+			}
+
+			break
+		}
+	}
+
+	if out.Items == nil && params.Select != types.SelectCount {
+		out.Items = []map[string]types.AttributeValue{}
+	}
+
+	u := usage{table: readUnits(scannedBytes, aws.ToBool(params.ConsistentRead))}
+	out.ConsumedCapacity = t.consumedCapacity(params.ReturnConsumedCapacity, u, true)
+
+	return out, nil
+}
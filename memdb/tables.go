@@ -0,0 +1,317 @@
+package memdb
+
+import (
+	"context"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const arnPrefix = "arn:aws:dynamodb:memdb:000000000000:table/"
+
+func (t *table) arn() string {
+	return arnPrefix + t.name
+}
+
+// tableByARN returns the table with the given ARN, or a ResourceNotFoundException.
+func (db *DB) tableByARN(arn *string) (*table, error) {
+	for _, t := range db.tables {
+		if t.arn() == aws.ToString(arn) {
+			return t, nil
+		}
+	}
+
+	return nil, &types.ResourceNotFoundException{Message: aws.String("Requested resource not found")}
+}
+
+// UpdateTable changes the billing mode, provisioned throughput, stream or encryption settings of a table,
+// or creates or deletes a global secondary index. Like the table itself, a new index is ACTIVE as soon as
+// the call returns.
+func (db *DB) UpdateTable(ctx context.Context, params *dynamodb.UpdateTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error) {
+	if err := db.checkContext(ctx); err != nil {
+		return nil, operationError("UpdateTable", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(params.TableName)
+	if err != nil {
+		return nil, operationError("UpdateTable", err)
+	}
+
+	if err := t.update(params); err != nil {
+		return nil, operationError("UpdateTable", err)
+	}
+
+	return &dynamodb.UpdateTableOutput{TableDescription: t.describe()}, nil
+}
+
+func (t *table) update(params *dynamodb.UpdateTableInput) error {
+	if len(params.GlobalSecondaryIndexUpdates) > 1 {
+		return validationError("Subscriber limit exceeded: Only 1 online index can be created or deleted simultaneously per table")
+	}
+
+	billing := t.billing
+	if params.BillingMode != "" {
+		billing = params.BillingMode
+	}
+
+	if params.ProvisionedThroughput != nil && billing == types.BillingModePayPerRequest {
+		return validationError("One or more parameter values were invalid: Neither ReadCapacityUnits nor WriteCapacityUnits can be specified when BillingMode is PAY_PER_REQUEST")
+	}
+
+	if spec := params.StreamSpecification; spec != nil && aws.ToBool(spec.StreamEnabled) && t.streamViewType != "" {
+		return validationError("Table already has an enabled stream: %v", t.arn())
+	}
+
+	attributes := append([]types.AttributeDefinition(nil), t.attributes...)
+	attrTypes := make(map[string]types.ScalarAttributeType)
+
+	for _, def := range attributes {
+		attrTypes[aws.ToString(def.AttributeName)] = def.AttributeType
+	}
+
+	for _, def := range params.AttributeDefinitions {
+		name := aws.ToString(def.AttributeName)
+		if typ, ok := attrTypes[name]; ok {
+			if typ != def.AttributeType {
+				return validationError("Cannot change the type of attribute %v", name)
+			}
+
+			continue
+		}
+
+		attrTypes[name] = def.AttributeType
+		attributes = append(attributes, def)
+	}
+
+	for _, update := range params.GlobalSecondaryIndexUpdates {
+		switch {
+		case update.Create != nil:
+			name := aws.ToString(update.Create.IndexName)
+			if _, exists := t.indexes[name]; exists {
+				return validationError("One or more parameter values were invalid: Index with name %v already exists", name)
+			}
+
+			hash, rng, err := parseKeySchema(attrTypes, update.Create.KeySchema)
+			if err != nil {
+				return err
+			}
+
+			t.indexes[name] = &index{name: name, hashKey: hash, rangeKey: rng, projection: projectionOrDefault(update.Create.Projection)}
+		case update.Delete != nil:
+			name := aws.ToString(update.Delete.IndexName)
+			if idx, exists := t.indexes[name]; !exists || idx.local {
+				return &types.ResourceNotFoundException{Message: aws.String("Requested resource not found: Index: " + name)}
+			}
+
+			delete(t.indexes, name)
+		}
+	}
+
+	t.attributes = attributes
+	t.billing = billing
+
+	if billing == types.BillingModePayPerRequest {
+		t.throughput = nil
+	}
+
+	if params.ProvisionedThroughput != nil {
+		t.throughput = params.ProvisionedThroughput
+	}
+
+	if spec := params.StreamSpecification; spec != nil {
+		t.streamViewType = ""
+		if aws.ToBool(spec.StreamEnabled) {
+			t.streamViewType = spec.StreamViewType
+		}
+	}
+
+	if params.SSESpecification != nil {
+		t.sse = aws.ToBool(params.SSESpecification.Enabled)
+	}
+
+	return nil
+}
+
+// DeleteTable deletes a table and all of its items. The table is gone as soon as the call returns.
+func (db *DB) DeleteTable(ctx context.Context, params *dynamodb.DeleteTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteTableOutput, error) {
+	if err := db.checkContext(ctx); err != nil {
+		return nil, operationError("DeleteTable", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(params.TableName)
+	if err != nil {
+		return nil, operationError("DeleteTable", err)
+	}
+
+	delete(db.tables, t.name)
+
+	desc := t.describe()
+	desc.TableStatus = types.TableStatusDeleting
+
+	return &dynamodb.DeleteTableOutput{TableDescription: desc}, nil
+}
+
+// UpdateTimeToLive records the expiry attribute of a table. The emulator never deletes expired items.
+func (db *DB) UpdateTimeToLive(ctx context.Context, params *dynamodb.UpdateTimeToLiveInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error) {
+	if err := db.checkContext(ctx); err != nil {
+		return nil, operationError("UpdateTimeToLive", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(params.TableName)
+	if err != nil {
+		return nil, operationError("UpdateTimeToLive", err)
+	}
+
+	spec := params.TimeToLiveSpecification
+	if spec == nil || aws.ToString(spec.AttributeName) == "" {
+		return nil, operationError("UpdateTimeToLive", validationError("TimeToLiveSpecification is required"))
+	}
+
+	switch {
+	case aws.ToBool(spec.Enabled) && t.ttlAttribute != "":
+		return nil, operationError("UpdateTimeToLive", validationError("TimeToLive is already enabled"))
+	case !aws.ToBool(spec.Enabled) && t.ttlAttribute == "":
+		return nil, operationError("UpdateTimeToLive", validationError("TimeToLive is already disabled"))
+	case aws.ToBool(spec.Enabled):
+		t.ttlAttribute = aws.ToString(spec.AttributeName)
+	default:
+		t.ttlAttribute = ""
+	}
+
+	return &dynamodb.UpdateTimeToLiveOutput{TimeToLiveSpecification: spec}, nil
+}
+
+// DescribeTimeToLive returns the expiry settings of a table.
+func (db *DB) DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, _ ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error) {
+	if err := db.checkContext(ctx); err != nil {
+		return nil, operationError("DescribeTimeToLive", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(params.TableName)
+	if err != nil {
+		return nil, operationError("DescribeTimeToLive", err)
+	}
+
+	desc := &types.TimeToLiveDescription{TimeToLiveStatus: types.TimeToLiveStatusDisabled}
+	if t.ttlAttribute != "" {
+		desc = &types.TimeToLiveDescription{AttributeName: aws.String(t.ttlAttribute), TimeToLiveStatus: types.TimeToLiveStatusEnabled}
+	}
+
+	return &dynamodb.DescribeTimeToLiveOutput{TimeToLiveDescription: desc}, nil
+}
+
+// UpdateContinuousBackups records whether point in time recovery is enabled for a table.
+func (db *DB) UpdateContinuousBackups(ctx context.Context, params *dynamodb.UpdateContinuousBackupsInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateContinuousBackupsOutput, error) {
+	if err := db.checkContext(ctx); err != nil {
+		return nil, operationError("UpdateContinuousBackups", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(params.TableName)
+	if err != nil {
+		return nil, operationError("UpdateContinuousBackups", err)
+	}
+
+	if params.PointInTimeRecoverySpecification == nil {
+		return nil, operationError("UpdateContinuousBackups", validationError("PointInTimeRecoverySpecification is required"))
+	}
+
+	t.pointInTimeRecovery = aws.ToBool(params.PointInTimeRecoverySpecification.PointInTimeRecoveryEnabled)
+
+	return &dynamodb.UpdateContinuousBackupsOutput{ContinuousBackupsDescription: t.continuousBackups()}, nil
+}
+
+// DescribeContinuousBackups returns whether point in time recovery is enabled for a table.
+func (db *DB) DescribeContinuousBackups(ctx context.Context, params *dynamodb.DescribeContinuousBackupsInput, _ ...func(*dynamodb.Options)) (*dynamodb.DescribeContinuousBackupsOutput, error) {
+	if err := db.checkContext(ctx); err != nil {
+		return nil, operationError("DescribeContinuousBackups", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(params.TableName)
+	if err != nil {
+		return nil, operationError("DescribeContinuousBackups", err)
+	}
+
+	return &dynamodb.DescribeContinuousBackupsOutput{ContinuousBackupsDescription: t.continuousBackups()}, nil
+}
+
+func (t *table) continuousBackups() *types.ContinuousBackupsDescription {
+	status := types.PointInTimeRecoveryStatusDisabled
+	if t.pointInTimeRecovery {
+		status = types.PointInTimeRecoveryStatusEnabled
+	}
+
+	return &types.ContinuousBackupsDescription{
+		ContinuousBackupsStatus:        types.ContinuousBackupsStatusEnabled,
+		PointInTimeRecoveryDescription: &types.PointInTimeRecoveryDescription{PointInTimeRecoveryStatus: status},
+	}
+}
+
+// TagResource adds tags to the table with the given ARN, replacing the values of existing tags.
+func (db *DB) TagResource(ctx context.Context, params *dynamodb.TagResourceInput, _ ...func(*dynamodb.Options)) (*dynamodb.TagResourceOutput, error) {
+	if err := db.checkContext(ctx); err != nil {
+		return nil, operationError("TagResource", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.tableByARN(params.ResourceArn)
+	if err != nil {
+		return nil, operationError("TagResource", err)
+	}
+
+	for _, tag := range params.Tags {
+		t.tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	return &dynamodb.TagResourceOutput{}, nil
+}
+
+// ListTagsOfResource returns the tags of the table with the given ARN, ordered by key.
+func (db *DB) ListTagsOfResource(ctx context.Context, params *dynamodb.ListTagsOfResourceInput, _ ...func(*dynamodb.Options)) (*dynamodb.ListTagsOfResourceOutput, error) {
+	if err := db.checkContext(ctx); err != nil {
+		return nil, operationError("ListTagsOfResource", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.tableByARN(params.ResourceArn)
+	if err != nil {
+		return nil, operationError("ListTagsOfResource", err)
+	}
+
+	keys := make([]string, 0, len(t.tags))
+	for key := range t.tags {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	out := &dynamodb.ListTagsOfResourceOutput{Tags: []types.Tag{}}
+	for _, key := range keys {
+		out.Tags = append(out.Tags, types.Tag{Key: aws.String(key), Value: aws.String(t.tags[key])})
+	}
+
+	return out, nil
+}
@@ -0,0 +1,502 @@
+package memdb
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// item is a stored DynamoDB item. Items are always deep-copied on the way in and on the way out,
+// so callers can never mutate the emulator's state through a shared reference.
+type item map[string]types.AttributeValue
+
+func (it item) clone() item {
+	if it == nil {
+		return nil
+	}
+
+	out := make(item, len(it))
+	for k, v := range it {
+		out[k] = cloneAV(v)
+	}
+
+	return out
+}
+
+func cloneAV(av types.AttributeValue) types.AttributeValue {
+	switch av := av.(type) {
+	case *types.AttributeValueMemberS:
+		return &types.AttributeValueMemberS{Value: av.Value}
+	case *types.AttributeValueMemberN:
+		return &types.AttributeValueMemberN{Value: av.Value}
+	case *types.AttributeValueMemberB:
+		return &types.AttributeValueMemberB{Value: append([]byte{}, av.Value...)}
+	case *types.AttributeValueMemberBOOL:
+		return &types.AttributeValueMemberBOOL{Value: av.Value}
+	case *types.AttributeValueMemberNULL:
+		return &types.AttributeValueMemberNULL{Value: av.Value}
+	case *types.AttributeValueMemberSS:
+		return &types.AttributeValueMemberSS{Value: append([]string{}, av.Value...)}
+	case *types.AttributeValueMemberNS:
+		return &types.AttributeValueMemberNS{Value: append([]string{}, av.Value...)}
+	case *types.AttributeValueMemberBS:
+		bs := make([][]byte, len(av.Value))
+		for i, b := range av.Value {
+			bs[i] = append([]byte{}, b...)
+		}
+
+		return &types.AttributeValueMemberBS{Value: bs}
+	case *types.AttributeValueMemberL:
+		l := make([]types.AttributeValue, len(av.Value))
+		for i, v := range av.Value {
+			l[i] = cloneAV(v)
+		}
+
+		return &types.AttributeValueMemberL{Value: l}
+	case *types.AttributeValueMemberM:
+		m := make(map[string]types.AttributeValue, len(av.Value))
+		for k, v := range av.Value {
+			m[k] = cloneAV(v)
+		}
+
+		return &types.AttributeValueMemberM{Value: m}
+	}
+
+	return av
+}
+
+// typeOf returns the DynamoDB type descriptor of the value (S, N, B, BOOL, NULL, SS, NS, BS, L or M).
+func typeOf(av types.AttributeValue) string {
+	switch av.(type) {
+	case *types.AttributeValueMemberS:
+		return "S"
+	case *types.AttributeValueMemberN:
+		return "N"
+	case *types.AttributeValueMemberB:
+		return "B"
+	case *types.AttributeValueMemberBOOL:
+		return "BOOL"
+	case *types.AttributeValueMemberNULL:
+		return "NULL"
+	case *types.AttributeValueMemberSS:
+		return "SS"
+	case *types.AttributeValueMemberNS:
+		return "NS"
+	case *types.AttributeValueMemberBS:
+		return "BS"
+	case *types.AttributeValueMemberL:
+		return "L"
+	case *types.AttributeValueMemberM:
+		return "M"
+	}
+
+	return ""
+}
+
+func parseNumber(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok || strings.TrimSpace(s) == "" {
+		return nil, fmt.Errorf("the parameter cannot be converted to a numeric value: %v", s)
+	}
+
+	return r, nil
+}
+
+// formatNumber renders a number the way DynamoDB returns it: plain decimal notation without
+// leading or trailing zeros. Numbers are held as exact rationals, so sums and differences of
+// decimal inputs always have a finite decimal representation.
+func formatNumber(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+
+	denom := new(big.Int).Set(r.Denom())
+	two, five, zero := big.NewInt(2), big.NewInt(5), big.NewInt(0)
+	twos, fives := 0, 0
+	mod := new(big.Int)
+
+	for mod.Mod(denom, two).Cmp(zero) == 0 {
+		denom.Div(denom, two)
+		twos++
+	}
+
+	for mod.Mod(denom, five).Cmp(zero) == 0 {
+		denom.Div(denom, five)
+		fives++
+	}
+
+	prec := twos
+	if fives > prec {
+		prec = fives
+	}
+
+	if denom.Cmp(big.NewInt(1)) != 0 {
+		prec = 38
+	}
+
+	s := r.FloatString(prec)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+
+	return s
+}
+
+func normalizeNumber(s string) (string, error) {
+	r, err := parseNumber(s)
+	if err != nil {
+		return "", err
+	}
+
+	return formatNumber(r), nil
+}
+
+// normalize validates the value and rewrites numbers into their canonical representation.
+func normalize(av types.AttributeValue) (types.AttributeValue, error) {
+	switch v := av.(type) {
+	case nil:
+		return nil, fmt.Errorf("supplied AttributeValue is empty, must contain exactly one of the supported datatypes")
+	case *types.AttributeValueMemberN:
+		n, err := normalizeNumber(v.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		return &types.AttributeValueMemberN{Value: n}, nil
+	case *types.AttributeValueMemberSS:
+		if len(v.Value) == 0 {
+			return nil, fmt.Errorf("one or more parameter values were invalid: an string set may not be empty")
+		}
+
+		seen := make(map[string]struct{})
+		for _, s := range v.Value {
+			if _, ok := seen[s]; ok {
+				return nil, fmt.Errorf("input collection %v contains duplicates", v.Value)
+			}
+			seen[s] = struct{}{}
+		}
+
+		return cloneAV(v), nil
+	case *types.AttributeValueMemberNS:
+		if len(v.Value) == 0 {
+			return nil, fmt.Errorf("one or more parameter values were invalid: an number set may not be empty")
+		}
+
+		out := make([]string, len(v.Value))
+		seen := make(map[string]struct{})
+		for i, s := range v.Value {
+			n, err := normalizeNumber(s)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, ok := seen[n]; ok {
+				return nil, fmt.Errorf("input collection %v contains duplicates", v.Value)
+			}
+			seen[n] = struct{}{}
+			out[i] = n
+		}
+
+		return &types.AttributeValueMemberNS{Value: out}, nil
+	case *types.AttributeValueMemberBS:
+		if len(v.Value) == 0 {
+			return nil, fmt.Errorf("one or more parameter values were invalid: an binary set may not be empty")
+		}
+
+		return cloneAV(v), nil
+	case *types.AttributeValueMemberL:
+		out := make([]types.AttributeValue, len(v.Value))
+		for i, e := range v.Value {
+			n, err := normalize(e)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = n
+		}
+
+		return &types.AttributeValueMemberL{Value: out}, nil
+	case *types.AttributeValueMemberM:
+		out := make(map[string]types.AttributeValue, len(v.Value))
+		for k, e := range v.Value {
+			n, err := normalize(e)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = n
+		}
+
+		return &types.AttributeValueMemberM{Value: out}, nil
+	}
+
+	return cloneAV(av), nil
+}
+
+// compare orders two scalar values of the same type. ok is false if the values are not
+// both of the same orderable type (S, N or B).
+func compare(a, b types.AttributeValue) (result int, ok bool) {
+	switch a := a.(type) {
+	case *types.AttributeValueMemberS:
+		if b, isS := b.(*types.AttributeValueMemberS); isS {
+			return strings.Compare(a.Value, b.Value), true
+		}
+	case *types.AttributeValueMemberN:
+		if b, isN := b.(*types.AttributeValueMemberN); isN {
+			ra, errA := parseNumber(a.Value)
+			rb, errB := parseNumber(b.Value)
+
+			if errA != nil || errB != nil {
+				return 0, false
+			}
+
+			return ra.Cmp(rb), true
+		}
+	case *types.AttributeValueMemberB:
+		if b, isB := b.(*types.AttributeValueMemberB); isB {
+			return bytes.Compare(a.Value, b.Value), true
+		}
+	}
+
+	return 0, false
+}
+
+// equal reports whether the two values are the same according to DynamoDB's rules: numbers compare
+// numerically and sets compare without regard to order.
+func equal(a, b types.AttributeValue) bool {
+	if typeOf(a) != typeOf(b) {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *types.AttributeValueMemberS, *types.AttributeValueMemberN, *types.AttributeValueMemberB:
+		c, ok := compare(a, b)
+		return ok && c == 0
+	case *types.AttributeValueMemberBOOL:
+		return a.Value == b.(*types.AttributeValueMemberBOOL).Value
+	case *types.AttributeValueMemberNULL:
+		return true
+	case *types.AttributeValueMemberSS, *types.AttributeValueMemberNS, *types.AttributeValueMemberBS:
+		ka, kb := setKeys(a), setKeys(b)
+		if len(ka) != len(kb) {
+			return false
+		}
+
+		for k := range ka {
+			if _, ok := kb[k]; !ok {
+				return false
+			}
+		}
+
+		return true
+	case *types.AttributeValueMemberL:
+		bl := b.(*types.AttributeValueMemberL).Value
+		if len(a.Value) != len(bl) {
+			return false
+		}
+
+		for i := range a.Value {
+			if !equal(a.Value[i], bl[i]) {
+				return false
+			}
+		}
+
+		return true
+	case *types.AttributeValueMemberM:
+		bm := b.(*types.AttributeValueMemberM).Value
+		if len(a.Value) != len(bm) {
+			return false
+		}
+
+		for k, v := range a.Value {
+			ov, ok := bm[k]
+			if !ok || !equal(v, ov) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// setKeys returns the members of a set value keyed by their canonical encoding.
+func setKeys(av types.AttributeValue) map[string]struct{} {
+	out := make(map[string]struct{})
+
+	switch av := av.(type) {
+	case *types.AttributeValueMemberSS:
+		for _, s := range av.Value {
+			out[s] = struct{}{}
+		}
+	case *types.AttributeValueMemberNS:
+		for _, s := range av.Value {
+			if n, err := normalizeNumber(s); err == nil {
+				out[n] = struct{}{}
+			}
+		}
+	case *types.AttributeValueMemberBS:
+		for _, b := range av.Value {
+			out[string(b)] = struct{}{}
+		}
+	}
+
+	return out
+}
+
+// setUnion and setDifference implement ADD and DELETE for set values. The result of a difference
+// may be nil, meaning the set became empty and the attribute must be removed.
+func setUnion(a, b types.AttributeValue) types.AttributeValue {
+	switch a := a.(type) {
+	case *types.AttributeValueMemberSS:
+		return &types.AttributeValueMemberSS{Value: unionStrings(a.Value, b.(*types.AttributeValueMemberSS).Value, identity)}
+	case *types.AttributeValueMemberNS:
+		return &types.AttributeValueMemberNS{Value: unionStrings(a.Value, b.(*types.AttributeValueMemberNS).Value, canonicalNumber)}
+	case *types.AttributeValueMemberBS:
+		out := append([][]byte{}, a.Value...)
+		seen := setKeys(a)
+		for _, v := range b.(*types.AttributeValueMemberBS).Value {
+			if _, ok := seen[string(v)]; !ok {
+				out = append(out, v)
+				seen[string(v)] = struct{}{}
+			}
+		}
+
+		return &types.AttributeValueMemberBS{Value: out}
+	}
+
+	return nil
+}
+
+func setDifference(a, b types.AttributeValue) types.AttributeValue {
+	remove := setKeys(b)
+
+	switch a := a.(type) {
+	case *types.AttributeValueMemberSS:
+		if out := filterStrings(a.Value, remove, identity); len(out) > 0 {
+			return &types.AttributeValueMemberSS{Value: out}
+		}
+	case *types.AttributeValueMemberNS:
+		if out := filterStrings(a.Value, remove, canonicalNumber); len(out) > 0 {
+			return &types.AttributeValueMemberNS{Value: out}
+		}
+	case *types.AttributeValueMemberBS:
+		var out [][]byte
+		for _, v := range a.Value {
+			if _, ok := remove[string(v)]; !ok {
+				out = append(out, v)
+			}
+		}
+
+		if len(out) > 0 {
+			return &types.AttributeValueMemberBS{Value: out}
+		}
+	}
+
+	return nil
+}
+
+func identity(s string) string {
+	return s
+}
+
+func canonicalNumber(s string) string {
+	if n, err := normalizeNumber(s); err == nil {
+		return n
+	}
+
+	return s
+}
+
+func unionStrings(a, b []string, canonical func(string) string) []string {
+	out := append([]string{}, a...)
+	seen := make(map[string]struct{})
+
+	for _, s := range a {
+		seen[canonical(s)] = struct{}{}
+	}
+
+	for _, s := range b {
+		if _, ok := seen[canonical(s)]; !ok {
+			out = append(out, s)
+			seen[canonical(s)] = struct{}{}
+		}
+	}
+
+	return out
+}
+
+func filterStrings(values []string, remove map[string]struct{}, canonical func(string) string) []string {
+	var out []string
+
+	for _, s := range values {
+		if _, ok := remove[canonical(s)]; !ok {
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
+
+// size approximates DynamoDB's item size accounting, see
+// https://docs.aws.amazon.com/amazondynamodb/latest/developerguide/CapacityUnitCalculations.html
+func (it item) size() int {
+	total := 0
+	for k, v := range it {
+		total += len(k) + avSize(v)
+	}
+
+	return total
+}
+
+func avSize(av types.AttributeValue) int {
+	switch av := av.(type) {
+	case *types.AttributeValueMemberS:
+		return len(av.Value)
+	case *types.AttributeValueMemberN:
+		return len(strings.TrimLeft(av.Value, "-"))/2 + 1
+	case *types.AttributeValueMemberB:
+		return len(av.Value)
+	case *types.AttributeValueMemberBOOL, *types.AttributeValueMemberNULL:
+		return 1
+	case *types.AttributeValueMemberSS:
+		total := 0
+		for _, s := range av.Value {
+			total += len(s)
+		}
+
+		return total
+	case *types.AttributeValueMemberNS:
+		total := 0
+		for _, s := range av.Value {
+			total += len(strings.TrimLeft(s, "-"))/2 + 1
+		}
+
+		return total
+	case *types.AttributeValueMemberBS:
+		total := 0
+		for _, b := range av.Value {
+			total += len(b)
+		}
+
+		return total
+	case *types.AttributeValueMemberL:
+		total := 3
+		for _, v := range av.Value {
+			total += avSize(v) + 1
+		}
+
+		return total
+	case *types.AttributeValueMemberM:
+		total := 3
+		for k, v := range av.Value {
+			total += len(k) + avSize(v) + 1
+		}
+
+		return total
+	}
+
+	return 0
+}
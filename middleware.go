@@ -0,0 +1,206 @@
+package redimo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Command is a command run by a client, as seen by Middleware.
+type Command struct {
+	// Name is the name of the command, such as "HSET".
+	Name string
+
+	// Keys are the keys the command was called with.
+	Keys []string
+
+	// Args summarizes the other arguments. Numbers, times and flags are shown as they are, maps and
+	// slices are reduced to their length, and strings and values to their type and length, so that
+	// values don't end up in logs and traces. Clients returned by VerboseArgs show strings and values
+	// quoted and truncated instead.
+	Args string
+
+	// Start is the time the command started.
+	Start time.Time
+
+	// Duration is how long the command took. It is set once the command has finished.
+	Duration time.Duration
+
+	// Calls are the DynamoDB calls made by the command, including retried attempts, in the order they
+	// completed. They are set once the command has finished.
+	Calls []Call
+
+	// Err is the error returned by the command. It is set once the command has finished.
+	Err error
+}
+
+// Call is a DynamoDB call made by a command.
+type Call struct {
+	// Operation is the name of the DynamoDB operation, such as "GetItem".
+	Operation string
+
+	// Duration is how long the call took.
+	Duration time.Duration
+
+	// Err is the error returned by the call, translated as described for Error.
+	Err error
+}
+
+// Middleware is called as every command of a client starts. It returns the context the command makes
+// its DynamoDB calls with, which is typically ctx or derived from it, and a function to call once the
+// command has finished, when its Duration, Calls and Err are set.
+//
+// Commands that other commands run internally are not seen by middleware, only the outermost command.
+type Middleware func(ctx context.Context, cmd *Command) (context.Context, func())
+
+// Use returns a copy of the client that runs every command through the given middleware, after any
+// middleware the client already has. Middleware is called in order as a command starts, and the
+// functions it returns are called in reverse order once it finishes, so the first middleware wraps
+// all the others.
+func (c Client) Use(middleware ...Middleware) Client {
+	c.middleware = append(append([]Middleware(nil), c.middleware...), middleware...)
+	return c
+}
+
+// VerboseArgs returns a copy of the client whose commands show middleware the strings and values they
+// are called with in Command.Args, truncated to 32 bytes, rather than only their type and length. As
+// these include the values written by commands such as SET and HSET, only use it where those may end
+// up in logs and traces.
+func (c Client) VerboseArgs() Client {
+	c.verboseArgs = true
+	return c
+}
+
+// commandRun collects the DynamoDB calls made by a command, which may be made concurrently.
+type commandRun struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+func (r *commandRun) record(operation string, start time.Time, err error) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, Call{Operation: operation, Duration: time.Since(start), Err: err})
+}
+
+// command starts a command, and returns the client to run it with and a function to call with its
+// error once it has finished. Without middleware, or within another command, the client is returned
+// unchanged.
+func (c Client) command(name string, keys []string, args ...interface{}) (Client, func(err *error)) {
+	if len(c.middleware) == 0 || c.run != nil {
+		return c, func(*error) {}
+	}
+
+	cmd := &Command{Name: name, Keys: keys, Args: summarize(args, c.verboseArgs), Start: time.Now()}
+	finishers := make([]func(), len(c.middleware))
+
+	ctx := c.ctx
+	for i, m := range c.middleware {
+		ctx, finishers[i] = m(ctx, cmd)
+	}
+
+	run := &commandRun{}
+	c.ctx = ctx
+	c.run = run
+
+	return c, func(err *error) {
+		run.mu.Lock()
+		cmd.Calls = run.calls
+		run.mu.Unlock()
+
+		cmd.Duration = time.Since(cmd.Start)
+		if err != nil {
+			cmd.Err = *err
+		}
+
+		for i := len(finishers) - 1; i >= 0; i-- {
+			if finishers[i] != nil {
+				finishers[i]()
+			}
+		}
+	}
+}
+
+// maxArgLength is the length strings are truncated to in Command.Args.
+const maxArgLength = 32
+
+func summarize(args []interface{}, verbose bool) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = summarizeArg(arg, verbose)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func summarizeArg(arg interface{}, verbose bool) string {
+	switch v := arg.(type) {
+	case nil:
+		return "nil"
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case time.Duration:
+		return v.String()
+	case Flags:
+		return fmt.Sprint([]Flag(v))
+	case XID:
+		return v.String()
+	case string:
+		if !verbose {
+			return fmt.Sprintf("string(%v)", len(v))
+		}
+
+		return strconv.Quote(truncate(v))
+	case fmt.Stringer:
+		if !verbose {
+			return fmt.Sprintf("%T", arg)
+		}
+
+		return truncate(v.String())
+	}
+
+	switch v := reflect.ValueOf(arg); v.Kind() {
+	case reflect.Map:
+		return fmt.Sprintf("map[%v]", v.Len())
+	case reflect.Slice, reflect.Array:
+		return fmt.Sprintf("[%v]", v.Len())
+	case reflect.String:
+		if !verbose {
+			return fmt.Sprintf("%T(%v)", arg, v.Len())
+		}
+
+		return strconv.Quote(truncate(v.String()))
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return fmt.Sprint(arg)
+	}
+
+	if !verbose {
+		return fmt.Sprintf("%T", arg)
+	}
+
+	return truncate(fmt.Sprint(arg))
+}
+
+func truncate(s string) string {
+	if len(s) <= maxArgLength {
+		return s
+	}
+
+	end := maxArgLength
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+
+	return s[:end] + "..."
+}
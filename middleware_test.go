@@ -0,0 +1,181 @@
+package redimo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	mu       sync.Mutex
+	name     string
+	events   *[]string
+	commands []Command
+}
+
+func (r *recorder) middleware() Middleware {
+	return func(ctx context.Context, cmd *Command) (context.Context, func()) {
+		*r.events = append(*r.events, "start "+r.name)
+
+		return ctx, func() {
+			*r.events = append(*r.events, "finish "+r.name)
+
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			r.commands = append(r.commands, *cmd)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	c := newClient(t).CheckTypes()
+
+	var events []string
+
+	outer := &recorder{name: "outer", events: &events}
+	inner := &recorder{name: "inner", events: &events}
+	observed := c.Use(outer.middleware()).Use(inner.middleware())
+
+	_, err := observed.HSET("h1", map[string]interface{}{"f1": "v1", "f2": "v2"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"start outer", "start inner", "finish inner", "finish outer"}, events)
+
+	cmd := inner.commands[0]
+	assert.Equal(t, "HSET", cmd.Name)
+	assert.Equal(t, []string{"h1"}, cmd.Keys)
+	assert.Equal(t, "map[2]", cmd.Args)
+	assert.True(t, cmd.Duration > 0)
+	assert.NotEmpty(t, cmd.Calls)
+	assert.NoError(t, cmd.Err)
+	assert.Equal(t, cmd.Name, outer.commands[0].Name)
+
+	// SETEX runs SET internally, which middleware does not see.
+	err = observed.SETEX("s1", 10, "a long value that is truncated in the summary")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(inner.commands))
+	assert.Equal(t, "SETEX", inner.commands[1].Name)
+	assert.Equal(t, `10 string(45)`, inner.commands[1].Args)
+
+	_, err = observed.HGET("s1", "f1")
+	assert.Equal(t, ErrWrongType, err)
+	assert.Equal(t, ErrWrongType, inner.commands[2].Err)
+	assert.Equal(t, `string(2)`, inner.commands[2].Args)
+
+	err = observed.VerboseArgs().SETEX("s1", 10, "a long value that is truncated in the summary")
+	assert.NoError(t, err)
+	assert.Equal(t, `10 "a long value that is truncated i..."`, inner.commands[3].Args)
+
+	count, err := observed.DEL("h1", "s1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	assert.Equal(t, []string{"h1", "s1"}, inner.commands[4].Keys)
+
+	for _, call := range inner.commands[4].Calls {
+		assert.NotEmpty(t, call.Operation)
+		assert.NoError(t, call.Err)
+	}
+
+	// Without middleware, commands are not observed.
+	_, err = c.GET("s1")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(inner.commands))
+
+	tx := observed.MULTI()
+	_, err = tx.SET("k1", "v1").SADD("set1", "m1").EXEC()
+	assert.NoError(t, err)
+	assert.Equal(t, "EXEC", inner.commands[5].Name)
+	assert.Equal(t, []string{"k1", "set1"}, inner.commands[5].Keys)
+}
+
+type contextKey struct{}
+
+type fakeSpan struct {
+	name       string
+	attributes map[string]interface{}
+	ended      bool
+	err        error
+}
+
+func (s *fakeSpan) SetAttribute(key string, value interface{}) { s.attributes[key] = value }
+
+func (s *fakeSpan) End(err error) {
+	s.ended = true
+	s.err = err
+}
+
+type fakeTracer struct {
+	spans []*fakeSpan
+}
+
+func (t *fakeTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	span := &fakeSpan{name: name, attributes: make(map[string]interface{})}
+	t.spans = append(t.spans, span)
+
+	return context.WithValue(ctx, contextKey{}, span), span
+}
+
+// contextService records the span in the context of every GetItem call.
+type contextService struct {
+	DynamoDBAPI
+	mu    sync.Mutex
+	spans []interface{}
+}
+
+func (s *contextService) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	s.mu.Lock()
+	s.spans = append(s.spans, ctx.Value(contextKey{}))
+	s.mu.Unlock()
+
+	return s.DynamoDBAPI.GetItem(ctx, params, optFns...)
+}
+
+func TestTraceCommands(t *testing.T) {
+	c := newClient(t).CheckTypes()
+	service := &contextService{DynamoDBAPI: c.ddbClient}
+	c.ddbClient = service
+
+	tracer := &fakeTracer{}
+	traced := c.Use(TraceCommands(tracer))
+
+	_, err := traced.INCR("counter")
+	assert.NoError(t, err)
+
+	_, err = traced.GET("counter")
+	assert.NoError(t, err)
+
+	_, err = traced.HGETALL("counter")
+	assert.True(t, errors.Is(err, ErrWrongType))
+
+	assert.Equal(t, 3, len(tracer.spans))
+
+	span := tracer.spans[0]
+	assert.Equal(t, "redimo.INCR", span.name)
+	assert.True(t, span.ended)
+	assert.NoError(t, span.err)
+	assert.Equal(t, "dynamodb", span.attributes["db.system"])
+	assert.Equal(t, "INCR", span.attributes["db.operation"])
+	assert.Equal(t, []string{"counter"}, span.attributes["redimo.keys"])
+	assert.True(t, span.attributes["redimo.calls"].(int) > 0)
+	assert.Equal(t, span, service.spans[0])
+
+	assert.Equal(t, "redimo.HGETALL", tracer.spans[2].name)
+	assert.Equal(t, ErrWrongType, tracer.spans[2].err)
+}
+
+func TestSummarize(t *testing.T) {
+	args := []interface{}{"a", 1, 2.5, []string{"x", "y", "z"}, map[string]int{"k": 1}, nil, Flags{IfNotExists}, StringValue{"secret"}, XID("1-1"), time.Second}
+
+	assert.Equal(t, "", summarize(nil, false))
+	assert.Equal(t, `string(1) 1 2.5 [3] map[1] nil [NX] redimo.StringValue 1-1 1s`, summarize(args, false))
+	assert.Equal(t, `string(40)`, summarize([]interface{}{strings.Repeat("x", 40)}, false))
+
+	assert.Equal(t, `"a" 1 2.5 [3] map[1] nil [NX] {secret} 1-1 1s`, summarize(args, true))
+	assert.Equal(t, `"`+strings.Repeat("x", 32)+`..."`, summarize([]interface{}{strings.Repeat("x", 40)}, true))
+}
@@ -0,0 +1,172 @@
+package redimo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Namespace returns a copy of the client whose keys live in the named namespace, so that several
+// applications or tenants can share a table without their keys colliding. Keys are stored prefixed
+// with the name and a slash, and redimo's own bookkeeping for them, such as list indexes and stream
+// sequences, is scoped the same way. Commands and their results use keys without the prefix, and SCAN
+// and KEYS only see the keys of the namespace.
+//
+// Namespaces nest: c.Namespace("a").Namespace("b") stores keys prefixed with "a/b/". A client without a
+// namespace sees namespaced keys with their prefix.
+func (c Client) Namespace(name string) Client {
+	c.namespace += name + "/"
+	return c
+}
+
+func (c Client) withoutNamespace() Client {
+	c.namespace = ""
+	return c
+}
+
+// namespaced returns the partition key the key is stored under. Internal keys keep their prefix first,
+// so that SCAN can tell them from the keys of any namespace.
+func (c Client) namespaced(key string) string {
+	if c.namespace == "" {
+		return key
+	}
+
+	if internalKey(key) {
+		return "_redimo/" + c.namespace + strings.TrimPrefix(key, "_redimo/")
+	}
+
+	return c.namespace + key
+}
+
+// unnamespaced returns the key stored under the partition key.
+func (c Client) unnamespaced(pk string) string {
+	if c.namespace == "" {
+		return pk
+	}
+
+	if internalKey(pk) {
+		return "_redimo/" + strings.TrimPrefix(strings.TrimPrefix(pk, "_redimo/"), c.namespace)
+	}
+
+	return strings.TrimPrefix(pk, c.namespace)
+}
+
+// DBSIZE returns the number of keys in the client's namespace. Like KEYS, it scans the whole table.
+//
+// Works similar to https://redis.io/commands/dbsize
+func (c Client) DBSIZE() (count int64, err error) {
+	c, finish := c.command("DBSIZE", nil)
+	defer finish(&err)
+
+	keys, err := c.KEYS("")
+
+	return int64(len(keys)), err
+}
+
+// FLUSHDB deletes every key in the client's namespace, along with redimo's bookkeeping for them, and
+// returns the number of keys deleted. On a client without a namespace it deletes every item in the
+// table, including those of all namespaces. It scans the whole table.
+//
+// With a blob store, the blobs of the deleted values are released. On a client without a namespace,
+// the blobs still counted once every key is deleted, such as those of items DynamoDB deleted when they
+// expired, are deleted too.
+//
+// Works similar to https://redis.io/commands/flushdb
+func (c Client) FLUSHDB() (deletedKeys int64, err error) {
+	c, finish := c.command("FLUSHDB", nil)
+	defer finish(&err)
+
+	partitions, err := c.namespacePartitions()
+	if err != nil {
+		return 0, err
+	}
+
+	root := c.withoutNamespace()
+
+	// Counts of blobs are left to the end, since deleting the keys releases their blobs.
+	var blobs []string
+
+	if c.blobs != nil {
+		keys := partitions[:0]
+
+		for _, pk := range partitions {
+			if strings.HasPrefix(pk, blobRefPartition) {
+				blobs = append(blobs, strings.TrimPrefix(pk, blobRefPartition))
+			} else {
+				keys = append(keys, pk)
+			}
+		}
+
+		partitions = keys
+	}
+
+	deleted := make([]bool, len(partitions))
+
+	err = c.fanOut(len(partitions), func(i int) (err error) {
+		deleted[i], err = root.del(partitions[i])
+		return
+	})
+
+	for i, ok := range deleted {
+		if ok && !internalKey(partitions[i]) {
+			deletedKeys++
+		}
+	}
+
+	if err != nil {
+		return deletedKeys, err
+	}
+
+	err = c.fanOut(len(blobs), func(i int) error {
+		return root.deleteBlob(blobs[i], false)
+	})
+
+	return deletedKeys, err
+}
+
+// namespacePartitions returns the partition keys, as stored, of every item in the client's namespace.
+func (c Client) namespacePartitions() (partitions []string, err error) {
+	builder := newExpresionBuilder()
+
+	if c.namespace != "" {
+		builder.filter(fmt.Sprintf("(begins_with(#%[1]v, :namespace) OR begins_with(#%[1]v, :internal))", c.partitionKey), c.partitionKey)
+		builder.values["namespace"] = StringValue{c.namespace}.ToAV()
+		builder.values["internal"] = StringValue{"_redimo/" + c.namespace}.ToAV()
+	}
+
+	seen := make(map[string]struct{})
+
+	var lastEvaluatedKey map[string]types.AttributeValue
+
+	for {
+		resp, err := c.ddb().Scan(c.ctx, &dynamodb.ScanInput{
+			ConsistentRead:            aws.Bool(c.consistentReads),
+			ExclusiveStartKey:         lastEvaluatedKey,
+			ExpressionAttributeNames:  map[string]string{"#" + c.partitionKey: c.partitionKey},
+			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			FilterExpression:          builder.filterExpression(),
+			ProjectionExpression:      aws.String("#" + c.partitionKey),
+			TableName:                 aws.String(c.tableName),
+		})
+		if err != nil {
+			return partitions, err
+		}
+
+		for _, item := range resp.Items {
+			pk := ReturnValue{item[c.partitionKey]}.String()
+			if _, ok := seen[pk]; !ok {
+				seen[pk] = struct{}{}
+				partitions = append(partitions, pk)
+			}
+		}
+
+		if len(resp.LastEvaluatedKey) == 0 {
+			return partitions, nil
+		}
+
+		lastEvaluatedKey = resp.LastEvaluatedKey
+	}
+}
@@ -0,0 +1,130 @@
+package redimo
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespace(t *testing.T) {
+	c := newClient(t).CheckTypes()
+	a, b := c.Namespace("tenant-a"), c.Namespace("tenant-b")
+
+	_, err := a.SET("k1", "a1")
+	assert.NoError(t, err)
+
+	_, err = b.SET("k1", "b1")
+	assert.NoError(t, err)
+
+	val, err := a.GET("k1")
+	assert.NoError(t, err)
+	assert.Equal(t, "a1", val.String())
+
+	val, err = b.GET("k1")
+	assert.NoError(t, err)
+	assert.Equal(t, "b1", val.String())
+
+	val, err = c.GET("tenant-a/k1")
+	assert.NoError(t, err)
+	assert.Equal(t, "a1", val.String())
+
+	_, err = a.RPUSH("l1", StringValue{"x"}, StringValue{"y"})
+	assert.NoError(t, err)
+
+	_, err = b.SADD("l1", "m1")
+	assert.NoError(t, err)
+
+	elements, err := a.LRANGE("l1", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(elements))
+
+	keyType, err := b.TYPE("l1")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeSet, keyType)
+
+	_, err = a.XADD("s1", XAutoID, map[string]Value{"f": StringValue{"v"}})
+	assert.NoError(t, err)
+
+	_, err = a.ZADD("z1", map[string]float64{"m1": 1, "m2": 2}, Flags{})
+	assert.NoError(t, err)
+
+	members, err := a.ZRANGEBYSCORE("z1", 0, 10, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"m1": 1, "m2": 2}, members)
+
+	assert.NoError(t, a.RENAME("z1", "z2"))
+
+	keys, err := a.KEYS("*")
+	assert.NoError(t, err)
+	sort.Strings(keys)
+	assert.Equal(t, []string{"k1", "l1", "s1", "z2"}, keys)
+
+	keys, err = b.KEYS("*")
+	assert.NoError(t, err)
+	sort.Strings(keys)
+	assert.Equal(t, []string{"k1", "l1"}, keys)
+
+	keys, err = c.KEYS("tenant-b/*")
+	assert.NoError(t, err)
+	sort.Strings(keys)
+	assert.Equal(t, []string{"tenant-b/k1", "tenant-b/l1"}, keys)
+
+	nested := a.Namespace("inner")
+	_, err = nested.SET("k1", "n1")
+	assert.NoError(t, err)
+
+	keys, err = c.KEYS("tenant-a/inner/*")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tenant-a/inner/k1"}, keys)
+
+	tx := a.MULTI()
+	_, err = tx.GET("k1")
+	assert.NoError(t, err)
+	_, err = tx.SET("k1", "a2").HSET("h1", map[string]interface{}{"f": "v"}).EXEC()
+	assert.NoError(t, err)
+
+	fields, err := a.HGETALL("h1")
+	assert.NoError(t, err)
+	assert.Equal(t, "v", fields["f"].String())
+
+	// Keys of nested namespaces are keys of the outer namespace too.
+	keys, err = a.KEYS("inner/*")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"inner/k1"}, keys)
+
+	size, err := a.DBSIZE()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), size)
+
+	size, err = b.DBSIZE()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), size)
+
+	deleted, err := a.FLUSHDB()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), deleted)
+
+	size, err = a.DBSIZE()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), size)
+
+	partitions, err := a.namespacePartitions()
+	assert.NoError(t, err)
+	assert.Empty(t, partitions)
+
+	val, err = b.GET("k1")
+	assert.NoError(t, err)
+	assert.Equal(t, "b1", val.String())
+
+	keyType, err = b.TYPE("l1")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeSet, keyType)
+
+	_, err = c.FLUSHDB()
+	assert.NoError(t, err)
+
+	partitions, err = c.namespacePartitions()
+	assert.NoError(t, err)
+	assert.Empty(t, partitions)
+}
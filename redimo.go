@@ -6,21 +6,90 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
+// DynamoDBAPI is the subset of the DynamoDB API that redimo uses. *dynamodb.Client satisfies it, as does
+// the in-memory emulator in the memdb package, which is convenient for tests.
+type DynamoDBAPI interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+	TransactGetItems(ctx context.Context, params *dynamodb.TransactGetItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactGetItemsOutput, error)
+	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+	CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error)
+	UpdateTable(ctx context.Context, params *dynamodb.UpdateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error)
+	DeleteTable(ctx context.Context, params *dynamodb.DeleteTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteTableOutput, error)
+	UpdateTimeToLive(ctx context.Context, params *dynamodb.UpdateTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error)
+	DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error)
+	UpdateContinuousBackups(ctx context.Context, params *dynamodb.UpdateContinuousBackupsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateContinuousBackupsOutput, error)
+	DescribeContinuousBackups(ctx context.Context, params *dynamodb.DescribeContinuousBackupsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeContinuousBackupsOutput, error)
+	TagResource(ctx context.Context, params *dynamodb.TagResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TagResourceOutput, error)
+	ListTagsOfResource(ctx context.Context, params *dynamodb.ListTagsOfResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ListTagsOfResourceOutput, error)
+}
+
+var _ DynamoDBAPI = (*dynamodb.Client)(nil)
+
 type Client struct {
-	ddbClient          *dynamodb.Client
+	ctx                context.Context
+	ddbClient          DynamoDBAPI
 	consistentReads    bool
 	tableName          string
 	indexName          string
 	partitionKey       string
 	sortKey            string
 	sortKeyNum         string
+	ttlAttribute       string
+	scanSegments       int
 	transactionActions int
+	retryPolicy        RetryPolicy
+	batchConcurrency   int
+	concurrency        int
+	versionAttribute   string
+	capacity           *ConsumedCapacity
+	middleware         []Middleware
+	run                *commandRun
+	namespace          string
+	chunkSize          int
+	blobs              BlobStore
+	blobThreshold      int
+	codec              Codec
+	codecThreshold     int
+	keys               KeyProvider
+	cache              *Cache
+	checkTypes         bool
+	verboseArgs        bool
+	expiries           []keyExpiry
+}
+
+// WithContext returns a copy of the client bound to the given context. Every DynamoDB call made by
+// commands on the returned client, including each page of multi-page queries and each attempt of
+// internal retry loops, uses this context, so cancelling it or letting its deadline pass stops the
+// command at the next call.
+func (c Client) WithContext(ctx context.Context) Client {
+	if ctx == nil {
+		panic("redimo: nil context")
+	}
+
+	c.ctx = ctx
+	return c
+}
+
+// Context returns the context the client is bound to. It is context.Background() unless
+// the client was derived with WithContext.
+func (c Client) Context() context.Context {
+	return c.ctx
 }
 
 func (c Client) EventuallyConsistent() Client {
@@ -46,6 +115,36 @@ func (c Client) Attributes(pk string, sk string, skN string) Client {
 	return c
 }
 
+// TTLAttribute sets the name of the attribute that holds the expiry time of items, as whole epoch
+// seconds. Enable DynamoDB's Time to Live on this attribute so that expired keys are eventually deleted;
+// until they are, redimo hides them on read, going by the millisecond expiry it keeps in the "expiry"
+// attribute. The default is "ttl".
+func (c Client) TTLAttribute(name string) Client {
+	c.ttlAttribute = name
+	return c
+}
+
+// ScanSegments sets the number of segments SCAN reads in parallel. The default is 4.
+func (c Client) ScanSegments(segments int) Client {
+	if segments < 1 {
+		segments = 1
+	}
+
+	c.scanSegments = segments
+	return c
+}
+
+// Concurrency sets the number of requests that commands on many keys or items, such as DEL and EXISTS,
+// send at a time. The default is 8.
+func (c Client) Concurrency(requests int) Client {
+	if requests < 1 {
+		requests = 1
+	}
+
+	c.concurrency = requests
+	return c
+}
+
 func (c Client) StronglyConsistent() Client {
 	c.consistentReads = true
 	return c
@@ -57,7 +156,7 @@ func (c Client) TransactionActions(actions int) Client {
 }
 
 func (c Client) ExistsTable() (bool, error) {
-	_, err := c.ddbClient.DescribeTable(context.TODO(), &dynamodb.DescribeTableInput{
+	_, err := c.ddb().DescribeTable(c.ctx, &dynamodb.DescribeTableInput{
 		TableName: aws.String(c.tableName),
 	})
 	if err == nil {
@@ -70,92 +169,27 @@ func (c Client) ExistsTable() (bool, error) {
 	return false, fmt.Errorf("couldn't determine existence of table %v. Here's why: %w", c.tableName, err)
 }
 
+// CreateTable creates the client's table with the given provisioned throughput, or billed per request
+// if both are zero, and waits until it is ACTIVE. EnsureTable also enables expiry and other features.
 func (c Client) CreateTable(readCapacity int64, writeCapacity int64) error {
-	if readCapacity == 0 && writeCapacity == 0 {
-		return c.CreatePayPerRequestTable()
-	}
-	return c.CreateProvisionedTable(readCapacity, writeCapacity)
+	_, err := c.createTable(TableSpec{ReadCapacity: readCapacity, WriteCapacity: writeCapacity})
+	return err
 }
 
+// CreatePayPerRequestTable creates the client's table billed per request, and waits until it is ACTIVE.
 func (c Client) CreatePayPerRequestTable() error {
-	_, err := c.ddbClient.CreateTable(context.TODO(), &dynamodb.CreateTableInput{
-		AttributeDefinitions: []types.AttributeDefinition{
-			{AttributeName: aws.String(c.partitionKey), AttributeType: "S"},
-			{AttributeName: aws.String(c.sortKey), AttributeType: "S"},
-			{AttributeName: aws.String(c.sortKeyNum), AttributeType: "N"},
-		},
-		BillingMode:            types.BillingModePayPerRequest,
-		GlobalSecondaryIndexes: nil,
-		KeySchema: []types.KeySchemaElement{
-			{AttributeName: aws.String(c.partitionKey), KeyType: types.KeyTypeHash},
-			{AttributeName: aws.String(c.sortKey), KeyType: types.KeyTypeRange},
-		},
-		LocalSecondaryIndexes: []types.LocalSecondaryIndex{
-			{
-				IndexName: aws.String(c.indexName),
-				KeySchema: []types.KeySchemaElement{
-					{AttributeName: aws.String(c.partitionKey), KeyType: types.KeyTypeHash},
-					{AttributeName: aws.String(c.sortKeyNum), KeyType: types.KeyTypeRange},
-				},
-				Projection: &types.Projection{
-					NonKeyAttributes: nil,
-					ProjectionType:   types.ProjectionTypeKeysOnly,
-				},
-			},
-		},
-		SSESpecification:    nil,
-		StreamSpecification: nil,
-		TableName:           aws.String(c.tableName),
-		Tags:                nil,
-	})
-
-	if err != nil {
-		return fmt.Errorf("couldn't create table %v. Here's why: %w", c.tableName, err)
-	}
-	return nil
+	return c.CreateTable(0, 0)
 }
 
+// CreateProvisionedTable creates the client's table with the given provisioned throughput, and waits
+// until it is ACTIVE.
 func (c Client) CreateProvisionedTable(readCapacity int64, writeCapacity int64) error {
-	_, err := c.ddbClient.CreateTable(context.TODO(), &dynamodb.CreateTableInput{
-		AttributeDefinitions: []types.AttributeDefinition{
-			{AttributeName: aws.String(c.partitionKey), AttributeType: "S"},
-			{AttributeName: aws.String(c.sortKey), AttributeType: "S"},
-			{AttributeName: aws.String(c.sortKeyNum), AttributeType: "N"},
-		},
-		BillingMode:            types.BillingModeProvisioned,
-		GlobalSecondaryIndexes: nil,
-		KeySchema: []types.KeySchemaElement{
-			{AttributeName: aws.String(c.partitionKey), KeyType: types.KeyTypeHash},
-			{AttributeName: aws.String(c.sortKey), KeyType: types.KeyTypeRange},
-		},
-		LocalSecondaryIndexes: []types.LocalSecondaryIndex{
-			{
-				IndexName: aws.String(c.indexName),
-				KeySchema: []types.KeySchemaElement{
-					{AttributeName: aws.String(c.partitionKey), KeyType: types.KeyTypeHash},
-					{AttributeName: aws.String(c.sortKeyNum), KeyType: types.KeyTypeRange},
-				},
-				Projection: &types.Projection{
-					NonKeyAttributes: nil,
-					ProjectionType:   types.ProjectionTypeKeysOnly,
-				},
-			},
-		},
-		ProvisionedThroughput: &types.ProvisionedThroughput{
-			ReadCapacityUnits:  aws.Int64(readCapacity),
-			WriteCapacityUnits: aws.Int64(writeCapacity),
-		},
-		SSESpecification:    nil,
-		StreamSpecification: nil,
-		TableName:           aws.String(c.tableName),
-		Tags:                nil,
-	})
-
-	return fmt.Errorf("couldn't create table %v. Here's why: %w", c.tableName, err)
+	return c.CreateTable(readCapacity, writeCapacity)
 }
 
-func NewClient(service *dynamodb.Client) Client {
+func NewClient(service DynamoDBAPI) Client {
 	return Client{
+		ctx:                context.Background(),
 		ddbClient:          service,
 		consistentReads:    true,
 		tableName:          "redimo",
@@ -163,7 +197,12 @@ func NewClient(service *dynamodb.Client) Client {
 		partitionKey:       "pk",
 		sortKey:            "sk",
 		sortKeyNum:         "skN",
-		transactionActions: 100,
+		ttlAttribute:       "ttl",
+		scanSegments:       4,
+		transactionActions: maxTransactionActions,
+		retryPolicy:        DefaultRetryPolicy,
+		concurrency:        defaultConcurrency,
+		versionAttribute:   "ver",
 	}
 }
 
@@ -171,10 +210,45 @@ const (
 	vk = "val"
 )
 
+// maxTransactionActions is the number of actions DynamoDB allows in a single transaction.
+const maxTransactionActions = 100
+
+// maxTransactionSize is the total size, in bytes, DynamoDB allows for the items of a single transaction.
+const maxTransactionSize = 4 * 1024 * 1024
+
+// transactionSize returns the approximate size of the items written by the actions, in bytes: their keys,
+// the items put, and the values of updates and conditions.
+func transactionSize(actions []types.TransactWriteItem) (size int) {
+	items := func(items ...map[string]types.AttributeValue) {
+		for _, item := range items {
+			for k, v := range item {
+				size += len(k) + avSize(v)
+			}
+		}
+	}
+
+	for _, action := range actions {
+		switch {
+		case action.Put != nil:
+			items(action.Put.Item)
+		case action.Update != nil:
+			items(action.Update.Key, action.Update.ExpressionAttributeValues)
+		case action.Delete != nil:
+			items(action.Delete.Key, action.Delete.ExpressionAttributeValues)
+		case action.ConditionCheck != nil:
+			items(action.ConditionCheck.Key, action.ConditionCheck.ExpressionAttributeValues)
+		}
+	}
+
+	return size
+}
+
 type expressionBuilder struct {
 	conditions []string
+	filters    []string
 	clauses    map[string][]string
 	keys       map[string]struct{}
+	aliases    map[string]string
 	values     map[string]types.AttributeValue
 }
 
@@ -191,6 +265,13 @@ func (b *expressionBuilder) condition(condition string, references ...string) {
 	}
 }
 
+func (b *expressionBuilder) filter(filter string, references ...string) {
+	b.filters = append(b.filters, filter)
+	for _, ref := range references {
+		b.keys[ref] = struct{}{}
+	}
+}
+
 func (b *expressionBuilder) conditionExpression() *string {
 	if len(b.conditions) == 0 {
 		return nil
@@ -199,8 +280,21 @@ func (b *expressionBuilder) conditionExpression() *string {
 	return aws.String(strings.Join(b.conditions, " AND "))
 }
 
+func (b *expressionBuilder) filterExpression() *string {
+	if len(b.filters) == 0 {
+		return nil
+	}
+
+	return aws.String(strings.Join(b.filters, " AND "))
+}
+
+// alias refers to an attribute whose name can't be used in a placeholder as #placeholder.
+func (b *expressionBuilder) alias(placeholder string, attributeName string) {
+	b.aliases[placeholder] = attributeName
+}
+
 func (b *expressionBuilder) expressionAttributeNames() map[string]string {
-	if len(b.keys) == 0 {
+	if len(b.keys) == 0 && len(b.aliases) == 0 {
 		return nil
 	}
 
@@ -210,6 +304,10 @@ func (b *expressionBuilder) expressionAttributeNames() map[string]string {
 		out["#"+n] = n
 	}
 
+	for placeholder, n := range b.aliases {
+		out["#"+placeholder] = n
+	}
+
 	return out
 }
 
@@ -279,6 +377,30 @@ func (b *expressionBuilder) updateSetAV(attributeName string, av types.Attribute
 	b.SET(fmt.Sprintf("#%v = :%v", attributeName, attributeName), attributeName, av)
 }
 
+func (b *expressionBuilder) updateREMOVE(attributeName string) {
+	b.clauses["REMOVE"] = append(b.clauses["REMOVE"], "#"+attributeName)
+	b.keys[attributeName] = struct{}{}
+}
+
+// addFilterNotExpired filters out items whose expiry, held in ttlAttribute, is at or before now.
+func (b *expressionBuilder) addFilterNotExpired(ttlAttribute string, now time.Time) {
+	b.filter(fmt.Sprintf("(attribute_not_exists(#%v) OR #%v > :now)", ttlAttribute, ttlAttribute), ttlAttribute)
+	b.values["now"] = expiryAV(now)
+}
+
+// addConditionNotExpired requires that the item has no expiry, or an expiry after now.
+func (b *expressionBuilder) addConditionNotExpired(ttlAttribute string, now time.Time) {
+	b.condition(fmt.Sprintf("(attribute_not_exists(#%v) OR #%v > :now)", ttlAttribute, ttlAttribute), ttlAttribute)
+	b.values["now"] = expiryAV(now)
+}
+
+// addConditionNotExistsOrExpired is like addConditionNotExists, but also accepts an item that has
+// expired and not yet been deleted.
+func (b *expressionBuilder) addConditionNotExistsOrExpired(attributeName string, ttlAttribute string, now time.Time) {
+	b.condition(fmt.Sprintf("(attribute_not_exists(#%v) OR #%v <= :now)", attributeName, ttlAttribute), attributeName, ttlAttribute)
+	b.values["now"] = expiryAV(now)
+}
+
 func (b *expressionBuilder) addConditionNotExists(attributeName string) {
 	b.condition(fmt.Sprintf("attribute_not_exists(#%v)", attributeName), attributeName)
 }
@@ -292,6 +414,7 @@ func newExpresionBuilder() expressionBuilder {
 		conditions: []string{},
 		clauses:    make(map[string][]string),
 		keys:       make(map[string]struct{}),
+		aliases:    make(map[string]string),
 		values:     make(map[string]types.AttributeValue),
 	}
 }
@@ -303,7 +426,7 @@ type keyDef struct {
 
 func (k keyDef) toAV(c Client) map[string]types.AttributeValue {
 	m := map[string]types.AttributeValue{
-		c.partitionKey: &types.AttributeValueMemberS{Value: k.pk},
+		c.partitionKey: &types.AttributeValueMemberS{Value: c.namespaced(k.pk)},
 		c.sortKey:      &types.AttributeValueMemberS{Value: compatibleWithEmtpySK(k.sk)},
 	}
 
@@ -335,7 +458,7 @@ type itemDef struct {
 
 func parseKey(avm map[string]types.AttributeValue, c Client) keyDef {
 	return keyDef{
-		pk: ReturnValue{avm[c.partitionKey]}.String(),
+		pk: c.unnamespaced(ReturnValue{avm[c.partitionKey]}.String()),
 		sk: recoverFromEmptySK(ReturnValue{avm[c.sortKey]}.String()),
 	}
 }
@@ -354,6 +477,8 @@ const (
 	Unconditionally      = None
 	IfAlreadyExists Flag = "XX"
 	IfNotExists     Flag = "NX"
+	KeepTTL         Flag = "KEEPTTL"
+	Replace         Flag = "REPLACE"
 )
 
 type Flags []Flag
@@ -368,27 +493,44 @@ func (flags Flags) has(flag Flag) bool {
 	return false
 }
 
-func conditionFailureError(err error) bool {
-	if err == nil {
-		return false
-	}
-	s := err.Error()
+// defaultConcurrency is the default number of requests sent at a time by commands that fan out.
+const defaultConcurrency = 8
 
-	if strings.Contains(s, "ConditionalCheckFailedException") {
-		return true
-	}
+// fanOut calls fn for every index in [0, n), up to the client's concurrency at a time, and returns
+// the first error.
+func (c Client) fanOut(n int, fn func(i int) error) error {
+	return fanOut(n, c.concurrency, fn)
+}
 
-	if strings.Contains(s, "TransactionInProgressException") {
-		return true
+func fanOut(n int, concurrency int, fn func(i int) error) error {
+	if concurrency < 1 {
+		concurrency = 1
 	}
 
-	if strings.Contains(s, "TransactionConflictException") {
-		return true
+	errs := make([]error, n)
+	slots := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		slots <- struct{}{}
+
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			errs[i] = fn(i)
+		}(i)
 	}
 
-	if strings.Contains(s, "TransactionCanceledException") {
-		return true
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
 	}
 
-	return false
+	return nil
 }
@@ -2,10 +2,13 @@ package redimo
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"testing"
 	"time"
 
+	"github.com/aura-studio/redimo/memdb"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
@@ -31,6 +34,24 @@ func TestClientBuilder(t *testing.T) {
 	assert.True(t, c2.StronglyConsistent().consistentReads)
 }
 
+func TestClientContext(t *testing.T) {
+	c := NewClient(newService(t))
+	assert.Equal(t, context.Background(), c.Context())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	bound := c.WithContext(ctx)
+	assert.Equal(t, ctx, bound.Context())
+	assert.Equal(t, context.Background(), c.Context())
+
+	_, err := bound.GET("hello")
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	_, err = bound.HGETALL("hello")
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
 func newClient(t *testing.T) Client {
 	t.Parallel()
 
@@ -39,7 +60,7 @@ func newClient(t *testing.T) Client {
 	partitionKey := "pk"
 	sortKey := "sk"
 	sortKeyNum := "skN"
-	dynamoService := dynamodb.NewFromConfig(newConfig(t))
+	dynamoService := newService(t)
 	_, err := dynamoService.CreateTable(context.TODO(), &dynamodb.CreateTableInput{
 		AttributeDefinitions: []types.AttributeDefinition{
 			{AttributeName: aws.String(partitionKey), AttributeType: "S"},
@@ -79,14 +100,30 @@ func newClient(t *testing.T) Client {
 	return NewClient(dynamoService).Table(tableName).Index(indexName).Attributes(partitionKey, sortKey, sortKeyNum)
 }
 
+// newService returns the in-memory emulator, or DynamoDB at REDIMO_DYNAMODB_ENDPOINT (typically DynamoDB
+// Local on http://localhost:8000) when that variable is set.
+func newService(t *testing.T) DynamoDBAPI {
+	if os.Getenv("REDIMO_DYNAMODB_ENDPOINT") == "" {
+		return memdb.New()
+	}
+
+	return dynamodb.NewFromConfig(newConfig(t))
+}
+
 func newConfig(t *testing.T) aws.Config {
 	region := "us-west-1"
+	endpoint := os.Getenv("REDIMO_DYNAMODB_ENDPOINT")
+
+	if endpoint == "" {
+		endpoint = "http://localhost:8000"
+	}
+
 	credentialsProvider := credentials.NewStaticCredentialsProvider("ABCD", "EFGH", "IKJGL")
 	customResolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, _ ...interface{}) (aws.Endpoint, error) {
 		if service == dynamodb.ServiceID {
 			return aws.Endpoint{
 				PartitionID:   "aws",
-				URL:           "http://localhost:8000",
+				URL:           endpoint,
 				SigningRegion: region,
 			}, nil
 		}
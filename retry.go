@@ -0,0 +1,115 @@
+package redimo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy controls how redimo retries DynamoDB calls that fail with a retryable error, and how
+// often its own optimistic loops, such as XADD and XREADGROUP racing other writers, try again. Every
+// retry waits for an exponentially growing delay with full jitter: a random duration between zero and
+// BaseDelay * 2^(retry-1), capped at MaxDelay.
+//
+// The AWS SDK has its own retryer, which is applied to each attempt made by redimo.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first. Values below 2 disable retries.
+	MaxAttempts int
+
+	// BaseDelay is the upper bound of the delay before the first retry.
+	BaseDelay time.Duration
+
+	// MaxDelay caps the upper bound of the delay before each retry.
+	MaxDelay time.Duration
+
+	// Retryable lists the classes of errors that are retried, matched with errors.Is. Typical
+	// classes are ErrThrottled and ErrTransactionConflict.
+	Retryable []error
+}
+
+// DefaultRetryPolicy is the RetryPolicy of a new client. It makes up to 5 attempts on throttling
+// and transaction conflicts, waiting at most 25ms before the first retry and at most a second before
+// any retry.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   25 * time.Millisecond,
+	MaxDelay:    time.Second,
+	Retryable:   []error{ErrThrottled, ErrTransactionConflict},
+}
+
+// NoRetries is a RetryPolicy that makes a single attempt.
+var NoRetries = RetryPolicy{MaxAttempts: 1}
+
+// WithRetryPolicy returns a copy of the client that retries according to the given policy.
+func (c Client) WithRetryPolicy(policy RetryPolicy) Client {
+	c.retryPolicy = policy
+	return c
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	for _, class := range p.Retryable {
+		if errors.Is(err, class) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// delay returns the jittered delay before the given retry, counting from 1.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	ceiling := p.MaxDelay
+
+	if retry < 63 && p.BaseDelay < p.MaxDelay>>uint(retry-1) {
+		ceiling = p.BaseDelay << uint(retry-1)
+	}
+
+	if ceiling <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// do calls fn until it succeeds, fails with an error that is not retryable, or has been called
+// MaxAttempts times. An error returned after retrying records the number of attempts made.
+func (p RetryPolicy) do(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !p.retryable(err) {
+			return withAttempts(err, attempt)
+		}
+
+		if attempt >= p.MaxAttempts || ctx.Err() != nil {
+			return withAttempts(err, attempt)
+		}
+
+		timer := time.NewTimer(p.delay(attempt))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return withAttempts(err, attempt)
+		case <-timer.C:
+		}
+	}
+}
+
+// withAttempts records the number of attempts made in the error, if there was more than one.
+func withAttempts(err error, attempts int) error {
+	if err == nil || attempts < 2 {
+		return err
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		copied := *e
+		copied.Attempts = attempts
+
+		return &copied
+	}
+
+	return fmt.Errorf("%w (after %v attempts)", err, attempts)
+}
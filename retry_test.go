@@ -0,0 +1,107 @@
+package redimo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// throttlingService fails the next failures calls to UpdateItem as if the table's capacity was exceeded.
+type throttlingService struct {
+	DynamoDBAPI
+	failures int
+	calls    int
+}
+
+func (s *throttlingService) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	s.calls++
+
+	if s.failures > 0 {
+		s.failures--
+		return nil, &types.ProvisionedThroughputExceededException{}
+	}
+
+	return s.DynamoDBAPI.UpdateItem(ctx, params, optFns...)
+}
+
+func TestRetryPolicy(t *testing.T) {
+	c := newClient(t)
+	service := &throttlingService{DynamoDBAPI: c.ddbClient}
+	c.ddbClient = service
+	c = c.WithRetryPolicy(RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    2 * time.Millisecond,
+		Retryable:   []error{ErrThrottled},
+	})
+
+	_, err := c.INCR("n")
+	assert.NoError(t, err)
+
+	service.failures, service.calls = 2, 0
+	n, err := c.INCR("n")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, n)
+	assert.Equal(t, 3, service.calls)
+
+	service.failures, service.calls = 3, 0
+	_, err = c.INCR("n")
+	assert.True(t, errors.Is(err, ErrThrottled))
+	assert.True(t, strings.Contains(err.Error(), "after 3 attempts"))
+	assert.Equal(t, 3, service.calls)
+
+	var e *Error
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, 3, e.Attempts)
+
+	service.failures, service.calls = 1, 0
+	_, err = c.WithRetryPolicy(NoRetries).INCR("n")
+	assert.True(t, errors.Is(err, ErrThrottled))
+	assert.Equal(t, 1, service.calls)
+
+	service.failures = 0
+	n, err = c.INCR("n")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, n)
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+
+	for i := 0; i < 100; i++ {
+		assert.True(t, p.delay(1) <= 10*time.Millisecond)
+		assert.True(t, p.delay(3) <= 40*time.Millisecond)
+		assert.True(t, p.delay(10) <= 50*time.Millisecond)
+		assert.True(t, p.delay(100) <= 50*time.Millisecond)
+		assert.True(t, p.delay(1) >= 0)
+	}
+
+	assert.Equal(t, time.Duration(0), RetryPolicy{}.delay(1))
+}
+
+func TestRetryPolicyContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	err := DefaultRetryPolicy.do(ctx, func() error {
+		calls++
+		return &Error{Kind: ErrThrottled, Err: errors.New("throttled")}
+	})
+	assert.True(t, errors.Is(err, ErrThrottled))
+	assert.Equal(t, 1, calls)
+
+	calls = 0
+	err = DefaultRetryPolicy.do(context.Background(), func() error {
+		calls++
+		return &Error{Kind: ErrConditionFailed, Err: errors.New("condition failed")}
+	})
+	assert.True(t, errors.Is(err, ErrConditionFailed))
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,423 @@
+package redimo
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// dynamoService wraps the DynamoDB service of a client. Errors are translated into redimo's typed
+// errors, calls failing with a retryable error are retried according to the client's RetryPolicy, and
+// every item written is stamped with a new version, and with the expiry of its key when the command
+// inherits it. When the client tracks capacity, every request
+// asks for its consumed capacity and records it. Calls made by a command run through middleware are
+// recorded for it. When the client caches reads, every write invalidates the keys of the items it writes.
+type dynamoService struct {
+	service          DynamoDBAPI
+	retryPolicy      RetryPolicy
+	versionAttribute string
+	capacity         *ConsumedCapacity
+	run              *commandRun
+	cache            *Cache
+	partitionKey     string
+	sortKey          string
+	ttlAttribute     string
+	expiries         []keyExpiry
+}
+
+// ddb returns the DynamoDB service of the client, wrapped with typed errors, retries, versions and
+// capacity tracking.
+func (c Client) ddb() DynamoDBAPI {
+	return dynamoService{
+		service:          c.ddbClient,
+		retryPolicy:      c.retryPolicy,
+		versionAttribute: c.versionAttribute,
+		capacity:         c.capacity,
+		run:              c.run,
+		cache:            c.cache,
+		partitionKey:     c.partitionKey,
+		sortKey:          c.sortKey,
+		ttlAttribute:     c.ttlAttribute,
+		expiries:         c.expiries,
+	}
+}
+
+func (s dynamoService) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.GetItemOutput, err error) {
+	if s.capacity != nil {
+		tracked := *params
+		tracked.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+		params = &tracked
+	}
+
+	err = s.retryPolicy.do(ctx, func() error {
+		start := time.Now()
+		out, err = s.service.GetItem(ctx, params, optFns...)
+		err = translateError(err)
+		s.run.record("GetItem", start, err)
+
+		return err
+	})
+
+	if err == nil && out.ConsumedCapacity != nil {
+		s.capacity.record(true, *out.ConsumedCapacity)
+	}
+
+	return
+}
+
+func (s dynamoService) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.PutItemOutput, err error) {
+	defer s.cache.invalidateItems(params.TableName, s.partitionKey, params.Item)
+
+	params = s.expirePutItem(s.versionPutItem(params))
+
+	if s.capacity != nil {
+		tracked := *params
+		tracked.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+		params = &tracked
+	}
+
+	err = s.retryPolicy.do(ctx, func() error {
+		start := time.Now()
+		out, err = s.service.PutItem(ctx, params, optFns...)
+		err = translateError(err)
+		s.run.record("PutItem", start, err)
+
+		return err
+	})
+
+	if err == nil && out.ConsumedCapacity != nil {
+		s.capacity.record(false, *out.ConsumedCapacity)
+	}
+
+	return
+}
+
+func (s dynamoService) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.UpdateItemOutput, err error) {
+	defer s.cache.invalidateItems(params.TableName, s.partitionKey, params.Key)
+
+	params = s.expireUpdateItem(s.versionUpdateItem(params))
+
+	if s.capacity != nil {
+		tracked := *params
+		tracked.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+		params = &tracked
+	}
+
+	err = s.retryPolicy.do(ctx, func() error {
+		start := time.Now()
+		out, err = s.service.UpdateItem(ctx, params, optFns...)
+		err = translateError(err)
+		s.run.record("UpdateItem", start, err)
+
+		return err
+	})
+
+	if err == nil && out.ConsumedCapacity != nil {
+		s.capacity.record(false, *out.ConsumedCapacity)
+	}
+
+	return
+}
+
+func (s dynamoService) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.DeleteItemOutput, err error) {
+	defer s.cache.invalidateItems(params.TableName, s.partitionKey, params.Key)
+
+	if s.capacity != nil {
+		tracked := *params
+		tracked.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+		params = &tracked
+	}
+
+	err = s.retryPolicy.do(ctx, func() error {
+		start := time.Now()
+		out, err = s.service.DeleteItem(ctx, params, optFns...)
+		err = translateError(err)
+		s.run.record("DeleteItem", start, err)
+
+		return err
+	})
+
+	if err == nil && out.ConsumedCapacity != nil {
+		s.capacity.record(false, *out.ConsumedCapacity)
+	}
+
+	return
+}
+
+func (s dynamoService) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.QueryOutput, err error) {
+	if s.capacity != nil {
+		tracked := *params
+		tracked.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+		params = &tracked
+	}
+
+	err = s.retryPolicy.do(ctx, func() error {
+		start := time.Now()
+		out, err = s.service.Query(ctx, params, optFns...)
+		err = translateError(err)
+		s.run.record("Query", start, err)
+
+		return err
+	})
+
+	if err == nil && out.ConsumedCapacity != nil {
+		s.capacity.record(true, *out.ConsumedCapacity)
+	}
+
+	return
+}
+
+func (s dynamoService) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.ScanOutput, err error) {
+	if s.capacity != nil {
+		tracked := *params
+		tracked.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+		params = &tracked
+	}
+
+	err = s.retryPolicy.do(ctx, func() error {
+		start := time.Now()
+		out, err = s.service.Scan(ctx, params, optFns...)
+		err = translateError(err)
+		s.run.record("Scan", start, err)
+
+		return err
+	})
+
+	if err == nil && out.ConsumedCapacity != nil {
+		s.capacity.record(true, *out.ConsumedCapacity)
+	}
+
+	return
+}
+
+func (s dynamoService) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.TransactWriteItemsOutput, err error) {
+	defer s.cache.invalidateTransaction(s.partitionKey, params)
+
+	params = s.expireTransactWriteItems(s.versionTransactWriteItems(params))
+
+	if s.capacity != nil {
+		tracked := *params
+		tracked.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+		params = &tracked
+	}
+
+	err = s.retryPolicy.do(ctx, func() error {
+		start := time.Now()
+		out, err = s.service.TransactWriteItems(ctx, params, optFns...)
+		err = translateError(err)
+		s.run.record("TransactWriteItems", start, err)
+
+		return err
+	})
+
+	if err == nil {
+		s.capacity.record(false, out.ConsumedCapacity...)
+	}
+
+	return
+}
+
+func (s dynamoService) TransactGetItems(ctx context.Context, params *dynamodb.TransactGetItemsInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.TransactGetItemsOutput, err error) {
+	if s.capacity != nil {
+		tracked := *params
+		tracked.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+		params = &tracked
+	}
+
+	err = s.retryPolicy.do(ctx, func() error {
+		start := time.Now()
+		out, err = s.service.TransactGetItems(ctx, params, optFns...)
+		err = translateError(err)
+		s.run.record("TransactGetItems", start, err)
+
+		return err
+	})
+
+	if err == nil {
+		s.capacity.record(true, out.ConsumedCapacity...)
+	}
+
+	return
+}
+
+func (s dynamoService) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.BatchGetItemOutput, err error) {
+	if s.capacity != nil {
+		tracked := *params
+		tracked.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+		params = &tracked
+	}
+
+	err = s.retryPolicy.do(ctx, func() error {
+		start := time.Now()
+		out, err = s.service.BatchGetItem(ctx, params, optFns...)
+		err = translateError(err)
+		s.run.record("BatchGetItem", start, err)
+
+		return err
+	})
+
+	if err == nil {
+		s.capacity.record(true, out.ConsumedCapacity...)
+	}
+
+	return
+}
+
+func (s dynamoService) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.BatchWriteItemOutput, err error) {
+	defer s.cache.invalidateBatch(s.partitionKey, params)
+
+	params = s.expireBatchWriteItem(s.versionBatchWriteItem(params))
+
+	if s.capacity != nil {
+		tracked := *params
+		tracked.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+		params = &tracked
+	}
+
+	err = s.retryPolicy.do(ctx, func() error {
+		start := time.Now()
+		out, err = s.service.BatchWriteItem(ctx, params, optFns...)
+		err = translateError(err)
+		s.run.record("BatchWriteItem", start, err)
+
+		return err
+	})
+
+	if err == nil {
+		s.capacity.record(false, out.ConsumedCapacity...)
+	}
+
+	return
+}
+
+func (s dynamoService) DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.DescribeTableOutput, err error) {
+	err = s.retryPolicy.do(ctx, func() error {
+		start := time.Now()
+		out, err = s.service.DescribeTable(ctx, params, optFns...)
+		err = translateError(err)
+		s.run.record("DescribeTable", start, err)
+
+		return err
+	})
+
+	return
+}
+
+func (s dynamoService) CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.CreateTableOutput, err error) {
+	err = s.retryPolicy.do(ctx, func() error {
+		start := time.Now()
+		out, err = s.service.CreateTable(ctx, params, optFns...)
+		err = translateError(err)
+		s.run.record("CreateTable", start, err)
+
+		return err
+	})
+
+	return
+}
+
+func (s dynamoService) UpdateTable(ctx context.Context, params *dynamodb.UpdateTableInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.UpdateTableOutput, err error) {
+	err = s.retryPolicy.do(ctx, func() error {
+		start := time.Now()
+		out, err = s.service.UpdateTable(ctx, params, optFns...)
+		err = translateError(err)
+		s.run.record("UpdateTable", start, err)
+
+		return err
+	})
+
+	return
+}
+
+func (s dynamoService) DeleteTable(ctx context.Context, params *dynamodb.DeleteTableInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.DeleteTableOutput, err error) {
+	err = s.retryPolicy.do(ctx, func() error {
+		start := time.Now()
+		out, err = s.service.DeleteTable(ctx, params, optFns...)
+		err = translateError(err)
+		s.run.record("DeleteTable", start, err)
+
+		return err
+	})
+
+	return
+}
+
+func (s dynamoService) UpdateTimeToLive(ctx context.Context, params *dynamodb.UpdateTimeToLiveInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.UpdateTimeToLiveOutput, err error) {
+	err = s.retryPolicy.do(ctx, func() error {
+		start := time.Now()
+		out, err = s.service.UpdateTimeToLive(ctx, params, optFns...)
+		err = translateError(err)
+		s.run.record("UpdateTimeToLive", start, err)
+
+		return err
+	})
+
+	return
+}
+
+func (s dynamoService) DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.DescribeTimeToLiveOutput, err error) {
+	err = s.retryPolicy.do(ctx, func() error {
+		start := time.Now()
+		out, err = s.service.DescribeTimeToLive(ctx, params, optFns...)
+		err = translateError(err)
+		s.run.record("DescribeTimeToLive", start, err)
+
+		return err
+	})
+
+	return
+}
+
+func (s dynamoService) UpdateContinuousBackups(ctx context.Context, params *dynamodb.UpdateContinuousBackupsInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.UpdateContinuousBackupsOutput, err error) {
+	err = s.retryPolicy.do(ctx, func() error {
+		start := time.Now()
+		out, err = s.service.UpdateContinuousBackups(ctx, params, optFns...)
+		err = translateError(err)
+		s.run.record("UpdateContinuousBackups", start, err)
+
+		return err
+	})
+
+	return
+}
+
+func (s dynamoService) DescribeContinuousBackups(ctx context.Context, params *dynamodb.DescribeContinuousBackupsInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.DescribeContinuousBackupsOutput, err error) {
+	err = s.retryPolicy.do(ctx, func() error {
+		start := time.Now()
+		out, err = s.service.DescribeContinuousBackups(ctx, params, optFns...)
+		err = translateError(err)
+		s.run.record("DescribeContinuousBackups", start, err)
+
+		return err
+	})
+
+	return
+}
+
+func (s dynamoService) TagResource(ctx context.Context, params *dynamodb.TagResourceInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.TagResourceOutput, err error) {
+	err = s.retryPolicy.do(ctx, func() error {
+		start := time.Now()
+		out, err = s.service.TagResource(ctx, params, optFns...)
+		err = translateError(err)
+		s.run.record("TagResource", start, err)
+
+		return err
+	})
+
+	return
+}
+
+func (s dynamoService) ListTagsOfResource(ctx context.Context, params *dynamodb.ListTagsOfResourceInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.ListTagsOfResourceOutput, err error) {
+	err = s.retryPolicy.do(ctx, func() error {
+		start := time.Now()
+		out, err = s.service.ListTagsOfResource(ctx, params, optFns...)
+		err = translateError(err)
+		s.run.record("ListTagsOfResource", start, err)
+
+		return err
+	})
+
+	return
+}
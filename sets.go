@@ -1,8 +1,9 @@
 package redimo
 
 import (
-	"context"
+	"errors"
 	"math/rand"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
@@ -23,7 +24,7 @@ func (sm setMember) toAV(c Client) map[string]types.AttributeValue {
 
 func (sm setMember) keyAV(c Client) map[string]types.AttributeValue {
 	av := make(map[string]types.AttributeValue)
-	av[c.partitionKey] = StringValue{sm.pk}.ToAV()
+	av[c.partitionKey] = StringValue{c.namespaced(sm.pk)}.ToAV()
 	av[c.sortKey] = StringValue{compatibleWithEmtpySK(sm.sk)}.ToAV()
 
 	return av
@@ -31,17 +32,44 @@ func (sm setMember) keyAV(c Client) map[string]types.AttributeValue {
 
 // SADD adds the given string members to the set at the given key.
 //
-// Returns that members that were actually added and did not already exist in the set.
+// Returns that members that were actually added and did not already exist in the set. With BatchWrites,
+// members are written in batches and none are returned.
 //
-// Cost is O(1) / 1 WCU for each member, whether it already exists or not.
+// Cost is O(1) / 1 WCU for each member, whether it already exists or not, plus the type check of the key.
 //
 // Works similar to https://redis.io/commands/sadd
 func (c Client) SADD(key string, members ...string) (addedMembers []string, err error) {
+	c, finish := c.command("SADD", []string{key}, members)
+	defer finish(&err)
+
+	if c, err = c.inheritExpiry(key); err != nil {
+		return
+	}
+
+	if err = c.claimType(key, TypeSet); err != nil {
+		return
+	}
+
+	if c.batchWrites() {
+		scores := make(map[string]types.AttributeValue)
+		for _, member := range members {
+			scores[member] = IntValue{rand.Int63()}.ToAV()
+		}
+
+		return nil, c.batchPutScores(key, scores)
+	}
+
 	for _, member := range members {
-		resp, err := c.ddbClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
-			Item:         setMember{pk: key, sk: member}.toAV(c),
-			ReturnValues: types.ReturnValueAllOld,
-			TableName:    aws.String(c.tableName),
+		builder := newExpresionBuilder()
+		builder.updateSetAV(c.sortKeyNum, IntValue{rand.Int63()}.ToAV())
+
+		resp, err := c.updateItem(&dynamodb.UpdateItemInput{
+			ExpressionAttributeNames:  builder.expressionAttributeNames(),
+			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			Key:                       setMember{pk: key, sk: member}.keyAV(c),
+			ReturnValues:              types.ReturnValueAllOld,
+			TableName:                 aws.String(c.tableName),
+			UpdateExpression:          builder.updateExpression(),
 		})
 		if err != nil {
 			return addedMembers, err
@@ -57,14 +85,24 @@ func (c Client) SADD(key string, members ...string) (addedMembers []string, err
 
 // SCARD returns the cardinality (the number of elements) in the set at key.
 //
-// Cost is O(size) / 1 WCU per 4KB of data counted.
+// Cost is O(size) / 1 RCU per 4KB of data counted, plus the type check of the key.
 //
 // Works similar to https://redis.io/commands/scard
 func (c Client) SCARD(key string) (count int32, err error) {
-	return c.HLEN(key)
+	c, finish := c.command("SCARD", []string{key})
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeSet); err != nil {
+		return
+	}
+
+	return c.hLen(key)
 }
 
 func (c Client) SDIFF(key string, subtractKeys ...string) (members []string, err error) {
+	c, finish := c.command("SDIFF", append([]string{key}, subtractKeys...))
+	defer finish(&err)
+
 	memberSet := make(map[string]struct{})
 	startingList, err := c.SMEMBERS(key)
 
@@ -95,6 +133,9 @@ func (c Client) SDIFF(key string, subtractKeys ...string) (members []string, err
 }
 
 func (c Client) SDIFFSTORE(destinationKey string, sourceKey string, subtractKeys ...string) (count int32, err error) {
+	c, finish := c.command("SDIFFSTORE", append([]string{destinationKey, sourceKey}, subtractKeys...))
+	defer finish(&err)
+
 	members, err := c.SDIFF(sourceKey, subtractKeys...)
 	if err == nil {
 		_, err = c.SADD(destinationKey, members...)
@@ -104,6 +145,9 @@ func (c Client) SDIFFSTORE(destinationKey string, sourceKey string, subtractKeys
 }
 
 func (c Client) SINTER(key string, otherKeys ...string) (members []string, err error) {
+	c, finish := c.command("SINTER", append([]string{key}, otherKeys...))
+	defer finish(&err)
+
 	memberSet := make(map[string]struct{})
 	startingList, err := c.SMEMBERS(key)
 
@@ -142,6 +186,9 @@ func (c Client) SINTER(key string, otherKeys ...string) (members []string, err e
 }
 
 func (c Client) SINTERSTORE(destinationKey string, sourceKey string, otherKeys ...string) (count int32, err error) {
+	c, finish := c.command("SINTERSTORE", append([]string{destinationKey, sourceKey}, otherKeys...))
+	defer finish(&err)
+
 	members, err := c.SINTER(sourceKey, otherKeys...)
 	if err == nil {
 		_, err = c.SADD(destinationKey, members...)
@@ -151,12 +198,19 @@ func (c Client) SINTERSTORE(destinationKey string, sourceKey string, otherKeys .
 }
 
 func (c Client) SISMEMBER(key string, member string) (ok bool, err error) {
-	resp, err := c.ddbClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+	c, finish := c.command("SISMEMBER", []string{key}, member)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeSet); err != nil {
+		return
+	}
+
+	resp, err := c.ddb().GetItem(c.ctx, &dynamodb.GetItemInput{
 		ConsistentRead: aws.Bool(c.consistentReads),
 		Key:            setMember{pk: key, sk: member}.keyAV(c),
 		TableName:      aws.String(c.tableName),
 	})
-	if err != nil || len(resp.Item) == 0 {
+	if err != nil || len(resp.Item) == 0 || c.expired(resp.Item, time.Now()) {
 		return
 	}
 
@@ -164,19 +218,36 @@ func (c Client) SISMEMBER(key string, member string) (ok bool, err error) {
 }
 
 func (c Client) SMEMBERS(key string) (members []string, err error) {
+	c, finish := c.command("SMEMBERS", []string{key})
+	defer finish(&err)
+
+	cached, ok, fill := c.cached("SMEMBERS", key, "")
+	if ok {
+		return cached.([]string), nil
+	}
+
+	if err = c.checkType(key, TypeSet); err != nil {
+		return
+	}
+
 	hasMoreResults := true
+	size := 0
+
+	var expires time.Time
 
 	var lastEvaluatedKey map[string]types.AttributeValue
 
 	for hasMoreResults {
 		builder := newExpresionBuilder()
-		builder.addConditionEquality(c.partitionKey, StringValue{key})
+		builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(key)})
+		builder.addFilterNotExpired(expiryAttribute, time.Now())
 
-		resp, err := c.ddbClient.Query(context.TODO(), &dynamodb.QueryInput{
+		resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
 			ConsistentRead:            aws.Bool(c.consistentReads),
 			ExclusiveStartKey:         lastEvaluatedKey,
 			ExpressionAttributeNames:  builder.expressionAttributeNames(),
 			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			FilterExpression:          builder.filterExpression(),
 			KeyConditionExpression:    builder.conditionExpression(),
 			TableName:                 aws.String(c.tableName),
 		})
@@ -188,6 +259,8 @@ func (c Client) SMEMBERS(key string) (members []string, err error) {
 		for _, item := range resp.Items {
 			parsedItem := parseItem(item, c)
 			members = append(members, parsedItem.sk)
+			size += len(parsedItem.sk) + 1
+			expires = earliest(expires, c.itemExpiry(item))
 		}
 
 		if len(resp.LastEvaluatedKey) > 0 {
@@ -197,14 +270,32 @@ func (c Client) SMEMBERS(key string) (members []string, err error) {
 		}
 	}
 
+	fill(members, size, expires)
+
 	return
 }
 
 func (c Client) SMOVE(sourceKey string, destinationKey string, member string) (ok bool, err error) {
+	c, finish := c.command("SMOVE", []string{sourceKey, destinationKey}, member)
+	defer finish(&err)
+
+	if err = c.checkType(sourceKey, TypeSet); err != nil {
+		return
+	}
+
+	if c, err = c.inheritExpiry(destinationKey); err != nil {
+		return
+	}
+
+	if err = c.claimType(destinationKey, TypeSet); err != nil {
+		return
+	}
+
 	builder := newExpresionBuilder()
 	builder.addConditionExists(c.partitionKey)
+	builder.addConditionNotExpired(expiryAttribute, time.Now())
 
-	_, err = c.ddbClient.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{
+	_, err = c.ddb().TransactWriteItems(c.ctx, &dynamodb.TransactWriteItemsInput{
 		TransactItems: []types.TransactWriteItem{
 			{
 				Delete: &types.Delete{
@@ -224,7 +315,7 @@ func (c Client) SMOVE(sourceKey string, destinationKey string, member string) (o
 		},
 	})
 
-	if conditionFailureError(err) {
+	if errors.Is(err, ErrConditionFailed) {
 		return false, nil
 	}
 
@@ -236,6 +327,9 @@ func (c Client) SMOVE(sourceKey string, destinationKey string, member string) (o
 }
 
 func (c Client) SPOP(key string, count int32) (members []string, err error) {
+	c, finish := c.command("SPOP", []string{key}, count)
+	defer finish(&err)
+
 	members, err = c.SRANDMEMBER(key, count)
 	if err == nil {
 		_, err = c.SREM(key, members...)
@@ -245,17 +339,26 @@ func (c Client) SPOP(key string, count int32) (members []string, err error) {
 }
 
 func (c Client) SRANDMEMBER(key string, count int32) (members []string, err error) {
+	c, finish := c.command("SRANDMEMBER", []string{key}, count)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeSet); err != nil {
+		return
+	}
+
 	if count < 0 {
 		count = -count
 	}
 
 	builder := newExpresionBuilder()
-	builder.addConditionEquality(c.partitionKey, StringValue{key})
+	builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(key)})
+	builder.addFilterNotExpired(expiryAttribute, time.Now())
 
-	resp, err := c.ddbClient.Query(context.TODO(), &dynamodb.QueryInput{
+	resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
 		ConsistentRead:            aws.Bool(c.consistentReads),
 		ExpressionAttributeNames:  builder.expressionAttributeNames(),
 		ExpressionAttributeValues: builder.expressionAttributeValues(),
+		FilterExpression:          builder.filterExpression(),
 		KeyConditionExpression:    builder.conditionExpression(),
 		Limit:                     aws.Int32(count),
 		TableName:                 aws.String(c.tableName),
@@ -274,8 +377,19 @@ func (c Client) SRANDMEMBER(key string, count int32) (members []string, err erro
 }
 
 func (c Client) SREM(key string, members ...string) (removedMembers []string, err error) {
+	c, finish := c.command("SREM", []string{key}, members)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeSet); err != nil {
+		return
+	}
+
+	if c.batchWrites() {
+		return nil, c.batchDelete(key, members)
+	}
+
 	for _, member := range members {
-		resp, err := c.ddbClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		resp, err := c.ddb().DeleteItem(c.ctx, &dynamodb.DeleteItemInput{
 			Key: setMember{
 				pk: key,
 				sk: member,
@@ -296,6 +410,9 @@ func (c Client) SREM(key string, members ...string) (removedMembers []string, er
 }
 
 func (c Client) SUNION(keys ...string) (members []string, err error) {
+	c, finish := c.command("SUNION", keys)
+	defer finish(&err)
+
 	memberSet := make(map[string]struct{})
 
 	for _, key := range keys {
@@ -317,6 +434,9 @@ func (c Client) SUNION(keys ...string) (members []string, err error) {
 }
 
 func (c Client) SUNIONSTORE(destinationKey string, sourceKeys ...string) (count int32, err error) {
+	c, finish := c.command("SUNIONSTORE", append([]string{destinationKey}, sourceKeys...))
+	defer finish(&err)
+
 	members, err := c.SUNION(sourceKeys...)
 	if err == nil {
 		_, err = c.SADD(destinationKey, members...)
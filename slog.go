@@ -0,0 +1,35 @@
+//go:build go1.21
+// +build go1.21
+
+package redimo
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LogCommands returns middleware that logs every command to logger once it has finished, at the given
+// level, or at slog.LevelError if the command failed. Records have the message "redimo command" and
+// the attributes command, keys, args, duration, calls and, for failed commands, error. It is only
+// available when building with Go 1.21 or later, which added log/slog.
+func LogCommands(logger *slog.Logger, level slog.Level) Middleware {
+	return func(ctx context.Context, cmd *Command) (context.Context, func()) {
+		return ctx, func() {
+			attrs := []slog.Attr{
+				slog.String("command", cmd.Name),
+				slog.Any("keys", cmd.Keys),
+				slog.String("args", cmd.Args),
+				slog.Duration("duration", cmd.Duration),
+				slog.Int("calls", len(cmd.Calls)),
+			}
+
+			recordLevel := level
+			if cmd.Err != nil {
+				recordLevel = slog.LevelError
+				attrs = append(attrs, slog.Any("error", cmd.Err))
+			}
+
+			logger.LogAttrs(ctx, recordLevel, "redimo command", attrs...)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+//go:build go1.21
+// +build go1.21
+
+package redimo
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogCommands(t *testing.T) {
+	c := newClient(t).CheckTypes()
+
+	var buf bytes.Buffer
+
+	logged := c.Use(LogCommands(slog.New(slog.NewJSONHandler(&buf, nil)), slog.LevelInfo))
+
+	_, err := logged.SADD("set1", "m1", "m2")
+	assert.NoError(t, err)
+
+	var record map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "INFO", record["level"])
+	assert.Equal(t, "redimo command", record["msg"])
+	assert.Equal(t, "SADD", record["command"])
+	assert.Equal(t, []interface{}{"set1"}, record["keys"])
+	assert.Equal(t, "[2]", record["args"])
+	assert.True(t, record["calls"].(float64) > 0)
+	assert.Nil(t, record["error"])
+
+	buf.Reset()
+
+	_, err = logged.GET("set1")
+	assert.Equal(t, ErrWrongType, err)
+
+	record = nil
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "ERROR", record["level"])
+	assert.Equal(t, ErrWrongType.Error(), record["error"])
+}
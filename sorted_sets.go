@@ -1,11 +1,12 @@
 package redimo
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"math"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
@@ -83,6 +84,27 @@ func zScoreFromAV(av types.AttributeValue) float64 {
 }
 
 func (c Client) ZADD(key string, membersWithScores map[string]float64, flags Flags) (addedMembers []string, err error) {
+	c, finish := c.command("ZADD", []string{key}, membersWithScores, flags)
+	defer finish(&err)
+
+	if c, err = c.inheritExpiry(key); err != nil {
+		return
+	}
+
+	if err = c.claimType(key, TypeZSet); err != nil {
+		return
+	}
+
+	// Flags need a condition on every member, which batched writes do not support.
+	if c.batchWrites() && !flags.has(IfNotExists) && !flags.has(IfAlreadyExists) {
+		scores := make(map[string]types.AttributeValue)
+		for member, score := range membersWithScores {
+			scores[member] = zScore{score}.ToAV()
+		}
+
+		return nil, c.batchPutScores(key, scores)
+	}
+
 	for member, score := range membersWithScores {
 		builder := newExpresionBuilder()
 		// snk 是分数
@@ -96,7 +118,7 @@ func (c Client) ZADD(key string, membersWithScores map[string]float64, flags Fla
 			builder.addConditionExists(c.partitionKey)
 		}
 
-		resp, err := c.ddbClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		resp, err := c.updateItem(&dynamodb.UpdateItemInput{
 			ConditionExpression:       builder.conditionExpression(),
 			ExpressionAttributeNames:  builder.expressionAttributeNames(),
 			ExpressionAttributeValues: builder.expressionAttributeValues(),
@@ -105,7 +127,7 @@ func (c Client) ZADD(key string, membersWithScores map[string]float64, flags Fla
 			TableName:                 aws.String(c.tableName),
 			UpdateExpression:          builder.updateExpression(),
 		})
-		if conditionFailureError(err) {
+		if errors.Is(err, ErrConditionFailed) {
 			continue
 		}
 
@@ -122,16 +144,31 @@ func (c Client) ZADD(key string, membersWithScores map[string]float64, flags Fla
 }
 
 func (c Client) ZCARD(key string) (count int32, err error) {
-	return c.HLEN(key)
+	c, finish := c.command("ZCARD", []string{key})
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeZSet); err != nil {
+		return
+	}
+
+	return c.hLen(key)
 }
 
 func (c Client) ZCOUNT(key string, minScore, maxScore float64) (count int32, err error) {
+	c, finish := c.command("ZCOUNT", []string{key}, minScore, maxScore)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeZSet); err != nil {
+		return
+	}
+
 	return c.zGeneralCount(key, zScore{minScore}, zScore{maxScore}, c.sortKeyNum)
 }
 
 func (c Client) zGeneralCount(key string, min rangeCap, max rangeCap, attribute string) (count int32, err error) {
 	builder := newExpresionBuilder()
-	builder.addConditionEquality(c.partitionKey, StringValue{key})
+	builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(key)})
+	builder.addFilterNotExpired(expiryAttribute, time.Now())
 
 	betweenRange := min.present() && max.present()
 
@@ -166,12 +203,13 @@ func (c Client) zGeneralCount(key string, min rangeCap, max rangeCap, attribute
 	}
 
 	for hasMoreResults {
-		resp, err := c.ddbClient.Query(context.TODO(), &dynamodb.QueryInput{
+		resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
 			ConsistentRead:            aws.Bool(c.consistentReads),
 			ExclusiveStartKey:         lastEvaluatedKey,
 			ExpressionAttributeNames:  builder.expressionAttributeNames(),
 			ExpressionAttributeValues: builder.expressionAttributeValues(),
 			IndexName:                 queryIndex,
+			FilterExpression:          builder.filterExpression(),
 			KeyConditionExpression:    builder.conditionExpression(),
 			Select:                    types.SelectCount,
 			TableName:                 aws.String(c.tableName),
@@ -194,11 +232,22 @@ func (c Client) zGeneralCount(key string, min rangeCap, max rangeCap, attribute
 }
 
 func (c Client) ZINCRBY(key string, member string, delta float64) (newScore float64, err error) {
+	c, finish := c.command("ZINCRBY", []string{key}, member, delta)
+	defer finish(&err)
+
+	if c, err = c.inheritExpiry(key); err != nil {
+		return
+	}
+
+	if err = c.claimType(key, TypeZSet); err != nil {
+		return
+	}
+
 	builder := newExpresionBuilder()
 	builder.keys[c.sortKeyNum] = struct{}{}
 	builder.values["delta"] = zScore{delta}.ToAV()
 
-	resp, err := c.ddbClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+	resp, err := c.updateItem(&dynamodb.UpdateItemInput{
 		ConditionExpression:       builder.conditionExpression(),
 		ExpressionAttributeNames:  builder.expressionAttributeNames(),
 		ExpressionAttributeValues: builder.expressionAttributeValues(),
@@ -220,6 +269,9 @@ func (c Client) ZINCRBY(key string, member string, delta float64) (newScore floa
 }
 
 func (c Client) ZINTERSTORE(destinationKey string, sourceKeys []string, aggregation ZAggregation, weights map[string]float64) (membersWithScores map[string]float64, err error) {
+	c, finish := c.command("ZINTERSTORE", append([]string{destinationKey}, sourceKeys...), aggregation, weights)
+	defer finish(&err)
+
 	set, err := c.ZINTER(sourceKeys, aggregation, weights)
 	if err == nil {
 		_, err = c.ZADD(destinationKey, set, Flags{})
@@ -229,14 +281,27 @@ func (c Client) ZINTERSTORE(destinationKey string, sourceKeys []string, aggregat
 }
 
 func (c Client) ZLEXCOUNT(key string, min string, max string) (count int32, err error) {
+	c, finish := c.command("ZLEXCOUNT", []string{key}, min, max)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeZSet); err != nil {
+		return
+	}
+
 	return c.zGeneralCount(key, zLex{min}, zLex{max}, c.sortKey)
 }
 
 func (c Client) ZPOPMAX(key string, count int32) (membersWithScores map[string]float64, err error) {
+	c, finish := c.command("ZPOPMAX", []string{key}, count)
+	defer finish(&err)
+
 	return c.zPop(key, count, false)
 }
 
 func (c Client) ZPOPMIN(key string, count int32) (membersWithScores map[string]float64, err error) {
+	c, finish := c.command("ZPOPMIN", []string{key}, count)
+	defer finish(&err)
+
 	return c.zPop(key, count, true)
 }
 
@@ -244,6 +309,10 @@ var negInf = zScore{math.Inf(-1)}
 var posInf = zScore{math.Inf(+1)}
 
 func (c Client) zPop(key string, count int32, forward bool) (membersWithScores map[string]float64, err error) {
+	if err = c.checkType(key, TypeZSet); err != nil {
+		return
+	}
+
 	membersWithScores, err = c.zGeneralRange(key, negInf, posInf, 0, count, forward, c.sortKeyNum)
 	if err != nil {
 		return
@@ -252,7 +321,7 @@ func (c Client) zPop(key string, count int32, forward bool) (membersWithScores m
 	poppedMembers := make(map[string]float64)
 
 	for member, score := range membersWithScores {
-		popped, err := c.ZREM(key, member)
+		popped, err := c.zRem(key, member)
 		if err != nil {
 			return poppedMembers, err
 		}
@@ -266,10 +335,17 @@ func (c Client) zPop(key string, count int32, forward bool) (membersWithScores m
 }
 
 func (c Client) ZRANGE(key string, start, stop int32) (membersWithScores map[string]float64, err error) {
+	c, finish := c.command("ZRANGE", []string{key}, start, stop)
+	defer finish(&err)
+
 	return c.zRange(key, start, stop, true)
 }
 
 func (c Client) zRange(key string, start int32, stop int32, forward bool) (membersWithScores map[string]float64, err error) {
+	if err = c.checkType(key, TypeZSet); err != nil {
+		return
+	}
+
 	if start <= 0 && stop < 0 {
 		return c.zGeneralRange(key, negInf, posInf, -stop-1, -start, !forward, c.sortKeyNum)
 	}
@@ -295,10 +371,24 @@ func floatValues(floatValuedMap map[string]float64) (values []float64) {
 }
 
 func (c Client) ZRANGEBYLEX(key string, min, max string, offset, count int32) (membersWithScores map[string]float64, err error) {
+	c, finish := c.command("ZRANGEBYLEX", []string{key}, min, max, offset, count)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeZSet); err != nil {
+		return
+	}
+
 	return c.zGeneralRange(key, zLex{min}, zLex{max}, offset, count, true, c.sortKey)
 }
 
 func (c Client) ZRANGEBYSCORE(key string, min, max float64, offset, count int32) (membersWithScores map[string]float64, err error) {
+	c, finish := c.command("ZRANGEBYSCORE", []string{key}, min, max, offset, count)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeZSet); err != nil {
+		return
+	}
+
 	return c.zGeneralRange(key, zScore{min}, zScore{max}, offset, count, true, c.sortKeyNum)
 }
 
@@ -320,7 +410,8 @@ func (c Client) zGeneralRange(key string,
 		}
 
 		builder := newExpresionBuilder()
-		builder.addConditionEquality(c.partitionKey, StringValue{key})
+		builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(key)})
+		builder.addFilterNotExpired(expiryAttribute, time.Now())
 
 		if start.present() {
 			builder.values["start"] = start.ToAV()
@@ -344,12 +435,13 @@ func (c Client) zGeneralRange(key string,
 			queryIndex = aws.String(c.indexName)
 		}
 
-		resp, err := c.ddbClient.Query(context.TODO(), &dynamodb.QueryInput{
+		resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
 			ConsistentRead:            aws.Bool(c.consistentReads),
 			ExclusiveStartKey:         lastKey,
 			ExpressionAttributeNames:  builder.expressionAttributeNames(),
 			ExpressionAttributeValues: builder.expressionAttributeValues(),
 			IndexName:                 queryIndex,
+			FilterExpression:          builder.filterExpression(),
 			KeyConditionExpression:    builder.conditionExpression(),
 			Limit:                     queryLimit,
 			ScanIndexForward:          aws.Bool(forward),
@@ -380,6 +472,9 @@ func (c Client) zGeneralRange(key string,
 }
 
 func (c Client) ZRANK(key string, member string) (rank int32, found bool, err error) {
+	c, finish := c.command("ZRANK", []string{key}, member)
+	defer finish(&err)
+
 	return c.zRank(key, member, true)
 }
 
@@ -405,8 +500,23 @@ func (c Client) zRank(key string, member string, forward bool) (rank int32, ok b
 }
 
 func (c Client) ZREM(key string, members ...string) (removedMembers []string, err error) {
+	c, finish := c.command("ZREM", []string{key}, members)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeZSet); err != nil {
+		return
+	}
+
+	return c.zRem(key, members...)
+}
+
+func (c Client) zRem(key string, members ...string) (removedMembers []string, err error) {
+	if c.batchWrites() {
+		return nil, c.batchDelete(key, members)
+	}
+
 	for _, member := range members {
-		resp, err := c.ddbClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		resp, err := c.ddb().DeleteItem(c.ctx, &dynamodb.DeleteItemInput{
 			Key:          keyDef{pk: key, sk: member}.toAV(c),
 			ReturnValues: types.ReturnValueAllOld,
 			TableName:    aws.String(c.tableName),
@@ -425,9 +535,12 @@ func (c Client) ZREM(key string, members ...string) (removedMembers []string, er
 }
 
 func (c Client) ZREMRANGEBYLEX(key string, min, max string) (removedMembers []string, err error) {
+	c, finish := c.command("ZREMRANGEBYLEX", []string{key}, min, max)
+	defer finish(&err)
+
 	membersWithScores, err := c.ZRANGEBYLEX(key, min, max, 0, 0)
 	if err == nil {
-		removedMembers, err = c.ZREM(key, zReadKeys(membersWithScores)...)
+		removedMembers, err = c.zRem(key, zReadKeys(membersWithScores)...)
 	}
 
 	return
@@ -443,58 +556,111 @@ func zReadKeys(membersWithScores map[string]float64) []string {
 }
 
 func (c Client) ZREMRANGEBYRANK(key string, start, stop int32) (removedMembers []string, err error) {
+	c, finish := c.command("ZREMRANGEBYRANK", []string{key}, start, stop)
+	defer finish(&err)
+
 	membersWithScores, err := c.ZRANGE(key, start, stop)
 	if err == nil {
-		removedMembers, err = c.ZREM(key, zReadKeys(membersWithScores)...)
+		removedMembers, err = c.zRem(key, zReadKeys(membersWithScores)...)
 	}
 
 	return
 }
 
 func (c Client) ZREMRANGEBYSCORE(key string, min, max float64) (removedMembers []string, err error) {
+	c, finish := c.command("ZREMRANGEBYSCORE", []string{key}, min, max)
+	defer finish(&err)
+
 	membersWithScores, err := c.ZRANGEBYSCORE(key, min, max, 0, 0)
 	if err == nil {
-		removedMembers, err = c.ZREM(key, zReadKeys(membersWithScores)...)
+		removedMembers, err = c.zRem(key, zReadKeys(membersWithScores)...)
 	}
 
 	return
 }
 
 func (c Client) ZREVRANGE(key string, start, stop int32) (membersWithScores map[string]float64, err error) {
+	c, finish := c.command("ZREVRANGE", []string{key}, start, stop)
+	defer finish(&err)
+
 	return c.zRange(key, start, stop, false)
 }
 
 func (c Client) ZREVRANGEBYLEX(key string, max, min string, offset, count int32) (membersWithScores map[string]float64, err error) {
+	c, finish := c.command("ZREVRANGEBYLEX", []string{key}, max, min, offset, count)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeZSet); err != nil {
+		return
+	}
+
 	return c.zGeneralRange(key, zLex{min}, zLex{max}, offset, count, false, c.sortKey)
 }
 
 func (c Client) ZREVRANGEBYSCORE(key string, max, min float64, offset, count int32) (membersWithScores map[string]float64, err error) {
+	c, finish := c.command("ZREVRANGEBYSCORE", []string{key}, max, min, offset, count)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeZSet); err != nil {
+		return
+	}
+
 	return c.zGeneralRange(key, zScore{min}, zScore{max}, offset, count, false, c.sortKeyNum)
 }
 
 func (c Client) ZREVRANK(key string, member string) (rank int32, found bool, err error) {
+	c, finish := c.command("ZREVRANK", []string{key}, member)
+	defer finish(&err)
+
 	return c.zRank(key, member, false)
 }
 
 func (c Client) ZSCORE(key string, member string) (score float64, found bool, err error) {
-	resp, err := c.ddbClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+	c, finish := c.command("ZSCORE", []string{key}, member)
+	defer finish(&err)
+
+	cached, ok, fill := c.cached("ZSCORE", key, member)
+	if ok {
+		result := cached.(zScoreResult)
+		return result.score, result.found, nil
+	}
+
+	if err = c.checkType(key, TypeZSet); err != nil {
+		return
+	}
+
+	resp, err := c.ddb().GetItem(c.ctx, &dynamodb.GetItemInput{
 		ConsistentRead: aws.Bool(c.consistentReads),
 		Key: keyDef{
 			pk: key,
 			sk: member,
 		}.toAV(c),
-		ProjectionExpression: aws.String(strings.Join([]string{c.sortKeyNum}, ", ")),
-		TableName:            aws.String(c.tableName),
+		ExpressionAttributeNames: map[string]string{"#" + expiryAttribute: expiryAttribute},
+		ProjectionExpression:     aws.String(strings.Join([]string{c.sortKeyNum, "#" + expiryAttribute}, ", ")),
+		TableName:                aws.String(c.tableName),
 	})
-	if err == nil && len(resp.Item) > 0 {
+	if err == nil && len(resp.Item) > 0 && !c.expired(resp.Item, time.Now()) {
 		found = true
 		score = zScoreFromAV(resp.Item[c.sortKeyNum])
 	}
 
+	if err == nil {
+		fill(zScoreResult{score: score, found: found}, 16, c.itemExpiry(resp.Item))
+	}
+
 	return
 }
 
+// zScoreResult is the result of ZSCORE, as cached.
+type zScoreResult struct {
+	score float64
+	found bool
+}
+
 func (c Client) ZUNIONSTORE(destinationKey string, sourceKeys []string, aggregation ZAggregation, weights map[string]float64) (membersWithScores map[string]float64, err error) {
+	c, finish := c.command("ZUNIONSTORE", append([]string{destinationKey}, sourceKeys...), aggregation, weights)
+	defer finish(&err)
+
 	set, err := c.ZUNION(sourceKeys, aggregation, weights)
 	if err == nil {
 		_, err = c.ZADD(destinationKey, set, Flags{})
@@ -515,6 +681,9 @@ func zGetWeight(weights map[string]float64, key string) float64 {
 	return 1
 }
 func (c Client) ZUNION(sourceKeys []string, aggregation ZAggregation, weights map[string]float64) (membersWithScores map[string]float64, err error) {
+	c, finish := c.command("ZUNION", sourceKeys, aggregation, weights)
+	defer finish(&err)
+
 	membersWithScores = make(map[string]float64)
 
 	for _, sourceKey := range sourceKeys {
@@ -536,6 +705,9 @@ func (c Client) ZUNION(sourceKeys []string, aggregation ZAggregation, weights ma
 }
 
 func (c Client) ZINTER(sourceKeys []string, aggregation ZAggregation, weights map[string]float64) (membersWithScores map[string]float64, err error) {
+	c, finish := c.command("ZINTER", sourceKeys, aggregation, weights)
+	defer finish(&err)
+
 	membersWithScores, err = c.ZRANGEBYSCORE(sourceKeys[0], math.Inf(-1), math.Inf(+1), 0, 0)
 	if err != nil {
 		return
@@ -1,7 +1,6 @@
 package redimo
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"strconv"
@@ -61,9 +60,17 @@ func xSequenceKey(key string) keyDef {
 	}
 }
 
+func xCountKey(key string) string {
+	return strings.Join([]string{"_redimo", "xcount", key}, "/")
+}
+
+// sequenceUpdateAction moves the stream's last ID forward to the ID, initializing it if the stream has
+// none yet, and fails if the stream is already at or past the ID.
 func (xid XID) sequenceUpdateAction(key string, c Client) types.TransactWriteItem {
 	builder := newExpresionBuilder()
-	builder.condition(fmt.Sprintf("#%v < :%v", vk, vk), vk)
+	builder.condition(fmt.Sprintf("(attribute_not_exists(#%[1]v) OR #%[1]v < :%[1]v OR #%[2]v <= :now)", vk, expiryAttribute),
+		vk, expiryAttribute)
+	builder.values["now"] = expiryAV(time.Now())
 	builder.SET(fmt.Sprintf("#%v = :%v", vk, vk), vk, StringValue{xid.String()}.ToAV())
 
 	return types.TransactWriteItem{
@@ -200,7 +207,7 @@ func (i StreamItem) putAction(key string, c Client) types.TransactWriteItem {
 
 func (i StreamItem) toAV(key string, c Client) map[string]types.AttributeValue {
 	avm := make(map[string]types.AttributeValue)
-	avm[c.partitionKey] = StringValue{key}.ToAV()
+	avm[c.partitionKey] = StringValue{c.namespaced(key)}.ToAV()
 	avm[c.sortKey] = StringValue{i.ID.String()}.ToAV()
 
 	for k, v := range i.Fields {
@@ -211,8 +218,15 @@ func (i StreamItem) toAV(key string, c Client) map[string]types.AttributeValue {
 }
 
 func (c Client) XACK(key string, group string, ids ...XID) (acknowledgedIds []XID, err error) {
+	c, finish := c.command("XACK", []string{key}, group, ids)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeStream); err != nil {
+		return
+	}
+
 	for _, id := range ids {
-		resp, err := c.ddbClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		resp, err := c.ddb().DeleteItem(c.ctx, &dynamodb.DeleteItemInput{
 			Key:          keyDef{pk: c.xGroupKey(key, group), sk: id.String()}.toAV(c),
 			ReturnValues: types.ReturnValueAllOld,
 			TableName:    aws.String(c.tableName),
@@ -242,84 +256,85 @@ func (c Client) XACK(key string, group string, ids ...XID) (acknowledgedIds []XI
 //
 // Works similar to https://redis.io/commands/xadd
 func (c Client) XADD(key string, id XID, fields map[string]Value) (returnedID XID, err error) {
-	retry := true
-	retryCount := 0
+	c, finish := c.command("XADD", []string{key}, id, fields)
+	defer finish(&err)
 
-	for retry && retryCount < 2 {
-		var actions []types.TransactWriteItem
+	if c, err = c.inheritExpiry(key); err != nil {
+		return
+	}
 
-		if id == XAutoID {
-			now := time.Now()
-			newSequence, err := c.INCR(strings.Join([]string{"_redimo", "xcount", key}, "/"))
+	if err = c.claimType(key, TypeStream); err != nil {
+		return
+	}
 
-			if err != nil {
-				return id, err
-			}
+	wrappedFields := make(map[string]ReturnValue)
+
+	var chunks []types.TransactWriteItem
 
-			id = NewXID(now, uint64(newSequence))
+	for k, v := range fields {
+		stored, fieldChunks, err := c.storeAV(streamFieldSlot(key, k), v.ToAV(), nil)
+		if err != nil {
+			return XID(""), err
 		}
 
-		wrappedFields := make(map[string]ReturnValue)
+		wrappedFields[k] = ReturnValue{stored}
+		chunks = append(chunks, fieldChunks...)
+	}
 
-		for k, v := range fields {
-			wrappedFields[k] = ReturnValue{v.ToAV()}
+	if len(chunks)+2 > c.transactionActions {
+		for _, stored := range wrappedFields {
+			if err = c.abandonAV(stored.av); err != nil {
+				return XID(""), err
+			}
 		}
 
-		actions = append(actions, StreamItem{ID: id, Fields: wrappedFields}.putAction(key, c))
-		actions = append(actions, id.sequenceUpdateAction(key, c))
+		return XID(""), ErrTooManyActions
+	}
 
-		_, err := c.ddbClient.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{
-			TransactItems: actions,
-		})
-		if err != nil {
-			if conditionFailureError(err) && retryCount == 0 {
-				// Steam may not have been initialized, let's try initializing
-				err = c.xInit(key)
-				if err != nil {
-					return returnedID, err
-				}
-			} else {
-				return returnedID, err
+	// Each attempt is made without retries of its own, so that the client's retry policy applies to
+	// the attempt as a whole.
+	once := c.WithRetryPolicy(NoRetries)
+
+	err = c.retryPolicy.do(c.ctx, func() error {
+		returnedID = id
+
+		if id == XAutoID {
+			newSequence, err := once.INCR(xCountKey(key))
+			if err != nil {
+				return err
 			}
-		} else {
-			retry = false
+
+			returnedID = NewXID(time.Now(), uint64(newSequence))
 		}
-		// Likely happened because of contention, let's retry once.
-		retryCount++
-	}
 
-	return id, err
-}
+		_, err := once.ddb().TransactWriteItems(c.ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: append([]types.TransactWriteItem{
+				StreamItem{ID: returnedID, Fields: wrappedFields}.putAction(key, c),
+				returnedID.sequenceUpdateAction(key, c),
+			}, chunks...),
+		})
+		if errors.Is(err, ErrConditionFailed) && id == XAutoID {
+			// A concurrent XADD has moved the stream past the generated ID, let's generate another.
+			return &Error{Kind: ErrTransactionConflict, Err: err}
+		}
 
-func (c Client) xInit(key string) (err error) {
-	_, err = c.ddbClient.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{
-		TransactItems: []types.TransactWriteItem{c.xInitAction(key)},
+		return err
 	})
-	if conditionFailureError(err) {
-		err = nil
+	if err != nil {
+		return XID(""), err
 	}
 
-	return
+	return returnedID, nil
 }
 
-func (c Client) xInitAction(key string) types.TransactWriteItem {
-	builder := newExpresionBuilder()
-	builder.addConditionNotExists(vk)
-	builder.SET(fmt.Sprintf("#%v = :%v", vk, vk), vk, StringValue{XStart.String()}.ToAV())
+func (c Client) XCLAIM(key string, group string, consumer string, lastDeliveredBefore time.Time, ids ...XID) (items []StreamItem, err error) {
+	c, finish := c.command("XCLAIM", []string{key}, group, consumer, lastDeliveredBefore, ids)
+	defer finish(&err)
 
-	return types.TransactWriteItem{
-		Update: &types.Update{
-			ConditionExpression:       builder.conditionExpression(),
-			ExpressionAttributeNames:  builder.expressionAttributeNames(),
-			ExpressionAttributeValues: builder.expressionAttributeValues(),
-			Key:                       xSequenceKey(key).toAV(c),
-			TableName:                 aws.String(c.tableName),
-			UpdateExpression:          builder.updateExpression(),
-		},
+	if err = c.checkType(key, TypeStream); err != nil {
+		return
 	}
-}
 
-func (c Client) XCLAIM(key string, group string, consumer string, lastDeliveredBefore time.Time, ids ...XID) (items []StreamItem, err error) {
 	for _, id := range ids {
 		builder := newExpresionBuilder()
 		builder.addConditionExists(c.partitionKey)
@@ -328,7 +343,7 @@ func (c Client) XCLAIM(key string, group string, consumer string, lastDeliveredB
 		builder.updateSET(deliveryCountKey, IntValue{0})
 		builder.updateSET(consumerKey, StringValue{consumer})
 
-		_, err = c.ddbClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		_, err = c.ddb().UpdateItem(c.ctx, &dynamodb.UpdateItemInput{
 			ConditionExpression:       builder.conditionExpression(),
 			ExpressionAttributeNames:  builder.expressionAttributeNames(),
 			ExpressionAttributeValues: builder.expressionAttributeValues(),
@@ -337,7 +352,7 @@ func (c Client) XCLAIM(key string, group string, consumer string, lastDeliveredB
 			UpdateExpression:          builder.updateExpression(),
 		})
 
-		if conditionFailureError(err) {
+		if errors.Is(err, ErrConditionFailed) {
 			continue
 		}
 
@@ -345,7 +360,7 @@ func (c Client) XCLAIM(key string, group string, consumer string, lastDeliveredB
 			return items, err
 		}
 
-		fetchedItems, err := c.XRANGE(key, id, id, 1)
+		fetchedItems, err := c.xRange(key, id, id, 1, true)
 
 		if err != nil || len(fetchedItems) < 1 {
 			return items, fmt.Errorf("could not loat stream item: %w", err)
@@ -365,8 +380,19 @@ func (c Client) XCLAIM(key string, group string, consumer string, lastDeliveredB
 //
 // Works similar to https://redis.io/commands/xdel
 func (c Client) XDEL(key string, ids ...XID) (deletedItems []XID, err error) {
+	c, finish := c.command("XDEL", []string{key}, ids)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeStream); err != nil {
+		return
+	}
+
+	return c.xDel(key, ids...)
+}
+
+func (c Client) xDel(key string, ids ...XID) (deletedItems []XID, err error) {
 	for _, id := range ids {
-		resp, err := c.ddbClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		resp, err := c.ddb().DeleteItem(c.ctx, &dynamodb.DeleteItemInput{
 			Key:          keyDef{pk: key, sk: id.String()}.toAV(c),
 			ReturnValues: types.ReturnValueAllOld,
 			TableName:    aws.String(c.tableName),
@@ -378,6 +404,12 @@ func (c Client) XDEL(key string, ids ...XID) (deletedItems []XID, err error) {
 		if len(resp.Attributes) > 0 {
 			deletedItems = append(deletedItems, id)
 		}
+
+		for _, field := range parseStreamItem(resp.Attributes, c).Fields {
+			if err = c.releaseAV(key, field.av); err != nil {
+				return deletedItems, err
+			}
+		}
 	}
 
 	return
@@ -390,11 +422,73 @@ func (c Client) XDEL(key string, ids ...XID) (deletedItems []XID, err error) {
 // This is a required initialization step before the group can be used. Trying to use
 // XREADGROUP without using XGROUP to initialize the group will return an error.
 //
-// Cost is O(1) / 1 WCU.
+// Cost is O(1) / 2 WCU, plus the type check of the key.
 //
 // Works similar to https://redis.io/commands/xgroup
 func (c Client) XGROUP(key string, group string, start XID) (err error) {
+	c, finish := c.command("XGROUP", []string{key}, group, start)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeStream); err != nil {
+		return
+	}
+
+	if c, err = c.inheritExpiry(key, group); err != nil {
+		return
+	}
+
 	err = c.xGroupCursorSet(key, group, start)
+	if err != nil {
+		return
+	}
+
+	_, err = c.HSET(xGroupsKey(key), map[string]Value{xGroupsPrefix + group: StringValue{group}})
+
+	return
+}
+
+// xGroupsKey is the partition that registers the consumer groups of a stream, so that RENAME and COPY
+// can find them. It is the key's internal partition, shared with the type record and list indexes.
+func xGroupsKey(key string) string {
+	return "_redimo/" + key
+}
+
+const xGroupsPrefix = "_redimo/group/"
+
+// xGroups returns the consumer groups created with XGROUP on the stream at key.
+func (c Client) xGroups(key string) (groups []string, err error) {
+	hasMoreResults := true
+
+	var cursor map[string]types.AttributeValue
+
+	for hasMoreResults {
+		builder := newExpresionBuilder()
+		builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(xGroupsKey(key))})
+		builder.addConditionBeginWith(c.sortKey, StringValue{xGroupsPrefix})
+
+		resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
+			ConsistentRead:            aws.Bool(c.consistentReads),
+			ExclusiveStartKey:         cursor,
+			ExpressionAttributeNames:  builder.expressionAttributeNames(),
+			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			KeyConditionExpression:    builder.conditionExpression(),
+			TableName:                 aws.String(c.tableName),
+		})
+		if err != nil {
+			return groups, err
+		}
+
+		for _, item := range resp.Items {
+			groups = append(groups, parseItem(item, c).val.String())
+		}
+
+		if len(resp.LastEvaluatedKey) > 0 {
+			cursor = resp.LastEvaluatedKey
+		} else {
+			hasMoreResults = false
+		}
+	}
+
 	return
 }
 
@@ -406,7 +500,7 @@ func (c Client) xGroupCursorSet(key string, group string, start XID) error {
 }
 
 func (c Client) xGroupCursorGet(key string, group string) (id XID, err error) {
-	resp, err := c.ddbClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+	resp, err := c.ddb().GetItem(c.ctx, &dynamodb.GetItemInput{
 		ConsistentRead: aws.Bool(true),
 		Key:            c.xGroupCursorKey(key, group).toAV(c),
 		TableName:      aws.String(c.tableName),
@@ -416,15 +510,17 @@ func (c Client) xGroupCursorGet(key string, group string) (id XID, err error) {
 	}
 
 	cursor := ReturnValue{resp.Item[vk]}.String()
-	if cursor == "" {
+	if cursor == "" || c.expired(resp.Item, time.Now()) {
 		return id, ErrXGroupNotInitialized
 	}
 
 	return XID(cursor), nil
 }
 
+const xGroupCursorSK = "_redimo/cursor"
+
 func (c Client) xGroupCursorKey(key string, group string) keyDef {
-	return keyDef{pk: c.xGroupKey(key, group), sk: "_redimo/cursor"}
+	return keyDef{pk: c.xGroupKey(key, group), sk: xGroupCursorSK}
 }
 
 func (c Client) xGroupKey(key string, group string) string {
@@ -434,25 +530,34 @@ func (c Client) xGroupKey(key string, group string) string {
 // XLEN counts the number of items in the stream with XIDs between the given XIDs. To count
 // the entire stream, pass XStart and XEnd as the start and end XIDs.
 //
-// Cost is O(N) or ~N RCUs where N is the number / size of items counted.
+// Cost is O(N) or ~N RCUs where N is the number / size of items counted, plus the type check of the key.
 //
 // Works similar to https://redis.io/commands/xlen
 func (c Client) XLEN(key string, start, stop XID) (count int32, err error) {
+	c, finish := c.command("XLEN", []string{key}, start, stop)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeStream); err != nil {
+		return
+	}
+
 	hasMoreResults := true
 
 	var cursor map[string]types.AttributeValue
 
 	for hasMoreResults {
 		builder := newExpresionBuilder()
-		builder.addConditionEquality(c.partitionKey, StringValue{key})
+		builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(key)})
 		builder.condition(fmt.Sprintf("#%v BETWEEN :start AND :stop", c.sortKey), c.sortKey)
 		builder.values["start"] = start.av()
 		builder.values["stop"] = stop.av()
-		resp, err := c.ddbClient.Query(context.TODO(), &dynamodb.QueryInput{
+		builder.addFilterNotExpired(expiryAttribute, time.Now())
+		resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
 			ConsistentRead:            aws.Bool(c.consistentReads),
 			ExclusiveStartKey:         cursor,
 			ExpressionAttributeNames:  builder.expressionAttributeNames(),
 			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			FilterExpression:          builder.filterExpression(),
 			KeyConditionExpression:    builder.conditionExpression(),
 			ScanIndexForward:          aws.Bool(true),
 			Select:                    types.SelectCount,
@@ -476,18 +581,25 @@ func (c Client) XLEN(key string, start, stop XID) (count int32, err error) {
 }
 
 func (c Client) XPENDING(key string, group string, count int32) (pendingItems []PendingItem, err error) {
+	c, finish := c.command("XPENDING", []string{key}, group, count)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeStream); err != nil {
+		return
+	}
+
 	hasMoreResults := true
 
 	var cursor map[string]types.AttributeValue
 
 	for hasMoreResults && count > 0 {
 		builder := newExpresionBuilder()
-		builder.addConditionEquality(c.partitionKey, StringValue{c.xGroupKey(key, group)})
+		builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(c.xGroupKey(key, group))})
 		builder.condition(fmt.Sprintf("#%v BETWEEN :start AND :stop", c.sortKey), c.sortKey)
 		builder.values["start"] = XStart.av()
 		builder.values["stop"] = XEnd.av()
 
-		resp, err := c.ddbClient.Query(context.TODO(), &dynamodb.QueryInput{
+		resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
 			ConsistentRead:            aws.Bool(c.consistentReads),
 			ExclusiveStartKey:         cursor,
 			ExpressionAttributeNames:  builder.expressionAttributeNames(),
@@ -545,6 +657,13 @@ func (c Client) XPENDING(key string, group string, count int32) (pendingItems []
 //
 // Works similar to https://redis.io/commands/xrange
 func (c Client) XRANGE(key string, start, stop XID, count int32) (streamItems []StreamItem, err error) {
+	c, finish := c.command("XRANGE", []string{key}, start, stop, count)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeStream); err != nil {
+		return
+	}
+
 	return c.xRange(key, start, stop, count, true)
 }
 
@@ -555,15 +674,17 @@ func (c Client) xRange(key string, start, stop XID, count int32, forward bool) (
 
 	for hasMoreResults && count > 0 {
 		builder := newExpresionBuilder()
-		builder.addConditionEquality(c.partitionKey, StringValue{key})
+		builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(key)})
 		builder.condition(fmt.Sprintf("#%v BETWEEN :start AND :stop", c.sortKey), c.sortKey)
 		builder.values["start"] = start.av()
 		builder.values["stop"] = stop.av()
-		resp, err := c.ddbClient.Query(context.TODO(), &dynamodb.QueryInput{
+		builder.addFilterNotExpired(expiryAttribute, time.Now())
+		resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
 			ConsistentRead:            aws.Bool(c.consistentReads),
 			ExclusiveStartKey:         cursor,
 			ExpressionAttributeNames:  builder.expressionAttributeNames(),
 			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			FilterExpression:          builder.filterExpression(),
 			KeyConditionExpression:    builder.conditionExpression(),
 			Limit:                     aws.Int32(count),
 			ScanIndexForward:          aws.Bool(forward),
@@ -581,7 +702,14 @@ func (c Client) xRange(key string, start, stop XID, count int32, forward bool) (
 		}
 
 		for _, resultItem := range resp.Items {
-			streamItems = append(streamItems, parseStreamItem(resultItem, c))
+			si := parseStreamItem(resultItem, c)
+			for field, val := range si.Fields {
+				if si.Fields[field], err = c.loadValue(streamFieldSlot(key, field), val); err != nil {
+					return streamItems, err
+				}
+			}
+
+			streamItems = append(streamItems, si)
 			count--
 		}
 	}
@@ -628,7 +756,14 @@ func (c Client) xGroupCursorPushAction(key string, group string, id XID) types.T
 //
 // Works similar to https://redis.io/commands/xread
 func (c Client) XREAD(key string, from XID, count int32) (items []StreamItem, err error) {
-	return c.XRANGE(key, from.Next(), XEnd, count)
+	c, finish := c.command("XREAD", []string{key}, from, count)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeStream); err != nil {
+		return
+	}
+
+	return c.xRange(key, from.Next(), XEnd, count, true)
 }
 
 type XReadOption string
@@ -646,13 +781,13 @@ func (c Client) xGroupReadPending(key string, group string, consumer string, cou
 
 	for hasMoreResults && count > 0 {
 		query := newExpresionBuilder()
-		query.addConditionEquality(c.partitionKey, StringValue{c.xGroupKey(key, group)})
+		query.addConditionEquality(c.partitionKey, StringValue{c.namespaced(c.xGroupKey(key, group))})
 		query.condition(fmt.Sprintf("#%v BETWEEN :start AND :stop", c.sortKey), c.sortKey)
 		query.values["start"] = StringValue{XStart.String()}.ToAV()
 		query.values["stop"] = StringValue{XEnd.String()}.ToAV()
 		query.values[consumerKey] = StringValue{consumer}.ToAV()
 		query.keys[consumerKey] = struct{}{}
-		resp, err := c.ddbClient.Query(context.TODO(), &dynamodb.QueryInput{
+		resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
 			ConsistentRead:            aws.Bool(c.consistentReads),
 			ExclusiveStartKey:         cursor,
 			ExpressionAttributeNames:  query.expressionAttributeNames(),
@@ -677,12 +812,12 @@ func (c Client) xGroupReadPending(key string, group string, consumer string, cou
 		for _, item := range resp.Items {
 			pendingItem := parsePendingItem(item, c)
 
-			_, err = c.ddbClient.UpdateItem(context.TODO(), pendingItem.updateDeliveryAction(c.xGroupKey(key, group), c))
+			_, err = c.ddb().UpdateItem(c.ctx, pendingItem.updateDeliveryAction(c.xGroupKey(key, group), c))
 			if err != nil {
 				return items, err
 			}
 
-			fetchedItems, err := c.XRANGE(key, pendingItem.ID, pendingItem.ID, 1)
+			fetchedItems, err := c.xRange(key, pendingItem.ID, pendingItem.ID, 1, true)
 			if err != nil || len(fetchedItems) < 1 {
 				return items, err
 			}
@@ -696,22 +831,32 @@ func (c Client) xGroupReadPending(key string, group string, consumer string, cou
 }
 
 func (c Client) XREADGROUP(key string, group string, consumer string, option XReadOption, maxCount int32) (items []StreamItem, err error) {
+	c, finish := c.command("XREADGROUP", []string{key}, group, consumer, option, maxCount)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeStream); err != nil {
+		return
+	}
+
+	if c, err = c.inheritExpiry(key, group); err != nil {
+		return
+	}
+
 	if option == XReadPending {
 		return c.xGroupReadPending(key, group, consumer, maxCount)
 	}
 
-	retryCount := 0
+	once := c.WithRetryPolicy(NoRetries)
 
-	for retryCount < 5 {
-		currentCursor, err := c.xGroupCursorGet(key, group)
+	err = c.retryPolicy.do(c.ctx, func() error {
+		currentCursor, err := once.xGroupCursorGet(key, group)
 		if err != nil {
-			return items, err
+			return err
 		}
 
-		items, err := c.XRANGE(key, currentCursor.Next(), XEnd, 1)
-
+		items, err = once.xRange(key, currentCursor.Next(), XEnd, 1, true)
 		if err != nil || len(items) == 0 {
-			return items, err
+			return err
 		}
 
 		item := items[0]
@@ -727,20 +872,21 @@ func (c Client) XREADGROUP(key string, group string, consumer string, option XRe
 			}.toPutAction(c.xGroupKey(key, group), c))
 		}
 
-		_, err = c.ddbClient.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{
+		_, err = once.ddb().TransactWriteItems(c.ctx, &dynamodb.TransactWriteItemsInput{
 			TransactItems: actions,
 		})
-		if err == nil {
-			return items, nil
+		if errors.Is(err, ErrConditionFailed) {
+			// Another consumer has moved the group's cursor, let's read the next item again.
+			return &Error{Kind: ErrTransactionConflict, Err: err}
 		}
 
-		if !conditionFailureError(err) {
-			return items, err
-		}
-		retryCount++
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return items, errors.New("too much contention")
+	return items, nil
 }
 
 // XREVRANGE is similar to XRANGE, but in reverse order. The stream items in descending chronological order. Using the
@@ -755,21 +901,35 @@ func (c Client) XREADGROUP(key string, group string, consumer string, option XRe
 //
 // Works similar to https://redis.io/commands/xrevrange
 func (c Client) XREVRANGE(key string, end, start XID, count int32) (streamItems []StreamItem, err error) {
+	c, finish := c.command("XREVRANGE", []string{key}, end, start, count)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeStream); err != nil {
+		return
+	}
+
 	return c.xRange(key, start, end, count, false)
 }
 
 func (c Client) XTRIM(key string, newCount int32) (deletedCount int32, err error) {
+	c, finish := c.command("XTRIM", []string{key}, newCount)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeStream); err != nil {
+		return
+	}
+
 	hasMoreResults := true
 
 	var cursor map[string]types.AttributeValue
 
 	for hasMoreResults {
 		builder := newExpresionBuilder()
-		builder.addConditionEquality(c.partitionKey, StringValue{key})
+		builder.addConditionEquality(c.partitionKey, StringValue{c.namespaced(key)})
 		builder.condition(fmt.Sprintf("#%v BETWEEN :start AND :stop", c.sortKey), c.sortKey)
 		builder.values["start"] = XStart.av()
 		builder.values["stop"] = XEnd.av()
-		resp, err := c.ddbClient.Query(context.TODO(), &dynamodb.QueryInput{
+		resp, err := c.ddb().Query(c.ctx, &dynamodb.QueryInput{
 			ConsistentRead:            aws.Bool(c.consistentReads),
 			ExclusiveStartKey:         cursor,
 			ExpressionAttributeNames:  builder.expressionAttributeNames(),
@@ -803,7 +963,7 @@ func (c Client) XTRIM(key string, newCount int32) (deletedCount int32, err error
 
 		if len(idsToDelete) > 0 {
 			deletedCount += int32(len(idsToDelete))
-			_, err = c.XDEL(key, idsToDelete...)
+			_, err = c.xDel(key, idsToDelete...)
 
 			if err != nil {
 				return deletedCount, err
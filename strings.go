@@ -1,8 +1,9 @@
 package redimo
 
 import (
-	"context"
+	"errors"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
@@ -11,18 +12,39 @@ import (
 
 // GET fetches the value at the given key. If the key does not exist, the ReturnValue will be Empty().
 //
+// Cost is O(1) / 1 RCU, plus the type check of the key.
+//
 // Works similar to https://redis.io/commands/get
 func (c Client) GET(key string) (val ReturnValue, err error) {
-	resp, err := c.ddbClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+	c, finish := c.command("GET", []string{key})
+	defer finish(&err)
+
+	cached, ok, fill := c.cached("GET", key, "")
+	if ok {
+		return cached.(ReturnValue), nil
+	}
+
+	if err = c.checkType(key, TypeString); err != nil {
+		return
+	}
+
+	resp, err := c.ddb().GetItem(c.ctx, &dynamodb.GetItemInput{
 		ConsistentRead: aws.Bool(c.consistentReads),
 		Key:            keyDef{pk: key, sk: ""}.toAV(c),
 		TableName:      aws.String(c.tableName),
 	})
-	if err != nil || len(resp.Item) == 0 {
+	if err != nil {
 		return
 	}
 
-	val = ReturnValue{resp.Item[vk]}
+	if len(resp.Item) == 0 || c.expired(resp.Item, time.Now()) {
+		fill(val, 0, time.Time{})
+		return
+	}
+
+	if val, err = c.loadValue(itemSlot(key, ""), ReturnValue{resp.Item[vk]}); err == nil {
+		fill(val, avSize(val.av), c.itemExpiry(resp.Item))
+	}
 
 	return
 }
@@ -33,27 +55,73 @@ func (c Client) GET(key string) (val ReturnValue, err error) {
 // The condition flags IfNotExists and IfAlreadyExists can be specified, and if they are
 // the SET becomes conditional and will return false if the condition fails.
 //
+// Any existing expiry on the key is discarded, unless the KeepTTL flag is given. A new expiry can
+// be set with the EX, PX, EXAT and PXAT options.
+//
+// As in Redis, SET replaces a key holding any type of value. With CheckTypes, SET on a key that holds
+// another type, such as a hash, list or stream, deletes the whole key first: every field, element or
+// entry, and its bookkeeping, in as many writes as that takes. Without type checks, the items of the
+// other type are left alone, next to the string.
+//
 // Works similar to https://redis.io/commands/set
-func (c Client) SET(key string, vValue interface{}, flags ...Flag) (ok bool, err error) {
+func (c Client) SET(key string, vValue interface{}, options ...SetOption) (ok bool, err error) {
+	c, finish := c.command("SET", []string{key}, vValue, options)
+	defer finish(&err)
+
 	value, err := ToValueE(vValue)
 	if err != nil {
 		return
 	}
+
+	opts := setOptions{}
+	for _, option := range options {
+		option.applySetOption(&opts)
+	}
+
+	// The chunks of a value stored with KeepTTL expire with it.
+	if opts.flags.has(KeepTTL) {
+		if c, err = c.inheritExpiry(key); err != nil {
+			return
+		}
+	}
+
+	ok, replaced, err := c.replaceType(key, TypeString, opts.flags)
+	if err != nil || !ok {
+		return
+	}
+
 	builder := newExpresionBuilder()
 
-	builder.updateSET(vk, value)
+	var expiry types.AttributeValue
+	if opts.expiresAt != nil {
+		expiry = expiryAV(*opts.expiresAt)
+	}
+
+	stored, chunks, err := c.storeAV(itemSlot(key, ""), value.ToAV(), expiry)
+	if err != nil {
+		return false, err
+	}
+
+	builder.updateSetAV(vk, stored)
+
+	switch {
+	case expiry != nil:
+		builder.updateSetExpiry(c.ttlAttribute, expiry)
+	case !opts.flags.has(KeepTTL):
+		builder.updateRemoveExpiry(c.ttlAttribute)
+	}
 
-	for _, flag := range flags {
+	for _, flag := range opts.flags {
 		if flag == IfNotExists {
 			builder.addConditionNotExists(c.partitionKey)
 		}
 
-		if flag == IfAlreadyExists {
+		if flag == IfAlreadyExists && !replaced {
 			builder.addConditionExists(c.partitionKey)
 		}
 	}
 
-	_, err = c.ddbClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+	old, err := c.updateValue(&dynamodb.UpdateItemInput{
 		ConditionExpression:       builder.conditionExpression(),
 		ExpressionAttributeNames:  builder.expressionAttributeNames(),
 		ExpressionAttributeValues: builder.expressionAttributeValues(),
@@ -63,22 +131,88 @@ func (c Client) SET(key string, vValue interface{}, flags ...Flag) (ok bool, err
 			sk: "",
 		}.toAV(c),
 		TableName: aws.String(c.tableName),
-	})
-	if conditionFailureError(err) {
-		return false, nil
+	}, chunks)
+	if errors.Is(err, ErrConditionFailed) {
+		return false, c.abandonAV(stored)
 	}
 
 	if err != nil {
 		return
 	}
 
-	return true, nil
+	return true, c.releaseAV(key, old[vk])
+}
+
+// SetOption is an option to SET: a Flag, or an expiry created with EX, PX, EXAT or PXAT.
+type SetOption interface {
+	applySetOption(opts *setOptions)
+}
+
+type setOptions struct {
+	flags     Flags
+	expiresAt *time.Time
+}
+
+func (f Flag) applySetOption(opts *setOptions) {
+	opts.flags = append(opts.flags, f)
+}
+
+type expiryOption time.Time
+
+func (e expiryOption) applySetOption(opts *setOptions) {
+	at := time.Time(e)
+	opts.expiresAt = &at
+}
+
+// EX makes SET expire the key after the given number of seconds.
+func EX(seconds int64) SetOption {
+	return expiryOption(time.Now().Add(time.Duration(seconds) * time.Second))
+}
+
+// PX makes SET expire the key after the given number of milliseconds.
+func PX(milliseconds int64) SetOption {
+	return expiryOption(time.Now().Add(time.Duration(milliseconds) * time.Millisecond))
+}
+
+// EXAT makes SET expire the key at the given Unix timestamp, in seconds.
+func EXAT(unixSeconds int64) SetOption {
+	return expiryOption(time.Unix(unixSeconds, 0))
+}
+
+// PXAT makes SET expire the key at the given Unix timestamp, in milliseconds.
+func PXAT(unixMilliseconds int64) SetOption {
+	return expiryOption(time.UnixMilli(unixMilliseconds))
+}
+
+// SETEX is equivalent to SET(key, value, EX(seconds))
+//
+// Works similar to https://redis.io/commands/setex
+func (c Client) SETEX(key string, seconds int64, value interface{}) (err error) {
+	c, finish := c.command("SETEX", []string{key}, seconds, value)
+	defer finish(&err)
+
+	_, err = c.SET(key, value, EX(seconds))
+	return
+}
+
+// PSETEX is equivalent to SET(key, value, PX(milliseconds))
+//
+// Works similar to https://redis.io/commands/psetex
+func (c Client) PSETEX(key string, milliseconds int64, value interface{}) (err error) {
+	c, finish := c.command("PSETEX", []string{key}, milliseconds, value)
+	defer finish(&err)
+
+	_, err = c.SET(key, value, PX(milliseconds))
+	return
 }
 
 // SETNX is equivalent to SET(key, value, Flags{IfNotExists})
 //
 // Works similar to https://redis.io/commands/setnx
 func (c Client) SETNX(key string, value Value) (ok bool, err error) {
+	c, finish := c.command("SETNX", []string{key}, value)
+	defer finish(&err)
+
 	return c.SET(key, value, IfNotExists)
 }
 
@@ -86,10 +220,23 @@ func (c Client) SETNX(key string, value Value) (ok bool, err error) {
 //
 // Works similar to https://redis.io/commands/getset
 func (c Client) GETSET(key string, value Value) (oldValue ReturnValue, err error) {
+	c, finish := c.command("GETSET", []string{key}, value)
+	defer finish(&err)
+
+	if err = c.claimType(key, TypeString); err != nil {
+		return
+	}
+
+	stored, chunks, err := c.storeAV(itemSlot(key, ""), value.ToAV(), nil)
+	if err != nil {
+		return
+	}
+
 	builder := newExpresionBuilder()
-	builder.updateSET(vk, value)
+	builder.updateSetAV(vk, stored)
+	builder.updateRemoveExpiry(c.ttlAttribute)
 
-	resp, err := c.ddbClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+	old, err := c.updateValue(&dynamodb.UpdateItemInput{
 		ConditionExpression:       builder.conditionExpression(),
 		ExpressionAttributeNames:  builder.expressionAttributeNames(),
 		ExpressionAttributeValues: builder.expressionAttributeValues(),
@@ -98,25 +245,45 @@ func (c Client) GETSET(key string, value Value) (oldValue ReturnValue, err error
 			pk: key,
 			sk: "",
 		}.toAV(c),
-		ReturnValues: types.ReturnValueAllOld,
-		TableName:    aws.String(c.tableName),
-	})
+		TableName: aws.String(c.tableName),
+	}, chunks)
+	if err != nil {
+		if abandonErr := c.abandonAV(stored); abandonErr != nil {
+			err = abandonErr
+		}
+
+		return
+	}
+
+	if len(old) == 0 {
+		return
+	}
 
-	if err != nil || len(resp.Attributes) == 0 {
+	if oldValue, err = c.loadValue(itemSlot(key, ""), parseItem(old, c).val); err != nil {
 		return
 	}
 
-	oldValue = parseItem(resp.Attributes, c).val
+	err = c.releaseAV(key, old[vk])
 
 	return
 }
 
-// MGET fetches the given keys atomically in a transaction. The call is limited to 25 keys and 4MB.
+// MGET fetches the given keys atomically in a transaction. The call is limited to 100 keys and 4MB, and
+// returns ErrTooManyActions for more keys.
 // See https://docs.aws.amazon.com/amazondynamodb/latest/APIReference/API_TransactGetItems.html
 //
+// Keys that do not hold a string are returned as empty values.
+//
 // Works similar to https://redis.io/commands/mget
 func (c Client) MGET(keys ...string) (values map[string]ReturnValue, err error) {
+	c, finish := c.command("MGET", keys)
+	defer finish(&err)
+
 	values = make(map[string]ReturnValue)
+	if len(keys) > maxTransactionActions {
+		return values, ErrTooManyActions
+	}
+
 	inputRequests := make([]types.TransactGetItem, len(keys))
 
 	for i, key := range keys {
@@ -126,13 +293,14 @@ func (c Client) MGET(keys ...string) (values map[string]ReturnValue, err error)
 					pk: key,
 					sk: "",
 				}.toAV(c),
-				ProjectionExpression: aws.String(strings.Join([]string{vk, c.partitionKey}, ", ")),
-				TableName:            aws.String(c.tableName),
+				ExpressionAttributeNames: map[string]string{"#" + expiryAttribute: expiryAttribute},
+				ProjectionExpression:     aws.String(strings.Join([]string{vk, c.partitionKey, "#" + expiryAttribute}, ", ")),
+				TableName:                aws.String(c.tableName),
 			},
 		}
 	}
 
-	resp, err := c.ddbClient.TransactGetItems(context.TODO(), &dynamodb.TransactGetItemsInput{
+	resp, err := c.ddb().TransactGetItems(c.ctx, &dynamodb.TransactGetItemsInput{
 		TransactItems: inputRequests,
 	})
 
@@ -140,19 +308,33 @@ func (c Client) MGET(keys ...string) (values map[string]ReturnValue, err error)
 		return
 	}
 
-	for _, item := range resp.Responses {
+	now := time.Now()
+
+	for i, item := range resp.Responses {
+		if len(item.Item) == 0 || c.expired(item.Item, now) {
+			values[keys[i]] = ReturnValue{}
+			continue
+		}
+
 		pi := parseItem(item.Item, c)
-		values[pi.pk] = pi.val
+		if values[pi.pk], err = c.loadValue(itemSlot(pi.pk, ""), pi.val); err != nil {
+			return
+		}
 	}
 
 	return
 }
 
-// MSET sets the given keys and values atomically in a transaction. The call is limited to 25 keys and 4MB.
+// MSET sets the given keys and values atomically in a transaction. The call is limited to 100 keys and 4MB,
+// and returns ErrTooManyActions for more keys, or for more items once the chunks of chunked values are
+// counted. The keys are read first, 1 RCU each, so that the values they replace are released.
 // See https://docs.aws.amazon.com/amazondynamodb/latest/APIReference/API_TransactWriteItems.html
 //
 // Works similar to https://redis.io/commands/mset
 func (c Client) MSET(vFieldMap interface{}) (err error) {
+	c, finish := c.command("MSET", nil, vFieldMap)
+	defer finish(&err)
+
 	fieldMap, err := ToValueMapE(vFieldMap)
 	if err != nil {
 		return err
@@ -166,6 +348,9 @@ func (c Client) MSET(vFieldMap interface{}) (err error) {
 //
 // Works similar to https://redis.io/commands/msetnx
 func (c Client) MSETNX(vFieldMap interface{}) (ok bool, err error) {
+	c, finish := c.command("MSETNX", nil, vFieldMap)
+	defer finish(&err)
+
 	fieldMap, err := ToValueMapE(vFieldMap)
 	if err != nil {
 		return ok, err
@@ -176,46 +361,107 @@ func (c Client) MSETNX(vFieldMap interface{}) (ok bool, err error) {
 }
 
 func (c Client) mset(data map[string]Value, flags Flags) (ok bool, err error) {
-	inputs := make([]types.TransactWriteItem, 0, len(data))
+	if len(data) > maxTransactionActions {
+		return false, ErrTooManyActions
+	}
+
+	for k := range data {
+		ok, _, err = c.replaceType(k, TypeString, flags)
+		if err != nil || !ok {
+			return
+		}
+	}
+
+	stored := make(map[string]types.AttributeValue, len(data))
+	keys := make([]keyDef, 0, len(data))
+	actions := 0
+
+	// Values that are stored but not written in the end are abandoned.
+	defer func() {
+		if err != nil || !ok {
+			if abandonErr := c.abandonAVs(stored); abandonErr != nil {
+				err = abandonErr
+			}
+		}
+	}()
+
+	var chunks []types.TransactWriteItem
 
 	for k, v := range data {
-		builder := newExpresionBuilder()
+		av, puts, err := c.storeAV(itemSlot(k, ""), v.ToAV(), nil)
+		if err != nil {
+			return false, err
+		}
 
-		if flags.has(IfNotExists) {
-			builder.addConditionNotExists(c.partitionKey)
+		stored[k] = av
+		chunks = append(chunks, puts...)
+		keys = append(keys, keyDef{pk: k, sk: ""})
+		actions += len(puts) + 1
+	}
+
+	if actions > c.transactionActions {
+		return false, ErrTooManyActions
+	}
+
+	// The keys are read first, so that the values the transaction replaces can be released after it,
+	// and read again if they change before it.
+	for {
+		old, err := c.getItems(keys, vk, expiryAttribute)
+		if err != nil {
+			return false, err
 		}
 
-		builder.updateSET(vk, v)
+		now := time.Now()
+		inputs := make([]types.TransactWriteItem, 0, actions)
+
+		for i, key := range keys {
+			if flags.has(IfNotExists) && len(old[i]) > 0 && !c.expired(old[i], now) {
+				return false, nil
+			}
+
+			builder := newExpresionBuilder()
+
+			if flags.has(IfNotExists) {
+				builder.addConditionNotExistsOrExpired(c.partitionKey, expiryAttribute, now)
+			}
+
+			builder.updateSetAV(vk, stored[key.pk])
+			builder.updateRemoveExpiry(c.ttlAttribute)
+			builder.addConditionValueUnchanged(old[i][vk])
+
+			inputs = append(inputs, types.TransactWriteItem{
+				Update: &types.Update{
+					ConditionExpression:       builder.conditionExpression(),
+					ExpressionAttributeNames:  builder.expressionAttributeNames(),
+					ExpressionAttributeValues: builder.expressionAttributeValues(),
+					Key:                       key.toAV(c),
+					TableName:                 aws.String(c.tableName),
+					UpdateExpression:          builder.updateExpression(),
+				},
+			})
+		}
 
-		inputs = append(inputs, types.TransactWriteItem{
-			Update: &types.Update{
-				ConditionExpression:       builder.conditionExpression(),
-				ExpressionAttributeNames:  builder.expressionAttributeNames(),
-				ExpressionAttributeValues: builder.expressionAttributeValues(),
-				Key: keyDef{
-					pk: k,
-					sk: "",
-				}.toAV(c),
-				TableName:        aws.String(c.tableName),
-				UpdateExpression: builder.updateExpression(),
-			},
+		_, err = c.ddb().TransactWriteItems(c.ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: append(inputs, chunks...),
 		})
-	}
+		if errors.Is(err, ErrConditionFailed) {
+			continue
+		}
 
-	_, err = c.ddbClient.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{
-		ClientRequestToken: nil,
-		TransactItems:      inputs,
-	})
+		if err != nil {
+			return false, err
+		}
 
-	if conditionFailureError(err) {
-		return false, nil
-	}
+		stored = nil
 
-	if err != nil {
-		return false, err
-	}
+		for i, key := range keys {
+			if err = c.releaseAV(key.pk, old[i][vk]); err != nil {
+				return true, err
+			}
+		}
 
-	return true, nil
+		return true, nil
+	}
 }
 
 // INCRBYFLOAT increments the number stored at the key with the given float64 delta (n = n + delta) and returns
@@ -228,10 +474,13 @@ func (c Client) mset(data map[string]Value, flags Flags) (ok bool, err error) {
 // the operation will throw an error. If the existing value is numeric, the operation
 // can continue irrespective of how it was initially set.
 //
-// Cost is O(1) or 1 WCU.
+// Cost is O(1) or 1 WCU, plus the type check of the key.
 //
 // Works similar to https://redis.io/commands/incrbyfloat
 func (c Client) INCRBYFLOAT(key string, delta float64) (after float64, err error) {
+	c, finish := c.command("INCRBYFLOAT", []string{key}, delta)
+	defer finish(&err)
+
 	rv, err := c.incr(key, FloatValue{delta})
 	if err == nil {
 		after = rv.Float()
@@ -241,9 +490,13 @@ func (c Client) INCRBYFLOAT(key string, delta float64) (after float64, err error
 }
 
 func (c Client) incr(key string, value Value) (newValue ReturnValue, err error) {
+	if err = c.claimType(key, TypeString); err != nil {
+		return
+	}
+
 	builder := newExpresionBuilder()
 	builder.keys[vk] = struct{}{}
-	resp, err := c.ddbClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+	resp, err := c.updateItem(&dynamodb.UpdateItemInput{
 		ExpressionAttributeNames: builder.expressionAttributeNames(),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":delta": value.ToAV(),
@@ -268,10 +521,13 @@ func (c Client) incr(key string, value Value) (newValue ReturnValue, err error)
 // the operation will throw an error. If the existing value is numeric, the operation
 // can continue irrespective of how it was initially set.
 //
-// Cost is O(1) or 1 WCU.
+// Cost is O(1) or 1 WCU, plus the type check of the key.
 //
 // Works similar to https://redis.io/commands/incr
 func (c Client) INCR(key string) (after int64, err error) {
+	c, finish := c.command("INCR", []string{key})
+	defer finish(&err)
+
 	return c.INCRBY(key, 1)
 }
 
@@ -282,10 +538,13 @@ func (c Client) INCR(key string) (after int64, err error) {
 // the operation will throw an error. If the existing value is numeric, the operation
 // can continue irrespective of how it was initially set.
 //
-// Cost is O(1) or 1 WCU.
+// Cost is O(1) or 1 WCU, plus the type check of the key.
 //
 // Works similar to https://redis.io/commands/decr
 func (c Client) DECR(key string) (after int64, err error) {
+	c, finish := c.command("DECR", []string{key})
+	defer finish(&err)
+
 	return c.INCRBY(key, -1)
 }
 
@@ -296,10 +555,13 @@ func (c Client) DECR(key string) (after int64, err error) {
 // the operation will throw an error. If the existing value is numeric, the operation
 // can continue irrespective of how it was initially set.
 //
-// Cost is O(1) or 1 WCU.
+// Cost is O(1) or 1 WCU, plus the type check of the key.
 //
 // Works similar to https://redis.io/commands/incrby
 func (c Client) INCRBY(key string, delta int64) (after int64, err error) {
+	c, finish := c.command("INCRBY", []string{key}, delta)
+	defer finish(&err)
+
 	rv, err := c.incr(key, IntValue{delta})
 	if err == nil {
 		after = rv.Int()
@@ -315,9 +577,12 @@ func (c Client) INCRBY(key string, delta int64) (after int64, err error) {
 // the operation will throw an error. If the existing value is numeric, the operation
 // can continue irrespective of how it was initially set.
 //
-// Cost is O(1) or 1 WCU.
+// Cost is O(1) or 1 WCU, plus the type check of the key.
 //
 // Works similar to https://redis.io/commands/decrby
 func (c Client) DECRBY(key string, delta int64) (after int64, err error) {
+	c, finish := c.command("DECRBY", []string{key}, delta)
+	defer finish(&err)
+
 	return c.INCRBY(key, -delta)
 }
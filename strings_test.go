@@ -2,6 +2,7 @@ package redimo
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -141,3 +142,78 @@ func TestAtomicOps(t *testing.T) {
 	assert.Equal(t, "v5", values["k5"].String())
 	assert.Equal(t, "v6", values["k6"].String())
 }
+
+func TestSETExpiry(t *testing.T) {
+	c := newClient(t)
+
+	ok, err := c.SET("session", StringValue{"abc"}, EX(60))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ttl, err := c.TTL("session")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 60, ttl)
+
+	ok, err = c.SET("session", StringValue{"def"}, KeepTTL)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ttl, err = c.TTL("session")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 60, ttl)
+
+	ok, err = c.SET("session", StringValue{"ghi"})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ttl, err = c.TTL("session")
+	assert.NoError(t, err)
+	assert.EqualValues(t, -1, ttl)
+
+	err = c.PSETEX("flash", 20, StringValue{"gone soon"})
+	assert.NoError(t, err)
+
+	val, err := c.GET("flash")
+	assert.NoError(t, err)
+	assert.Equal(t, "gone soon", val.String())
+
+	time.Sleep(30 * time.Millisecond)
+
+	val, err = c.GET("flash")
+	assert.NoError(t, err)
+	assert.False(t, val.Present())
+
+	values, err := c.MGET("flash", "session")
+	assert.NoError(t, err)
+	assert.False(t, values["flash"].Present())
+	assert.Equal(t, "ghi", values["session"].String())
+
+	ok, err = c.SET("flash", StringValue{"again"}, IfAlreadyExists)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = c.SETNX("flash", StringValue{"again"})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ttl, err = c.TTL("flash")
+	assert.NoError(t, err)
+	assert.EqualValues(t, -1, ttl)
+
+	ok, err = c.SET("counter", IntValue{10}, PXAT(time.Now().Add(20*time.Millisecond).UnixMilli()))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	time.Sleep(30 * time.Millisecond)
+
+	n, err := c.INCR("counter")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, n)
+
+	err = c.SETEX("old", -1, StringValue{"never visible"})
+	assert.NoError(t, err)
+
+	ttl, err = c.TTL("old")
+	assert.NoError(t, err)
+	assert.EqualValues(t, -2, ttl)
+}
@@ -0,0 +1,508 @@
+package redimo
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	valueType       = reflect.TypeOf((*Value)(nil)).Elem()
+	returnValueType = reflect.TypeOf(ReturnValue{})
+)
+
+// FieldTypeError is returned when a stored value can't be decoded into the Go type of a struct field.
+type FieldTypeError struct {
+	// Field is the name of the hash field.
+	Field string
+
+	// Stored is the DynamoDB type the value is stored as, such as S, N or B.
+	Stored string
+
+	// Type is the Go type the value couldn't be decoded into.
+	Type reflect.Type
+
+	// Err is the reason, if there is more to it than the types.
+	Err error
+}
+
+func (e *FieldTypeError) Error() string {
+	msg := fmt.Sprintf("redimo: cannot decode field %q stored as %v into %v", e.Field, e.Stored, e.Type)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+
+	return msg
+}
+
+func (e *FieldTypeError) Unwrap() error {
+	return e.Err
+}
+
+// HSetStruct is like HSET, with the fields of the struct v, or a pointer to one, as the hash fields.
+// See MarshalStruct for how struct fields are stored.
+func (c Client) HSetStruct(key string, v interface{}) (newlySavedFields map[string]Value, err error) {
+	fieldMap, err := MarshalStruct(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.HSET(key, fieldMap)
+}
+
+// HGetAllInto reads the hash with HGETALL into the struct dest points to. See UnmarshalStruct for how
+// hash fields are decoded.
+func (c Client) HGetAllInto(key string, dest interface{}) error {
+	if _, err := structValue(dest); err != nil {
+		return err
+	}
+
+	fieldValues, err := c.HGETALL(key)
+	if err != nil {
+		return err
+	}
+
+	return UnmarshalStruct(fieldValues, dest)
+}
+
+// HMGetInto reads the given fields of the hash with HMGET into the struct dest points to, or all the
+// fields the struct has if none are given. See UnmarshalStruct for how hash fields are decoded.
+func (c Client) HMGetInto(key string, dest interface{}, fields ...string) error {
+	rv, err := structValue(dest)
+	if err != nil {
+		return err
+	}
+
+	if len(fields) == 0 {
+		for _, f := range structFields(rv.Type()) {
+			fields = append(fields, f.name)
+		}
+	}
+
+	fieldValues, err := c.HMGET(key, fields...)
+	if err != nil {
+		return err
+	}
+
+	return UnmarshalStruct(fieldValues, dest)
+}
+
+// MarshalStruct returns the hash fields of the struct v, or a pointer to one. Each exported field is
+// stored under its name, or under the name given by a `redimo:"name"` tag. A tag of "-" skips the
+// field, and the omitempty option skips it when it has its zero value. Nil pointers are always
+// skipped. Fields of embedded structs are stored as if they were fields of the outer struct.
+//
+// Strings are stored as strings, byte slices as bytes, integers and floats as numbers, and bools as
+// bools. A time.Time is stored as a string in RFC 3339 format with nanoseconds. Other slices and
+// arrays are stored as lists, and maps with string keys and other structs as maps, with their elements
+// stored the same way. Fields that implement Value are stored as the attribute value they return.
+func MarshalStruct(v interface{}) (map[string]Value, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("redimo: MarshalStruct needs a struct, got %T", v)
+	}
+
+	fieldMap := make(map[string]Value)
+
+	for _, f := range structFields(rv.Type()) {
+		fv := rv.FieldByIndex(f.index)
+
+		if (f.omitEmpty && fv.IsZero()) || (fv.Kind() == reflect.Ptr && fv.IsNil()) {
+			continue
+		}
+
+		av, err := marshalAV(fv)
+		if err != nil {
+			return nil, fmt.Errorf("redimo: cannot encode field %q: %w", f.name, err)
+		}
+
+		fieldMap[f.name] = ReturnValue{av}
+	}
+
+	return fieldMap, nil
+}
+
+// UnmarshalStruct decodes hash fields, such as those returned by HGETALL or HMGET, into the struct dest
+// points to, the reverse of MarshalStruct. Fields that are missing or empty leave the struct field as it
+// was, and fields the struct doesn't have are ignored. Numbers and bools can also be decoded from
+// strings, and bools from numbers, with 1 as true, so hashes written by hand with string values, or by
+// earlier versions that stored bools as numbers, can be read. A value that can't be decoded
+// into its struct field is reported as a *FieldTypeError.
+func UnmarshalStruct(fieldValues map[string]ReturnValue, dest interface{}) error {
+	rv, err := structValue(dest)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range structFields(rv.Type()) {
+		val, ok := fieldValues[f.name]
+		if !ok || val.Empty() {
+			continue
+		}
+
+		if err := unmarshalAV(val.av, fieldByIndex(rv, f.index)); err != nil {
+			if fte, ok := err.(*FieldTypeError); ok {
+				fte.Field = strings.TrimSuffix(f.name+"."+fte.Field, ".")
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// structValue returns the struct that dest, a non-nil pointer to a struct, points to.
+func structValue(dest interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("redimo: need a non-nil pointer to a struct, got %T", dest)
+	}
+
+	return rv.Elem(), nil
+}
+
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// structFields returns the fields of the struct type that are stored, including those of embedded
+// structs.
+func structFields(t reflect.Type) (fields []structField) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		tag := sf.Tag.Get("redimo")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if comma := strings.Index(tag, ","); comma >= 0 {
+			name, opts = tag[:comma], tag[comma+1:]
+		}
+
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct && sf.Type != timeType {
+			for _, f := range structFields(sf.Type) {
+				f.index = append([]int{i}, f.index...)
+				fields = append(fields, f)
+			}
+
+			continue
+		}
+
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		fields = append(fields, structField{
+			name:      name,
+			index:     []int{i},
+			omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+		})
+	}
+
+	return fields
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex, for embedded structs that aren't pointers.
+func fieldByIndex(rv reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		rv = rv.Field(i)
+	}
+
+	return rv
+}
+
+func marshalAV(rv reflect.Value) (types.AttributeValue, error) {
+	if rv.Type().Implements(valueType) {
+		if rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return &types.AttributeValueMemberNULL{Value: true}, nil
+		}
+
+		if av := rv.Interface().(Value).ToAV(); av != nil {
+			return av, nil
+		}
+
+		return &types.AttributeValueMemberNULL{Value: true}, nil
+	}
+
+	if rv.Type() == timeType {
+		return StringValue{rv.Interface().(time.Time).Format(time.RFC3339Nano)}.ToAV(), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		return StringValue{rv.String()}.ToAV(), nil
+	case reflect.Bool:
+		return &types.AttributeValueMemberBOOL{Value: rv.Bool()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return IntValue{rv.Int()}.ToAV(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &types.AttributeValueMemberN{Value: strconv.FormatUint(rv.Uint(), 10)}, nil
+	case reflect.Float32, reflect.Float64:
+		return FloatValue{rv.Float()}.ToAV(), nil
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return &types.AttributeValueMemberNULL{Value: true}, nil
+		}
+
+		return marshalAV(rv.Elem())
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(data), rv)
+
+			return BytesValue{data}.ToAV(), nil
+		}
+
+		list := make([]types.AttributeValue, rv.Len())
+
+		for i := range list {
+			av, err := marshalAV(rv.Index(i))
+			if err != nil {
+				return nil, err
+			}
+
+			list[i] = av
+		}
+
+		return &types.AttributeValueMemberL{Value: list}, nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %v", rv.Type().Key())
+		}
+
+		m := make(map[string]types.AttributeValue, rv.Len())
+
+		iter := rv.MapRange()
+		for iter.Next() {
+			av, err := marshalAV(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+
+			m[iter.Key().String()] = av
+		}
+
+		return &types.AttributeValueMemberM{Value: m}, nil
+	case reflect.Struct:
+		fieldMap, err := MarshalStruct(rv.Interface())
+		if err != nil {
+			return nil, err
+		}
+
+		m := make(map[string]types.AttributeValue, len(fieldMap))
+		for name, v := range fieldMap {
+			m[name] = v.ToAV()
+		}
+
+		return &types.AttributeValueMemberM{Value: m}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %v", rv.Type())
+}
+
+// numberString returns the text of a number, from a number or a string attribute value.
+func numberString(av types.AttributeValue) (string, bool) {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberN:
+		return v.Value, true
+	case *types.AttributeValueMemberS:
+		return strings.TrimSpace(v.Value), true
+	}
+
+	return "", false
+}
+
+func unmarshalAV(av types.AttributeValue, rv reflect.Value) error {
+	mismatch := func(err error) error {
+		return &FieldTypeError{Stored: string(ReturnValue{av}.Type()), Type: rv.Type(), Err: err}
+	}
+
+	if _, ok := av.(*types.AttributeValueMemberNULL); ok {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+
+	switch rv.Type() {
+	case returnValueType:
+		rv.Set(reflect.ValueOf(ReturnValue{av}))
+		return nil
+	case reflect.TypeOf(StringValue{}), reflect.TypeOf(BytesValue{}), reflect.TypeOf(IntValue{}), reflect.TypeOf(FloatValue{}):
+		return unmarshalAV(av, rv.Field(0))
+	}
+
+	if rv.Type() == timeType {
+		s, ok := av.(*types.AttributeValueMemberS)
+		if !ok {
+			return mismatch(nil)
+		}
+
+		t, err := time.Parse(time.RFC3339Nano, s.Value)
+		if err != nil {
+			return mismatch(err)
+		}
+
+		rv.Set(reflect.ValueOf(t))
+
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		s, ok := av.(*types.AttributeValueMemberS)
+		if !ok {
+			return mismatch(nil)
+		}
+
+		rv.SetString(s.Value)
+	case reflect.Bool:
+		if b, ok := av.(*types.AttributeValueMemberBOOL); ok {
+			rv.SetBool(b.Value)
+			return nil
+		}
+
+		text, ok := numberString(av)
+		if !ok {
+			return mismatch(nil)
+		}
+
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return mismatch(err)
+		}
+
+		rv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		text, ok := numberString(av)
+		if !ok {
+			return mismatch(nil)
+		}
+
+		i, err := strconv.ParseInt(text, 10, rv.Type().Bits())
+		if err != nil {
+			return mismatch(err)
+		}
+
+		rv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		text, ok := numberString(av)
+		if !ok {
+			return mismatch(nil)
+		}
+
+		u, err := strconv.ParseUint(text, 10, rv.Type().Bits())
+		if err != nil {
+			return mismatch(err)
+		}
+
+		rv.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		text, ok := numberString(av)
+		if !ok {
+			return mismatch(nil)
+		}
+
+		f, err := strconv.ParseFloat(text, rv.Type().Bits())
+		if err != nil {
+			return mismatch(err)
+		}
+
+		rv.SetFloat(f)
+	case reflect.Ptr:
+		elem := reflect.New(rv.Type().Elem())
+		if err := unmarshalAV(av, elem.Elem()); err != nil {
+			return err
+		}
+
+		rv.Set(elem)
+	case reflect.Interface:
+		if rv.NumMethod() > 0 {
+			return mismatch(nil)
+		}
+
+		rv.Set(reflect.ValueOf(ReturnValue{av}.Interface()))
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b, ok := av.(*types.AttributeValueMemberB)
+			if !ok {
+				return mismatch(nil)
+			}
+
+			if rv.Kind() == reflect.Slice {
+				rv.Set(reflect.MakeSlice(rv.Type(), len(b.Value), len(b.Value)))
+			} else if len(b.Value) != rv.Len() {
+				return mismatch(fmt.Errorf("%v bytes don't fit an array of %v", len(b.Value), rv.Len()))
+			}
+
+			reflect.Copy(rv, reflect.ValueOf(b.Value))
+
+			return nil
+		}
+
+		l, ok := av.(*types.AttributeValueMemberL)
+		if !ok {
+			return mismatch(nil)
+		}
+
+		if rv.Kind() == reflect.Slice {
+			rv.Set(reflect.MakeSlice(rv.Type(), len(l.Value), len(l.Value)))
+		} else if len(l.Value) != rv.Len() {
+			return mismatch(fmt.Errorf("%v elements don't fit an array of %v", len(l.Value), rv.Len()))
+		}
+
+		for i, elem := range l.Value {
+			if err := unmarshalAV(elem, rv.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		m, ok := av.(*types.AttributeValueMemberM)
+		if !ok || rv.Type().Key().Kind() != reflect.String {
+			return mismatch(nil)
+		}
+
+		rv.Set(reflect.MakeMapWithSize(rv.Type(), len(m.Value)))
+
+		for k, elemAV := range m.Value {
+			elem := reflect.New(rv.Type().Elem()).Elem()
+			if err := unmarshalAV(elemAV, elem); err != nil {
+				return err
+			}
+
+			rv.SetMapIndex(reflect.ValueOf(k).Convert(rv.Type().Key()), elem)
+		}
+	case reflect.Struct:
+		m, ok := av.(*types.AttributeValueMemberM)
+		if !ok {
+			return mismatch(nil)
+		}
+
+		fieldValues := make(map[string]ReturnValue, len(m.Value))
+		for k, v := range m.Value {
+			fieldValues[k] = ReturnValue{v}
+		}
+
+		return UnmarshalStruct(fieldValues, rv.Addr().Interface())
+	default:
+		return mismatch(nil)
+	}
+
+	return nil
+}
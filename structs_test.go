@@ -0,0 +1,161 @@
+package redimo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type structAudit struct {
+	CreatedAt time.Time  `redimo:"created_at"`
+	UpdatedAt *time.Time `redimo:"updated_at"`
+}
+
+type structAddress struct {
+	City string
+	Zip  string `redimo:"zip,omitempty"`
+}
+
+type structUser struct {
+	structAudit
+	Name     string            `redimo:"name"`
+	Age      int               `redimo:"age"`
+	Score    float64           `redimo:"score,omitempty"`
+	Admin    bool              `redimo:"admin"`
+	Avatar   []byte            `redimo:"avatar,omitempty"`
+	Tags     []string          `redimo:"tags"`
+	Logins   []time.Time       `redimo:"logins,omitempty"`
+	Address  structAddress     `redimo:"address"`
+	Labels   map[string]int    `redimo:"labels,omitempty"`
+	Raw      ReturnValue       `redimo:"raw,omitempty"`
+	Password string            `redimo:"-"`
+	Nickname *string           `redimo:"nickname"`
+	Extra    map[string]string `redimo:",omitempty"`
+	internal string
+}
+
+func TestMarshalStruct(t *testing.T) {
+	created := time.Date(2020, 5, 1, 10, 30, 0, 123, time.UTC)
+
+	fields, err := MarshalStruct(structUser{
+		structAudit: structAudit{CreatedAt: created},
+		Name:        "ada",
+		Age:         36,
+		Admin:       true,
+		Tags:        []string{"a", "b"},
+		Password:    "secret",
+		internal:    "internal",
+	})
+	assert.NoError(t, err)
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+
+	assert.ElementsMatch(t, []string{"created_at", "name", "age", "admin", "tags", "address"}, names)
+	assert.Equal(t, "2020-05-01T10:30:00.000000123Z", fields["created_at"].(ReturnValue).String())
+	assert.Equal(t, int64(36), fields["age"].(ReturnValue).Int())
+	assert.Equal(t, ValueBool, fields["admin"].(ReturnValue).Type())
+	assert.True(t, fields["admin"].(ReturnValue).Bool())
+
+	_, err = MarshalStruct("not a struct")
+	assert.Error(t, err)
+
+	_, err = MarshalStruct(struct{ Ch chan int }{})
+	assert.Error(t, err)
+}
+
+func TestHashStructs(t *testing.T) {
+	c := newClient(t)
+
+	updated := time.Date(2021, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+	nickname := "ace"
+
+	user := structUser{
+		structAudit: structAudit{CreatedAt: time.Date(2020, 5, 1, 10, 30, 0, 123, time.UTC), UpdatedAt: &updated},
+		Name:        "ada",
+		Age:         36,
+		Score:       99.5,
+		Admin:       true,
+		Avatar:      []byte{1, 2, 3},
+		Tags:        []string{"math", "engines"},
+		Logins:      []time.Time{updated},
+		Address:     structAddress{City: "London"},
+		Labels:      map[string]int{"level": 3},
+		Nickname:    &nickname,
+		Extra:       map[string]string{"k": "v"},
+	}
+
+	saved, err := c.HSetStruct("user", &user)
+	assert.NoError(t, err)
+	assert.Len(t, saved, 13)
+
+	var got structUser
+	assert.NoError(t, c.HGetAllInto("user", &got))
+	assert.True(t, user.CreatedAt.Equal(got.CreatedAt))
+	assert.True(t, updated.Equal(*got.UpdatedAt))
+	assert.Equal(t, user.Name, got.Name)
+	assert.Equal(t, user.Age, got.Age)
+	assert.Equal(t, user.Score, got.Score)
+	assert.Equal(t, user.Admin, got.Admin)
+	assert.Equal(t, user.Avatar, got.Avatar)
+	assert.Equal(t, user.Tags, got.Tags)
+	assert.True(t, updated.Equal(got.Logins[0]))
+	assert.Equal(t, user.Address, got.Address)
+	assert.Equal(t, user.Labels, got.Labels)
+	assert.Equal(t, "ace", *got.Nickname)
+	assert.Equal(t, user.Extra, got.Extra)
+
+	var partial structUser
+	assert.NoError(t, c.HMGetInto("user", &partial, "name", "age"))
+	assert.Equal(t, structUser{Name: "ada", Age: 36}, partial)
+
+	partial = structUser{}
+	assert.NoError(t, c.HMGetInto("user", &partial))
+	assert.Equal(t, "London", partial.Address.City)
+
+	// Hashes written by hand with strings can be read too.
+	_, err = c.HSET("manual", map[string]string{"name": "bob", "age": "41", "admin": "true"})
+	assert.NoError(t, err)
+
+	got = structUser{}
+	assert.NoError(t, c.HGetAllInto("manual", &got))
+	assert.Equal(t, structUser{Name: "bob", Age: 41, Admin: true}, got)
+
+	// So can bools stored as numbers.
+	_, err = c.HSET("manual", map[string]Value{"admin": IntValue{0}})
+	assert.NoError(t, err)
+
+	assert.NoError(t, c.HGetAllInto("manual", &got))
+	assert.False(t, got.Admin)
+
+	_, err = c.HSET("manual", map[string]string{"age": "old"})
+	assert.NoError(t, err)
+
+	err = c.HGetAllInto("manual", &got)
+
+	var fte *FieldTypeError
+	assert.True(t, errors.As(err, &fte))
+	assert.Equal(t, "age", fte.Field)
+	assert.Equal(t, "S", fte.Stored)
+
+	_, err = c.HSET("manual", map[string]interface{}{"age": 1, "address": "London"})
+	assert.NoError(t, err)
+
+	err = c.HGetAllInto("manual", &got)
+	assert.True(t, errors.As(err, &fte))
+	assert.Equal(t, "address", fte.Field)
+	assert.Equal(t, "redimo: cannot decode field \"address\" stored as S into redimo.structAddress", err.Error())
+
+	_, err = c.HSET("manual", map[string]interface{}{"address": map[string]interface{}{"City": "Paris"}})
+	assert.NoError(t, err)
+
+	got = structUser{}
+	assert.NoError(t, c.HGetAllInto("manual", &got))
+	assert.Equal(t, "Paris", got.Address.City)
+
+	assert.Error(t, c.HGetAllInto("manual", got))
+}
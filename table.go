@@ -0,0 +1,461 @@
+package redimo
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// defaultPollInterval is how often the table is described while waiting for it to change.
+const defaultPollInterval = 2 * time.Second
+
+// TableSpec describes the table EnsureTable creates or updates. The key schema and local secondary
+// index are always those the client is configured with.
+type TableSpec struct {
+	// ReadCapacity and WriteCapacity are the provisioned throughput of the table. The table is billed per
+	// request when both are zero.
+	ReadCapacity  int64
+	WriteCapacity int64
+
+	// GlobalSecondaryIndexes are additional indexes, and AttributeDefinitions the definitions of their key
+	// attributes. Indexes missing from an existing table are added one at a time; indexes the spec does
+	// not mention are left alone.
+	GlobalSecondaryIndexes []types.GlobalSecondaryIndex
+	AttributeDefinitions   []types.AttributeDefinition
+
+	// StreamViewType enables DynamoDB Streams with the given view type, if set. An existing stream with
+	// another view type is not replaced, and EnsureTable fails instead.
+	StreamViewType types.StreamViewType
+
+	// PointInTimeRecovery enables continuous backups.
+	PointInTimeRecovery bool
+
+	// Encryption enables server-side encryption with a KMS key: KMSKeyID if set, or the AWS managed key
+	// for DynamoDB. Without it, tables are encrypted with a key owned by AWS.
+	Encryption bool
+	KMSKeyID   string
+
+	// Tags are added to the table. Tags the spec does not mention are left alone.
+	Tags map[string]string
+
+	// PollInterval is how often the table is checked while waiting for it to become ACTIVE. The default
+	// is two seconds.
+	PollInterval time.Duration
+}
+
+func (spec TableSpec) billingMode() types.BillingMode {
+	if spec.ReadCapacity == 0 && spec.WriteCapacity == 0 {
+		return types.BillingModePayPerRequest
+	}
+
+	return types.BillingModeProvisioned
+}
+
+func (spec TableSpec) throughput() *types.ProvisionedThroughput {
+	if spec.billingMode() == types.BillingModePayPerRequest {
+		return nil
+	}
+
+	return &types.ProvisionedThroughput{
+		ReadCapacityUnits:  aws.Int64(spec.ReadCapacity),
+		WriteCapacityUnits: aws.Int64(spec.WriteCapacity),
+	}
+}
+
+func (spec TableSpec) sse() *types.SSESpecification {
+	if !spec.Encryption {
+		return nil
+	}
+
+	sse := &types.SSESpecification{Enabled: aws.Bool(true), SSEType: types.SSETypeKms}
+	if spec.KMSKeyID != "" {
+		sse.KMSMasterKeyId = aws.String(spec.KMSKeyID)
+	}
+
+	return sse
+}
+
+func (spec TableSpec) pollInterval() time.Duration {
+	if spec.PollInterval <= 0 {
+		return defaultPollInterval
+	}
+
+	return spec.PollInterval
+}
+
+// EnsureTable makes the client's table match the spec, creating it if it does not exist, and waits
+// until it is ACTIVE. On an existing table it changes the billing mode or throughput, adds missing
+// global secondary indexes, and enables streams, encryption, point in time recovery and tags as the spec
+// asks, but never disables or removes anything. Either way it enables expiry on the client's
+// TTLAttribute. It is safe to call every time an application starts.
+//
+// Waiting is bounded by the client's context, not by a timeout of its own.
+func (c Client) EnsureTable(spec TableSpec) error {
+	desc, err := c.describeTable()
+
+	var notFound *types.ResourceNotFoundException
+
+	switch {
+	case errors.As(err, &notFound):
+		desc, err = c.createTable(spec)
+	case err == nil:
+		desc, err = c.updateTable(desc, spec)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err = c.ensureTTL(); err != nil {
+		return err
+	}
+
+	if spec.PointInTimeRecovery {
+		if err = c.ensurePointInTimeRecovery(); err != nil {
+			return err
+		}
+	}
+
+	return c.ensureTags(desc, spec.Tags)
+}
+
+// DeleteTable deletes the client's table with all its items, and waits until it is gone. It does
+// nothing if the table does not exist.
+func (c Client) DeleteTable() error {
+	_, err := c.ddb().DeleteTable(c.ctx, &dynamodb.DeleteTableInput{TableName: aws.String(c.tableName)})
+
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("couldn't delete table %v. Here's why: %w", c.tableName, err)
+	}
+
+	for {
+		if _, err = c.describeTable(); errors.As(err, &notFound) {
+			return nil
+		}
+
+		if err == nil {
+			err = c.sleep(defaultPollInterval)
+		}
+
+		if err != nil {
+			return fmt.Errorf("couldn't delete table %v. Here's why: %w", c.tableName, err)
+		}
+	}
+}
+
+func (c Client) describeTable() (*types.TableDescription, error) {
+	resp, err := c.ddb().DescribeTable(c.ctx, &dynamodb.DescribeTableInput{TableName: aws.String(c.tableName)})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Table, nil
+}
+
+// sleep waits for the duration, or until the client's context is done.
+func (c Client) sleep(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+}
+
+// waitForTable waits until the table and all its global secondary indexes are ACTIVE.
+func (c Client) waitForTable(interval time.Duration) (*types.TableDescription, error) {
+	for {
+		desc, err := c.describeTable()
+		if err != nil {
+			return nil, err
+		}
+
+		if tableActive(desc) {
+			return desc, nil
+		}
+
+		if err = c.sleep(interval); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func tableActive(desc *types.TableDescription) bool {
+	if desc.TableStatus != types.TableStatusActive {
+		return false
+	}
+
+	for _, gsi := range desc.GlobalSecondaryIndexes {
+		if gsi.IndexStatus != types.IndexStatusActive || aws.ToBool(gsi.Backfilling) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c Client) createTableInput(spec TableSpec) *dynamodb.CreateTableInput {
+	attributes := []types.AttributeDefinition{
+		{AttributeName: aws.String(c.partitionKey), AttributeType: "S"},
+		{AttributeName: aws.String(c.sortKey), AttributeType: "S"},
+		{AttributeName: aws.String(c.sortKeyNum), AttributeType: "N"},
+	}
+
+	input := &dynamodb.CreateTableInput{
+		AttributeDefinitions:   mergeAttributeDefinitions(attributes, spec.AttributeDefinitions),
+		BillingMode:            spec.billingMode(),
+		GlobalSecondaryIndexes: spec.GlobalSecondaryIndexes,
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String(c.partitionKey), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String(c.sortKey), KeyType: types.KeyTypeRange},
+		},
+		LocalSecondaryIndexes: []types.LocalSecondaryIndex{
+			{
+				IndexName: aws.String(c.indexName),
+				KeySchema: []types.KeySchemaElement{
+					{AttributeName: aws.String(c.partitionKey), KeyType: types.KeyTypeHash},
+					{AttributeName: aws.String(c.sortKeyNum), KeyType: types.KeyTypeRange},
+				},
+				Projection: &types.Projection{
+					NonKeyAttributes: nil,
+					ProjectionType:   types.ProjectionTypeKeysOnly,
+				},
+			},
+		},
+		ProvisionedThroughput: spec.throughput(),
+		SSESpecification:      spec.sse(),
+		TableName:             aws.String(c.tableName),
+	}
+
+	if spec.StreamViewType != "" {
+		input.StreamSpecification = &types.StreamSpecification{StreamEnabled: aws.Bool(true), StreamViewType: spec.StreamViewType}
+	}
+
+	for key, value := range spec.Tags {
+		input.Tags = append(input.Tags, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+
+	return input
+}
+
+func mergeAttributeDefinitions(definitions []types.AttributeDefinition, more []types.AttributeDefinition) []types.AttributeDefinition {
+	defined := make(map[string]struct{})
+	for _, def := range definitions {
+		defined[aws.ToString(def.AttributeName)] = struct{}{}
+	}
+
+	for _, def := range more {
+		if _, ok := defined[aws.ToString(def.AttributeName)]; !ok {
+			defined[aws.ToString(def.AttributeName)] = struct{}{}
+			definitions = append(definitions, def)
+		}
+	}
+
+	return definitions
+}
+
+// createTable creates the table and waits until it is ACTIVE.
+func (c Client) createTable(spec TableSpec) (*types.TableDescription, error) {
+	_, err := c.ddb().CreateTable(c.ctx, c.createTableInput(spec))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create table %v. Here's why: %w", c.tableName, err)
+	}
+
+	desc, err := c.waitForTable(spec.pollInterval())
+	if err != nil {
+		return nil, fmt.Errorf("couldn't wait for table %v to become active. Here's why: %w", c.tableName, err)
+	}
+
+	return desc, nil
+}
+
+// updateTable applies the changes the spec asks for to the existing table one at a time, as DynamoDB
+// requires, waiting until the table is ACTIVE before each.
+func (c Client) updateTable(desc *types.TableDescription, spec TableSpec) (*types.TableDescription, error) {
+	var updates []*dynamodb.UpdateTableInput
+
+	billing := types.BillingModeProvisioned
+	if desc.BillingModeSummary != nil && desc.BillingModeSummary.BillingMode != "" {
+		billing = desc.BillingModeSummary.BillingMode
+	}
+
+	throughputChanged := spec.billingMode() == types.BillingModeProvisioned && desc.ProvisionedThroughput != nil &&
+		(aws.ToInt64(desc.ProvisionedThroughput.ReadCapacityUnits) != spec.ReadCapacity ||
+			aws.ToInt64(desc.ProvisionedThroughput.WriteCapacityUnits) != spec.WriteCapacity)
+
+	if billing != spec.billingMode() || throughputChanged {
+		updates = append(updates, &dynamodb.UpdateTableInput{BillingMode: spec.billingMode(), ProvisionedThroughput: spec.throughput()})
+	}
+
+	existing := make(map[string]struct{})
+	for _, gsi := range desc.GlobalSecondaryIndexes {
+		existing[aws.ToString(gsi.IndexName)] = struct{}{}
+	}
+
+	for i := range spec.GlobalSecondaryIndexes {
+		gsi := spec.GlobalSecondaryIndexes[i]
+		if _, ok := existing[aws.ToString(gsi.IndexName)]; ok {
+			continue
+		}
+
+		updates = append(updates, &dynamodb.UpdateTableInput{
+			AttributeDefinitions:        spec.AttributeDefinitions,
+			GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{{Create: &types.CreateGlobalSecondaryIndexAction{IndexName: gsi.IndexName, KeySchema: gsi.KeySchema, Projection: gsi.Projection, ProvisionedThroughput: gsi.ProvisionedThroughput}}},
+		})
+	}
+
+	if spec.StreamViewType != "" {
+		stream := desc.StreamSpecification
+
+		switch {
+		case stream == nil || !aws.ToBool(stream.StreamEnabled):
+			updates = append(updates, &dynamodb.UpdateTableInput{
+				StreamSpecification: &types.StreamSpecification{StreamEnabled: aws.Bool(true), StreamViewType: spec.StreamViewType},
+			})
+		case stream.StreamViewType != spec.StreamViewType:
+			return nil, fmt.Errorf("couldn't update table %v. Here's why: its stream has view type %v, not %v", c.tableName, stream.StreamViewType, spec.StreamViewType)
+		}
+	}
+
+	if spec.Encryption && (desc.SSEDescription == nil ||
+		(desc.SSEDescription.Status != types.SSEStatusEnabled && desc.SSEDescription.Status != types.SSEStatusUpdating)) {
+		updates = append(updates, &dynamodb.UpdateTableInput{SSESpecification: spec.sse()})
+	}
+
+	desc, err := c.waitForTable(spec.pollInterval())
+
+	for _, update := range updates {
+		if err != nil {
+			break
+		}
+
+		update.TableName = aws.String(c.tableName)
+
+		if _, err = c.ddb().UpdateTable(c.ctx, update); err != nil {
+			return nil, fmt.Errorf("couldn't update table %v. Here's why: %w", c.tableName, err)
+		}
+
+		desc, err = c.waitForTable(spec.pollInterval())
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't wait for table %v to become active. Here's why: %w", c.tableName, err)
+	}
+
+	return desc, nil
+}
+
+// ensureTTL enables expiry on the client's TTL attribute, unless it is already enabled.
+func (c Client) ensureTTL() error {
+	if c.ttlAttribute == "" {
+		return nil
+	}
+
+	resp, err := c.ddb().DescribeTimeToLive(c.ctx, &dynamodb.DescribeTimeToLiveInput{TableName: aws.String(c.tableName)})
+	if err != nil {
+		return fmt.Errorf("couldn't describe the time to live of table %v. Here's why: %w", c.tableName, err)
+	}
+
+	if ttl := resp.TimeToLiveDescription; ttl != nil {
+		switch ttl.TimeToLiveStatus {
+		case types.TimeToLiveStatusEnabled, types.TimeToLiveStatusEnabling:
+			if aws.ToString(ttl.AttributeName) == c.ttlAttribute {
+				return nil
+			}
+
+			return fmt.Errorf("couldn't enable time to live on table %v. Here's why: it is enabled on attribute %v", c.tableName, aws.ToString(ttl.AttributeName))
+		}
+	}
+
+	_, err = c.ddb().UpdateTimeToLive(c.ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(c.tableName),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String(c.ttlAttribute),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't enable time to live on table %v. Here's why: %w", c.tableName, err)
+	}
+
+	return nil
+}
+
+func (c Client) ensurePointInTimeRecovery() error {
+	resp, err := c.ddb().DescribeContinuousBackups(c.ctx, &dynamodb.DescribeContinuousBackupsInput{TableName: aws.String(c.tableName)})
+	if err != nil {
+		return fmt.Errorf("couldn't describe the backups of table %v. Here's why: %w", c.tableName, err)
+	}
+
+	if backups := resp.ContinuousBackupsDescription; backups != nil && backups.PointInTimeRecoveryDescription != nil &&
+		backups.PointInTimeRecoveryDescription.PointInTimeRecoveryStatus == types.PointInTimeRecoveryStatusEnabled {
+		return nil
+	}
+
+	_, err = c.ddb().UpdateContinuousBackups(c.ctx, &dynamodb.UpdateContinuousBackupsInput{
+		TableName:                        aws.String(c.tableName),
+		PointInTimeRecoverySpecification: &types.PointInTimeRecoverySpecification{PointInTimeRecoveryEnabled: aws.Bool(true)},
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't enable point in time recovery on table %v. Here's why: %w", c.tableName, err)
+	}
+
+	return nil
+}
+
+// ensureTags adds the tags the table does not have, or has with other values.
+func (c Client) ensureTags(desc *types.TableDescription, tags map[string]string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	current := make(map[string]string)
+
+	var nextToken *string
+
+	for {
+		resp, err := c.ddb().ListTagsOfResource(c.ctx, &dynamodb.ListTagsOfResourceInput{ResourceArn: desc.TableArn, NextToken: nextToken})
+		if err != nil {
+			return fmt.Errorf("couldn't list the tags of table %v. Here's why: %w", c.tableName, err)
+		}
+
+		for _, tag := range resp.Tags {
+			current[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+
+		if nextToken = resp.NextToken; nextToken == nil {
+			break
+		}
+	}
+
+	var missing []types.Tag
+
+	for key, value := range tags {
+		if v, ok := current[key]; !ok || v != value {
+			missing = append(missing, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	_, err := c.ddb().TagResource(c.ctx, &dynamodb.TagResourceInput{ResourceArn: desc.TableArn, Tags: missing})
+	if err != nil {
+		return fmt.Errorf("couldn't tag table %v. Here's why: %w", c.tableName, err)
+	}
+
+	return nil
+}
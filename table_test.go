@@ -0,0 +1,143 @@
+package redimo
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTableClient(t *testing.T) Client {
+	t.Parallel()
+
+	return NewClient(newService(t)).Table(fmt.Sprintf("%v-%v", time.Now().UnixMilli(), uuid.New().String()))
+}
+
+func TestEnsureTable(t *testing.T) {
+	c := newTableClient(t)
+
+	exists, err := c.ExistsTable()
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	spec := TableSpec{StreamViewType: types.StreamViewTypeNewAndOldImages, Tags: map[string]string{"app": "redimo"}}
+	assert.NoError(t, c.EnsureTable(spec))
+	assert.NoError(t, c.EnsureTable(spec))
+
+	desc, err := c.describeTable()
+	assert.NoError(t, err)
+	assert.Equal(t, types.TableStatusActive, desc.TableStatus)
+	assert.Equal(t, types.BillingModePayPerRequest, desc.BillingModeSummary.BillingMode)
+	assert.Equal(t, types.StreamViewTypeNewAndOldImages, desc.StreamSpecification.StreamViewType)
+
+	ttl, err := c.ddb().DescribeTimeToLive(c.ctx, &dynamodb.DescribeTimeToLiveInput{TableName: aws.String(c.tableName)})
+	assert.NoError(t, err)
+	assert.Equal(t, types.TimeToLiveStatusEnabled, ttl.TimeToLiveDescription.TimeToLiveStatus)
+	assert.Equal(t, "ttl", aws.ToString(ttl.TimeToLiveDescription.AttributeName))
+
+	_, err = c.SET("hello", StringValue{"world"})
+	assert.NoError(t, err)
+
+	val, err := c.GET("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, "world", val.String())
+
+	assert.Error(t, c.EnsureTable(TableSpec{StreamViewType: types.StreamViewTypeKeysOnly}))
+}
+
+func TestEnsureTableUpdates(t *testing.T) {
+	c := newTableClient(t)
+	assert.NoError(t, c.CreateTable(0, 0))
+
+	spec := TableSpec{
+		ReadCapacity:  5,
+		WriteCapacity: 5,
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("owner"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{
+			{
+				IndexName:             aws.String("owners"),
+				KeySchema:             []types.KeySchemaElement{{AttributeName: aws.String("owner"), KeyType: types.KeyTypeHash}},
+				Projection:            &types.Projection{ProjectionType: types.ProjectionTypeKeysOnly},
+				ProvisionedThroughput: &types.ProvisionedThroughput{ReadCapacityUnits: aws.Int64(5), WriteCapacityUnits: aws.Int64(5)},
+			},
+		},
+		PointInTimeRecovery: true,
+		Encryption:          true,
+		Tags:                map[string]string{"app": "redimo", "env": "test"},
+	}
+
+	assert.NoError(t, c.EnsureTable(spec))
+
+	desc, err := c.describeTable()
+	assert.NoError(t, err)
+	assert.Equal(t, types.BillingModeProvisioned, desc.BillingModeSummary.BillingMode)
+	assert.Equal(t, int64(5), aws.ToInt64(desc.ProvisionedThroughput.ReadCapacityUnits))
+	assert.Len(t, desc.GlobalSecondaryIndexes, 1)
+	assert.Equal(t, types.SSEStatusEnabled, desc.SSEDescription.Status)
+
+	backups, err := c.ddb().DescribeContinuousBackups(c.ctx, &dynamodb.DescribeContinuousBackupsInput{TableName: aws.String(c.tableName)})
+	assert.NoError(t, err)
+	assert.Equal(t, types.PointInTimeRecoveryStatusEnabled, backups.ContinuousBackupsDescription.PointInTimeRecoveryDescription.PointInTimeRecoveryStatus)
+
+	tags, err := c.ddb().ListTagsOfResource(c.ctx, &dynamodb.ListTagsOfResourceInput{ResourceArn: desc.TableArn})
+	assert.NoError(t, err)
+	assert.Len(t, tags.Tags, 2)
+
+	assert.NoError(t, c.EnsureTable(spec))
+}
+
+func TestDeleteTable(t *testing.T) {
+	c := newTableClient(t)
+	assert.NoError(t, c.DeleteTable())
+
+	assert.NoError(t, c.EnsureTable(TableSpec{}))
+	assert.NoError(t, c.DeleteTable())
+
+	exists, err := c.ExistsTable()
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+// creatingService reports tables as CREATING for the next describes calls to DescribeTable.
+type creatingService struct {
+	DynamoDBAPI
+	describes int
+	calls     int
+}
+
+func (s *creatingService) DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	out, err := s.DynamoDBAPI.DescribeTable(ctx, params, optFns...)
+	s.calls++
+
+	if err == nil && s.calls <= s.describes {
+		out.Table.TableStatus = types.TableStatusCreating
+	}
+
+	return out, err
+}
+
+func TestEnsureTableWaits(t *testing.T) {
+	c := newTableClient(t)
+	service := &creatingService{DynamoDBAPI: c.ddbClient}
+	c.ddbClient = service
+
+	assert.NoError(t, c.CreateTable(0, 0))
+
+	service.calls = 0
+	service.describes = 3
+	assert.NoError(t, c.EnsureTable(TableSpec{PollInterval: time.Millisecond}))
+	assert.Equal(t, 4, service.calls)
+
+	service.calls = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, c.WithContext(ctx).EnsureTable(TableSpec{PollInterval: time.Millisecond}))
+}
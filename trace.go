@@ -0,0 +1,41 @@
+package redimo
+
+import (
+	"context"
+)
+
+// Tracer starts spans for commands. It is independent of any tracing library, and is easily bridged to
+// one, such as OpenTelemetry, by wrapping its tracer.
+type Tracer interface {
+	// Start starts a span with the given name as a child of any span in ctx, and returns a context
+	// holding the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// SetAttribute sets an attribute of the span. Values are strings, string slices or ints.
+	SetAttribute(key string, value interface{})
+
+	// End ends the span, and records the error if it is not nil.
+	End(err error)
+}
+
+// TraceCommands returns middleware that runs every command in a span named "redimo.<command>", such as
+// "redimo.HSET", so that DynamoDB calls traced by the AWS SDK are its children. Spans have the
+// attributes db.system, db.operation, redimo.keys, redimo.args and redimo.calls, the number of
+// DynamoDB calls made.
+func TraceCommands(tracer Tracer) Middleware {
+	return func(ctx context.Context, cmd *Command) (context.Context, func()) {
+		ctx, span := tracer.Start(ctx, "redimo."+cmd.Name)
+		span.SetAttribute("db.system", "dynamodb")
+		span.SetAttribute("db.operation", cmd.Name)
+		span.SetAttribute("redimo.keys", cmd.Keys)
+		span.SetAttribute("redimo.args", cmd.Args)
+
+		return ctx, func() {
+			span.SetAttribute("redimo.calls", len(cmd.Calls))
+			span.End(cmd.Err)
+		}
+	}
+}
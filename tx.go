@@ -0,0 +1,888 @@
+package redimo
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Tx queues write commands across keys and data types, and applies them atomically with EXEC: either
+// every command takes effect or none does. Create one with MULTI.
+//
+// All the commands are compiled into a single TransactWriteItems call, so a transaction is limited to
+// the client's TransactionActions (100 by default) items written, and may not write the same item
+// twice – such as the same hash field in two HSET commands, or two XADD commands on one stream.
+//
+// Writes in a transaction replace the value of the items they write and clear any expiry on them.
+// Values are compressed, encrypted, chunked and offloaded as they are by the commands outside of a
+// transaction, and their chunks count towards the transaction's items. SET, HSET and HDEL read the
+// values they replace when EXEC runs, 1 RCU each, so that they are released once the transaction
+// is done; if one of them changes before the transaction is applied, it fails with ErrConditionFailed.
+// With CheckTypes, types are checked before the transaction is sent, and recorded by the transaction itself, on the
+// condition that no other type has been recorded since, so an aborted transaction leaves every key as
+// it was. Each key whose type is checked adds an action to the transaction. Unlike SET, a SET queued
+// on a key of another type fails with ErrWrongType, since replacing the key means deleting it first.
+//
+// Like Redis, a transaction can WATCH items before queuing commands, typically through its GET, HGET
+// and ZSCORE reads. EXEC then commits only if none of the watched items has been written since.
+type Tx struct {
+	c        Client
+	commands []txCommand
+	watched  []watchedItem
+	err      error
+
+	// stored holds the values stored by EXEC for its commands, which are abandoned if they aren't
+	// written, and replaced the values they replace, which are released once they are.
+	stored   []types.AttributeValue
+	replaced []txValue
+}
+
+// txValue is a value stored at a key, as it is stored.
+type txValue struct {
+	key string
+	av  types.AttributeValue
+}
+
+// watchedItem is an item read by a transaction, and the version it had. The version is nil if the
+// item did not exist. The item is reported as watched if it changes.
+type watchedItem struct {
+	item     keyDef
+	version  types.AttributeValue
+	reported WatchedItem
+}
+
+// WatchedItem identifies an item watched by a transaction: the string at a key, for which Field is
+// empty, or a field of a hash or a member of a sorted set.
+type WatchedItem struct {
+	Key   string
+	Field string
+}
+
+type txCommand struct {
+	key     string
+	keyType KeyType
+	// write is set for commands that claim the key's type, rather than just checking it.
+	write bool
+	// prepare returns the actions of the command, and its result.
+	prepare func(c Client) ([]types.TransactWriteItem, TxResult, error)
+}
+
+// TxResult is the result of a command applied by EXEC.
+type TxResult struct {
+	// Command is the name of the command, such as "HSET".
+	Command string
+
+	// Key is the key the command was run against.
+	Key string
+
+	// ID is the ID of the stream item added by XADD.
+	ID XID
+}
+
+// MULTI starts a transaction. Commands queued on the returned Tx are applied by EXEC.
+//
+// Works similar to https://redis.io/commands/multi
+func (c Client) MULTI() *Tx {
+	return &Tx{c: c}
+}
+
+// DISCARD drops every command queued so far, and stops watching every item.
+//
+// Works similar to https://redis.io/commands/discard
+func (tx *Tx) DISCARD() {
+	tx.commands = nil
+	tx.watched = nil
+	tx.err = nil
+	tx.stored = nil
+	tx.replaced = nil
+}
+
+// WATCH watches the string value at key when no fields are given, or the given fields of the hash or
+// members of the sorted set at key, so that EXEC fails with ErrWatchConflict if any of them is written
+// before it. An item is watched from the first time it is watched or read by the transaction.
+//
+// Without fields, WATCH also watches the key's recorded type, so that EXEC fails if the key is created
+// with any type, deleted, or replaced with another type. A key that already holds another type than a
+// string is made of many items, which must be given as fields: WATCH returns ErrWatchFields for it.
+// Keys written by clients that skip type checks have no recorded type, so only their string value is
+// watched.
+//
+// Watching needs the client's VersionAttribute. Items are read with strongly consistent reads.
+//
+// Works similar to https://redis.io/commands/watch
+func (tx *Tx) WATCH(key string, fields ...string) (err error) {
+	c, finish := tx.c.command("WATCH", []string{key}, fields)
+	defer finish(&err)
+
+	if len(fields) == 0 {
+		if c.versionAttribute == "" {
+			return ErrNoVersions
+		}
+
+		_, actual, err := c.currentType(key, TypeString)
+		if err != nil {
+			return err
+		}
+
+		if actual != TypeNone && actual != TypeString {
+			return ErrWatchFields
+		}
+
+		if _, err = tx.watchItem(c, typeKey(key), WatchedItem{Key: key}); err != nil {
+			return err
+		}
+
+		fields = []string{""}
+	}
+
+	for _, field := range fields {
+		if _, err = tx.watch(c, key, field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UNWATCH stops watching every item.
+//
+// Works similar to https://redis.io/commands/unwatch
+func (tx *Tx) UNWATCH() {
+	tx.watched = nil
+}
+
+// GET is like Client.GET, and watches the value it reads.
+func (tx *Tx) GET(key string) (val ReturnValue, err error) {
+	c, finish := tx.c.command("GET", []string{key})
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeString); err != nil {
+		return
+	}
+
+	item, err := tx.watch(c, key, "")
+	if err == nil && len(item) > 0 && !c.expired(item, time.Now()) {
+		val, err = c.loadValue(itemSlot(key, ""), ReturnValue{item[vk]})
+	}
+
+	return
+}
+
+// HGET is like Client.HGET, and watches the field it reads.
+func (tx *Tx) HGET(key string, field string) (val ReturnValue, err error) {
+	c, finish := tx.c.command("HGET", []string{key}, field)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeHash); err != nil {
+		return
+	}
+
+	item, err := tx.watch(c, key, field)
+	if err == nil && len(item) > 0 && !c.expired(item, time.Now()) {
+		val, err = c.loadValue(itemSlot(key, field), ReturnValue{item[vk]})
+	}
+
+	return
+}
+
+// ZSCORE is like Client.ZSCORE, and watches the member it reads.
+func (tx *Tx) ZSCORE(key string, member string) (score float64, found bool, err error) {
+	c, finish := tx.c.command("ZSCORE", []string{key}, member)
+	defer finish(&err)
+
+	if err = c.checkType(key, TypeZSet); err != nil {
+		return
+	}
+
+	item, err := tx.watch(c, key, member)
+	if err == nil && len(item) > 0 && !c.expired(item, time.Now()) {
+		found = true
+		score = zScoreFromAV(item[c.sortKeyNum])
+	}
+
+	return
+}
+
+// watch reads the item with the client, and records its version unless the item is already watched.
+func (tx *Tx) watch(c Client, key string, sk string) (item map[string]types.AttributeValue, err error) {
+	return tx.watchItem(c, keyDef{pk: key, sk: sk}, WatchedItem{Key: key, Field: sk})
+}
+
+// watchItem is watch for any item, reported as the given watched item if it changes.
+func (tx *Tx) watchItem(c Client, item keyDef, reported WatchedItem) (map[string]types.AttributeValue, error) {
+	if c.versionAttribute == "" {
+		return nil, ErrNoVersions
+	}
+
+	resp, err := c.ddb().GetItem(c.ctx, &dynamodb.GetItemInput{
+		ConsistentRead: aws.Bool(true),
+		Key:            item.toAV(c),
+		TableName:      aws.String(c.tableName),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	watched := watchedItem{item: item, reported: reported}
+	if len(resp.Item) > 0 {
+		watched.version = resp.Item[c.versionAttribute]
+	}
+
+	for _, w := range tx.watched {
+		if w.item == watched.item {
+			return resp.Item, nil
+		}
+	}
+
+	tx.watched = append(tx.watched, watched)
+
+	return resp.Item, nil
+}
+
+// SET queues setting the string value at key.
+func (tx *Tx) SET(key string, vValue interface{}) *Tx {
+	value, err := ToValueE(vValue)
+	if err != nil {
+		tx.err = err
+		return tx
+	}
+
+	return tx.queue("SET", key, TypeString, true, func(c Client) ([]types.TransactWriteItem, error) {
+		return tx.valueActions(c, key, map[string]Value{"": value})
+	})
+}
+
+// HSET queues setting the given fields of the hash at key.
+func (tx *Tx) HSET(key string, vFieldMap interface{}) *Tx {
+	fieldMap, err := ToValueMapE(vFieldMap)
+	if err != nil {
+		tx.err = err
+		return tx
+	}
+
+	return tx.queue("HSET", key, TypeHash, true, func(c Client) ([]types.TransactWriteItem, error) {
+		return tx.valueActions(c, key, fieldMap)
+	})
+}
+
+// HDEL queues deleting the given fields of the hash at key.
+func (tx *Tx) HDEL(key string, fields ...string) *Tx {
+	return tx.queue("HDEL", key, TypeHash, false, func(c Client) ([]types.TransactWriteItem, error) {
+		return tx.deleteValueActions(c, key, fields)
+	})
+}
+
+// SADD queues adding the given members to the set at key.
+func (tx *Tx) SADD(key string, members ...string) *Tx {
+	return tx.queue("SADD", key, TypeSet, true, func(Client) (actions []types.TransactWriteItem, err error) {
+		for _, member := range members {
+			actions = append(actions, tx.updateAction(keyDef{pk: key, sk: member}, tx.c.sortKeyNum, IntValue{rand.Int63()}.ToAV()))
+		}
+
+		return
+	})
+}
+
+// SREM queues removing the given members from the set at key.
+func (tx *Tx) SREM(key string, members ...string) *Tx {
+	return tx.queue("SREM", key, TypeSet, false, func(Client) ([]types.TransactWriteItem, error) {
+		return tx.deleteActions(key, members), nil
+	})
+}
+
+// ZADD queues adding the given members to the sorted set at key, or updating their scores.
+func (tx *Tx) ZADD(key string, membersWithScores map[string]float64) *Tx {
+	return tx.queue("ZADD", key, TypeZSet, true, func(Client) (actions []types.TransactWriteItem, err error) {
+		for member, score := range membersWithScores {
+			actions = append(actions, tx.updateAction(keyDef{pk: key, sk: member}, tx.c.sortKeyNum, zScore{score}.ToAV()))
+		}
+
+		return
+	})
+}
+
+// ZREM queues removing the given members from the sorted set at key.
+func (tx *Tx) ZREM(key string, members ...string) *Tx {
+	return tx.queue("ZREM", key, TypeZSet, false, func(Client) ([]types.TransactWriteItem, error) {
+		return tx.deleteActions(key, members), nil
+	})
+}
+
+// XADD queues adding an item to the stream at key. As with XADD, an XAutoID is generated from the
+// current time and the stream's sequence, which the transaction increments, provided no other XADD
+// has incremented it since EXEC read it. The ID the item was added with is reported in the command's
+// TxResult.
+func (tx *Tx) XADD(key string, id XID, fields map[string]Value) *Tx {
+	tx.commands = append(tx.commands, txCommand{key: key, keyType: TypeStream, write: true,
+		prepare: func(c Client) (actions []types.TransactWriteItem, result TxResult, err error) {
+			result = TxResult{Command: "XADD", Key: key, ID: id}
+
+			if id == XAutoID {
+				var sequenceAction types.TransactWriteItem
+
+				if result.ID, sequenceAction, err = c.xNextID(key); err != nil {
+					return nil, result, err
+				}
+
+				actions = append(actions, sequenceAction)
+			}
+
+			wrappedFields := make(map[string]ReturnValue)
+
+			var chunks []types.TransactWriteItem
+
+			for k, v := range fields {
+				stored, fieldChunks, err := c.storeAV(streamFieldSlot(key, k), v.ToAV(), nil)
+				if err != nil {
+					return nil, result, err
+				}
+
+				tx.stored = append(tx.stored, stored)
+				wrappedFields[k] = ReturnValue{stored}
+				chunks = append(chunks, fieldChunks...)
+			}
+
+			actions = append(actions,
+				StreamItem{ID: result.ID, Fields: wrappedFields}.putAction(key, c),
+				result.ID.sequenceUpdateAction(key, c),
+			)
+
+			return append(actions, chunks...), result, nil
+		},
+	})
+
+	return tx
+}
+
+// xNextID reads the stream's sequence, and returns an ID from the current time and the next sequence
+// number, along with the action that moves the sequence to it if it is still the one read.
+func (c Client) xNextID(key string) (id XID, action types.TransactWriteItem, err error) {
+	counter := keyDef{pk: xCountKey(key), sk: ""}
+
+	resp, err := c.ddb().GetItem(c.ctx, &dynamodb.GetItemInput{
+		ConsistentRead: aws.Bool(true),
+		Key:            counter.toAV(c),
+		TableName:      aws.String(c.tableName),
+	})
+	if err != nil {
+		return id, action, err
+	}
+
+	builder := newExpresionBuilder()
+	sequence := ReturnValue{resp.Item[vk]}.Int()
+
+	if len(resp.Item) == 0 {
+		builder.addConditionNotExists(vk)
+	} else {
+		builder.addConditionEquality(vk, IntValue{sequence})
+	}
+
+	builder.updateSetAV(vk, IntValue{sequence + 1}.ToAV())
+
+	return NewXID(time.Now(), uint64(sequence+1)), types.TransactWriteItem{
+		Update: &types.Update{
+			ConditionExpression:       builder.conditionExpression(),
+			ExpressionAttributeNames:  builder.expressionAttributeNames(),
+			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			Key:                       counter.toAV(c),
+			TableName:                 aws.String(c.tableName),
+			UpdateExpression:          builder.updateExpression(),
+		},
+	}, nil
+}
+
+// EXEC applies every queued command atomically, and returns their results in the order they were
+// queued. If DynamoDB cancels the transaction, nothing is written and the error is a *TxAbortError
+// naming the commands that caused the cancellation and the watched items that changed; errors.Is
+// reports its reasons, such as ErrWatchConflict or ErrTransactionConflict.
+//
+// Works similar to https://redis.io/commands/exec
+func (tx *Tx) EXEC() (results []TxResult, err error) {
+	defer tx.DISCARD()
+
+	keys := make([]string, len(tx.commands))
+	for i, command := range tx.commands {
+		keys[i] = command.key
+	}
+
+	c, finish := tx.c.command("EXEC", uniqueKeys(keys), len(tx.commands))
+	defer finish(&err)
+
+	if tx.err != nil || len(tx.commands) == 0 {
+		return nil, tx.err
+	}
+
+	typeActions, typeOwners, err := tx.typeActions(c)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		for _, stored := range tx.stored {
+			if abandonErr := c.abandonAV(stored); abandonErr != nil {
+				err = abandonErr
+			}
+		}
+	}()
+
+	var (
+		actions []types.TransactWriteItem
+		owners  []int
+	)
+
+	for i, command := range tx.commands {
+		commandActions, result, err := command.prepare(c)
+		if err != nil {
+			return nil, err
+		}
+
+		for range commandActions {
+			owners = append(owners, i)
+		}
+
+		actions = append(actions, commandActions...)
+		results = append(results, result)
+	}
+
+	if len(actions) == 0 {
+		return results, nil
+	}
+
+	actions, owners = append(actions, typeActions...), append(owners, typeOwners...)
+	if len(actions) > c.transactionActions {
+		return nil, ErrTooManyActions
+	}
+
+	if err = c.uniqueItems(actions); err != nil {
+		return nil, err
+	}
+
+	actions, watches := tx.watchActions(actions)
+	if len(actions) > c.transactionActions {
+		return nil, ErrTooManyActions
+	}
+
+	_, err = c.ddb().TransactWriteItems(c.ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: actions,
+	})
+	if err != nil {
+		return nil, tx.abortError(err, owners, watches)
+	}
+
+	tx.stored = nil
+
+	for _, replaced := range tx.replaced {
+		if err = c.releaseAV(replaced.key, replaced.av); err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+func (tx *Tx) queue(name string, key string, keyType KeyType, write bool, actions func(c Client) ([]types.TransactWriteItem, error)) *Tx {
+	tx.commands = append(tx.commands, txCommand{key: key, keyType: keyType, write: write,
+		prepare: func(c Client) ([]types.TransactWriteItem, TxResult, error) {
+			commandActions, err := actions(c)
+			return commandActions, TxResult{Command: name, Key: key}, err
+		},
+	})
+
+	return tx
+}
+
+// typeActions checks the type of every key of the transaction against the commands queued on it, and
+// returns the actions that make the transaction depend on it, along with the index of the first
+// command on the key of each: a condition that the recorded type is unchanged, or, for a key written
+// by the transaction that has no type recorded yet, an update recording it.
+func (tx *Tx) typeActions(c Client) (actions []types.TransactWriteItem, owners []int, err error) {
+	first := make(map[string]int)
+	claimed := make(map[string]KeyType)
+
+	var keys []string
+
+	for i, command := range tx.commands {
+		if !c.typeChecked(command.key) {
+			continue
+		}
+
+		if _, ok := first[command.key]; !ok {
+			first[command.key] = i
+			keys = append(keys, command.key)
+		}
+
+		if _, ok := claimed[command.key]; !ok && command.write {
+			claimed[command.key] = command.keyType
+		}
+	}
+
+	for _, key := range keys {
+		expected, claim := claimed[key], claimed[key]
+		if expected == "" {
+			expected = tx.commands[first[key]].keyType
+		}
+
+		recorded, actual, err := c.currentType(key, expected)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Every command must agree with the key's type, and with the type the transaction gives it.
+		for _, command := range tx.commands {
+			if command.key != key {
+				continue
+			}
+
+			if !compatibleType(actual, command.keyType, recorded == TypeNone) ||
+				(claim != "" && !compatibleType(claim, command.keyType, false)) {
+				return nil, nil, ErrWrongType
+			}
+		}
+
+		builder := newExpresionBuilder()
+		action := types.TransactWriteItem{}
+
+		if recorded == TypeNone {
+			builder.addConditionNotExists(c.partitionKey)
+		} else {
+			builder.condition(fmt.Sprintf("#%v = :previous", vk), vk)
+			builder.values["previous"] = StringValue{string(recorded)}.ToAV()
+		}
+
+		switch {
+		case claim != "" && claim != recorded && (recorded == TypeNone || actual == TypeNone):
+			builder.updateSET(vk, StringValue{string(claim)})
+			action.Update = &types.Update{
+				ConditionExpression:       builder.conditionExpression(),
+				ExpressionAttributeNames:  builder.expressionAttributeNames(),
+				ExpressionAttributeValues: builder.expressionAttributeValues(),
+				Key:                       typeKey(key).toAV(c),
+				TableName:                 aws.String(c.tableName),
+				UpdateExpression:          builder.updateExpression(),
+			}
+		case recorded != TypeNone:
+			action.ConditionCheck = &types.ConditionCheck{
+				ConditionExpression:       builder.conditionExpression(),
+				ExpressionAttributeNames:  builder.expressionAttributeNames(),
+				ExpressionAttributeValues: builder.expressionAttributeValues(),
+				Key:                       typeKey(key).toAV(c),
+				TableName:                 aws.String(c.tableName),
+			}
+		default:
+			// Only deletes are queued on a key with no recorded type, which they needn't record.
+			continue
+		}
+
+		actions = append(actions, action)
+		owners = append(owners, first[key])
+	}
+
+	return actions, owners, nil
+}
+
+// updateAction sets the attribute of the item, and clears its expiry.
+func (tx *Tx) updateAction(item keyDef, attribute string, av types.AttributeValue) types.TransactWriteItem {
+	builder := newExpresionBuilder()
+	builder.updateSetAV(attribute, av)
+	builder.updateRemoveExpiry(tx.c.ttlAttribute)
+
+	return types.TransactWriteItem{
+		Update: &types.Update{
+			ExpressionAttributeNames:  builder.expressionAttributeNames(),
+			ExpressionAttributeValues: builder.expressionAttributeValues(),
+			Key:                       item.toAV(tx.c),
+			TableName:                 aws.String(tx.c.tableName),
+			UpdateExpression:          builder.updateExpression(),
+		},
+	}
+}
+
+// valueActions stores the values of the fields of the key the way HSET does, and returns the actions
+// that write them, along with their chunks. The values they replace are read first, and the actions
+// are conditioned on them being unchanged, so that EXEC can release them once it is done.
+func (tx *Tx) valueActions(c Client, key string, values map[string]Value) (actions []types.TransactWriteItem, err error) {
+	fields := make([]string, 0, len(values))
+	for field := range values {
+		fields = append(fields, field)
+	}
+
+	old, err := c.batchGet(key, fields, vk)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range fields {
+		stored, chunks, err := c.storeAV(itemSlot(key, field), values[field].ToAV(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		tx.stored = append(tx.stored, stored)
+		tx.replaced = append(tx.replaced, txValue{key: key, av: old[field][vk]})
+
+		builder := newExpresionBuilder()
+		builder.updateSetAV(vk, stored)
+		builder.updateRemoveExpiry(c.ttlAttribute)
+		builder.addConditionValueUnchanged(old[field][vk])
+
+		actions = append(actions, types.TransactWriteItem{
+			Update: &types.Update{
+				ConditionExpression:       builder.conditionExpression(),
+				ExpressionAttributeNames:  builder.expressionAttributeNames(),
+				ExpressionAttributeValues: builder.expressionAttributeValues(),
+				Key:                       keyDef{pk: key, sk: field}.toAV(c),
+				TableName:                 aws.String(c.tableName),
+				UpdateExpression:          builder.updateExpression(),
+			},
+		})
+		actions = append(actions, chunks...)
+	}
+
+	return actions, nil
+}
+
+// deleteValueActions returns the actions that delete the fields of the key, on the condition that their
+// values are still those read first, so that EXEC can release them once it is done.
+func (tx *Tx) deleteValueActions(c Client, key string, fields []string) (actions []types.TransactWriteItem, err error) {
+	old, err := c.batchGet(key, fields, vk)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range fields {
+		tx.replaced = append(tx.replaced, txValue{key: key, av: old[field][vk]})
+
+		builder := newExpresionBuilder()
+		builder.addConditionValueUnchanged(old[field][vk])
+
+		actions = append(actions, types.TransactWriteItem{
+			Delete: &types.Delete{
+				ConditionExpression:       builder.conditionExpression(),
+				ExpressionAttributeNames:  builder.expressionAttributeNames(),
+				ExpressionAttributeValues: builder.expressionAttributeValues(),
+				Key:                       keyDef{pk: key, sk: field}.toAV(c),
+				TableName:                 aws.String(c.tableName),
+			},
+		})
+	}
+
+	return actions, nil
+}
+
+func (tx *Tx) deleteActions(key string, sortKeys []string) (actions []types.TransactWriteItem) {
+	for _, sk := range sortKeys {
+		actions = append(actions, types.TransactWriteItem{
+			Delete: &types.Delete{
+				Key:       keyDef{pk: key, sk: sk}.toAV(tx.c),
+				TableName: aws.String(tx.c.tableName),
+			},
+		})
+	}
+
+	return
+}
+
+// uniqueItems returns ErrTxSameItem if more than one of the actions targets the same item, which
+// DynamoDB does not allow in a transaction.
+func (c Client) uniqueItems(actions []types.TransactWriteItem) error {
+	seen := make(map[keyDef]struct{})
+
+	for _, action := range actions {
+		item := c.actionItem(action)
+		if _, ok := seen[item]; ok {
+			return fmt.Errorf("%w: %v %v", ErrTxSameItem, item.pk, item.sk)
+		}
+
+		seen[item] = struct{}{}
+	}
+
+	return nil
+}
+
+// watchActions adds a condition on the version of every watched item to the actions: to the action
+// writing the item if there is one, or to a new ConditionCheck action after the others. It returns the
+// watched item checked by each action, if any.
+func (tx *Tx) watchActions(actions []types.TransactWriteItem) ([]types.TransactWriteItem, map[int]WatchedItem) {
+	c := tx.c
+	watches := make(map[int]WatchedItem)
+
+	for _, w := range tx.watched {
+		builder := newExpresionBuilder()
+		if w.version == nil {
+			builder.addConditionNotExists(c.partitionKey)
+		} else {
+			builder.condition(fmt.Sprintf("#%v = :%v", c.versionAttribute, c.versionAttribute), c.versionAttribute)
+			builder.values[c.versionAttribute] = w.version
+		}
+
+		i := c.actionIndex(actions, w.item)
+		if i < 0 {
+			i = len(actions)
+			actions = append(actions, types.TransactWriteItem{
+				ConditionCheck: &types.ConditionCheck{
+					Key:       w.item.toAV(c),
+					TableName: aws.String(c.tableName),
+				},
+			})
+		}
+
+		actions[i] = withCondition(actions[i], &builder)
+		watches[i] = w.reported
+	}
+
+	return actions, watches
+}
+
+// actionIndex returns the index of the action on the item, or -1 if there is none.
+func (c Client) actionIndex(actions []types.TransactWriteItem, item keyDef) int {
+	for i, action := range actions {
+		if c.actionItem(action) == (keyDef{pk: item.pk, sk: compatibleWithEmtpySK(item.sk)}) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// actionItem returns the key of the item the action applies to, with the sort key as it is stored.
+func (c Client) actionItem(action types.TransactWriteItem) keyDef {
+	var key map[string]types.AttributeValue
+
+	switch {
+	case action.Put != nil:
+		key = action.Put.Item
+	case action.Update != nil:
+		key = action.Update.Key
+	case action.Delete != nil:
+		key = action.Delete.Key
+	case action.ConditionCheck != nil:
+		key = action.ConditionCheck.Key
+	}
+
+	return keyDef{pk: c.unnamespaced(ReturnValue{key[c.partitionKey]}.String()), sk: ReturnValue{key[c.sortKey]}.String()}
+}
+
+// withCondition returns a copy of the action with the builder's condition added to the action's own.
+// The builder's placeholders are named after the version and partition key attributes, which the
+// actions of a transaction do not use.
+func withCondition(action types.TransactWriteItem, builder *expressionBuilder) types.TransactWriteItem {
+	merge := func(condition **string, names *map[string]string, values *map[string]types.AttributeValue) {
+		expression := builder.conditionExpression()
+		if *condition != nil {
+			expression = aws.String(fmt.Sprintf("(%v) AND (%v)", **condition, *expression))
+		}
+
+		*condition = expression
+
+		mergedNames := builder.expressionAttributeNames()
+		for k, v := range *names {
+			mergedNames[k] = v
+		}
+
+		*names = mergedNames
+
+		if builderValues := builder.expressionAttributeValues(); builderValues != nil {
+			for k, v := range *values {
+				builderValues[k] = v
+			}
+
+			*values = builderValues
+		}
+	}
+
+	switch {
+	case action.Put != nil:
+		put := *action.Put
+		merge(&put.ConditionExpression, &put.ExpressionAttributeNames, &put.ExpressionAttributeValues)
+		action.Put = &put
+	case action.Update != nil:
+		update := *action.Update
+		merge(&update.ConditionExpression, &update.ExpressionAttributeNames, &update.ExpressionAttributeValues)
+		action.Update = &update
+	case action.Delete != nil:
+		del := *action.Delete
+		merge(&del.ConditionExpression, &del.ExpressionAttributeNames, &del.ExpressionAttributeValues)
+		action.Delete = &del
+	case action.ConditionCheck != nil:
+		check := *action.ConditionCheck
+		merge(&check.ConditionExpression, &check.ExpressionAttributeNames, &check.ExpressionAttributeValues)
+		action.ConditionCheck = &check
+	}
+
+	return action
+}
+
+// abortError wraps the error of a failed transaction in a TxAbortError, naming the commands whose
+// actions were the reason for its cancellation, and the watched items that changed.
+func (tx *Tx) abortError(err error, owners []int, watches map[int]WatchedItem) error {
+	abort := &TxAbortError{Err: err}
+
+	var e *Error
+	if errors.As(err, &e) {
+		for i, reason := range e.Reasons {
+			if reason.Code == "None" {
+				continue
+			}
+
+			if w, ok := watches[i]; ok && reason.Code == "ConditionalCheckFailed" {
+				// A key watched without fields is reported once, whether its value or its type changed.
+				if n := len(abort.Changed); n == 0 || abort.Changed[n-1] != w {
+					abort.Changed = append(abort.Changed, w)
+				}
+
+				continue
+			}
+
+			if i >= len(owners) {
+				continue
+			}
+
+			command := owners[i]
+			if n := len(abort.Commands); n == 0 || abort.Commands[n-1] != command {
+				abort.Commands = append(abort.Commands, command)
+			}
+		}
+	}
+
+	return abort
+}
+
+// TxAbortError is returned by EXEC when the transaction fails, in which case none of its commands
+// have taken effect. It wraps the error returned by DynamoDB.
+type TxAbortError struct {
+	// Commands holds the indexes, in the order they were queued, of the commands that caused
+	// DynamoDB to cancel the transaction.
+	Commands []int
+
+	// Changed lists the watched items that were written since the transaction watched them.
+	Changed []WatchedItem
+
+	// Err is the error returned by DynamoDB.
+	Err error
+}
+
+func (e *TxAbortError) Error() string {
+	if len(e.Changed) > 0 {
+		return fmt.Sprintf("%v: %v: %v", ErrTxAborted, ErrWatchConflict, e.Changed)
+	}
+
+	if len(e.Commands) == 0 {
+		return fmt.Sprintf("%v: %v", ErrTxAborted, e.Err)
+	}
+
+	return fmt.Sprintf("%v by commands %v: %v", ErrTxAborted, e.Commands, e.Err)
+}
+
+func (e *TxAbortError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is ErrTxAborted, or ErrWatchConflict if a watched item changed.
+func (e *TxAbortError) Is(target error) bool {
+	return target == ErrTxAborted || (target == ErrWatchConflict && len(e.Changed) > 0)
+}
@@ -0,0 +1,320 @@
+package redimo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTx(t *testing.T) {
+	c := newClient(t).CheckTypes()
+
+	results, err := c.MULTI().
+		HSET("order:1", map[string]Value{"status": StringValue{"pending"}, "total": IntValue{42}}).
+		ZADD("orders:pending", map[string]float64{"order:1": 42}).
+		SADD("customers", "alice").
+		SET("last-order", StringValue{"order:1"}).
+		XADD("events", XAutoID, map[string]Value{"order": StringValue{"order:1"}}).
+		EXEC()
+	assert.NoError(t, err)
+	assert.Len(t, results, 5)
+	assert.Equal(t, "HSET", results[0].Command)
+	assert.Equal(t, "order:1", results[0].Key)
+	assert.Equal(t, "XADD", results[4].Command)
+	assert.EqualValues(t, 1, results[4].ID.Seq())
+
+	status, err := c.HGET("order:1", "status")
+	assert.NoError(t, err)
+	assert.Equal(t, "pending", status.String())
+
+	score, ok, err := c.ZSCORE("orders:pending", "order:1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 42.0, score)
+
+	last, err := c.GET("last-order")
+	assert.NoError(t, err)
+	assert.Equal(t, "order:1", last.String())
+
+	items, err := c.XRANGE("events", XStart, XEnd, 10)
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, results[4].ID, items[0].ID)
+
+	keyType, err := c.TYPE("events")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeStream, keyType)
+
+	// An explicit ID below the stream's last ID cancels the whole transaction.
+	_, err = c.MULTI().
+		HSET("order:1", map[string]Value{"status": StringValue{"shipped"}}).
+		ZREM("orders:pending", "order:1").
+		XADD("events", NewXID(results[4].ID.Time(), 0), map[string]Value{"order": StringValue{"order:1"}}).
+		EXEC()
+	assert.True(t, errors.Is(err, ErrTxAborted))
+	assert.True(t, errors.Is(err, ErrConditionFailed))
+
+	var abort *TxAbortError
+	assert.True(t, errors.As(err, &abort))
+	assert.Equal(t, []int{2}, abort.Commands)
+
+	status, err = c.HGET("order:1", "status")
+	assert.NoError(t, err)
+	assert.Equal(t, "pending", status.String())
+
+	_, ok, err = c.ZSCORE("orders:pending", "order:1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = c.MULTI().HSET("customers", map[string]Value{"f": StringValue{"v"}}).EXEC()
+	assert.Equal(t, ErrWrongType, err)
+
+	_, err = c.MULTI().
+		HSET("order:2", map[string]Value{"status": StringValue{"pending"}}).
+		HDEL("order:2", "status").
+		EXEC()
+	assert.True(t, errors.Is(err, ErrTxSameItem))
+
+	members := make([]string, 60)
+	for i := range members {
+		members[i] = string(rune('a' + i))
+	}
+
+	_, err = c.MULTI().SADD("s1", members...).SREM("s2", members...).EXEC()
+	assert.Equal(t, ErrTooManyActions, err)
+
+	tx := c.MULTI().SADD("s3", "m1")
+	tx.DISCARD()
+
+	results, err = tx.EXEC()
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+
+	exists, err := c.EXISTS("s3", "order:2")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, exists)
+}
+
+func TestTxWatch(t *testing.T) {
+	c := newClient(t)
+
+	_, err := c.SET("balance", IntValue{100})
+	assert.NoError(t, err)
+
+	tx := c.MULTI()
+	balance, err := tx.GET("balance")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 100, balance.Int())
+
+	_, err = tx.SET("balance", IntValue{balance.Int() - 30}).EXEC()
+	assert.NoError(t, err)
+
+	tx = c.MULTI()
+	balance, err = tx.GET("balance")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 70, balance.Int())
+
+	_, err = c.INCRBY("balance", 5)
+	assert.NoError(t, err)
+
+	_, err = tx.SET("balance", IntValue{balance.Int() - 30}).EXEC()
+	assert.True(t, errors.Is(err, ErrTxAborted))
+	assert.True(t, errors.Is(err, ErrWatchConflict))
+
+	var abort *TxAbortError
+	assert.True(t, errors.As(err, &abort))
+	assert.Equal(t, []WatchedItem{{Key: "balance"}}, abort.Changed)
+	assert.Empty(t, abort.Commands)
+
+	balance, err = c.GET("balance")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 75, balance.Int())
+
+	// Items that are only read are checked without being written, including items that did not exist.
+	_, err = c.HSET("account", map[string]Value{"owner": StringValue{"alice"}})
+	assert.NoError(t, err)
+
+	tx = c.MULTI()
+	owner, err := tx.HGET("account", "owner")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", owner.String())
+
+	_, found, err := tx.ZSCORE("leaderboard", "alice")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	_, err = c.HSET("account", map[string]Value{"email": StringValue{"alice@example.com"}})
+	assert.NoError(t, err)
+
+	results, err := tx.ZADD("leaderboard", map[string]float64{"bob": 1}).EXEC()
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+
+	tx = c.MULTI()
+	_, _, err = tx.ZSCORE("leaderboard", "alice")
+	assert.NoError(t, err)
+	assert.NoError(t, tx.WATCH("account", "owner", "email"))
+
+	_, err = c.ZADD("leaderboard", map[string]float64{"alice": 2}, Flags{})
+	assert.NoError(t, err)
+
+	_, err = tx.HSET("account", map[string]Value{"email": StringValue{"bob@example.com"}}).EXEC()
+	assert.True(t, errors.As(err, &abort))
+	assert.Equal(t, []WatchedItem{{Key: "leaderboard", Field: "alice"}}, abort.Changed)
+
+	email, err := c.HGET("account", "email")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice@example.com", email.String())
+
+	tx = c.MULTI()
+	assert.NoError(t, tx.WATCH("balance"))
+	tx.UNWATCH()
+
+	_, err = c.INCR("balance")
+	assert.NoError(t, err)
+
+	_, err = tx.SET("balance", IntValue{0}).EXEC()
+	assert.NoError(t, err)
+
+	assert.Equal(t, ErrNoVersions, c.VersionAttribute("").MULTI().WATCH("balance"))
+}
+
+func TestTxAbortLeavesKeys(t *testing.T) {
+	c := newClient(t).CheckTypes()
+
+	_, err := c.HSET("h", map[string]Value{"f": StringValue{"v"}})
+	assert.NoError(t, err)
+
+	_, err = c.SET("balance", IntValue{100})
+	assert.NoError(t, err)
+
+	_, err = c.MULTI().SET("h", StringValue{"replaced"}).EXEC()
+	assert.Equal(t, ErrWrongType, err)
+
+	_, err = c.MULTI().SET("new", StringValue{"v"}).HSET("new", map[string]Value{"f": StringValue{"v"}}).EXEC()
+	assert.Equal(t, ErrWrongType, err)
+
+	tx := c.MULTI()
+	assert.NoError(t, tx.WATCH("balance"))
+
+	_, err = c.INCR("balance")
+	assert.NoError(t, err)
+
+	_, err = tx.
+		HSET("h", map[string]Value{"f": StringValue{"changed"}}).
+		SET("string", StringValue{"v"}).
+		SADD("set", "m1").
+		ZADD("zset", map[string]float64{"m1": 1}).
+		XADD("stream", XAutoID, map[string]Value{"f": StringValue{"v"}}).
+		EXEC()
+	assert.True(t, errors.Is(err, ErrWatchConflict))
+
+	fields, err := c.HGETALL("h")
+	assert.NoError(t, err)
+	assert.Len(t, fields, 1)
+	assert.Equal(t, "v", fields["f"].String())
+
+	for key, keyType := range map[string]KeyType{"h": TypeHash, "string": TypeNone, "set": TypeNone, "zset": TypeNone, "stream": TypeNone} {
+		recorded, err := c.TYPE(key)
+		assert.NoError(t, err)
+		assert.Equal(t, keyType, recorded, key)
+	}
+
+	for _, key := range []string{"string", "set", "zset", "stream"} {
+		for _, p := range c.keyPartitions(key, nil) {
+			items, err := c.partitionItems(p.pk)
+			assert.NoError(t, err)
+			assert.Empty(t, items, p.pk)
+		}
+	}
+
+	// A type recorded concurrently aborts a transaction that would record another.
+	service := &transactHookService{DynamoDBAPI: c.ddbClient}
+	hooked := c
+	hooked.ddbClient = service
+	service.beforeTransact = func() {
+		service.beforeTransact = nil
+
+		_, err := c.HSET("contested", map[string]Value{"f": StringValue{"v"}})
+		assert.NoError(t, err)
+	}
+
+	_, err = hooked.MULTI().SADD("contested", "m1").EXEC()
+	assert.True(t, errors.Is(err, ErrTxAborted))
+	assert.True(t, errors.Is(err, ErrConditionFailed))
+
+	keyType, err := c.TYPE("contested")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeHash, keyType)
+
+	count, err := c.HLEN("contested")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, count)
+}
+
+// transactHookService calls beforeTransact, if set, before every TransactWriteItems call.
+type transactHookService struct {
+	DynamoDBAPI
+	beforeTransact func()
+}
+
+func (s *transactHookService) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	if s.beforeTransact != nil {
+		s.beforeTransact()
+	}
+
+	return s.DynamoDBAPI.TransactWriteItems(ctx, params, optFns...)
+}
+
+func TestTxWatchKey(t *testing.T) {
+	c := newClient(t).CheckTypes()
+
+	_, err := c.HSET("hash", map[string]Value{"f": StringValue{"v"}})
+	assert.NoError(t, err)
+
+	_, err = c.SET("balance", IntValue{100})
+	assert.NoError(t, err)
+
+	assert.Equal(t, ErrWatchFields, c.MULTI().WATCH("hash"))
+
+	// A key that doesn't exist yet is watched through its recorded type, whatever it is created as.
+	tx := c.MULTI()
+	assert.NoError(t, tx.WATCH("new"))
+
+	_, err = c.HSET("new", map[string]Value{"f": StringValue{"v"}})
+	assert.NoError(t, err)
+
+	_, err = tx.SET("balance", IntValue{0}).EXEC()
+	assert.True(t, errors.Is(err, ErrWatchConflict))
+
+	var abort *TxAbortError
+	assert.True(t, errors.As(err, &abort))
+	assert.Equal(t, []WatchedItem{{Key: "new"}}, abort.Changed)
+
+	// Deleting a watched key is seen too.
+	tx = c.MULTI()
+	assert.NoError(t, tx.WATCH("balance"))
+
+	_, err = c.DEL("balance")
+	assert.NoError(t, err)
+
+	_, err = tx.SET("other", StringValue{"v"}).EXEC()
+	assert.True(t, errors.Is(err, ErrWatchConflict))
+
+	// A watched string may be written by the transaction itself.
+	_, err = c.SET("balance", IntValue{100})
+	assert.NoError(t, err)
+
+	tx = c.MULTI()
+	assert.NoError(t, tx.WATCH("balance"))
+
+	_, err = tx.SET("balance", IntValue{50}).EXEC()
+	assert.NoError(t, err)
+
+	balance, err := c.GET("balance")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 50, balance.Int())
+}
@@ -0,0 +1,170 @@
+package redimo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TableReport lists the ways the client's table differs from what the client is configured with.
+type TableReport struct {
+	// Table is the name of the table.
+	Table string
+
+	// Mismatches are the differences found, in the order they were checked.
+	Mismatches []TableMismatch
+}
+
+// TableMismatch is a setting of the table that differs from what the client expects.
+type TableMismatch struct {
+	// Setting names what differs, such as "partition key" or "index idx projection".
+	Setting string
+
+	// Expected is what the client expects, and Actual what the table has. Attributes are given with
+	// their type, as in "pk (S)", and missing settings as "none".
+	Expected string
+	Actual   string
+
+	// Warning is set for mismatches that commands work despite, only less efficiently or without
+	// expired items being deleted.
+	Warning bool
+}
+
+func (m TableMismatch) String() string {
+	s := fmt.Sprintf("%v: expected %v, got %v", m.Setting, m.Expected, m.Actual)
+	if m.Warning {
+		s += " (warning)"
+	}
+
+	return s
+}
+
+// OK reports whether commands can work with the table, that is whether every mismatch is a warning.
+func (r TableReport) OK() bool {
+	return r.Err() == nil
+}
+
+// Err returns an error describing the mismatches that are not warnings, or nil if there are none.
+func (r TableReport) Err() error {
+	var problems []string
+
+	for _, m := range r.Mismatches {
+		if !m.Warning {
+			problems = append(problems, m.String())
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("table %v doesn't match the client: %v", r.Table, strings.Join(problems, "; "))
+}
+
+// ValidateTable describes the client's table and checks it against the client's configuration: the names
+// and types of the partition and sort keys, the local secondary index on the numeric sort key and its
+// projection, and expiry on the TTL attribute. Call it before sending any traffic, so that a
+// misconfigured client fails with a clear report rather than with validation errors deep inside
+// commands. The error is only set if the table could not be described, including when it does not
+// exist; mismatches are reported in the TableReport.
+func (c Client) ValidateTable() (report TableReport, err error) {
+	report.Table = c.tableName
+
+	desc, err := c.describeTable()
+	if err != nil {
+		return report, fmt.Errorf("couldn't describe table %v. Here's why: %w", c.tableName, err)
+	}
+
+	attrTypes := make(map[string]types.ScalarAttributeType)
+	for _, def := range desc.AttributeDefinitions {
+		attrTypes[aws.ToString(def.AttributeName)] = def.AttributeType
+	}
+
+	attribute := func(name string) string {
+		if name == "" {
+			return "none"
+		}
+
+		return fmt.Sprintf("%v (%v)", name, attrTypes[name])
+	}
+
+	check := func(setting string, expected, actual string, warning bool) {
+		if expected != actual {
+			report.Mismatches = append(report.Mismatches, TableMismatch{Setting: setting, Expected: expected, Actual: actual, Warning: warning})
+		}
+	}
+
+	hash, rng := keySchemaNames(desc.KeySchema)
+	check("partition key", c.partitionKey+" (S)", attribute(hash), false)
+	check("sort key", c.sortKey+" (S)", attribute(rng), false)
+
+	c.validateIndex(desc, check, attribute)
+
+	if c.ttlAttribute != "" {
+		ttl, err := c.ddb().DescribeTimeToLive(c.ctx, &dynamodb.DescribeTimeToLiveInput{TableName: aws.String(c.tableName)})
+		if err != nil {
+			return report, fmt.Errorf("couldn't describe the time to live of table %v. Here's why: %w", c.tableName, err)
+		}
+
+		actual := "none"
+		if d := ttl.TimeToLiveDescription; d != nil && (d.TimeToLiveStatus == types.TimeToLiveStatusEnabled || d.TimeToLiveStatus == types.TimeToLiveStatusEnabling) {
+			actual = aws.ToString(d.AttributeName)
+		}
+
+		check("time to live", c.ttlAttribute, actual, true)
+	}
+
+	return report, nil
+}
+
+func (c Client) validateIndex(desc *types.TableDescription, check func(setting, expected, actual string, warning bool), attribute func(string) string) {
+	setting := "index " + c.indexName
+
+	for _, gsi := range desc.GlobalSecondaryIndexes {
+		if aws.ToString(gsi.IndexName) == c.indexName {
+			check(setting, "local secondary index", "global secondary index", false)
+			return
+		}
+	}
+
+	var lsi *types.LocalSecondaryIndexDescription
+
+	for i := range desc.LocalSecondaryIndexes {
+		if aws.ToString(desc.LocalSecondaryIndexes[i].IndexName) == c.indexName {
+			lsi = &desc.LocalSecondaryIndexes[i]
+		}
+	}
+
+	if lsi == nil {
+		check(setting, "local secondary index", "none", false)
+		return
+	}
+
+	_, rng := keySchemaNames(lsi.KeySchema)
+	check(setting+" sort key", c.sortKeyNum+" (N)", attribute(rng), false)
+
+	// Every projection includes the keys, which is all commands read from the index, but wider ones
+	// take more storage and write capacity.
+	projection := "none"
+	if lsi.Projection != nil {
+		projection = string(lsi.Projection.ProjectionType)
+	}
+
+	check(setting+" projection", string(types.ProjectionTypeKeysOnly), projection, true)
+}
+
+func keySchemaNames(schema []types.KeySchemaElement) (hash, rng string) {
+	for _, key := range schema {
+		switch key.KeyType {
+		case types.KeyTypeHash:
+			hash = aws.ToString(key.AttributeName)
+		case types.KeyTypeRange:
+			rng = aws.ToString(key.AttributeName)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,51 @@
+package redimo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTable(t *testing.T) {
+	c := newTableClient(t)
+
+	_, err := c.ValidateTable()
+	assert.Error(t, err)
+
+	assert.NoError(t, c.EnsureTable(TableSpec{}))
+
+	report, err := c.ValidateTable()
+	assert.NoError(t, err)
+	assert.True(t, report.OK())
+	assert.NoError(t, report.Err())
+	assert.Empty(t, report.Mismatches)
+
+	report, err = c.Attributes("id", "sk", "score").Index("scores").TTLAttribute("expires").ValidateTable()
+	assert.NoError(t, err)
+	assert.False(t, report.OK())
+	assert.Equal(t, []TableMismatch{
+		{Setting: "partition key", Expected: "id (S)", Actual: "pk (S)"},
+		{Setting: "index scores", Expected: "local secondary index", Actual: "none"},
+		{Setting: "time to live", Expected: "expires", Actual: "ttl", Warning: true},
+	}, report.Mismatches)
+	assert.EqualError(t, report.Err(), "table "+c.tableName+" doesn't match the client: "+
+		"partition key: expected id (S), got pk (S); index scores: expected local secondary index, got none")
+
+	report, err = c.Attributes("pk", "sk", "sk").ValidateTable()
+	assert.NoError(t, err)
+	assert.Equal(t, []TableMismatch{
+		{Setting: "index idx sort key", Expected: "sk (N)", Actual: "skN (N)"},
+	}, report.Mismatches)
+}
+
+func TestValidateTableWarnings(t *testing.T) {
+	c := newClient(t)
+
+	report, err := c.ValidateTable()
+	assert.NoError(t, err)
+	assert.True(t, report.OK())
+	assert.Equal(t, []TableMismatch{
+		{Setting: "time to live", Expected: "ttl", Actual: "none", Warning: true},
+	}, report.Mismatches)
+	assert.Equal(t, "time to live: expected ttl, got none (warning)", report.Mismatches[0].String())
+}
@@ -5,6 +5,7 @@ import (
 	"math/big"
 	"reflect"
 	"strconv"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
@@ -26,18 +27,17 @@ type Value interface {
 	ToAV() types.AttributeValue
 }
 
+// ToValueE wraps data in a Value. Besides values, it accepts strings, byte slices, numbers, bools and
+// nil, and maps with string keys and slices of any of these, which become MapValue and ListValue. Maps
+// with keys that begin with "_redimo/" are rejected with ErrReservedKey.
 func ToValueE(data interface{}) (value Value, err error) {
 	switch data := data.(type) {
-	case ReturnValue:
-		value = data
-	case StringValue:
-		value = data
-	case BytesValue:
-		value = data
-	case IntValue:
-		value = data
-	case FloatValue:
+	case Value:
 		value = data
+	case nil:
+		value = NullValue{}
+	case bool:
+		value = BoolValue{data}
 	case string:
 		value = StringValue{data}
 	case []byte:
@@ -66,9 +66,36 @@ func ToValueE(data interface{}) (value Value, err error) {
 		value = FloatValue{float64(data)}
 	case float64:
 		value = FloatValue{float64(data)}
+	case map[string]interface{}:
+		var m map[string]Value
+		if m, err = ToValueMapE(data); err == nil {
+			value = MapValue{m}
+		}
+	case map[string]Value:
+		value = MapValue{data}
+	case []interface{}:
+		var l []Value
+		if l, err = ToValuesE(data); err == nil {
+			value = ListValue{l}
+		}
+	case []Value:
+		value = ListValue{data}
+	case []string:
+		l := make([]Value, len(data))
+		for i, s := range data {
+			l[i] = StringValue{s}
+		}
+
+		value = ListValue{l}
 	default:
 		err = fmt.Errorf("ToValue: unsupported type: %T", data)
 	}
+
+	switch value.(type) {
+	case MapValue, ListValue:
+		err = checkReservedKeys(value.ToAV())
+	}
+
 	return value, err
 }
 
@@ -198,6 +225,151 @@ func (bv BytesValue) ToAV() types.AttributeValue {
 	return &types.AttributeValueMemberB{Value: bv.B}
 }
 
+// BoolValue is a convenience wrapper for a bool, usable as
+//
+//	BoolValue{true}
+type BoolValue struct {
+	B bool
+}
+
+func (bv BoolValue) ToAV() types.AttributeValue {
+	return &types.AttributeValueMemberBOOL{Value: bv.B}
+}
+
+// NullValue is the DynamoDB null value, usable as
+//
+//	NullValue{}
+//
+// A ReturnValue holding it is Empty.
+type NullValue struct{}
+
+func (NullValue) ToAV() types.AttributeValue {
+	return &types.AttributeValueMemberNULL{Value: true}
+}
+
+// reservedKeyPrefix begins the keys of the maps stored in place of values, such as blob pointers and
+// chunk manifests, so that they can't be told apart from maps stored by users.
+const reservedKeyPrefix = "_redimo/"
+
+// checkReservedKeys returns ErrReservedKey if the attribute value is, or holds, a map with a key that
+// begins with reservedKeyPrefix.
+func checkReservedKeys(av types.AttributeValue) error {
+	switch av := av.(type) {
+	case *types.AttributeValueMemberM:
+		for k, v := range av.Value {
+			if strings.HasPrefix(k, reservedKeyPrefix) {
+				return ErrReservedKey
+			}
+
+			if err := checkReservedKeys(v); err != nil {
+				return err
+			}
+		}
+	case *types.AttributeValueMemberL:
+		for _, v := range av.Value {
+			if err := checkReservedKeys(v); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// MapValue is a convenience wrapper for a DynamoDB map, whose values can be any Value, usable as
+//
+//	MapValue{map[string]Value{"name": StringValue{"redimo"}, "stars": IntValue{5}}}
+//
+// Keys that begin with "_redimo/" are reserved, at any depth: commands fail with ErrReservedKey rather
+// than store a map that has one.
+type MapValue struct {
+	M map[string]Value
+}
+
+func (mv MapValue) ToAV() types.AttributeValue {
+	m := make(map[string]types.AttributeValue, len(mv.M))
+	for k, v := range mv.M {
+		m[k] = toAVOrNull(v)
+	}
+
+	return &types.AttributeValueMemberM{Value: m}
+}
+
+// ListValue is a convenience wrapper for a DynamoDB list, whose elements can be any Value, usable as
+//
+//	ListValue{[]Value{StringValue{"a"}, IntValue{1}}}
+type ListValue struct {
+	L []Value
+}
+
+func (lv ListValue) ToAV() types.AttributeValue {
+	l := make([]types.AttributeValue, len(lv.L))
+	for i, v := range lv.L {
+		l[i] = toAVOrNull(v)
+	}
+
+	return &types.AttributeValueMemberL{Value: l}
+}
+
+// StringSetValue is a convenience wrapper for a DynamoDB string set, usable as
+//
+//	StringSetValue{[]string{"a", "b"}}
+//
+// DynamoDB doesn't store empty sets, or sets with duplicate elements.
+type StringSetValue struct {
+	SS []string
+}
+
+func (sv StringSetValue) ToAV() types.AttributeValue {
+	return &types.AttributeValueMemberSS{Value: sv.SS}
+}
+
+// NumberSetValue is a convenience wrapper for a DynamoDB number set, usable as
+//
+//	NumberSetValue{[]float64{1, 2.5}}
+//
+// DynamoDB doesn't store empty sets, or sets with duplicate elements.
+type NumberSetValue struct {
+	NS []float64
+}
+
+func (nv NumberSetValue) ToAV() types.AttributeValue {
+	ns := make([]string, len(nv.NS))
+	for i, f := range nv.NS {
+		ns[i] = strconv.FormatFloat(f, 'G', 17, 64)
+	}
+
+	return &types.AttributeValueMemberNS{Value: ns}
+}
+
+// toAVOrNull returns the attribute value of v, or null for nil values, such as an empty ReturnValue.
+func toAVOrNull(v Value) types.AttributeValue {
+	if v != nil {
+		if av := v.ToAV(); av != nil {
+			return av
+		}
+	}
+
+	return &types.AttributeValueMemberNULL{Value: true}
+}
+
+// ValueType is the DynamoDB type of a value, as returned by ReturnValue.Type.
+type ValueType string
+
+const (
+	ValueNone      ValueType = ""
+	ValueString    ValueType = "S"
+	ValueNumber    ValueType = "N"
+	ValueBytes     ValueType = "B"
+	ValueBool      ValueType = "BOOL"
+	ValueNull      ValueType = "NULL"
+	ValueMap       ValueType = "M"
+	ValueList      ValueType = "L"
+	ValueStringSet ValueType = "SS"
+	ValueNumberSet ValueType = "NS"
+	ValueBytesSet  ValueType = "BS"
+)
+
 // ReturnValue holds a value returned by DynamoDB. There are convenience methods used to coerce the held value into common types,
 // but you can also retrieve the raw types.AttributeValue by calling ToAV if you would like to do custom decoding.
 type ReturnValue struct {
@@ -270,22 +442,139 @@ func (rv ReturnValue) Empty() bool {
 	return ok
 }
 
-// Interface returns the value as an interface{}. This is useful if you are not sure what type
-func (rv ReturnValue) Interface() interface{} {
-	switch {
-	case rv.Empty():
+// Bool returns the value as a bool. Will be false if the value is not actually a bool.
+func (rv ReturnValue) Bool() bool {
+	if av, ok := rv.av.(*types.AttributeValueMemberBOOL); ok {
+		return av.Value
+	}
+
+	return false
+}
+
+// Map returns the values of a map. Will be nil if the value is not actually a map.
+func (rv ReturnValue) Map() map[string]ReturnValue {
+	av, ok := rv.av.(*types.AttributeValueMemberM)
+	if !ok {
 		return nil
-	case rv.String() != "":
-		return rv.String()
-	case rv.Bytes() != nil:
-		return rv.Bytes()
-	case rv.Int() != 0:
-		return rv.Int()
-	case rv.Float() != 0:
-		return rv.Float()
-	default:
+	}
+
+	m := make(map[string]ReturnValue, len(av.Value))
+	for k, v := range av.Value {
+		m[k] = ReturnValue{v}
+	}
+
+	return m
+}
+
+// List returns the elements of a list. Will be nil if the value is not actually a list.
+func (rv ReturnValue) List() []ReturnValue {
+	av, ok := rv.av.(*types.AttributeValueMemberL)
+	if !ok {
 		return nil
 	}
+
+	l := make([]ReturnValue, len(av.Value))
+	for i, v := range av.Value {
+		l[i] = ReturnValue{v}
+	}
+
+	return l
+}
+
+// StringSet returns the elements of a string set. Will be nil if the value is not actually a string set.
+func (rv ReturnValue) StringSet() []string {
+	if av, ok := rv.av.(*types.AttributeValueMemberSS); ok {
+		return av.Value
+	}
+
+	return nil
+}
+
+// NumberSet returns the elements of a number set. Will be nil if the value is not actually a number set.
+func (rv ReturnValue) NumberSet() []float64 {
+	av, ok := rv.av.(*types.AttributeValueMemberNS)
+	if !ok {
+		return nil
+	}
+
+	ns := make([]float64, len(av.Value))
+	for i, n := range av.Value {
+		ns[i], _ = strconv.ParseFloat(n, 64)
+	}
+
+	return ns
+}
+
+// Type returns the DynamoDB type of the value, or ValueNone if there is no value.
+func (rv ReturnValue) Type() ValueType {
+	switch rv.av.(type) {
+	case *types.AttributeValueMemberS:
+		return ValueString
+	case *types.AttributeValueMemberN:
+		return ValueNumber
+	case *types.AttributeValueMemberB:
+		return ValueBytes
+	case *types.AttributeValueMemberBOOL:
+		return ValueBool
+	case *types.AttributeValueMemberNULL:
+		return ValueNull
+	case *types.AttributeValueMemberM:
+		return ValueMap
+	case *types.AttributeValueMemberL:
+		return ValueList
+	case *types.AttributeValueMemberSS:
+		return ValueStringSet
+	case *types.AttributeValueMemberNS:
+		return ValueNumberSet
+	case *types.AttributeValueMemberBS:
+		return ValueBytesSet
+	}
+
+	return ValueNone
+}
+
+// Interface returns the value as an interface{}, which is useful if you are not sure what type the
+// value is. Strings, bytes and bools are returned as they are, and numbers as int64 if they are
+// integers that fit, or float64 otherwise. Maps are returned as map[string]interface{} and lists as
+// []interface{}, with their elements converted the same way, and sets as []string, []float64 or
+// [][]byte. Null and missing values are returned as nil.
+func (rv ReturnValue) Interface() interface{} {
+	switch av := rv.av.(type) {
+	case *types.AttributeValueMemberS:
+		return av.Value
+	case *types.AttributeValueMemberN:
+		if i, err := strconv.ParseInt(av.Value, 10, 64); err == nil {
+			return i
+		}
+
+		return rv.Float()
+	case *types.AttributeValueMemberB:
+		return av.Value
+	case *types.AttributeValueMemberBOOL:
+		return av.Value
+	case *types.AttributeValueMemberM:
+		m := make(map[string]interface{}, len(av.Value))
+		for k, v := range av.Value {
+			m[k] = ReturnValue{v}.Interface()
+		}
+
+		return m
+	case *types.AttributeValueMemberL:
+		l := make([]interface{}, len(av.Value))
+		for i, v := range av.Value {
+			l[i] = ReturnValue{v}.Interface()
+		}
+
+		return l
+	case *types.AttributeValueMemberSS:
+		return av.Value
+	case *types.AttributeValueMemberNS:
+		return rv.NumberSet()
+	case *types.AttributeValueMemberBS:
+		return av.Value
+	}
+
+	return nil
 }
 
 // Present returns true if a value is present. It indicates that the underlying
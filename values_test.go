@@ -29,3 +29,85 @@ func TestValues(t *testing.T) {
 	assert.True(t, ReturnValue{IntValue{0}.ToAV()}.Present())
 	assert.True(t, ReturnValue{StringValue{""}.ToAV()}.Present())
 }
+
+func TestDocumentValues(t *testing.T) {
+	value, err := ToValueE(map[string]interface{}{
+		"name":    "redimo",
+		"stars":   5,
+		"ratio":   0.5,
+		"active":  true,
+		"deleted": nil,
+		"tags":    []string{"redis", "dynamodb"},
+		"nested":  map[string]interface{}{"empty": "", "zero": 0, "list": []interface{}{false, []byte{1}}},
+		"sets":    ListValue{[]Value{StringSetValue{[]string{"a"}}, NumberSetValue{[]float64{1, 2.5}}}},
+	})
+	assert.NoError(t, err)
+
+	rv := ReturnValue{value.ToAV()}
+	assert.Equal(t, ValueMap, rv.Type())
+	assert.Equal(t, "redimo", rv.Map()["name"].String())
+	assert.Equal(t, ValueBool, rv.Map()["active"].Type())
+	assert.True(t, rv.Map()["active"].Bool())
+	assert.True(t, rv.Map()["deleted"].Empty())
+	assert.Equal(t, ValueNull, rv.Map()["deleted"].Type())
+	assert.Equal(t, "dynamodb", rv.Map()["tags"].List()[1].String())
+	assert.Nil(t, rv.Map()["name"].Map())
+	assert.Nil(t, rv.List())
+	assert.False(t, rv.Bool())
+	assert.Equal(t, ValueNone, ReturnValue{}.Type())
+
+	assert.Equal(t, map[string]interface{}{
+		"name":    "redimo",
+		"stars":   int64(5),
+		"ratio":   0.5,
+		"active":  true,
+		"deleted": nil,
+		"tags":    []interface{}{"redis", "dynamodb"},
+		"nested":  map[string]interface{}{"empty": "", "zero": int64(0), "list": []interface{}{false, []byte{1}}},
+		"sets":    []interface{}{[]string{"a"}, []float64{1, 2.5}},
+	}, rv.Interface())
+
+	assert.Nil(t, ReturnValue{}.Interface())
+	assert.Equal(t, "", ReturnValue{StringValue{""}.ToAV()}.Interface())
+	assert.Equal(t, int64(0), ReturnValue{IntValue{0}.ToAV()}.Interface())
+	assert.Equal(t, 1.5, ReturnValue{FloatValue{1.5}.ToAV()}.Interface())
+
+	_, err = ToValueE(map[string]interface{}{"bad": struct{}{}})
+	assert.Error(t, err)
+
+	// Maps shaped like the ones stored in place of values are rejected.
+	_, err = ToValueE(map[string]interface{}{"_redimo/blob": map[string]interface{}{"hash": "h"}})
+	assert.Equal(t, ErrReservedKey, err)
+
+	_, err = ToValueE([]interface{}{map[string]interface{}{"_redimo/chunks": "1"}})
+	assert.Equal(t, ErrReservedKey, err)
+
+	c := newClient(t)
+
+	_, err = c.HSET("doc", map[string]interface{}{"profile": value, "flag": false, "set": StringSetValue{[]string{"x", "y"}}})
+	assert.NoError(t, err)
+
+	fields, err := c.HGETALL("doc")
+	assert.NoError(t, err)
+	assert.Equal(t, rv.Interface(), fields["profile"].Interface())
+	assert.Equal(t, ValueBool, fields["flag"].Type())
+	assert.ElementsMatch(t, []string{"x", "y"}, fields["set"].StringSet())
+
+	_, err = c.XADD("events", XAutoID, map[string]Value{"payload": value})
+	assert.NoError(t, err)
+
+	items, err := c.XRANGE("events", XStart, XEnd, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, rv.Interface(), items[0].Fields["payload"].Interface())
+
+	forged := MapValue{map[string]Value{"_redimo/compressed": MapValue{map[string]Value{"data": BytesValue{[]byte{1}}}}}}
+
+	_, err = c.SET("forged", forged)
+	assert.Equal(t, ErrReservedKey, err)
+
+	_, err = c.HSET("doc", map[string]Value{"forged": forged})
+	assert.Equal(t, ErrReservedKey, err)
+
+	_, err = c.XADD("events", XAutoID, map[string]Value{"payload": forged})
+	assert.Equal(t, ErrReservedKey, err)
+}
@@ -0,0 +1,173 @@
+package redimo
+
+import (
+	"math/rand"
+	"regexp"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// The placeholders of the version attribute and of the new version in update expressions. They are
+// distinct from the "#name" and ":name" placeholders of the expression builder.
+const (
+	versionName  = "#redimoVersion"
+	versionValue = ":redimoVersion"
+)
+
+// setClause matches the SET keyword of an update expression.
+var setClause = regexp.MustCompile(`(?i)(^|\s)SET\s+`)
+
+// removeClause matches the REMOVE keyword of an update expression.
+var removeClause = regexp.MustCompile(`(?i)(^|\s)REMOVE\s+`)
+
+// VersionAttribute sets the name of the attribute that holds the version of items. Every time redimo
+// writes an item it stamps a new, random version on it, which transactions compare to detect that an
+// item they WATCH has changed. The default is "ver"; an empty name turns versions off, and with them
+// WATCH.
+func (c Client) VersionAttribute(name string) Client {
+	c.versionAttribute = name
+	return c
+}
+
+func newVersion() types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(rand.Int63(), 10)}
+}
+
+// versionItem returns a copy of the item with a new version.
+func (s dynamoService) versionItem(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	versioned := make(map[string]types.AttributeValue, len(item)+1)
+	for k, v := range item {
+		versioned[k] = v
+	}
+
+	versioned[s.versionAttribute] = newVersion()
+
+	return versioned
+}
+
+// versionUpdate adds setting a new version to the update expression, and returns it with copies of
+// the attribute names and values that include the version's placeholders.
+func (s dynamoService) versionUpdate(update *string, names map[string]string,
+	values map[string]types.AttributeValue) (*string, map[string]string, map[string]types.AttributeValue) {
+	versionedNames := map[string]string{versionName: s.versionAttribute}
+	for k, v := range names {
+		versionedNames[k] = v
+	}
+
+	versionedValues := map[string]types.AttributeValue{versionValue: newVersion()}
+	for k, v := range values {
+		versionedValues[k] = v
+	}
+
+	return addSetClause(update, versionName+" = "+versionValue), versionedNames, versionedValues
+}
+
+// addSetClause adds the clause to the SET section of the update expression, adding the section if there
+// is none.
+func addSetClause(update *string, clause string) *string {
+	expression := aws.ToString(update)
+
+	if loc := setClause.FindStringIndex(expression); loc != nil {
+		expression = expression[:loc[1]] + clause + ", " + expression[loc[1]:]
+	} else if expression != "" {
+		expression += " SET " + clause
+	} else {
+		expression = "SET " + clause
+	}
+
+	return aws.String(expression)
+}
+
+// addRemoveClause adds the clause to the REMOVE section of the update expression, adding the section if
+// there is none.
+func addRemoveClause(update *string, clause string) *string {
+	expression := aws.ToString(update)
+
+	if loc := removeClause.FindStringIndex(expression); loc != nil {
+		expression = expression[:loc[1]] + clause + ", " + expression[loc[1]:]
+	} else if expression != "" {
+		expression += " REMOVE " + clause
+	} else {
+		expression = "REMOVE " + clause
+	}
+
+	return aws.String(expression)
+}
+
+func (s dynamoService) versionPutItem(params *dynamodb.PutItemInput) *dynamodb.PutItemInput {
+	if s.versionAttribute == "" {
+		return params
+	}
+
+	versioned := *params
+	versioned.Item = s.versionItem(params.Item)
+
+	return &versioned
+}
+
+func (s dynamoService) versionUpdateItem(params *dynamodb.UpdateItemInput) *dynamodb.UpdateItemInput {
+	if s.versionAttribute == "" {
+		return params
+	}
+
+	versioned := *params
+	versioned.UpdateExpression, versioned.ExpressionAttributeNames, versioned.ExpressionAttributeValues =
+		s.versionUpdate(params.UpdateExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+
+	return &versioned
+}
+
+func (s dynamoService) versionTransactWriteItems(params *dynamodb.TransactWriteItemsInput) *dynamodb.TransactWriteItemsInput {
+	if s.versionAttribute == "" {
+		return params
+	}
+
+	versioned := *params
+	versioned.TransactItems = make([]types.TransactWriteItem, len(params.TransactItems))
+
+	for i, action := range params.TransactItems {
+		switch {
+		case action.Put != nil:
+			put := *action.Put
+			put.Item = s.versionItem(put.Item)
+			action.Put = &put
+		case action.Update != nil:
+			update := *action.Update
+			update.UpdateExpression, update.ExpressionAttributeNames, update.ExpressionAttributeValues =
+				s.versionUpdate(update.UpdateExpression, update.ExpressionAttributeNames, update.ExpressionAttributeValues)
+			action.Update = &update
+		}
+
+		versioned.TransactItems[i] = action
+	}
+
+	return &versioned
+}
+
+func (s dynamoService) versionBatchWriteItem(params *dynamodb.BatchWriteItemInput) *dynamodb.BatchWriteItemInput {
+	if s.versionAttribute == "" {
+		return params
+	}
+
+	versioned := *params
+	versioned.RequestItems = make(map[string][]types.WriteRequest, len(params.RequestItems))
+
+	for table, requests := range params.RequestItems {
+		versionedRequests := make([]types.WriteRequest, len(requests))
+
+		for i, request := range requests {
+			if request.PutRequest != nil {
+				request.PutRequest = &types.PutRequest{Item: s.versionItem(request.PutRequest.Item)}
+			}
+
+			versionedRequests[i] = request
+		}
+
+		versioned.RequestItems[table] = versionedRequests
+	}
+
+	return &versioned
+}